@@ -0,0 +1,490 @@
+// Package client is a Go client for the GoDocHive JSON API, version 1. The
+// API is described by the OpenAPI spec served at /api/openapi.json.
+//
+//	c := client.New("https://docs.example.com")
+//	c.Token = os.Getenv("GODOCHIVE_TOKEN")
+//	resp, err := c.Search(ctx, "connection pool", nil)
+//
+// Every call takes a context for cancellation and deadlines. Reads are
+// retried a few times when the server is rate limiting or unavailable.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersion is the version of the API this package talks to
+const APIVersion = "1"
+
+// Client calls the API of one GoDocHive server
+type Client struct {
+	// BaseURL is the address of the server, e.g. "https://docs.example.com"
+	BaseURL string
+	// Token is sent as a bearer token when set
+	Token string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Retries is how often a request is retried when the server is rate
+	// limiting or briefly unavailable. Requests that create something are
+	// never retried, so they aren't applied twice.
+	Retries int
+	// RetryWait is the wait before the first retry, doubling after each
+	// one. A Retry-After header from the server takes precedence.
+	RetryWait time.Duration
+}
+
+// New returns a client for the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Retries: 2, RetryWait: 500 * time.Millisecond}
+}
+
+// Error is a failed request, decoded from the API's error envelope
+type Error struct {
+	Status    int    `json:"-"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+
+	retryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("godochive: %s (%d %s, request %s)", e.Message, e.Status, e.Code, e.RequestID)
+	}
+	return fmt.Sprintf("godochive: %s (%d %s)", e.Message, e.Status, e.Code)
+}
+
+// Hit is a single search hit. Fields holds the requested stored fields.
+type Hit struct {
+	ID     string                 `json:"id"`
+	Score  float64                `json:"score"`
+	Fields map[string]interface{} `json:"fields"`
+	// Origin is the instance the hit is from, in federated searches
+	Origin string `json:"origin"`
+}
+
+// SearchResponse is the result of a search
+type SearchResponse struct {
+	Query string `json:"query"`
+	Total uint64 `json:"total"`
+	Hits  []Hit  `json:"hits"`
+	// Facets are the counts asked for with SearchOptions.Facets
+	Facets []Facet `json:"facets,omitempty"`
+	// Peers tells how each peer answered a federated search
+	Peers []PeerStatus `json:"peers,omitempty"`
+}
+
+// PeerStatus is the answer of one peer to a federated search. The hits of
+// a peer with an Error are missing.
+type PeerStatus struct {
+	Name  string `json:"name"`
+	Total uint64 `json:"total"`
+	Error string `json:"error"`
+}
+
+// Facet counts the matching documents per value of a field
+type Facet struct {
+	Name  string `json:"name"`
+	Terms []struct {
+		Term string `json:"term"`
+		Docs int    `json:"docs"`
+	} `json:"terms"`
+	// Missing documents have no value, Other ones only less frequent values
+	Missing int `json:"missing"`
+	Other   int `json:"other"`
+}
+
+// SearchOptions narrow a search. The zero value searches everything.
+type SearchOptions struct {
+	// Fields are the stored fields to return, all by default
+	Fields []string
+	// Types are file types such as "md" or "html"
+	Types []string
+	// Tags must all be on a document
+	Tags []string
+	// Updated is "7d", "30d" or "365d"
+	Updated string
+	// Since and Until limit the modification date, zero for no limit
+	Since, Until time.Time
+	// Facets are counted over the matching documents: "docset", "type",
+	// "language", "trust" or "tag"
+	Facets []string
+	// Mode is "keyword", the default, or "hybrid" to fuse keyword ranks
+	// with semantic ones when the server has embeddings configured
+	Mode string
+	// SemanticWeight is the share of semantic ranks in a hybrid search,
+	// between 0 and 1; zero leaves it to the server
+	SemanticWeight float64
+	// Federated also searches the server's peer instances
+	Federated bool
+}
+
+func (o *SearchOptions) values(query string) url.Values {
+	v := url.Values{"q": {query}}
+	if o == nil {
+		return v
+	}
+	if len(o.Fields) > 0 {
+		v.Set("fields", strings.Join(o.Fields, ","))
+	}
+	if len(o.Types) > 0 {
+		v.Set("type", strings.Join(o.Types, ","))
+	}
+	if len(o.Tags) > 0 {
+		v.Set("tag", strings.Join(o.Tags, ","))
+	}
+	if o.Updated != "" {
+		v.Set("updated", o.Updated)
+	}
+	if !o.Since.IsZero() {
+		v.Set("since", o.Since.Format(time.RFC3339))
+	}
+	if !o.Until.IsZero() {
+		v.Set("until", o.Until.Format(time.RFC3339))
+	}
+	if len(o.Facets) > 0 {
+		v.Set("facets", strings.Join(o.Facets, ","))
+	}
+	if o.Mode != "" {
+		v.Set("mode", o.Mode)
+	}
+	if o.SemanticWeight > 0 {
+		v.Set("semantic_weight", strconv.FormatFloat(o.SemanticWeight, 'f', -1, 64))
+	}
+	if o.Federated {
+		v.Set("federated", "1")
+	}
+	return v
+}
+
+// Search returns the documents matching query
+func (c *Client) Search(ctx context.Context, query string, opts *SearchOptions) (*SearchResponse, error) {
+	var resp SearchResponse
+	err := c.do(ctx, http.MethodGet, "/search?"+opts.values(query).Encode(), nil, &resp)
+	return &resp, err
+}
+
+// Suggestion is a page offered while the user is typing
+type Suggestion struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Suggest returns titles and URLs of pages whose title completes a partial
+// query, e.g. "conn po" offers "Connection pooling", for autocomplete
+func (c *Client) Suggest(ctx context.Context, prefix string) ([]Suggestion, error) {
+	var resp struct {
+		Suggestions []Suggestion `json:"suggestions"`
+	}
+	err := c.do(ctx, http.MethodGet, "/suggest?"+url.Values{"q": {prefix}}.Encode(), nil, &resp)
+	return resp.Suggestions, err
+}
+
+// Count returns how many documents match query
+func (c *Client) Count(ctx context.Context, query string, opts *SearchOptions) (uint64, error) {
+	var resp struct {
+		Count uint64 `json:"count"`
+	}
+	err := c.do(ctx, http.MethodGet, "/count?"+opts.values(query).Encode(), nil, &resp)
+	return resp.Count, err
+}
+
+// MultiSearchQuery is one search of a MultiSearch
+type MultiSearchQuery struct {
+	Q       string `json:"q"`
+	Fields  string `json:"fields,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	Updated string `json:"updated,omitempty"`
+	// Size is the number of hits, 10 when nil; 0 returns the total only
+	Size *int `json:"size,omitempty"`
+}
+
+// MultiSearch runs several searches in one round trip and returns their
+// responses in order
+func (c *Client) MultiSearch(ctx context.Context, queries []MultiSearchQuery) ([]SearchResponse, error) {
+	var resp struct {
+		Responses []SearchResponse `json:"responses"`
+	}
+	err := c.do(ctx, http.MethodPost, "/msearch", map[string]interface{}{"queries": queries}, &resp)
+	return resp.Responses, err
+}
+
+// Stats describes the index as the caller sees it
+type Stats struct {
+	Documents uint64 `json:"documents"`
+	DiskBytes uint64 `json:"disk_bytes"`
+	LastBuild *struct {
+		Finished   time.Time `json:"finished"`
+		DurationMS int64     `json:"duration_ms"`
+	} `json:"last_build"`
+	DocsetsUpToDate bool `json:"docsets_up_to_date"`
+	Docsets         []struct {
+		Name      string `json:"name"`
+		Documents uint64 `json:"documents"`
+	} `json:"docsets"`
+	Extensions []string `json:"extensions"`
+}
+
+// Stats returns statistics about the index
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	err := c.do(ctx, http.MethodGet, "/stats", nil, &stats)
+	return &stats, err
+}
+
+// IngestResult reports a reindex of the server's docs
+type IngestResult struct {
+	Documents  int   `json:"documents"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// Ingest has the server index its docs again, picking up added, changed
+// and removed files without a restart. It needs an admin token and returns
+// once the index is up to date.
+func (c *Client) Ingest(ctx context.Context) (*IngestResult, error) {
+	var res IngestResult
+	err := c.do(ctx, http.MethodPost, "/admin/ingest", nil, &res)
+	return &res, err
+}
+
+// TermCount is a term and the number of documents containing it
+type TermCount struct {
+	Term string `json:"term"`
+	Docs int    `json:"docs"`
+}
+
+// Terms lists the terms found in the most documents for a field: "title",
+// "content", "docset" or "tags"
+func (c *Client) Terms(ctx context.Context, field string, size int) ([]TermCount, error) {
+	v := url.Values{"field": {field}}
+	if size > 0 {
+		v.Set("size", strconv.Itoa(size))
+	}
+	var resp struct {
+		Terms []TermCount `json:"terms"`
+	}
+	err := c.do(ctx, http.MethodGet, "/terms?"+v.Encode(), nil, &resp)
+	return resp.Terms, err
+}
+
+// SavedSearch is a named search kept on the server
+type SavedSearch struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Params  string    `json:"params"`
+	Created time.Time `json:"created"`
+}
+
+// SavedSearches lists the caller's saved searches
+func (c *Client) SavedSearches(ctx context.Context) ([]SavedSearch, error) {
+	var saved []SavedSearch
+	err := c.do(ctx, http.MethodGet, "/saved", nil, &saved)
+	return saved, err
+}
+
+// SaveSearch saves a search given as a query string, e.g. "q=pool&type=md"
+func (c *Client) SaveSearch(ctx context.Context, name, params string) (*SavedSearch, error) {
+	var saved SavedSearch
+	err := c.do(ctx, http.MethodPost, "/saved", map[string]string{"name": name, "params": params}, &saved)
+	return &saved, err
+}
+
+// DeleteSavedSearch deletes the saved search with the given ID
+func (c *Client) DeleteSavedSearch(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/saved/"+url.PathEscape(id), nil, nil)
+}
+
+// Bookmark is a document on the caller's reading list
+type Bookmark struct {
+	URL   string    `json:"url"`
+	Title string    `json:"title"`
+	Added time.Time `json:"added"`
+}
+
+// Bookmarks lists the caller's bookmarks, newest first
+func (c *Client) Bookmarks(ctx context.Context) ([]Bookmark, error) {
+	var bookmarks []Bookmark
+	err := c.do(ctx, http.MethodGet, "/bookmarks", nil, &bookmarks)
+	return bookmarks, err
+}
+
+// AddBookmark bookmarks the document at path, e.g. "/guides/start.html"
+func (c *Client) AddBookmark(ctx context.Context, path, title string) (*Bookmark, error) {
+	var b Bookmark
+	err := c.do(ctx, http.MethodPost, "/bookmarks", map[string]string{"url": path, "title": title}, &b)
+	return &b, err
+}
+
+// DeleteBookmark removes the bookmark of the document at path
+func (c *Client) DeleteBookmark(ctx context.Context, path string) error {
+	file, anchor, _ := strings.Cut(strings.TrimPrefix(path, "/"), "#")
+	target := "/bookmarks/" + (&url.URL{Path: file}).EscapedPath()
+	if anchor != "" {
+		target += "?anchor=" + url.QueryEscape(anchor)
+	}
+	return c.do(ctx, http.MethodDelete, target, nil, nil)
+}
+
+// Tags returns the tags of the document at path
+func (c *Client) Tags(ctx context.Context, path string) ([]string, error) {
+	var resp struct {
+		Tags []string `json:"tags"`
+	}
+	err := c.do(ctx, http.MethodGet, "/tags/"+(&url.URL{Path: strings.TrimPrefix(path, "/")}).EscapedPath(), nil, &resp)
+	return resp.Tags, err
+}
+
+// SetTags replaces the tags of the document at path
+func (c *Client) SetTags(ctx context.Context, path string, tags []string) ([]string, error) {
+	var resp struct {
+		Tags []string `json:"tags"`
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	err := c.do(ctx, http.MethodPut, "/tags/"+(&url.URL{Path: strings.TrimPrefix(path, "/")}).EscapedPath(), map[string][]string{"tags": tags}, &resp)
+	return resp.Tags, err
+}
+
+// History returns the caller's recent queries, newest first
+func (c *Client) History(ctx context.Context) ([]string, error) {
+	var recent []string
+	err := c.do(ctx, http.MethodGet, "/history", nil, &recent)
+	return recent, err
+}
+
+// ClearHistory forgets the caller's recent queries
+func (c *Client) ClearHistory(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/history", nil, nil)
+}
+
+// Share creates a link to a document or search page that works without
+// logging in for the given hours, 24 when zero
+func (c *Client) Share(ctx context.Context, target string, hours int) (string, time.Time, error) {
+	var resp struct {
+		URL     string    `json:"url"`
+		Expires time.Time `json:"expires"`
+	}
+	req := map[string]interface{}{"url": target}
+	if hours > 0 {
+		req["hours"] = hours
+	}
+	err := c.do(ctx, http.MethodPost, "/share", req, &resp)
+	return resp.URL, resp.Expires, err
+}
+
+// ShortLink returns a short URL for a search page, given its query such
+// as "q=pool&sort=newest". It reproduces the filters, sort order and page
+// for whoever opens it.
+func (c *Client) ShortLink(ctx context.Context, params string) (string, error) {
+	var resp struct {
+		URL string `json:"url"`
+	}
+	err := c.do(ctx, http.MethodPost, "/links", map[string]string{"params": params}, &resp)
+	return resp.URL, err
+}
+
+// retryable are the statuses worth trying again after a wait
+var retryable = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// do sends a request to the versioned API, retrying as configured, and
+// decodes the JSON response into out, unless out is nil
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var data []byte
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	// POST creates alerts, bookmarks and share links; a retry after a lost
+	// response could create them twice. msearch only reads.
+	retries := c.Retries
+	if method == http.MethodPost && path != "/msearch" {
+		retries = 0
+	}
+
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, method, path, data, out)
+		apiErr, ok := err.(*Error)
+		if err == nil || attempt >= retries || (ok && !retryable[apiErr.Status]) {
+			return err
+		}
+		if ok && apiErr.retryAfter > 0 {
+			wait = apiErr.retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// send makes one attempt of a request
+func (c *Client) send(ctx context.Context, method, path string, data []byte, out interface{}) error {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/api/v"+APIVersion+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("API-Version", APIVersion)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{Status: resp.StatusCode}
+		var envelope struct {
+			Error *Error `json:"error"`
+		}
+		envelope.Error = apiErr
+		if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil || apiErr.Code == "" {
+			apiErr.Code = "unknown"
+			apiErr.Message = resp.Status
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			apiErr.retryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/search" || r.Header.Get("API-Version") != "1" || r.Header.Get("Authorization") != "Bearer t0k" {
+			t.Errorf("request = %s %s %v", r.Method, r.URL, r.Header)
+		}
+		if got := r.URL.Query().Encode(); got != "facets=docset&federated=1&fields=title%2Curl&mode=hybrid&q=pool&semantic_weight=0.3&type=md" {
+			t.Errorf("query = %s", got)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"query": "pool", "total": 1,
+			"hits":   []map[string]interface{}{{"id": "guides/pool.html", "score": 1.5, "fields": map[string]string{"title": "Pooling"}, "origin": "payments"}},
+			"facets": []map[string]interface{}{{"name": "docset", "terms": []map[string]interface{}{{"term": "guides", "docs": 1}}}},
+		})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL + "/")
+	c.Token = "t0k"
+	resp, err := c.Search(context.Background(), "pool", &SearchOptions{Fields: []string{"title", "url"}, Types: []string{"md"}, Facets: []string{"docset"}, Mode: "hybrid", SemanticWeight: 0.3, Federated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 1 || resp.Hits[0].Fields["title"] != "Pooling" || resp.Hits[0].Origin != "payments" || resp.Facets[0].Terms[0].Docs != 1 {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/bookmarks/guides/start.html" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": "not_found", "message": "no such bookmark", "request_id": "abc"}}`))
+			return
+		}
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+	c.Retries = 0
+
+	err := c.DeleteBookmark(context.Background(), "/guides/start.html")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Code != "not_found" || apiErr.RequestID != "abc" {
+		t.Errorf("err = %#v, want the decoded error", err)
+	}
+
+	err = c.ClearHistory(context.Background())
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway || apiErr.Code != "unknown" {
+		t.Errorf("err = %#v, want a generic error for a body that isn't JSON", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"documents": 42}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	c.RetryWait = time.Millisecond
+	stats, err := c.Stats(context.Background())
+	if err != nil || stats.Documents != 42 || calls != 3 {
+		t.Errorf("stats = %+v, %v after %d calls, want success on the third", stats, err, calls)
+	}
+
+	calls = 0
+	if _, err := c.AddBookmark(context.Background(), "/guides/start.html", ""); err == nil || calls != 1 {
+		t.Errorf("creating = %v after %d calls, want no retry", err, calls)
+	}
+
+	calls = -10
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	c.Retries, c.RetryWait = 100, 5*time.Millisecond
+	if _, err := c.Stats(ctx); err == nil {
+		t.Error("retries outlived the context")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/suggest" || r.URL.Query().Get("q") != "conn poo" {
+			t.Errorf("request = %s", r.URL)
+		}
+		w.Write([]byte(`{"query": "conn poo", "suggestions": [{"title": "Connection pooling", "url": "guides/pool.html"}]}`))
+	}))
+	defer srv.Close()
+
+	got, err := New(srv.URL).Suggest(context.Background(), "conn poo")
+	if err != nil || len(got) != 1 || got[0] != (Suggestion{Title: "Connection pooling", URL: "guides/pool.html"}) {
+		t.Errorf("suggestions = %+v, %v", got, err)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/admin/ingest" {
+			t.Errorf("request = %s %s", r.Method, r.URL)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.URL).Ingest(context.Background()); err == nil {
+		t.Error("no error from a failed ingest")
+	}
+	if calls != 1 {
+		t.Errorf("ingest sent %d times, want no retries", calls)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	alertsBucket   = "alerts"
+	seenDocsBucket = "seen_docs"
+)
+
+// Alert is a saved query whose owner is notified when newly indexed
+// documents match it
+type Alert struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Groups  []string  `json:"groups,omitempty"`
+	Name    string    `json:"name"`
+	Query   string    `json:"query"`
+	Email   string    `json:"email,omitempty"`
+	Webhook string    `json:"webhook,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// AlertMatch is a newly indexed document reported to an alert's owner
+type AlertMatch struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// alertWebhookClient delivers alert webhooks, which any user can point
+// anywhere. It only connects to public addresses, checked when dialing so
+// a name can't be pointed elsewhere after the alert was created.
+var alertWebhookClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: &http.Transport{DialContext: dialPublic},
+}
+
+func handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	owner := ownerName(r.Context())
+
+	alerts := []Alert{}
+	err := storeEach(alertsBucket, func(_ string, data []byte) error {
+		var a Alert
+		if err := json.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		if a.Owner == owner {
+			alerts = append(alerts, a)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func handleCreateAlert(w http.ResponseWriter, r *http.Request) {
+	var a Alert
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&a); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	a.Query = strings.TrimSpace(a.Query)
+	if a.Query == "" {
+		writeError(w, r, http.StatusBadRequest, "query is required")
+		return
+	}
+	if a.Email == "" && a.Webhook == "" {
+		writeError(w, r, http.StatusBadRequest, "email or webhook is required")
+		return
+	}
+	if a.Email != "" {
+		if !mailEnabled() {
+			writeError(w, r, http.StatusBadRequest, "email alerts need smtp to be configured")
+			return
+		}
+		addr, err := mail.ParseAddress(a.Email)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "email must be an email address")
+			return
+		}
+		a.Email = addr.Address
+	}
+	if a.Webhook != "" {
+		u, err := url.Parse(a.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, r, http.StatusBadRequest, "webhook must be an http(s) URL")
+			return
+		}
+		if !webhookHostAllowed(u.Hostname()) {
+			if _, err := publicAddrs(r.Context(), u.Hostname()); err != nil {
+				writeError(w, r, http.StatusBadRequest, "webhook must point at a public host: "+err.Error())
+				return
+			}
+		}
+	}
+
+	p, _ := principalFromContext(r.Context())
+	a.ID = randomString(12)
+	a.Owner = p.Name
+	a.Groups = p.Groups
+	a.Created = time.Now().UTC()
+	if a.Name == "" {
+		a.Name = a.Query
+	}
+
+	if err := storePut(alertsBucket, a.ID, a); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func handleDeleteAlert(w http.ResponseWriter, r *http.Request) {
+	var a Alert
+	found, err := storeGet(alertsBucket, r.PathValue("id"), &a)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || a.Owner != ownerName(r.Context()) {
+		writeError(w, r, http.StatusNotFound, "no such alert")
+		return
+	}
+
+	if err := storeDelete(alertsBucket, a.ID); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownerName is the key server-side user data is stored under. Without auth
+// every caller shares the anonymous owner "".
+func ownerName(ctx context.Context) string {
+	p, _ := principalFromContext(ctx)
+	return p.Name
+}
+
+// recordNewDocuments remembers the indexed document IDs and returns those
+// that were never seen before. The very first run only seeds the list, so
+// building a fresh index doesn't report the whole corpus as new.
+func recordNewDocuments(ids []string) ([]string, error) {
+	var fresh []string
+	now, err := time.Now().UTC().MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(seenDocsBucket))
+		if err != nil {
+			return err
+		}
+		first, _ := b.Cursor().First()
+		seeded := first != nil
+
+		for _, id := range ids {
+			if b.Get([]byte(id)) != nil {
+				continue
+			}
+			if err := b.Put([]byte(id), now); err != nil {
+				return err
+			}
+			if seeded {
+				fresh = append(fresh, id)
+			}
+		}
+		return nil
+	})
+	return fresh, err
+}
+
+// forgetRemovedDocuments drops the documents that weren't in the last build
+// from the seen list, so it doesn't keep every path that ever existed. A
+// document that comes back is reported as new again.
+func forgetRemovedDocuments(ids []string) error {
+	indexed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		indexed[id] = true
+	}
+	return store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(seenDocsBucket))
+		if b == nil {
+			return nil
+		}
+		var gone [][]byte
+		err := b.ForEach(func(k, _ []byte) error {
+			if !indexed[string(k)] {
+				gone = append(gone, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range gone {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// notifyAlerts runs every alert against the newly indexed documents and
+// notifies the owners of alerts with matches
+func notifyAlerts(newIDs []string) {
+	if len(newIDs) == 0 {
+		return
+	}
+
+	var alerts []Alert
+	err := storeEach(alertsBucket, func(_ string, data []byte) error {
+		var a Alert
+		if err := json.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		alerts = append(alerts, a)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error loading alerts: %v", err)
+		return
+	}
+
+	for _, a := range alerts {
+		matches, err := alertMatches(a, newIDs)
+		if err != nil {
+			log.Printf("Error running alert %s: %v", a.ID, err)
+			continue
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		if err := deliverAlert(a, matches); err != nil {
+			log.Printf("Error delivering alert %s: %v", a.ID, err)
+		}
+	}
+}
+
+func alertMatches(a Alert, ids []string) ([]AlertMatch, error) {
+	ctx := context.WithValue(context.Background(), principalKey{}, Principal{Name: a.Owner, Groups: a.Groups})
+	denied := deniedDocsets(ctx)
+
+	q := bleve.NewConjunctionQuery(newTextQuery(a.Query), bleve.NewDocIDQuery(ids))
+	searchRequest := bleve.NewSearchRequestOptions(restrictQuery(q, denied), 50, 0, false)
+	searchRequest.Fields = []string{"Title"}
+
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []AlertMatch
+	for _, hit := range searchResult.Hits {
+		if !hitAllowed(hit.ID, denied) {
+			continue
+		}
+		rel, err := filepath.Rel(root, hit.ID)
+		if err != nil {
+			continue
+		}
+		title, _ := hit.Fields["Title"].(string)
+		matches = append(matches, AlertMatch{Title: title, URL: absoluteURL(rel)})
+	}
+	return matches, nil
+}
+
+func deliverAlert(a Alert, matches []AlertMatch) error {
+	if a.Webhook != "" {
+		payload := map[string]interface{}{
+			"alert":     a.Name,
+			"query":     a.Query,
+			"documents": matches,
+		}
+		if err := postWebhook(a.Webhook, payload); err != nil {
+			return err
+		}
+	}
+
+	if a.Email != "" {
+		var body strings.Builder
+		fmt.Fprintf(&body, "New documents match your alert %q:\n\n", a.Name)
+		for _, m := range matches {
+			fmt.Fprintf(&body, "- %s\n  %s\n", m.Title, m.URL)
+		}
+		subject := fmt.Sprintf("[GoDocHive] %d new match(es) for %q", len(matches), a.Name)
+		if err := sendMail([]string{a.Email}, subject, body.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postWebhook POSTs payload as JSON and expects a 2xx answer
+func postWebhook(target string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := alertWebhookClient.Post(target, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", target, resp.Status)
+	}
+	return nil
+}
+
+// webhookHostAllowed reports whether alert webhooks may reach host whatever
+// it resolves to, because it is listed in alert_webhook_hosts
+func webhookHostAllowed(host string) bool {
+	for _, h := range config.AlertWebhookHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicAddrs resolves host and fails when any of its addresses is
+// loopback, link-local, private or otherwise not reachable from outside
+func publicAddrs(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() ||
+			ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+			return nil, fmt.Errorf("%s resolves to %s", host, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s has no addresses", host)
+	}
+	return ips, nil
+}
+
+// dialPublic connects to one of the public addresses of the host in addr,
+// or to any address of an allowed host
+func dialPublic(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	if webhookHostAllowed(host) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	ips, err := publicAddrs(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].String(), port))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateAlertValidatesTargets(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{
+		SMTP:              SMTPConfig{Host: "smtp.example.com", From: "docs@example.com"},
+		AlertWebhookHosts: []string{"10.0.0.5"},
+	})
+
+	create := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/alerts", strings.NewReader(body))
+		return serve(http.HandlerFunc(handleCreateAlert), r)
+	}
+	for _, webhook := range []string{"http://127.0.0.1:8080/hook", "http://169.254.169.254/latest/meta-data", "http://192.168.1.10/hook", "http://[::1]/hook", "http://0.0.0.0/hook"} {
+		if rec := create(`{"query": "pool", "webhook": "` + webhook + `"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("webhook %s: %d %s", webhook, rec.Code, rec.Body.String())
+		}
+	}
+	for _, webhook := range []string{"https://93.184.216.34/hook", "http://10.0.0.5/hook"} {
+		if rec := create(`{"query": "pool", "webhook": "` + webhook + `"}`); rec.Code != http.StatusCreated {
+			t.Errorf("webhook %s: %d %s", webhook, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := create(`{"query": "pool", "email": "not an address"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid email: %d %s", rec.Code, rec.Body.String())
+	}
+	rec := create(`{"query": "pool", "email": "Ana Lima <ana@example.com>"}`)
+	var a Alert
+	if err := json.NewDecoder(rec.Body).Decode(&a); err != nil || rec.Code != http.StatusCreated || a.Email != "ana@example.com" {
+		t.Errorf("email alert = %d %+v, %v", rec.Code, a, err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/simple"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/web"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/lang/de"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/lang/es"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/it"
+	"github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/token/stop"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/analysis/tokenmap"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+// AnalysisConfig changes how document text is split into terms. Every
+// setting here is baked into the index, so changing one needs a rebuild.
+type AnalysisConfig struct {
+	// Stemmer reduces words to their stem in documents of no detected
+	// language, one of the languages of stemmers
+	Stemmer string `json:"stemmer"`
+	// Stopwords are left out of documents of no detected language, on top
+	// of the English ones the standard analyzer drops
+	Stopwords []string `json:"stopwords"`
+	// Fields sets the analyzer of "title", "content" or "headings" in
+	// documents of every language, one of fieldAnalyzers
+	Fields map[string]string `json:"fields"`
+}
+
+// textAnalyzer analyzes documents of no detected language when a stemmer
+// or stopwords are configured
+const textAnalyzer = "text"
+
+// stemmers are the stemmer languages and their token filters
+var stemmers = map[string]string{
+	"en": en.SnowballStemmerName,
+	"de": de.SnowballStemmerName,
+	"fr": fr.SnowballStemmerName,
+	"es": es.SnowballStemmerName,
+	"it": it.SnowballStemmerName,
+	"nl": nl.SnowballStemmerName,
+}
+
+// fieldAnalyzers are the analyzers a field can be set to. "text" is the
+// analyzer of documents of no detected language, configured or not.
+var fieldAnalyzers = []string{textAnalyzer, standard.Name, simple.Name, keyword.Name, web.Name, en.AnalyzerName, de.AnalyzerName, cjk.AnalyzerName}
+
+// analyzedFields are the Document fields the config can set analyzers
+// of, by their lowercase names
+var analyzedFields = []string{"title", "content", "headings"}
+
+func (a AnalysisConfig) configured() bool {
+	return a.Stemmer != "" || len(a.Stopwords) > 0 || len(a.Fields) > 0
+}
+
+func (a AnalysisConfig) validate() error {
+	if _, ok := stemmers[a.Stemmer]; a.Stemmer != "" && !ok {
+		return fmt.Errorf("analysis: unknown stemmer %q", a.Stemmer)
+	}
+	for field, analyzer := range a.Fields {
+		if !contains(analyzedFields, field) {
+			return fmt.Errorf("analysis: unknown field %q", field)
+		}
+		if !contains(fieldAnalyzers, analyzer) {
+			return fmt.Errorf("analysis: field %q has unknown analyzer %q", field, analyzer)
+		}
+	}
+	return nil
+}
+
+// normalize lowercases the stopwords, since the standard analyzer
+// lowercases the terms they are compared with
+func (a *AnalysisConfig) normalize() {
+	for i, word := range a.Stopwords {
+		a.Stopwords[i] = strings.ToLower(strings.TrimSpace(word))
+	}
+}
+
+// defaultTextAnalyzer analyzes the text of documents of no detected
+// language
+func defaultTextAnalyzer() string {
+	if config.Analysis.Stemmer != "" || len(config.Analysis.Stopwords) > 0 {
+		return textAnalyzer
+	}
+	return standard.Name
+}
+
+// fieldAnalyzer is the analyzer of a Document field in documents analyzed
+// with languageAnalyzer, which the config can override
+func fieldAnalyzer(field, languageAnalyzer string) string {
+	switch analyzer := config.Analysis.Fields[strings.ToLower(field)]; analyzer {
+	case "":
+		return languageAnalyzer
+	case textAnalyzer:
+		return defaultTextAnalyzer()
+	default:
+		return analyzer
+	}
+}
+
+// addTextAnalyzer registers the configured analyzer of documents of no
+// detected language: the standard analyzer plus the stopwords and stemmer
+func addTextAnalyzer(indexMapping *mapping.IndexMappingImpl) error {
+	if defaultTextAnalyzer() != textAnalyzer {
+		return nil
+	}
+	filters := []string{lowercase.Name, en.StopName}
+	if len(config.Analysis.Stopwords) > 0 {
+		tokens := make([]interface{}, len(config.Analysis.Stopwords))
+		for i, w := range config.Analysis.Stopwords {
+			tokens[i] = w
+		}
+		err := indexMapping.AddCustomTokenMap("stopwords", map[string]interface{}{
+			"type":   tokenmap.Name,
+			"tokens": tokens,
+		})
+		if err != nil {
+			return err
+		}
+		err = indexMapping.AddCustomTokenFilter("stop_configured", map[string]interface{}{
+			"type":           stop.Name,
+			"stop_token_map": "stopwords",
+		})
+		if err != nil {
+			return err
+		}
+		filters = append(filters, "stop_configured")
+	}
+	if config.Analysis.Stemmer != "" {
+		filters = append(filters, stemmers[config.Analysis.Stemmer])
+	}
+	return indexMapping.AddCustomAnalyzer(textAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": filters,
+	})
+}
+
+const analysisInternalKey = "godochive:analysis"
+
+// analysisFingerprint identifies the analysis settings the index was
+// built with, empty when none are set so older indexes stay valid
+func analysisFingerprint() []byte {
+	a := config.Analysis
+	if !a.configured() {
+		return nil
+	}
+	// stopwords are a set, their order doesn't change the index
+	a.Stopwords = append([]string(nil), a.Stopwords...)
+	sort.Strings(a.Stopwords)
+	data, err := json.Marshal(a)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+// analysisUpToDate reports whether the index was built with the current
+// analysis settings
+func analysisUpToDate(idx bleve.Index) bool {
+	stamp, err := idx.GetInternal([]byte(analysisInternalKey))
+	if err != nil {
+		return false
+	}
+	return string(stamp) == string(analysisFingerprint())
+}
+
+func stampAnalysis(idx bleve.Index) error {
+	if fingerprint := analysisFingerprint(); fingerprint != nil {
+		return idx.SetInternal([]byte(analysisInternalKey), fingerprint)
+	}
+	return idx.DeleteInternal([]byte(analysisInternalKey))
+}
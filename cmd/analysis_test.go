@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestConfiguredAnalysis(t *testing.T) {
+	withConfig(t, Config{Analysis: AnalysisConfig{
+		Stemmer:   "fr",
+		Stopwords: []string{"avec"},
+		Fields:    map[string]string{"title": "keyword"},
+	}})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	docs := []Document{
+		{Title: "Connexions", Content: "les serveurs rapides avec le cache", URL: "fr.html"},
+		{Title: "Connections", Content: "connections are reused", URL: "en.html", Language: "en"},
+	}
+	for _, doc := range docs {
+		doc.URL = filepath.Join(root, doc.URL)
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// stemmed with the French stemmer
+		{"serveur", []string{"fr.html"}},
+		{"connection", []string{"en.html"}},
+		{"avec", nil},
+		// the keyword title matches as a whole only
+		{"Connexions", []string{"fr.html"}},
+	}
+	for _, tt := range tests {
+		results, err := performSearch(tt.query, searchFilter{}, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.URL)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: results = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestAnalysisUpToDate(t *testing.T) {
+	withConfig(t, Config{})
+	idx := withEmptyIndex(t)
+	// indexes from before the setting existed stay valid
+	if !analysisUpToDate(idx) {
+		t.Error("unconfigured analysis reported stale")
+	}
+
+	config.Analysis.Stemmer = "de"
+	if analysisUpToDate(idx) {
+		t.Error("changed stemmer not reported")
+	}
+	if err := stampAnalysis(idx); err != nil {
+		t.Fatal(err)
+	}
+	if !analysisUpToDate(idx) {
+		t.Error("stamped index reported stale")
+	}
+
+	config.Analysis = AnalysisConfig{}
+	if analysisUpToDate(idx) {
+		t.Error("removed stemmer not reported")
+	}
+}
+
+func TestInvalidAnalysis(t *testing.T) {
+	for _, cfg := range []string{
+		`{"analysis": {"stemmer": "xx"}}`,
+		`{"analysis": {"fields": {"url": "keyword"}}}`,
+		`{"analysis": {"fields": {"title": "fancy"}}}`,
+	} {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "analysis") {
+			t.Errorf("%s: err = %v, want an analysis error", cfg, err)
+		}
+	}
+}
+
+func TestStopwordsLowercased(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"analysis": {"stopwords": ["The", " AVEC "]}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cfg.Analysis.Stopwords, ","); got != "the,avec" {
+		t.Errorf("stopwords = %q, want the,avec", got)
+	}
+}
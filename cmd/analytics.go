@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// analyticsBucket holds a bucket per day, named like 2024-05-01, with one
+// key per query searched that day in its queries bucket and one per
+// document opened in its opens bucket. Older releases kept each day as one
+// analyticsDay in JSON; those days are still read.
+const analyticsBucket = "search_analytics"
+
+var (
+	analyticsQueries = []byte("queries")
+	analyticsOpens   = []byte("opens")
+)
+
+const (
+	// defaultAnalyticsDays is how long analytics are kept when
+	// analytics.days is unset
+	defaultAnalyticsDays = 90
+	// analyticsTop is how many entries each dashboard table lists
+	analyticsTop = 25
+	// maxAnalyticsQuery caps the length of a recorded query, in bytes
+	maxAnalyticsQuery = 200
+)
+
+// maxAnalyticsQueries caps the distinct queries recorded per day. New
+// queries past it aren't counted that day, so made-up queries can't grow
+// the database without bound.
+var maxAnalyticsQueries uint64 = 10000
+
+// analyticsDay is what's recorded on one day, read back for the report.
+// Nothing identifies who searched or opened a document.
+type analyticsDay struct {
+	Queries map[string]*queryCounts `json:"queries"`
+	// Opens counts the documents opened from search results, by path
+	// relative to the root
+	Opens map[string]int `json:"opens"`
+}
+
+type queryCounts struct {
+	Searches    int `json:"searches"`
+	ZeroResults int `json:"zero_results"`
+	// Results is how many results the last search showed on its first
+	// page
+	Results int `json:"results"`
+}
+
+// AnalyticsReport is the body of /api/admin/analytics and the data of the
+// dashboard
+type AnalyticsReport struct {
+	Days int `json:"days"`
+	// TopQueries are the most searched queries, ZeroResultQueries the
+	// most searched of those that found nothing the last time
+	TopQueries        []QueryStat `json:"top_queries"`
+	ZeroResultQueries []QueryStat `json:"zero_result_queries"`
+	TopDocuments      []OpenStat  `json:"top_documents"`
+}
+
+// QueryStat sums up the searches for one query
+type QueryStat struct {
+	Query       string `json:"query"`
+	Searches    int    `json:"searches"`
+	ZeroResults int    `json:"zero_results"`
+	Results     int    `json:"results"`
+}
+
+// OpenStat is how often a document was opened from the results
+type OpenStat struct {
+	Path  string `json:"path"`
+	Opens int    `json:"opens"`
+}
+
+func analyticsEnabled() bool {
+	return config.Analytics.Enabled && store != nil
+}
+
+func (c AnalyticsConfig) days() int {
+	if c.Days > 0 {
+		return c.Days
+	}
+	return defaultAnalyticsDays
+}
+
+// normalizeQuery folds case and whitespace, so the same search typed
+// differently is counted once
+func normalizeQuery(q string) string {
+	q = strings.ToLower(strings.Join(strings.Fields(q), " "))
+	if len(q) > maxAnalyticsQuery {
+		q = strings.ToValidUTF8(q[:maxAnalyticsQuery], "")
+	}
+	return q
+}
+
+// analyticsDayBucket returns the bucket name of the day of now, creating
+// it. A day still kept as JSON is moved into buckets first.
+func analyticsDayBucket(tx *bolt.Tx, now time.Time, name []byte) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists([]byte(analyticsBucket))
+	if err != nil {
+		return nil, err
+	}
+	key := []byte(now.UTC().Format("2006-01-02"))
+	if data := b.Get(key); data != nil {
+		if err := migrateAnalyticsDay(b, key, data); err != nil {
+			return nil, err
+		}
+	}
+	day, err := b.CreateBucketIfNotExists(key)
+	if err != nil {
+		return nil, err
+	}
+	return day.CreateBucketIfNotExists(name)
+}
+
+// migrateAnalyticsDay replaces the JSON record of a day with its buckets
+func migrateAnalyticsDay(b *bolt.Bucket, key, data []byte) error {
+	var day analyticsDay
+	if err := json.Unmarshal(data, &day); err != nil {
+		return err
+	}
+	if err := b.Delete(key); err != nil {
+		return err
+	}
+	dayBucket, err := b.CreateBucket(key)
+	if err != nil {
+		return err
+	}
+	queries, err := dayBucket.CreateBucket(analyticsQueries)
+	if err != nil {
+		return err
+	}
+	for q, c := range day.Queries {
+		if err := putJSON(queries, q, c); err != nil {
+			return err
+		}
+	}
+	if err := queries.SetSequence(uint64(len(day.Queries))); err != nil {
+		return err
+	}
+	opens, err := dayBucket.CreateBucket(analyticsOpens)
+	if err != nil {
+		return err
+	}
+	for path, n := range day.Opens {
+		if err := putJSON(opens, path, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putJSON(b *bolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), data)
+}
+
+// recordSearch counts a search for query that showed results on its first
+// page. Only the counts of that query are read and written, whatever else
+// was searched that day.
+func recordSearch(query string, results int, now time.Time) error {
+	q := normalizeQuery(query)
+	if q == "" {
+		return nil
+	}
+	return store.Update(func(tx *bolt.Tx) error {
+		b, err := analyticsDayBucket(tx, now, analyticsQueries)
+		if err != nil {
+			return err
+		}
+		var c queryCounts
+		if data := b.Get([]byte(q)); data != nil {
+			if err := json.Unmarshal(data, &c); err != nil {
+				return err
+			}
+		} else {
+			// the sequence counts the distinct queries of the day
+			if b.Sequence() >= maxAnalyticsQueries {
+				return nil
+			}
+			if _, err := b.NextSequence(); err != nil {
+				return err
+			}
+		}
+		c.Searches++
+		c.Results = results
+		if results == 0 {
+			c.ZeroResults++
+		}
+		return putJSON(b, q, c)
+	})
+}
+
+// recordOpen counts the opening of the document at path, relative to the
+// root, from the search results
+func recordOpen(path string, now time.Time) error {
+	return store.Update(func(tx *bolt.Tx) error {
+		b, err := analyticsDayBucket(tx, now, analyticsOpens)
+		if err != nil {
+			return err
+		}
+		var n int
+		if data := b.Get([]byte(path)); data != nil {
+			if err := json.Unmarshal(data, &n); err != nil {
+				return err
+			}
+		}
+		return putJSON(b, path, n+1)
+	})
+}
+
+// recordSearchAnalytics counts a search that showed results on its first
+// page, and updates the zero-result log
+func recordSearchAnalytics(query string, results int) {
+	now := time.Now()
+	if err := recordSearch(query, results, now); err != nil {
+		log.Printf("Error recording search analytics: %v", err)
+	}
+	var err error
+	if results == 0 {
+		err = recordZeroResults(query, now)
+	} else {
+		err = resolveZeroResults(query)
+	}
+	if err != nil {
+		log.Printf("Error updating the zero-result log: %v", err)
+	}
+}
+
+// readAnalyticsDay reads the day at key of the analytics bucket, either
+// its buckets or, for days recorded by older releases, its JSON value
+func readAnalyticsDay(b *bolt.Bucket, key, value []byte) (analyticsDay, error) {
+	day := analyticsDay{Queries: make(map[string]*queryCounts), Opens: make(map[string]int)}
+	if value != nil {
+		err := json.Unmarshal(value, &day)
+		return day, err
+	}
+	dayBucket := b.Bucket(key)
+	if queries := dayBucket.Bucket(analyticsQueries); queries != nil {
+		err := queries.ForEach(func(k, v []byte) error {
+			var c queryCounts
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			day.Queries[string(k)] = &c
+			return nil
+		})
+		if err != nil {
+			return day, err
+		}
+	}
+	if opens := dayBucket.Bucket(analyticsOpens); opens != nil {
+		err := opens.ForEach(func(k, v []byte) error {
+			var n int
+			if err := json.Unmarshal(v, &n); err != nil {
+				return err
+			}
+			day.Opens[string(k)] = n
+			return nil
+		})
+		if err != nil {
+			return day, err
+		}
+	}
+	return day, nil
+}
+
+// analyticsReport sums up the days recorded since days ago. Queries
+// searched fewer than analytics.min_searches times are left out.
+func analyticsReport(days int, now time.Time) (AnalyticsReport, error) {
+	report := AnalyticsReport{Days: days, TopQueries: []QueryStat{}, ZeroResultQueries: []QueryStat{}, TopDocuments: []OpenStat{}}
+	if store == nil {
+		return report, nil
+	}
+	from := now.UTC().AddDate(0, 0, 1-days).Format("2006-01-02")
+	queries := make(map[string]*QueryStat)
+	opens := make(map[string]int)
+	err := store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(analyticsBucket))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(from)); k != nil; k, v = c.Next() {
+			day, err := readAnalyticsDay(b, k, v)
+			if err != nil {
+				return err
+			}
+			addAnalyticsDay(queries, opens, day)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, s := range queries {
+		if s.Searches < config.Analytics.MinSearches {
+			continue
+		}
+		report.TopQueries = append(report.TopQueries, *s)
+		if s.Results == 0 {
+			report.ZeroResultQueries = append(report.ZeroResultQueries, *s)
+		}
+	}
+	for path, n := range opens {
+		report.TopDocuments = append(report.TopDocuments, OpenStat{Path: path, Opens: n})
+	}
+	byQueries := func(stats []QueryStat) {
+		sort.Slice(stats, func(i, j int) bool {
+			if stats[i].Searches != stats[j].Searches {
+				return stats[i].Searches > stats[j].Searches
+			}
+			return stats[i].Query < stats[j].Query
+		})
+	}
+	byQueries(report.TopQueries)
+	byQueries(report.ZeroResultQueries)
+	sort.Slice(report.TopDocuments, func(i, j int) bool {
+		a, b := report.TopDocuments[i], report.TopDocuments[j]
+		if a.Opens != b.Opens {
+			return a.Opens > b.Opens
+		}
+		return a.Path < b.Path
+	})
+	if len(report.TopQueries) > analyticsTop {
+		report.TopQueries = report.TopQueries[:analyticsTop]
+	}
+	if len(report.ZeroResultQueries) > analyticsTop {
+		report.ZeroResultQueries = report.ZeroResultQueries[:analyticsTop]
+	}
+	if len(report.TopDocuments) > analyticsTop {
+		report.TopDocuments = report.TopDocuments[:analyticsTop]
+	}
+	return report, nil
+}
+
+// addAnalyticsDay adds the counts of day to the report's totals
+func addAnalyticsDay(queries map[string]*QueryStat, opens map[string]int, day analyticsDay) {
+	for q, c := range day.Queries {
+		s := queries[q]
+		if s == nil {
+			s = &QueryStat{Query: q}
+			queries[q] = s
+		}
+		s.Searches += c.Searches
+		s.ZeroResults += c.ZeroResults
+		// days come in order, so the last day's count wins
+		s.Results = c.Results
+	}
+	for path, n := range day.Opens {
+		opens[path] += n
+	}
+}
+
+// pruneAnalytics deletes the days recorded before cutoff
+func pruneAnalytics(cutoff time.Time) (int, error) {
+	before := []byte(cutoff.UTC().Format("2006-01-02"))
+	removed := 0
+	err := store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(analyticsBucket))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		// keys sort by day, so the first is always the oldest left
+		for k, v := c.First(); k != nil && string(k) < string(before); k, v = c.First() {
+			var err error
+			if v == nil {
+				err = b.DeleteBucket(k)
+			} else {
+				err = c.Delete()
+			}
+			if err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// analyticsDaysFrom reads the days= parameter of the dashboard, 30 when
+// unset, capped at how long analytics are kept
+func analyticsDaysFrom(r *http.Request) int {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+	if kept := config.Analytics.days(); days > kept {
+		days = kept
+	}
+	return days
+}
+
+// handleOpenResult records that a search result was opened. The search
+// page sends it as a beacon when a result link is clicked.
+func handleOpenResult(w http.ResponseWriter, r *http.Request) {
+	if !analyticsEnabled() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	rel := strings.TrimPrefix(r.FormValue("path"), "/")
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	// only documents in the index are counted, so the table can't be
+	// filled with made-up paths
+	if rel == "" || !canAccessPath(r.Context(), path) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if doc, err := index.Document(path); err != nil || doc == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := recordOpen(filepath.ToSlash(rel), time.Now()); err != nil {
+		log.Printf("Error recording an opened result: %v", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleAPIAnalytics(w http.ResponseWriter, r *http.Request) {
+	report, err := analyticsReport(analyticsDaysFrom(r), time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func handleAnalytics(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		renderError(w, r, http.StatusForbidden)
+		return
+	}
+	report, err := analyticsReport(analyticsDaysFrom(r), time.Now())
+	if err != nil {
+		log.Printf("Error loading analytics: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "analytics.html", struct {
+		Page
+		Report  AnalyticsReport
+		Enabled bool
+	}{newPage(r, "analytics.title"), report, analyticsEnabled()})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyticsReport(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{Analytics: AnalyticsConfig{Enabled: true, MinSearches: 2}})
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	earlier := now.AddDate(0, 0, -40)
+
+	for _, s := range []struct {
+		query   string
+		results int
+		at      time.Time
+	}{
+		{"Connection  Pool", 10, now},
+		{"connection pool", 8, now},
+		{"pool", 3, now.AddDate(0, 0, -1)},
+		{"kubernetes", 0, now},
+		{"kubernetes", 0, now.AddDate(0, 0, -2)},
+		{"k8s", 0, now},
+		{"retries", 0, earlier},
+		{"retries", 0, earlier},
+	} {
+		if err := recordSearch(s.query, s.results, s.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recordOpen("guides/pool.html", now)
+	recordOpen("guides/pool.html", now.AddDate(0, 0, -3))
+	recordOpen("guides/start.html", now)
+
+	report, err := analyticsReport(30, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pool and k8s were searched once, below min_searches; retries is
+	// outside the last 30 days
+	want := []QueryStat{{Query: "connection pool", Searches: 2, Results: 8}, {Query: "kubernetes", Searches: 2, ZeroResults: 2}}
+	if !reflect.DeepEqual(report.TopQueries, want) {
+		t.Errorf("top queries = %+v, want %+v", report.TopQueries, want)
+	}
+	if len(report.ZeroResultQueries) != 1 || report.ZeroResultQueries[0].Query != "kubernetes" {
+		t.Errorf("zero result queries = %+v, want kubernetes", report.ZeroResultQueries)
+	}
+	wantDocs := []OpenStat{{Path: "guides/pool.html", Opens: 2}, {Path: "guides/start.html", Opens: 1}}
+	if !reflect.DeepEqual(report.TopDocuments, wantDocs) {
+		t.Errorf("top documents = %+v, want %+v", report.TopDocuments, wantDocs)
+	}
+
+	if n, err := pruneAnalytics(now.AddDate(0, 0, -30)); err != nil || n != 1 {
+		t.Errorf("pruned %d days, %v; want the day of retries", n, err)
+	}
+	if report, _ := analyticsReport(90, now); len(report.TopQueries) != 2 {
+		t.Errorf("top queries after pruning = %+v", report.TopQueries)
+	}
+}
+
+func TestOpenResult(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{Analytics: AnalyticsConfig{Enabled: true}})
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+
+	for _, path := range []string{"guides/pool.html", "/guides/pool.html", "guides/made-up.html", "../etc/passwd"} {
+		form := url.Values{"path": {path}}
+		req := httptest.NewRequest(http.MethodPost, "/search/open", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if rec := serve(http.HandlerFunc(handleOpenResult), req); rec.Code != http.StatusNoContent {
+			t.Errorf("open %s: status %d", path, rec.Code)
+		}
+	}
+	report, err := analyticsReport(1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []OpenStat{{Path: "guides/pool.html", Opens: 2}}; !reflect.DeepEqual(report.TopDocuments, want) {
+		t.Errorf("top documents = %+v, want only the indexed document", report.TopDocuments)
+	}
+}
+
+func TestAnalyticsPage(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{
+		Analytics: AnalyticsConfig{Enabled: true},
+		Auth:      AuthConfig{Tokens: []AuthToken{{Name: "ops", Token: "ops-tok"}}, AdminGroups: []string{"admins"}},
+	})
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	serve(http.HandlerFunc(handleSearch), httptest.NewRequest(http.MethodGet, "/search?q=pooling", nil))
+	serve(http.HandlerFunc(handleSearch), httptest.NewRequest(http.MethodGet, "/search?q=pooling&page=2", nil))
+	serve(http.HandlerFunc(handleSearch), httptest.NewRequest(http.MethodGet, "/search?q=sharding", nil))
+
+	if rec := serve(http.HandlerFunc(handleAnalytics), httptest.NewRequest(http.MethodGet, "/admin/analytics", nil).WithContext(memberContext())); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin got status %d", rec.Code)
+	}
+	rec := serve(http.HandlerFunc(handleAnalytics), httptest.NewRequest(http.MethodGet, "/admin/analytics", nil).WithContext(memberContext("admins")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	body := rec.Body.String()
+	zero := body[strings.Index(body, "Queries without results"):]
+	if !strings.Contains(body, ">pooling</a></td><td>1</td>") || !strings.Contains(zero, ">sharding</a>") || strings.Contains(zero, ">pooling</a>") {
+		t.Errorf("dashboard doesn't count pooling once and list sharding as not found:\n%s", body)
+	}
+}
+
+func TestAnalyticsDays(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{Analytics: AnalyticsConfig{Enabled: true}})
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	// days recorded as JSON by older releases are read, and today's is
+	// moved into buckets when it's recorded to
+	legacy := analyticsDay{Queries: map[string]*queryCounts{"pool": {Searches: 2, Results: 4}}, Opens: map[string]int{"guides/pool.html": 1}}
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+		if err := storePut(analyticsBucket, day.Format("2006-01-02"), legacy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recordSearch("pool", 5, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordOpen("guides/pool.html", now); err != nil {
+		t.Fatal(err)
+	}
+	report, err := analyticsReport(2, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []QueryStat{{Query: "pool", Searches: 5, Results: 5}}; !reflect.DeepEqual(report.TopQueries, want) {
+		t.Errorf("top queries = %+v, want %+v", report.TopQueries, want)
+	}
+	if want := []OpenStat{{Path: "guides/pool.html", Opens: 3}}; !reflect.DeepEqual(report.TopDocuments, want) {
+		t.Errorf("top documents = %+v, want %+v", report.TopDocuments, want)
+	}
+
+	// past the cap new queries aren't counted, known ones still are
+	old := maxAnalyticsQueries
+	maxAnalyticsQueries = 2
+	t.Cleanup(func() { maxAnalyticsQueries = old })
+	for _, q := range []string{"cache", "tls", "pool"} {
+		if err := recordSearch(q, 1, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, _ = analyticsReport(1, now)
+	var got []string
+	for _, s := range report.TopQueries {
+		got = append(got, s.Query)
+	}
+	if strings.Join(got, ",") != "pool,cache" {
+		t.Errorf("queries counted = %v, want pool and cache", got)
+	}
+}
+
+func TestAPISearchAnalytics(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{Analytics: AnalyticsConfig{Enabled: true}})
+	withRoot(t, "/docs")
+	docs := map[string]string{}
+	for i := 0; i < 12; i++ {
+		docs[fmt.Sprintf("guides/pool%d.html", i)] = "connection pooling"
+	}
+	withIndex(t, docs)
+
+	serve(http.HandlerFunc(handleAPISearch), httptest.NewRequest(http.MethodGet, "/api/search?q=pooling", nil))
+	serve(http.HandlerFunc(handleAPISearch), httptest.NewRequest(http.MethodGet, "/api/search?q=pool&live=1", nil))
+	if rec := serve(http.HandlerFunc(handleAPISearch), httptest.NewRequest(http.MethodGet, "/api/search?q=pooling&federated=1", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("federated search without peers = %d", rec.Code)
+	}
+
+	report, err := analyticsReport(1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every match counts, not only the first page of them
+	if want := []QueryStat{{Query: "pooling", Searches: 1, Results: 12}}; !reflect.DeepEqual(report.TopQueries, want) {
+		t.Errorf("top queries = %+v, want only the API search that wasn't live or rejected", report.TopQueries)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// storedFields maps the lowercase API name of each stored field to its
+// name in the index
+var storedFields = map[string]string{
+	"title":      "Title",
+	"content":    "Content",
+	"url":        "URL",
+	"deprecated": "Deprecated",
+	"tags":       "Tags",
+	"trust":      "Trust",
+	"type":       "DocType",
+	"size":       "Size",
+	"revision":   "Revision",
+	"authors":    "Authors",
+	"date":       "Date",
+}
+
+var defaultAPIFields = []string{"title", "content", "url", "deprecated", "tags"}
+
+// APIHit is a single search hit as returned by the JSON API
+type APIHit struct {
+	ID     string                 `json:"id"`
+	Score  float64                `json:"score"`
+	Fields map[string]interface{} `json:"fields"`
+	// Origin names the instance the hit is from, in federated searches
+	Origin string `json:"origin,omitempty"`
+}
+
+// APISearchResponse is the body of /api/search
+type APISearchResponse struct {
+	Query string   `json:"query"`
+	Total uint64   `json:"total"`
+	Hits  []APIHit `json:"hits"`
+	// Facets are the counts asked for with facets=, see facets.go
+	Facets []APIFacet `json:"facets,omitempty"`
+	// Peers tells how each peer answered a federated search, see
+	// federation.go
+	Peers []PeerStatus `json:"peers,omitempty"`
+	// timing is for the slow-query log
+	timing searchTiming
+}
+
+func handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	query := r.URL.Query().Get("q")
+
+	fields, err := parseFieldsParam(r.URL.Query().Get("fields"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	facets, err := parseFacetsParam(r.URL.Query().Get("facets"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	federated := r.URL.Query().Get("federated") == "1"
+	if federated && len(config.Federation.Peers) == 0 {
+		writeError(w, r, http.StatusBadRequest, "federation isn't configured, add peers to the config")
+		return
+	}
+
+	var resp APISearchResponse
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "keyword":
+		resp, err = runAPISearch(query, fields, filter, 10)
+	case "hybrid":
+		e := currentEmbedder()
+		if e == nil {
+			writeError(w, r, http.StatusServiceUnavailable, errNoEmbeddings.Error())
+			return
+		}
+		weight, werr := semanticWeightFromRequest(r)
+		if werr != nil {
+			writeError(w, r, http.StatusBadRequest, werr.Error())
+			return
+		}
+		resp, err = runHybridSearch(r.Context(), e, query, fields, filter, 10, weight)
+	default:
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown mode %q, use one of %s", mode, strings.Join(searchModes, ", ")))
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// searches run while typing, like the widget's, aren't counted
+	if query != "" && analyticsEnabled() && r.URL.Query().Get("live") != "1" {
+		recordSearchAnalytics(query, int(resp.Total))
+	}
+
+	if federated && query != "" {
+		resp = federate(r.Context(), resp, peerParams(r.URL.Query()), 10)
+	}
+
+	if len(facets) > 0 && query != "" {
+		q := filter.apply(filter.textQuery(query))
+		if r.URL.Query().Get("stream") == "1" {
+			streamFacets(w, r, resp, q, facets)
+			return
+		}
+		if resp.Facets, err = runFacets(r.Context(), q, facets); err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	rendering := time.Now()
+	writeJSON(w, http.StatusOK, resp)
+	logSlowSearch(r, query, resp.timing, start, time.Since(rendering))
+}
+
+// APICountResponse is the body of /api/count
+type APICountResponse struct {
+	Query string `json:"query"`
+	Count uint64 `json:"count"`
+}
+
+// handleAPICount returns only the number of matching pages. No fields are
+// loaded and no hits are returned, which keeps it cheap enough for
+// monitoring scripts.
+func handleAPICount(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing q parameter")
+		return
+	}
+
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	q := filter.apply(pagesOnly(filter.textQuery(query)))
+	searchRequest := bleve.NewSearchRequestOptions(q, 0, 0, false)
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APICountResponse{Query: query, Count: searchResult.Total})
+}
+
+func runAPISearch(query string, fields []string, filter searchFilter, size int) (APISearchResponse, error) {
+	resp := APISearchResponse{Query: query, Hits: []APIHit{}}
+	if query == "" {
+		return resp, nil
+	}
+
+	searchRequest := bleve.NewSearchRequest(filter.apply(filter.textQuery(query)))
+	searchRequest.Size = size
+	for _, f := range fields {
+		searchRequest.Fields = append(searchRequest.Fields, storedFields[f])
+	}
+	searchResult, err := searchRanked(index, searchRequest, query, filter.rankers()...)
+	if err != nil {
+		return resp, err
+	}
+
+	resp.Total = searchResult.Total
+	resp.timing = newSearchTiming(searchRequest, searchResult)
+	for _, hit := range searchResult.Hits {
+		if !hitAllowed(hit.ID, filter.Denied) {
+			continue
+		}
+		resp.Hits = append(resp.Hits, toAPIHit(hit.ID, hit.Score, hit.Fields, fields))
+	}
+	return resp, nil
+}
+
+// parseFieldsParam turns "title,url" into the list of API field names,
+// falling back to every stored field when the parameter is empty
+func parseFieldsParam(param string) ([]string, error) {
+	if strings.TrimSpace(param) == "" {
+		return defaultAPIFields, nil
+	}
+
+	var fields []string
+	for _, f := range strings.Split(param, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		if _, ok := storedFields[f]; !ok {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func toAPIHit(id string, score float64, stored map[string]interface{}, fields []string) APIHit {
+	hit := APIHit{ID: id, Score: score, Fields: map[string]interface{}{}}
+	// the ID is a path on the server, which clients have no use for
+	if relativeID, err := filepath.Rel(root, id); err == nil {
+		hit.ID = relativeID
+	}
+	for _, f := range fields {
+		v, ok := stored[storedFields[f]]
+		if !ok {
+			continue
+		}
+		if f == "tags" || f == "authors" {
+			v = storedTags(v)
+		}
+		if f == "url" {
+			if s, ok := v.(string); ok {
+				relativeURL, err := filepath.Rel(root, s)
+				if err != nil {
+					log.Printf("Error creating relative URL: %v", err)
+				} else {
+					v = relativeURL
+				}
+			}
+		}
+		hit.Fields[f] = v
+	}
+	return hit
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIHitIDsAreRelative(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	withIndex(t, map[string]string{"guides/pool.html": "Pooling"})
+
+	rec := serve(http.HandlerFunc(handleAPISearch), httptest.NewRequest(http.MethodGet, "/api/search?q=pooling&fields=url", nil))
+	var resp APISearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Hits) != 1 || resp.Hits[0].ID != "guides/pool.html" || resp.Hits[0].Fields["url"] != "guides/pool.html" {
+		t.Errorf("hits = %+v, want the path relative to the docs root", resp.Hits)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// apiSite knows the layout of pages a documentation generator writes
+type apiSite struct {
+	// chrome reports the navigation and page furniture left out of the text
+	chrome func(*html.Node) bool
+	// navigation reports pages that are only navigation, like the lists of
+	// a frameset, which aren't indexed at all
+	navigation func(*html.Node) bool
+	// symbols finds the name of the class or file the page documents and
+	// the names of its members
+	symbols func(*html.Node) (string, []string)
+}
+
+// apiSites are the generators whose pages get a structure-aware extraction
+var apiSites = map[string]apiSite{
+	"javadoc": {chrome: javadocChrome, navigation: javadocNavigation, symbols: javadocSymbols},
+	"doxygen": {chrome: doxygenChrome, navigation: hasFrameset, symbols: doxygenSymbols},
+}
+
+// generatorComment matches the comment both generators start their pages
+// with, like <!-- Generated by javadoc (1.8.0_292) -->
+var generatorComment = regexp.MustCompile(`(?i)^\s*Generated by (javadoc|doxygen)\b`)
+
+// detectSite tells which generator wrote doc from its generator meta tag or
+// comment, "" for other pages. Doxygen puts its comment in the body.
+func detectSite(doc *html.Node) string {
+	site := ""
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if site != "" {
+			return
+		}
+		switch {
+		case n.Type == html.CommentNode:
+			if m := generatorComment.FindStringSubmatch(n.Data); m != nil {
+				site = strings.ToLower(m[1])
+			}
+		case n.Type == html.ElementNode && n.Data == "meta" && strings.EqualFold(attr(n, "name"), "generator"):
+			generator := strings.ToLower(attr(n, "content"))
+			for name := range apiSites {
+				if strings.HasPrefix(generator, name) {
+					site = name
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return site
+}
+
+// removeNodes takes the elements below n that match out of the tree
+func removeNodes(n *html.Node, match func(*html.Node) bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && match(c) {
+			n.RemoveChild(c)
+		} else {
+			removeNodes(c, match)
+		}
+		c = next
+	}
+}
+
+func hasClass(n *html.Node, classes ...string) bool {
+	for _, class := range strings.Fields(attr(n, "class")) {
+		if contains(classes, class) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFrameset(doc *html.Node) bool {
+	return findElement(doc, "frameset") != nil
+}
+
+// findElements lists the elements below n that match, in order, without
+// looking inside those
+func findElements(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	var found []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && match(c) {
+			found = append(found, c)
+		} else {
+			found = append(found, findElements(c, match)...)
+		}
+	}
+	return found
+}
+
+// javadocChrome is the navigation bars of Javadoc, both the classic
+// layout (topNav, subNav, bottomNav) and the HTML5 one (header, nav,
+// footer)
+func javadocChrome(n *html.Node) bool {
+	switch n.Data {
+	case "nav", "header", "footer", "noscript", "script":
+		return true
+	}
+	return hasClass(n, "topNav", "subNav", "bottomNav", "skipNav", "navList", "top-nav", "sub-nav", "bottom-nav", "skip-nav", "flex-header", "legalCopy", "legal-copy")
+}
+
+// javadocNavigation is a frameset, or one of the class and package lists
+// shown in its frames
+func javadocNavigation(doc *html.Node) bool {
+	return hasFrameset(doc) || len(findElements(doc, func(n *html.Node) bool { return hasClass(n, "indexContainer", "index-container") })) > 0
+}
+
+// javadocTitleKind is the kind of type a Javadoc title starts with
+var javadocTitleKind = regexp.MustCompile(`^(?:Class|Interface|Enum|Enum Class|Record|Record Class|Annotation Type|Annotation Interface|Exception|Error|Package|Module)\s+`)
+
+// javadocSymbols is the type a class page documents, without type
+// parameters, and the members linked from its summary tables
+func javadocSymbols(doc *html.Node) (string, []string) {
+	var symbol string
+	if titles := findElements(doc, func(n *html.Node) bool { return (n.Data == "h1" || n.Data == "h2") && hasClass(n, "title") }); len(titles) > 0 {
+		symbol = strings.Join(strings.Fields(nodeText(titles[0])), " ")
+		symbol = javadocTitleKind.ReplaceAllString(symbol, "")
+		symbol, _, _ = strings.Cut(symbol, "<")
+	}
+	links := findElements(doc, func(n *html.Node) bool { return hasClass(n, "memberNameLink", "member-name-link") })
+	return strings.TrimSpace(symbol), symbolNames(links)
+}
+
+// doxygenChrome is Doxygen's title area and tabs, its tree view and search
+// box, the navigation path and the footer
+func doxygenChrome(n *html.Node) bool {
+	switch attr(n, "id") {
+	case "top", "titlearea", "main-nav", "nav-tree", "side-nav", "nav-path", "MSearchBox", "MSearchSelectWindow", "MSearchResultsWindow":
+		return true
+	}
+	if n.Data == "script" || n.Data == "noscript" {
+		return true
+	}
+	return hasClass(n, "tabs", "tabs2", "tabs3", "navpath", "footer", "ui-resizable-handle")
+}
+
+// doxygenTitleKind is the kind of page a Doxygen title ends with
+var doxygenTitleKind = regexp.MustCompile(`\s+(?:Class|Struct|Union|Interface|Protocol|Namespace|File|Module|Category|Exception)(?:\s+Template)?\s+Reference$`)
+
+// doxygenSymbols is what a reference page documents, without template
+// arguments, and the members listed in its member tables
+func doxygenSymbols(doc *html.Node) (string, []string) {
+	var symbol string
+	if titles := findElements(doc, func(n *html.Node) bool { return n.Data == "div" && hasClass(n, "title") }); len(titles) > 0 {
+		symbol = strings.Join(strings.Fields(nodeText(titles[0])), " ")
+		symbol = doxygenTitleKind.ReplaceAllString(symbol, "")
+		symbol, _, _ = strings.Cut(symbol, "<")
+	}
+	var links []*html.Node
+	for _, cell := range findElements(doc, func(n *html.Node) bool { return n.Data == "td" && hasClass(n, "memItemRight", "memTemplItemRight") }) {
+		// the first link is the member, the rest are types in its
+		// signature
+		if a := findElement(cell, "a"); a != nil && hasClass(a, "el") {
+			links = append(links, a)
+		}
+	}
+	return strings.TrimSpace(symbol), symbolNames(links)
+}
+
+// symbolNames is the text of each of nodes, once each
+func symbolNames(nodes []*html.Node) []string {
+	var names []string
+	for _, n := range nodes {
+		if name := strings.TrimSpace(nodeText(n)); name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const javadocClassPage = `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN">
+<!-- NewPage -->
+<html lang="en">
+<head>
+<!-- Generated by javadoc (1.8.0_292) on Mon May 03 2024 -->
+<title>HashMap (Java Platform SE 8 )</title>
+<script type="text/javascript">var methods = {"i0":10};</script>
+</head>
+<body>
+<div class="topNav"><a name="navbar.top"></a>
+<ul class="navList" title="Navigation">
+<li><a href="../../overview-summary.html">Overview</a></li>
+<li class="navBarCell1Rev">Class</li>
+<li><a href="package-tree.html">Tree</a></li>
+</ul>
+</div>
+<div class="subNav"><a href="../../allclasses-noframe.html">All Classes</a></div>
+<div class="header">
+<div class="subTitle">java.util</div>
+<h2 title="Class HashMap" class="title">Class HashMap&lt;K,V&gt;</h2>
+</div>
+<div class="contentContainer">
+<div class="block">Hash table based implementation of the Map interface.</div>
+<table class="memberSummary">
+<tr><td class="colLast"><code><span class="memberNameLink"><a href="#put-K-V-">put</a></span>(K key, V value)</code>
+<div class="block">Associates the specified value with the specified key in this map.</div></td></tr>
+<tr><td class="colLast"><code><span class="memberNameLink"><a href="#putIfAbsent-K-V-">putIfAbsent</a></span>(K key, V value)</code></td></tr>
+<tr><td class="colLast"><code><span class="memberNameLink"><a href="#put-K-V-">put</a></span>(K key, V value)</code></td></tr>
+</table>
+</div>
+<div class="bottomNav"><a href="../../overview-summary.html">Overview</a></div>
+<p class="legalCopy"><small>Copyright 1993, 2024, Oracle.</small></p>
+</body>
+</html>`
+
+const doxygenClassPage = `<!DOCTYPE html>
+<html><head>
+<meta name="generator" content="Doxygen 1.9.8"/>
+<title>Pool: net::Pool&lt; Conn &gt; Class Template Reference</title>
+<script type="text/javascript" src="jquery.js"></script>
+</head>
+<body>
+<div id="top">
+<div id="titlearea"><div id="projectname">Pool</div></div>
+<div id="main-nav"><ul><li><a href="index.html">Main Page</a></li><li><a href="annotated.html">Classes</a></li></ul></div>
+<div id="MSearchBox" class="MSearchBoxInactive"><input type="text" value="Search"/></div>
+</div>
+<div id="nav-path" class="navpath"><ul><li class="navelem"><a class="el" href="namespacenet.html">net</a></li></ul></div>
+<div class="header">
+<div class="headertitle"><div class="title">net::Pool&lt; Conn &gt; Class Template Reference</div></div>
+</div>
+<div class="contents">
+<p>Keeps a set of open connections ready for reuse.</p>
+<table class="memberdecls">
+<tr class="memitem:a1"><td class="memItemLeft" align="right" valign="top"><a class="el" href="classnet_1_1Conn.html">Conn</a> *</td>
+<td class="memItemRight" valign="bottom"><a class="el" href="classnet_1_1Pool.html#a1">acquire</a> (<a class="el" href="classnet_1_1Deadline.html">Deadline</a> d)</td></tr>
+<tr class="memitem:a2"><td class="memItemLeft" align="right" valign="top">void</td>
+<td class="memItemRight" valign="bottom"><a class="el" href="classnet_1_1Pool.html#a2">release</a> (<a class="el" href="classnet_1_1Conn.html">Conn</a> *c)</td></tr>
+</table>
+</div>
+<hr class="footer"/><address class="footer"><small>Generated by <a href="https://www.doxygen.org/index.html">doxygen</a> 1.9.8</small></address>
+</body>
+</html>`
+
+func TestDetectSite(t *testing.T) {
+	tests := []struct {
+		name, page, want string
+	}{
+		{"javadoc comment", javadocClassPage, "javadoc"},
+		{"javadoc meta", `<html><head><meta name="generator" content="javadoc/ClassWriterImpl"></head><body></body></html>`, "javadoc"},
+		{"doxygen", doxygenClassPage, "doxygen"},
+		{"doxygen comment", `<html><body><!-- Generated by Doxygen 1.8.17 --><p>Pools</p></body></html>`, "doxygen"},
+		{"plain", `<html><head><meta name="generator" content="Hugo 0.125"></head><body><!-- javadoc --><p>Pools</p></body></html>`, ""},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := detectSite(doc); got != tt.want {
+			t.Errorf("%s: detectSite = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractAPIPages(t *testing.T) {
+	page := extractPage(javadocClassPage)
+	if page.Symbol != "HashMap" || strings.Join(page.Members, ",") != "put,putIfAbsent" {
+		t.Errorf("javadoc symbol %q, members %q", page.Symbol, page.Members)
+	}
+	for _, chrome := range []string{"Overview", "All Classes", "Copyright", "var methods"} {
+		if strings.Contains(page.Content, chrome) {
+			t.Errorf("javadoc content has %q: %q", chrome, page.Content)
+		}
+	}
+	if !strings.Contains(page.Content, "Hash table based implementation") {
+		t.Errorf("javadoc content = %q", page.Content)
+	}
+
+	page = extractPage(doxygenClassPage)
+	if page.Symbol != "net::Pool" || strings.Join(page.Members, ",") != "acquire,release" {
+		t.Errorf("doxygen symbol %q, members %q", page.Symbol, page.Members)
+	}
+	for _, chrome := range []string{"Main Page", "Search", "Generated by"} {
+		if strings.Contains(page.Content, chrome) {
+			t.Errorf("doxygen content has %q: %q", chrome, page.Content)
+		}
+	}
+
+	frames := []string{
+		`<html><head><!-- Generated by javadoc (1.8.0_292) --></head><frameset cols="20%,80%"><frame src="overview-frame.html"></frameset></html>`,
+		`<html><head><!-- Generated by javadoc (1.8.0_292) --></head><body><div class="indexContainer"><ul><li><a href="HashMap.html">HashMap</a></li></ul></div></body></html>`,
+	}
+	for _, frame := range frames {
+		if page := extractPage(frame); !page.Navigation {
+			t.Errorf("not navigation: %s", frame)
+		}
+	}
+	if page := extractPage(`<html><body><div class="indexContainer">Pools</div></body></html>`); page.Navigation {
+		t.Error("a page that isn't Javadoc counts as navigation")
+	}
+}
+
+func TestAPIClassPageRanksFirst(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+
+	files := map[string]string{
+		"HashMap.html":          javadocClassPage,
+		"LinkedHashMap.html":    strings.NewReplacer("Class HashMap", "Class LinkedHashMap", "Hash table based implementation of the Map interface.", "Unlike HashMap, keeps entries in insertion order. See HashMap and HashMap.put for HashMap.").Replace(javadocClassPage),
+		"allclasses-frame.html": `<html><head><!-- Generated by javadoc (1.8.0_292) --></head><body><div class="indexContainer"><ul><li>HashMap</li><li>LinkedHashMap</li></ul></div></body></html>`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids, err := buildIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, id := range ids {
+		got = append(got, filepath.Base(id))
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "HashMap.html,LinkedHashMap.html" {
+		t.Errorf("indexed %v", got)
+	}
+
+	results, err := performSearch("hashmap", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].URL != "HashMap.html" {
+		t.Errorf("results = %+v, want HashMap.html first", results)
+	}
+}
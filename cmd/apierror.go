@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// APIError is the body of every failed /api/* response:
+//
+//	{"error": {"code": "bad_request", "message": "...", "request_id": "..."}}
+type APIError struct {
+	// Code is a stable, machine-readable name for the status, see errorCodes
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// RequestID is also sent in the X-Request-ID header, quote it when
+	// reporting a problem
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errorCodes are the statuses the API answers with and their codes
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusNotAcceptable:         "unsupported_version",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// writeError sends an error in the API envelope
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+	writeJSON(w, status, struct {
+		Error APIError `json:"error"`
+	}{APIError{Code: code, Message: message, RequestID: requestIDFrom(r.Context())}})
+}
+
+// isAPIRequest reports whether errors for r should use the API envelope
+// rather than plain text
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// handleAPINotFound answers /api/* paths without an endpoint, and methods an
+// endpoint doesn't support, which the mux would otherwise answer in plain
+// text
+func handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := http.DefaultServeMux.Handler(probe); pattern != "" && pattern != "/api/" {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, r, http.StatusMethodNotAllowed, r.Method+" is not supported here")
+		return
+	}
+	writeError(w, r, http.StatusNotFound, "no such endpoint: "+r.URL.Path)
+}
+
+type requestIDKey struct{}
+
+// validRequestID limits the request IDs taken from clients or proxies to
+// ones that are safe to log and echo
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID gives every request an ID, taken from its X-Request-ID
+// header when it has a valid one, and sends it back in the same header
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = randomString(16)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
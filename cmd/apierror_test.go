@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func decodeAPIError(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("content type = %q, want JSON", ct)
+	}
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Error
+}
+
+func TestAPIErrorEnvelope(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/count", nil)
+	rec := serve(withRequestID(http.HandlerFunc(handleAPICount)), r)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	got := decodeAPIError(t, rec)
+	want := APIError{Code: "bad_request", Message: "Missing q parameter", RequestID: rec.Header().Get("X-Request-ID")}
+	if got != want || want.RequestID == "" {
+		t.Errorf("error = %+v, want %+v", got, want)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		header string
+		kept   bool
+	}{
+		{"", false},
+		{"abc-123.def_4", true},
+		{"has spaces", false},
+		{"<script>", false},
+	}
+	for _, tt := range tests {
+		var seen string
+		h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = requestIDFrom(r.Context())
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/api/search", nil)
+		if tt.header != "" {
+			r.Header.Set("X-Request-ID", tt.header)
+		}
+		rec := serve(h, r)
+		id := rec.Header().Get("X-Request-ID")
+		if id == "" || id != seen {
+			t.Errorf("%q: header %q, context %q, want the same ID", tt.header, id, seen)
+		}
+		if (id == tt.header) != tt.kept {
+			t.Errorf("%q: got ID %q, kept = %v", tt.header, id, tt.kept)
+		}
+	}
+}
+
+func TestAPIErrorsFromMiddleware(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{Tokens: []AuthToken{{Name: "ci", Token: "t0k"}}}})
+
+	rec := serve(requireAuth(okHandler), httptest.NewRequest(http.MethodGet, "/api/search?q=x", nil))
+	if rec.Code != http.StatusUnauthorized || decodeAPIError(t, rec).Code != "unauthorized" {
+		t.Errorf("API request without credentials = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = serve(requireAuth(okHandler), httptest.NewRequest(http.MethodGet, "/search?q=x", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("Content-Type") == "application/json" {
+		t.Errorf("page request without credentials = %d %q, want plain text", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = serve(http.HandlerFunc(handleAPINotFound), httptest.NewRequest(http.MethodGet, "/api/nope", nil))
+	if rec.Code != http.StatusNotFound || decodeAPIError(t, rec).Code != "not_found" {
+		t.Errorf("unknown endpoint = %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// apiVersions are the supported versions of the JSON API, oldest first.
+// Breaking changes ship as a new version while the old ones keep working.
+var apiVersions = []string{"1"}
+
+// defaultAPIVersion serves unversioned /api/* paths, so clients written
+// before versioning keep the behaviour they were written against
+const defaultAPIVersion = "1"
+
+type apiVersionKey struct{}
+
+// versionAPI resolves the API version of /api/* requests. The version comes
+// from the path (/api/v1/search) or else the API-Version header, and is
+// echoed in the API-Version response header. Versioned paths are rewritten
+// to the unversioned routes, so handlers and middleware see one set of
+// paths and branch on apiVersionFrom where versions differ.
+func versionAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		version := r.Header.Get("API-Version")
+		rest := strings.TrimPrefix(r.URL.Path, "/api/")
+		if segment, path, _ := strings.Cut(rest, "/"); len(segment) > 1 && segment[0] == 'v' && isDigits(segment[1:]) {
+			if version != "" && version != segment[1:] {
+				writeError(w, r, http.StatusBadRequest, "API-Version header "+version+" contradicts the path version "+segment)
+				return
+			}
+			version = segment[1:]
+			r = r.Clone(r.Context())
+			r.URL.Path = "/api/" + path
+			r.URL.RawPath = ""
+		}
+		if version == "" {
+			version = defaultAPIVersion
+		}
+		if !contains(apiVersions, version) {
+			writeError(w, r, http.StatusNotAcceptable, "unsupported API version "+version+", use one of "+strings.Join(apiVersions, ", "))
+			return
+		}
+
+		w.Header().Set("API-Version", version)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+	})
+}
+
+// apiVersionFrom returns the API version of a request, the default one
+// outside the API
+func apiVersionFrom(ctx context.Context) string {
+	if v, ok := ctx.Value(apiVersionKey{}).(string); ok {
+		return v
+	}
+	return defaultAPIVersion
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionAPI(t *testing.T) {
+	var path, version string
+	h := versionAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, version = r.URL.Path, apiVersionFrom(r.Context())
+	}))
+
+	tests := []struct {
+		target, header string
+		status         int
+		path, version  string
+	}{
+		{"/api/v1/search?q=x", "", http.StatusOK, "/api/search", "1"},
+		{"/api/search?q=x", "", http.StatusOK, "/api/search", "1"},
+		{"/api/search?q=x", "1", http.StatusOK, "/api/search", "1"},
+		{"/api/v1/saved/abc", "1", http.StatusOK, "/api/saved/abc", "1"},
+		{"/api/v9/search?q=x", "", http.StatusNotAcceptable, "", ""},
+		{"/api/search?q=x", "9", http.StatusNotAcceptable, "", ""},
+		{"/api/v1/search?q=x", "2", http.StatusBadRequest, "", ""},
+		{"/search?q=x", "9", http.StatusOK, "/search", "1"},
+	}
+	for _, tt := range tests {
+		path, version = "", ""
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.header != "" {
+			r.Header.Set("API-Version", tt.header)
+		}
+		rec := serve(h, r)
+		if rec.Code != tt.status || path != tt.path || version != tt.version {
+			t.Errorf("%s (API-Version %q) = %d at %q version %q, want %d at %q version %q",
+				tt.target, tt.header, rec.Code, path, version, tt.status, tt.path, tt.version)
+		}
+		if rec.Code == http.StatusNotAcceptable && decodeAPIError(t, rec).Code != "unsupported_version" {
+			t.Errorf("%s: want an unsupported_version error", tt.target)
+		}
+		if tt.path != "" && tt.path != "/search" && rec.Header().Get("API-Version") != tt.version {
+			t.Errorf("%s: API-Version header = %q", tt.target, rec.Header().Get("API-Version"))
+		}
+	}
+}
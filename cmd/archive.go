@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// archived holds the snapshots opened so far, by name. They are opened
+// read-only on first use and stay open until the snapshot is replaced or
+// pruned.
+var archived = struct {
+	sync.Mutex
+	open map[string]openedSnapshot
+}{open: map[string]openedSnapshot{}}
+
+// openedSnapshot is an open snapshot and its directory as it was opened
+type openedSnapshot struct {
+	idx  bleve.Index
+	info os.FileInfo
+}
+
+// archiveIndex copies idx into the archive as today's snapshot, replacing
+// an earlier one from the same day, and prunes the oldest snapshots beyond
+// cfg.Keep
+func archiveIndex(idx bleve.Index, cfg ArchiveConfig, now time.Time) error {
+	copyable, ok := idx.(bleve.IndexCopyable)
+	if !ok {
+		return fmt.Errorf("index does not support copying")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := now.Format(time.DateOnly)
+	dest := filepath.Join(cfg.Dir, name)
+	tmp := dest + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := copyable.CopyTo(bleve.FileSystemDirectory(tmp)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return err
+	}
+
+	_, err := pruneSnapshots(cfg)
+	return err
+}
+
+// pruneSnapshots removes the oldest snapshots beyond cfg.Keep and returns
+// how many it removed
+func pruneSnapshots(cfg ArchiveConfig) (int, error) {
+	if cfg.Keep <= 0 {
+		return 0, nil
+	}
+	snapshots, err := archiveSnapshots(cfg.Dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for ; len(snapshots) > cfg.Keep; snapshots = snapshots[1:] {
+		archived.Lock()
+		if opened, ok := archived.open[snapshots[0]]; ok {
+			opened.idx.Close()
+			delete(archived.open, snapshots[0])
+		}
+		archived.Unlock()
+		if err := os.RemoveAll(filepath.Join(cfg.Dir, snapshots[0])); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// archiveSnapshots lists the snapshot names in dir, oldest first
+func archiveSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if _, err := time.Parse(time.DateOnly, e.Name()); err == nil && e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// snapshotAt finds the newest snapshot taken on or before date, so any day
+// can be asked for
+func snapshotAt(date string) (string, bool) {
+	if _, err := time.Parse(time.DateOnly, date); err != nil || config.Archive.Dir == "" {
+		return "", false
+	}
+	snapshots, err := archiveSnapshots(config.Archive.Dir)
+	if err != nil {
+		log.Printf("Error listing archived indexes: %v", err)
+		return "", false
+	}
+	// names sort like dates
+	i := sort.SearchStrings(snapshots, date)
+	if i < len(snapshots) && snapshots[i] == date {
+		return date, true
+	}
+	if i == 0 {
+		return "", false
+	}
+	return snapshots[i-1], true
+}
+
+// openSnapshot returns the archived index called name, opening it
+// read-only the first time. A later index run of the same day replaces the
+// snapshot's directory, and the new one is opened in place of the old.
+func openSnapshot(name string) (bleve.Index, error) {
+	dir := filepath.Join(config.Archive.Dir, name)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	archived.Lock()
+	defer archived.Unlock()
+	if opened, ok := archived.open[name]; ok {
+		if os.SameFile(opened.info, info) && opened.info.ModTime().Equal(info.ModTime()) {
+			return opened.idx, nil
+		}
+		opened.idx.Close()
+		delete(archived.open, name)
+	}
+	idx, err := openIndexUsing(dir, map[string]interface{}{"read_only": true})
+	if err != nil {
+		return nil, err
+	}
+	archived.open[name] = openedSnapshot{idx: idx, info: info}
+	return idx, nil
+}
+
+// archiveHit is a search result from a snapshot
+type archiveHit struct {
+	Title, Path, Snippet string
+}
+
+type archiveView struct {
+	Page
+	// Snapshots are listed newest first when no snapshot is picked
+	Snapshots []string
+	// Date is the day asked for, Snapshot the one searched
+	Date, Snapshot string
+	Query          string
+	Results        []archiveHit
+	Total          uint64
+}
+
+// handleArchive lists the snapshots that can be searched
+func handleArchive(w http.ResponseWriter, r *http.Request) {
+	view := archiveView{Page: newPage(r, "archive.title")}
+	if config.Archive.Dir != "" {
+		snapshots, err := archiveSnapshots(config.Archive.Dir)
+		if err != nil {
+			log.Printf("Error listing archived indexes: %v", err)
+			renderError(w, r, http.StatusInternalServerError)
+			return
+		}
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			view.Snapshots = append(view.Snapshots, snapshots[i])
+		}
+	}
+	renderTemplate(w, "archive.html", view)
+}
+
+// handleArchiveSearch runs a search against the index as it was on the
+// date in the path. Results only link to archived text, since the files
+// themselves may have changed or gone since.
+func handleArchiveSearch(w http.ResponseWriter, r *http.Request) {
+	date := r.PathValue("date")
+	name, ok := snapshotAt(date)
+	if !ok {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	idx, err := openSnapshot(name)
+	if err != nil {
+		log.Printf("Error opening archived index %s: %v", name, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	view := archiveView{Page: newPage(r, "archive.title"), Date: date, Snapshot: name, Query: r.URL.Query().Get("q")}
+	if view.Query != "" {
+		denied := deniedDocsets(r.Context())
+		searchRequest := bleve.NewSearchRequestOptions(restrictQuery(newTextQuery(view.Query), denied), view.Prefs.PerPage, 0, false)
+		searchRequest.Fields = []string{"Title", "Content"}
+		result, err := idx.Search(searchRequest)
+		if err != nil {
+			log.Printf("Error searching archived index %s for %q: %v", name, view.Query, err)
+			renderError(w, r, http.StatusInternalServerError)
+			return
+		}
+		view.Total = result.Total
+		for _, hit := range result.Hits {
+			rel, err := filepath.Rel(root, hit.ID)
+			if !hitAllowed(hit.ID, denied) || err != nil {
+				continue
+			}
+			h := archiveHit{Path: filepath.ToSlash(rel)}
+			h.Title, _ = hit.Fields["Title"].(string)
+			content, _ := hit.Fields["Content"].(string)
+			h.Snippet = truncate(strings.Join(strings.Fields(content), " "), 200)
+			view.Results = append(view.Results, h)
+		}
+	}
+	renderTemplate(w, "archive.html", view)
+}
+
+// handleArchiveDoc shows the text of a document as it was indexed in a
+// snapshot
+func handleArchiveDoc(w http.ResponseWriter, r *http.Request) {
+	name, ok := snapshotAt(r.PathValue("date"))
+	if !ok {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	idx, err := openSnapshot(name)
+	if err != nil {
+		log.Printf("Error opening archived index %s: %v", name, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	id := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(r.URL.Query().Get("path"), "/")))
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery([]string{id}), 1, 0, false)
+	searchRequest.Fields = []string{"Title", "Content", "Docset"}
+	result, err := idx.Search(searchRequest)
+	if err != nil {
+		log.Printf("Error reading archived document %s from %s: %v", id, name, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	if len(result.Hits) == 0 || !hitAllowed(id, deniedDocsets(r.Context())) {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	// the docset may have been restricted since
+	docset, _ := result.Hits[0].Fields["Docset"].(string)
+	if !canAccessDocset(r.Context(), docset) {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+
+	data := struct {
+		Page
+		Date, Snapshot, Path, Title, Content string
+		// Current is set when the document still exists
+		Current bool
+	}{Page: newPage(r, "archive.title"), Date: r.PathValue("date"), Snapshot: name, Path: r.URL.Query().Get("path")}
+	data.Title, _ = result.Hits[0].Fields["Title"].(string)
+	data.Content, _ = result.Hits[0].Fields["Content"].(string)
+	if _, err := os.Stat(id); err == nil {
+		data.Current = true
+	}
+	renderTemplate(w, "archive_doc.html", data)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestArchive(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := restrictedConfig
+	cfg.Archive = ArchiveConfig{Dir: filepath.Join(t.TempDir(), "archive"), Keep: 2}
+	withConfig(t, cfg)
+	withDocFiles(t, map[string]string{"guides/pool.html": "Pooling"})
+	t.Cleanup(func() {
+		archived.Lock()
+		defer archived.Unlock()
+		for name, opened := range archived.open {
+			opened.idx.Close()
+			delete(archived.open, name)
+		}
+	})
+
+	idx, err := bleve.New(filepath.Join(t.TempDir(), "index"), newIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	put := func(rel, title, content string) {
+		path := filepath.Join(root, rel)
+		if err := idx.Index(path, Document{Title: title, Content: content, URL: path, Docset: docsetFor(path)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 9, 0, 0, 0, time.UTC) }
+
+	put("guides/pool.html", "Pooling", "connections are pooled per host")
+	put("security/playbooks/incident.html", "Incidents", "page the pooled on-call")
+	for _, d := range []int{1, 5} {
+		if err := archiveIndex(idx, cfg.Archive, day(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("guides/pool.html", "Pooling", "connections are shared")
+	put("guides/retired.html", "Retired", "nothing pooled here any more")
+	if err := archiveIndex(idx, cfg.Archive, day(9)); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := archiveSnapshots(cfg.Archive.Dir)
+	if err != nil || strings.Join(snapshots, ",") != "2024-05-05,2024-05-09" {
+		t.Fatalf("snapshots = %q, %v, want the two newest", snapshots, err)
+	}
+	for date, want := range map[string]string{"2024-05-07": "2024-05-05", "2024-05-09": "2024-05-09", "2024-06-01": "2024-05-09", "2024-05-02": "", "May 7": ""} {
+		if got, _ := snapshotAt(date); got != want {
+			t.Errorf("snapshotAt(%q) = %q, want %q", date, got, want)
+		}
+	}
+
+	archiveGet := func(target, pattern string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.SetPathValue("date", strings.Split(target, "/")[2])
+		if pattern == "doc" {
+			return serve(http.HandlerFunc(handleArchiveDoc), req)
+		}
+		return serve(http.HandlerFunc(handleArchiveSearch), req)
+	}
+
+	// the 7th searches the snapshot of the 5th, before retired.html existed
+	rec := archiveGet("/archive/2024-05-07/search?q=pooled", "search")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "connections are pooled per host") || strings.Contains(body, "Retired") || strings.Contains(body, "Incidents") {
+		t.Errorf("archive search = %d %s", rec.Code, body)
+	}
+	if rec := archiveGet("/archive/2024-05-02/search?q=pooled", "search"); rec.Code != http.StatusNotFound {
+		t.Errorf("search before the first snapshot = %d, want 404", rec.Code)
+	}
+
+	rec = archiveGet("/archive/2024-05-07/doc?path=guides/pool.html", "doc")
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "connections are pooled per host") || !strings.Contains(body, `href="/guides/pool.html"`) {
+		t.Errorf("archived doc = %d %s", rec.Code, body)
+	}
+	for _, target := range []string{"/archive/2024-05-07/doc?path=security/playbooks/incident.html", "/archive/2024-05-07/doc?path=guides/retired.html"} {
+		if rec := archiveGet(target, "doc"); rec.Code != http.StatusNotFound {
+			t.Errorf("%s = %d, want 404", target, rec.Code)
+		}
+	}
+
+	rec = serve(http.HandlerFunc(handleArchive), httptest.NewRequest(http.MethodGet, "/archive", nil))
+	if body := rec.Body.String(); strings.Index(body, "2024-05-09") > strings.Index(body, "2024-05-05") {
+		t.Errorf("archive list isn't newest first: %s", body)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Archive.Dir, "2024-05-01")); !os.IsNotExist(err) {
+		t.Errorf("the oldest snapshot wasn't pruned: %v", err)
+	}
+
+	// another run on the 9th replaces the snapshot the server has open
+	if rec := archiveGet("/archive/2024-05-09/search?q=shared", "search"); !strings.Contains(rec.Body.String(), "connections are shared") {
+		t.Errorf("archive search = %d %s", rec.Code, rec.Body.String())
+	}
+	put("guides/pool.html", "Pooling", "connections are leased")
+	if err := archiveIndex(idx, cfg.Archive, day(9)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := archiveGet("/archive/2024-05-09/search?q=leased", "search"); !strings.Contains(rec.Body.String(), "connections are leased") {
+		t.Errorf("search of a replaced snapshot = %d %s", rec.Code, rec.Body.String())
+	}
+}
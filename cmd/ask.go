@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultAskSources and maxAskSources bound the passages an answer is
+	// written from
+	defaultAskSources = 5
+	maxAskSources     = 10
+	// maxPassage is how many characters of a document go in the prompt
+	maxPassage = 1500
+)
+
+var errNoLLM = errors.New("question answering is not configured")
+
+// askPrompt tells the model to answer from the sources only and cite them
+const askPrompt = `You answer questions about documentation using only the numbered sources given. ` +
+	`Cite the sources you use by their number in square brackets, like [1]. ` +
+	`If the sources don't contain the answer, say so instead of guessing.`
+
+// AskRequest is the body of POST /api/ask
+type AskRequest struct {
+	Question string `json:"question"`
+	// Size is how many documents the answer is written from
+	Size int `json:"size"`
+}
+
+// AskSource is a passage the answer was written from. N is the number the
+// answer cites it by.
+type AskSource struct {
+	N       int     `json:"n"`
+	Path    string  `json:"path"`
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Score   float64 `json:"score"`
+	Passage string  `json:"passage"`
+}
+
+// AskResponse is the answer to a question with the sources behind it
+type AskResponse struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	// Citations are the numbers of the sources the answer cites, in the
+	// order it first cites them
+	Citations []int       `json:"citations"`
+	Sources   []AskSource `json:"sources"`
+}
+
+// chatCompleter calls an OpenAI-compatible /chat/completions endpoint
+type chatCompleter struct {
+	url, model, key string
+	client          *http.Client
+}
+
+// currentLLM is the configured model, nil when /api/ask is off
+func currentLLM() *chatCompleter {
+	cfg := config.LLM
+	if cfg.URL == "" {
+		return nil
+	}
+	return &chatCompleter{
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/chat/completions",
+		model:  cfg.Model,
+		key:    cfg.APIKey,
+		client: &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Complete returns the model's reply to the system and user messages
+func (c *chatCompleter) Complete(ctx context.Context, system, user string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":       c.model,
+		"temperature": 0,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("language model returned %s", resp.Status)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", errors.New("language model returned no answer")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+// askSources finds the documents that best match question and takes the
+// passage of each that matches it best. Sections and examples count as
+// their page, so a page is only quoted once.
+func askSources(ctx context.Context, question string, filter searchFilter, size int) ([]AskSource, error) {
+	var resp APISearchResponse
+	var err error
+	if e := currentEmbedder(); e != nil {
+		resp, err = runHybridSearch(ctx, e, question, []string{"title"}, filter, size*2, defaultSemanticWeight)
+	} else {
+		resp, err = runAPISearch(question, []string{"title"}, filter, size*2)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []AskSource{}
+	seen := make(map[string]bool)
+	for _, hit := range resp.Hits {
+		rel, _, _ := strings.Cut(hit.ID, "#")
+		if seen[rel] || len(sources) == size {
+			continue
+		}
+		seen[rel] = true
+		content, err := readDoc(filepath.Join(root, rel))
+		if err != nil {
+			continue
+		}
+		passage := strings.Join(hitContext(string(content), question, 1).Paragraphs, "\n\n")
+		passage = truncate(passage, maxPassage)
+		title, _ := hit.Fields["title"].(string)
+		rel = filepath.ToSlash(rel)
+		sources = append(sources, AskSource{
+			N: len(sources) + 1, Path: rel, Title: title, URL: absoluteURL(rel), Score: hit.Score, Passage: passage,
+		})
+	}
+	return sources, nil
+}
+
+// askMessage is the user message: the numbered sources, then the question
+func askMessage(question string, sources []AskSource) string {
+	var sb strings.Builder
+	for _, s := range sources {
+		fmt.Fprintf(&sb, "[%d] %s (%s)\n%s\n\n", s.N, s.Title, s.Path, s.Passage)
+	}
+	sb.WriteString("Question: " + question)
+	return sb.String()
+}
+
+var citation = regexp.MustCompile(`\[(\d+)\]`)
+
+// citations lists the source numbers cited in answer, first citation
+// first, leaving out numbers that aren't sources
+func citations(answer string, sources int) []int {
+	cited := []int{}
+	seen := make(map[int]bool)
+	for _, m := range citation.FindAllStringSubmatch(answer, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 || n > sources || seen[n] {
+			continue
+		}
+		seen[n] = true
+		cited = append(cited, n)
+	}
+	return cited
+}
+
+// handleAsk answers a question from the documents that match it best,
+// with the passages the answer was written from
+func handleAsk(w http.ResponseWriter, r *http.Request) {
+	llm := currentLLM()
+	if llm == nil {
+		writeError(w, r, http.StatusServiceUnavailable, errNoLLM.Error())
+		return
+	}
+	var req AskRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	req.Question = strings.TrimSpace(req.Question)
+	if req.Question == "" {
+		writeError(w, r, http.StatusBadRequest, "question is required")
+		return
+	}
+	if req.Size == 0 {
+		req.Size = defaultAskSources
+	}
+	if req.Size < 1 || req.Size > maxAskSources {
+		writeError(w, r, http.StatusBadRequest, "size must be between 1 and "+strconv.Itoa(maxAskSources))
+		return
+	}
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sources, err := askSources(r.Context(), req.Question, filter, req.Size)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := AskResponse{Question: req.Question, Citations: []int{}, Sources: sources}
+	// without sources there's nothing to answer from, and the model
+	// shouldn't answer from what it remembers
+	if len(sources) == 0 {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	if resp.Answer, err = llm.Complete(r.Context(), askPrompt, askMessage(req.Question, sources)); err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	resp.Citations = citations(resp.Answer, len(sources))
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCitations(t *testing.T) {
+	got := citations("Rotate them yearly [2]. Old keys stay valid [1][2], see [7].", 3)
+	if len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Errorf("citations = %v, want [2 1]", got)
+	}
+}
+
+func TestHandleAsk(t *testing.T) {
+	var prompt string
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct{ Role, Content string } `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/v1/chat/completions" || len(req.Messages) != 2 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		prompt = req.Messages[1].Content
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": "Restart every node after rotating the keys [1]."}}},
+		})
+	}))
+	defer llm.Close()
+
+	dir := t.TempDir()
+	cfg := restrictedConfig
+	cfg.LLM = LLMConfig{URL: llm.URL + "/v1", Model: "m"}
+	cfg.BaseURL = "https://docs.example.com"
+	withConfig(t, cfg)
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	for rel, content := range map[string]string{
+		"guides/keys.html":             contextPage,
+		"security/playbooks/keys.html": `<title>Key leak</title><p>Rotating keys after a leak.</p>`,
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	ask := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleAsk(rec, httptest.NewRequest("POST", "/api/ask", strings.NewReader(body)))
+		return rec
+	}
+	rec := ask(`{"question": "does rotating the signing keys need a restart?"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp AskResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Sources) != 1 || resp.Sources[0].Path != "guides/keys.html" || resp.Sources[0].URL != "https://docs.example.com/guides/keys.html" {
+		t.Fatalf("sources = %+v, want only the guide", resp.Sources)
+	}
+	if len(resp.Citations) != 1 || resp.Citations[0] != 1 || !strings.Contains(resp.Answer, "Restart") {
+		t.Errorf("answer = %q, citations = %v", resp.Answer, resp.Citations)
+	}
+	if !strings.Contains(prompt, "[1] ") || !strings.Contains(prompt, "restart of every node") || strings.Contains(prompt, "leak") {
+		t.Errorf("prompt = %q", prompt)
+	}
+
+	for body, status := range map[string]int{`{"question": ""}`: 400, `{"question": "x", "size": 11}`: 400, `{`: 400} {
+		if rec := ask(body); rec.Code != status {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, status)
+		}
+	}
+	withConfig(t, Config{})
+	if rec := ask(`{"question": "x"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status without a model = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Name   string
+	Groups []string
+}
+
+func (p Principal) inAnyGroup(groups []string) bool {
+	for _, want := range groups {
+		for _, have := range p.Groups {
+			if want == have {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// principalFromContext returns the caller attached by requireAuth, if any
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Route groups, for making parts of the server public with auth enabled
+const (
+	routeRead  = "read"
+	routeWrite = "write"
+	routeAdmin = "admin"
+)
+
+// readRoutes are the pages and endpoints for reading docs and searching.
+// A route ending in "/" stands for every path under it.
+var readRoutes = []string{
+	"/_static/", "/widget.js", "/search", "/search/results", "/search/export", "/search/open",
+	"/feed.atom", "/sitemap.xml", "/browse", "/browse/dir", "/toc", "/related", "/archive", "/archive/",
+	"/badge/", "/s/", "/preferences", "/stats", "/mcp",
+	"/api/openapi.json", "/api/stats", "/api/search", "/api/msearch", "/api/count", "/api/terms", "/api/terms/df",
+	"/api/suggest", "/api/similar/", "/api/doc/", "/api/semantic", "/api/context/", "/api/ask",
+}
+
+func isReadRoute(p string) bool {
+	for _, route := range readRoutes {
+		if p == route || strings.HasSuffix(route, "/") && strings.HasPrefix(p, route) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeGroup sorts a request into a route group: admin endpoints, write
+// endpoints that keep per-user state or change tags and notes, and reading
+// docs and searching. Paths that are neither a listed route nor a document
+// under the docs root count as admin, so a new endpoint stays closed until
+// it's put in a group.
+func routeGroup(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/admin/"), strings.HasPrefix(r.URL.Path, "/admin/"), r.URL.Path == "/trust":
+		return routeAdmin
+	case strings.HasPrefix(r.URL.Path, "/api/alerts"), strings.HasPrefix(r.URL.Path, "/api/saved"),
+		r.URL.Path == "/api/share", r.URL.Path == "/search/saved",
+		r.URL.Path == "/api/links", r.URL.Path == "/search/link",
+		r.URL.Path == "/api/history", r.URL.Path == "/search/history/clear",
+		strings.HasPrefix(r.URL.Path, "/api/bookmarks"), r.URL.Path == "/bookmarks",
+		(strings.HasPrefix(r.URL.Path, "/api/tags/") || strings.HasPrefix(r.URL.Path, "/api/notes") || r.URL.Path == "/notes") &&
+			r.Method != http.MethodGet && r.Method != http.MethodHead,
+		r.URL.Path == "/tags":
+		return routeWrite
+	case isReadRoute(r.URL.Path),
+		strings.HasPrefix(r.URL.Path, "/api/tags/"), strings.HasPrefix(r.URL.Path, "/api/notes"), r.URL.Path == "/notes":
+		return routeRead
+	case !strings.HasPrefix(r.URL.Path, "/api/"):
+		if _, err := statDoc(filepath.Join(root, filepath.FromSlash(path.Clean("/"+r.URL.Path)))); err == nil {
+			return routeRead
+		}
+	}
+	return routeAdmin
+}
+
+// isPublic reports whether r may go through without credentials. Requests
+// that bring credentials are still checked, so members see their restricted
+// docsets on public routes too.
+func isPublic(r *http.Request) bool {
+	return r.Header.Get("Authorization") == "" && len(config.Auth.PublicRoutes) > 0 && contains(config.Auth.PublicRoutes, routeGroup(r))
+}
+
+func authEnabled() bool {
+	return len(config.Auth.Users) > 0 || len(config.Auth.Tokens) > 0 || oidcEnabled()
+}
+
+// requireAuth rejects requests without a valid session, basic auth
+// credentials or bearer token. /healthz and /readyz are always reachable so
+// probes work unauthenticated. Share links, public routes and badges go
+// through without a principal, i.e. with the access of an anonymous user. With OIDC
+// enabled, browsers are sent to the login page.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || (oidcEnabled() && strings.HasPrefix(r.URL.Path, "/auth/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, ok := authenticate(r)
+		if !ok && (sharedAccess(r) || isPublic(r) || strings.HasPrefix(r.URL.Path, "/badge/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !ok {
+			// every failed attempt costs a token so credentials can't be
+			// guessed at full speed on paths limitRate doesn't cover; the
+			// paths it covers have paid already
+			if limiter != nil && !rateLimited(r) {
+				if allowed, wait := limiter.allow(clientIP(r)); !allowed {
+					tooManyRequests(w, r, wait)
+					return
+				}
+			}
+
+			if oidcEnabled() && r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") &&
+				r.Header.Get("Authorization") == "" {
+				http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+
+			// only challenge for basic auth when it can actually succeed
+			if len(config.Auth.Users) > 0 {
+				realm := config.Auth.Realm
+				if realm == "" {
+					realm = "GoDocHive"
+				}
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			}
+			if isAPIRequest(r) {
+				writeError(w, r, http.StatusUnauthorized, "authentication required")
+			} else {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, p)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func authenticate(r *http.Request) (Principal, bool) {
+	if s, ok := sessionFromRequest(r); ok {
+		return Principal{Name: s.Name, Groups: s.Groups}, true
+	}
+
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token := strings.TrimPrefix(header, "Bearer ")
+		for _, t := range config.Auth.Tokens {
+			if t.Token != "" && secureEqual(token, t.Token) {
+				return Principal{Name: t.Name, Groups: t.Groups}, true
+			}
+		}
+		return Principal{}, false
+	}
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return Principal{}, false
+	}
+	for _, u := range config.Auth.Users {
+		if secureEqual(name, u.Name) && secureEqual(password, u.Password) {
+			return Principal{Name: u.Name, Groups: u.Groups}, true
+		}
+	}
+	return Principal{}, false
+}
+
+// isAdmin reports whether the caller may use the admin endpoints. They need
+// auth to be enabled and the caller to be in one of auth.admin_groups.
+func isAdmin(ctx context.Context) bool {
+	p, ok := principalFromContext(ctx)
+	return ok && authEnabled() && p.inAnyGroup(config.Auth.AdminGroups)
+}
+
+// requireAdmin guards an admin endpoint
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r.Context()) {
+			writeError(w, r, http.StatusForbidden, "admin access required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withConfig swaps the global config for the duration of a test
+func withConfig(t *testing.T, cfg Config) {
+	t.Helper()
+	old := config
+	config = cfg
+	t.Cleanup(func() { config = old })
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestRequireAuth(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{
+		Users:  []AuthUser{{Name: "alice", Password: "s3cret"}},
+		Tokens: []AuthToken{{Name: "ci", Token: "tok"}},
+	}})
+	h := requireAuth(okHandler)
+
+	basic := func(user, pass string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/search", nil)
+		r.SetBasicAuth(user, pass)
+		return r
+	}
+	bearer := func(token string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/search", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"no credentials", httptest.NewRequest(http.MethodGet, "/search", nil), http.StatusUnauthorized},
+		{"raw files", httptest.NewRequest(http.MethodGet, "/guide/index.html", nil), http.StatusUnauthorized},
+		{"healthz", httptest.NewRequest(http.MethodGet, "/healthz", nil), http.StatusOK},
+		{"readyz", httptest.NewRequest(http.MethodGet, "/readyz", nil), http.StatusOK},
+		{"valid basic", basic("alice", "s3cret"), http.StatusOK},
+		{"wrong password", basic("alice", "nope"), http.StatusUnauthorized},
+		{"valid bearer", bearer("tok"), http.StatusOK},
+		{"wrong bearer", bearer("other"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestPublicRoutes(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{
+		Users:        []AuthUser{{Name: "alice", Password: "s3cret"}},
+		PublicRoutes: []string{routeRead},
+	}})
+	dir := t.TempDir()
+	withRoot(t, dir)
+	if err := os.MkdirAll(filepath.Join(dir, "guides"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "guides", "start.html"), []byte("<p>Start</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var sawPrincipal bool
+	h := requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, sawPrincipal = principalFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		method, path string
+		user, pass   string
+		want         int
+		principal    bool
+	}{
+		{http.MethodGet, "/search?q=x", "", "", http.StatusOK, false},
+		{http.MethodGet, "/guides/start.html", "", "", http.StatusOK, false},
+		{http.MethodGet, "/api/search?q=x", "", "", http.StatusOK, false},
+		{http.MethodGet, "/api/suggest?q=po", "", "", http.StatusOK, false},
+		{http.MethodGet, "/guides/missing.html", "", "", http.StatusUnauthorized, false},
+		{http.MethodGet, "/api/unknown", "", "", http.StatusUnauthorized, false},
+		{http.MethodGet, "/search?q=x", "alice", "s3cret", http.StatusOK, true},
+		{http.MethodGet, "/search?q=x", "alice", "nope", http.StatusUnauthorized, false},
+		{http.MethodGet, "/api/alerts", "", "", http.StatusUnauthorized, false},
+		{http.MethodPost, "/api/alerts", "", "", http.StatusUnauthorized, false},
+		{http.MethodPost, "/api/share", "", "", http.StatusUnauthorized, false},
+		{http.MethodGet, "/api/admin/usage", "", "", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		sawPrincipal = false
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		if rec := serve(h, r); rec.Code != tt.want || sawPrincipal != tt.principal {
+			t.Errorf("%s %s as %q = %d with principal %v, want %d and %v", tt.method, tt.path, tt.user, rec.Code, sawPrincipal, tt.want, tt.principal)
+		}
+	}
+}
+
+func TestPublicRoutesConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for body, ok := range map[string]bool{
+		`{"auth": {"public_routes": ["read"]}}`:          true,
+		`{"auth": {"public_routes": ["read", "write"]}}`: true,
+		`{"auth": {"public_routes": ["admin"]}}`:         false,
+		`{"auth": {"public_routes": ["search"]}}`:        false,
+	} {
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(path); (err == nil) != ok {
+			t.Errorf("loadConfig(%s) error = %v, want ok = %v", body, err, ok)
+		}
+	}
+}
+
+func TestRequireAuthEmptyTokenNeverMatches(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{Tokens: []AuthToken{{Name: "blank"}}}})
+
+	r := httptest.NewRequest(http.MethodGet, "/search", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	if rec := serve(requireAuth(okHandler), r); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{
+		Tokens: []AuthToken{
+			{Name: "ops", Token: "ops-tok", Groups: []string{"admins"}},
+			{Name: "ci", Token: "ci-tok", Groups: []string{"builders"}},
+		},
+		AdminGroups: []string{"admins"},
+	}})
+	h := requireAuth(requireAdmin(okHandler))
+
+	for token, want := range map[string]int{"ops-tok": http.StatusOK, "ci-tok": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodPost, "/api/admin/optimize", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if rec := serve(h, r); rec.Code != want {
+			t.Errorf("token %s: status = %d, want %d", token, rec.Code, want)
+		}
+	}
+
+	// without auth there is no way to tell admins apart
+	withConfig(t, Config{})
+	r := httptest.NewRequest(http.MethodPost, "/api/admin/optimize", nil)
+	if rec := serve(requireAdmin(okHandler), r); rec.Code != http.StatusForbidden {
+		t.Errorf("unauthenticated: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
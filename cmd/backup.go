@@ -0,0 +1,351 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+// backupVersion is bumped when the layout of a backup archive changes
+const backupVersion = 1
+
+// Entries of a backup archive, a gzipped tar. The manifest comes first.
+const (
+	backupManifestEntry = "backup.json"
+	backupIndexDir      = "index/"
+	backupDatabaseEntry = "godochive.db"
+)
+
+// backupManifest describes what a backup holds
+type backupManifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Root is the docs directory the index was built from. Documents are
+	// indexed by their path, so a backup only fits the same directory.
+	Root      string `json:"root"`
+	Documents uint64 `json:"documents"`
+	// Database is set when the backup holds the tags, bookmarks and the
+	// rest of the server-side data
+	Database bool `json:"database"`
+}
+
+// writeBackup writes a copy of idx and, unless it is nil, of db to w.
+// Both are copied consistently while they stay usable.
+func writeBackup(w io.Writer, idx bleve.Index, db *bolt.DB, now time.Time) error {
+	copyable, ok := idx.(bleve.IndexCopyable)
+	if !ok {
+		return fmt.Errorf("index does not support copying")
+	}
+	tmp, err := os.MkdirTemp("", "godochive-backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	snapshot := filepath.Join(tmp, "index")
+	if err := copyable.CopyTo(bleve.FileSystemDirectory(snapshot)); err != nil {
+		return err
+	}
+	count, err := idx.DocCount()
+	if err != nil {
+		return err
+	}
+	docsRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	manifest, err := json.MarshalIndent(backupManifest{
+		Version: backupVersion, Created: now.UTC(), Root: docsRoot, Documents: count, Database: db != nil,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, backupManifestEntry, int64(len(manifest)), now, strings.NewReader(string(manifest))); err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(snapshot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(snapshot, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return writeTarEntry(tw, backupIndexDir+filepath.ToSlash(rel), info.Size(), info.ModTime(), f)
+	})
+	if err != nil {
+		return err
+	}
+
+	if db != nil {
+		err := db.View(func(tx *bolt.Tx) error {
+			if err := tw.WriteHeader(&tar.Header{Name: backupDatabaseEntry, Mode: 0o600, Size: tx.Size(), ModTime: now}); err != nil {
+				return err
+			}
+			_, err := tx.WriteTo(tw)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: size, ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// extractBackup unpacks a backup written by writeBackup, the index into
+// the directory indexDir and the database, if the backup has one, into the
+// file dbFile. Neither may exist yet.
+func extractBackup(r io.Reader, indexDir, dbFile string) (backupManifest, error) {
+	var manifest backupManifest
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, fmt.Errorf("not a backup: %w", err)
+	}
+	tr := tar.NewReader(zr)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupManifestEntry {
+		return manifest, errors.New("not a backup: the manifest is missing")
+	}
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("reading the manifest: %w", err)
+	}
+	if manifest.Version != backupVersion {
+		return manifest, fmt.Errorf("backup version %d is not supported, only %d", manifest.Version, backupVersion)
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return manifest, fmt.Errorf("unexpected entry %s", hdr.Name)
+		}
+		var dest string
+		switch rel, inIndex := strings.CutPrefix(hdr.Name, backupIndexDir); {
+		case hdr.Name == backupDatabaseEntry && manifest.Database:
+			dest = dbFile
+		case inIndex && filepath.IsLocal(rel):
+			dest = filepath.Join(indexDir, filepath.FromSlash(rel))
+		default:
+			return manifest, fmt.Errorf("unexpected entry %s", hdr.Name)
+		}
+		if err := extractFile(tr, dest); err != nil {
+			return manifest, err
+		}
+	}
+	if _, err := os.Stat(indexDir); err != nil {
+		return manifest, errors.New("the backup holds no index")
+	}
+	if _, err := os.Stat(dbFile); manifest.Database && err != nil {
+		return manifest, errors.New("the backup is missing its database")
+	}
+	return manifest, nil
+}
+
+func extractFile(r io.Reader, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runBackup is the "backup" command. Like optimize it needs the server to
+// be stopped, since only one process can hold the index open.
+func runBackup(args []string) error {
+	fs, opts := newFlagSet("backup", "[flags] <file>", true)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := opts.apply(); err != nil {
+		return err
+	}
+
+	idx, err := openIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+	// a missing database is left out rather than created empty
+	var db *bolt.DB
+	if _, err := os.Stat(opts.dbPath); err == nil {
+		if db, err = openStore(opts.dbPath); err != nil {
+			return fmt.Errorf("opening database: %w", err)
+		}
+		defer db.Close()
+	}
+
+	file := fs.Arg(0)
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := writeBackup(f, idx, db, time.Now()); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	count, _ := idx.DocCount()
+	fmt.Printf("Saved %d documents to %s\n", count, file)
+	return nil
+}
+
+// runRestore is the "restore" command. The backup is unpacked and checked
+// next to the current index and database, which are only replaced once it
+// is known to be complete.
+func runRestore(args []string) error {
+	fs, opts := newFlagSet("restore", "[flags] <file>", true)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := opts.apply(); err != nil {
+		return err
+	}
+
+	// holding the database keeps a server from starting meanwhile, and
+	// fails if one is running
+	db, err := openStore(opts.dbPath)
+	if err != nil {
+		return fmt.Errorf("opening database, is the server still running? %w", err)
+	}
+	defer db.Close()
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tmpIndex, tmpDB := indexPath+".restore", opts.dbPath+".restore"
+	for _, path := range []string{tmpIndex, tmpDB} {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		defer os.RemoveAll(path)
+	}
+	manifest, err := extractBackup(f, tmpIndex, tmpDB)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", fs.Arg(0), err)
+	}
+	docsRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if manifest.Root != docsRoot {
+		return fmt.Errorf("the backup is of the docs in %s, run restore with -path %s or rebuild the index instead", manifest.Root, manifest.Root)
+	}
+
+	idx, err := openIndexUsing(tmpIndex, nil)
+	if err != nil {
+		return fmt.Errorf("the backup's index is unreadable: %w", err)
+	}
+	count, err := idx.DocCount()
+	idx.Close()
+	if err != nil || count != manifest.Documents {
+		return fmt.Errorf("the backup's index has %d documents, want %d", count, manifest.Documents)
+	}
+
+	restoredDB := ""
+	if manifest.Database {
+		restoredDB = tmpDB
+	}
+	if err := swapRestored(indexPath, tmpIndex, opts.dbPath, restoredDB, db.Close); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d documents from the backup of %s\n", manifest.Documents, manifest.Created.Local().Format(time.DateTime))
+	return refreshStandby()
+}
+
+// swapRestored moves the restored index at tmpIndex to indexDir and then,
+// unless tmpDB is empty, the restored database to dbPath after closeDB
+// closed the current one. The existing index is kept aside until both are
+// in place, so when the database can't be swapped it's put back and the
+// index and database still match.
+func swapRestored(indexDir, tmpIndex, dbPath, tmpDB string, closeDB func() error) error {
+	oldIndex := indexDir + ".old"
+	if err := os.RemoveAll(oldIndex); err != nil {
+		return err
+	}
+	if err := os.Rename(indexDir, oldIndex); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("moving the existing index aside: %w", err)
+	}
+	rollback := func() {
+		os.RemoveAll(indexDir)
+		os.Rename(oldIndex, indexDir)
+	}
+	if err := os.Rename(tmpIndex, indexDir); err != nil {
+		rollback()
+		return err
+	}
+	if tmpDB != "" {
+		err := closeDB()
+		if err == nil {
+			err = os.Rename(tmpDB, dbPath)
+		}
+		if err != nil {
+			rollback()
+			return fmt.Errorf("restoring the database, the index was left as it was: %w", err)
+		}
+	}
+	if err := os.RemoveAll(oldIndex); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting the old index at %s: %v\n", oldIndex, err)
+	}
+	return nil
+}
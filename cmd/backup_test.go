@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestBackupRoundTrip(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	withStore(t)
+
+	idx, err := bleve.New(filepath.Join(t.TempDir(), "index"), newIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	path := filepath.Join(root, "guides/pool.html")
+	if err := idx.Index(path, Document{Title: "Pooling", Content: "connections are pooled per host", URL: path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storePut(tagsBucket, "guides/pool.html", []string{"networking"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	if err := writeBackup(&buf, idx, store, now); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	indexDir, dbFile := filepath.Join(dir, "index"), filepath.Join(dir, "test.db")
+	manifest, err := extractBackup(bytes.NewReader(buf.Bytes()), indexDir, dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Root != root || manifest.Documents != 1 || !manifest.Database || !manifest.Created.Equal(now) {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	restored, err := bleve.Open(indexDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	res, err := restored.Search(bleve.NewSearchRequest(bleve.NewMatchQuery("pooled")))
+	if err != nil || res.Total != 1 || res.Hits[0].ID != path {
+		t.Errorf("search of the restored index = %v, %v", res, err)
+	}
+	db, err := openStore(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store = db
+	var tags []string
+	if ok, err := storeGet(tagsBucket, "guides/pool.html", &tags); !ok || err != nil || len(tags) != 1 || tags[0] != "networking" {
+		t.Errorf("restored tags = %v, %v, %v", tags, ok, err)
+	}
+}
+
+func TestExtractBackupRejects(t *testing.T) {
+	archive := func(entries map[string]string, order ...string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		for _, name := range order {
+			if err := writeTarEntry(tw, name, int64(len(entries[name])), time.Now(), strings.NewReader(entries[name])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tw.Close()
+		zw.Close()
+		return &buf
+	}
+	manifest := `{"version": 1, "root": "/docs", "documents": 0}`
+
+	tests := map[string]*bytes.Buffer{
+		"not gzip":         bytes.NewBufferString("index.bleve"),
+		"no manifest":      archive(map[string]string{"index/index_meta.json": "{}"}, "index/index_meta.json"),
+		"newer version":    archive(map[string]string{backupManifestEntry: `{"version": 2}`}, backupManifestEntry),
+		"outside the root": archive(map[string]string{backupManifestEntry: manifest, "index/../../evil": "x"}, backupManifestEntry, "index/../../evil"),
+		"unlisted db":      archive(map[string]string{backupManifestEntry: manifest, backupDatabaseEntry: "x"}, backupManifestEntry, backupDatabaseEntry),
+		"no index":         archive(map[string]string{backupManifestEntry: manifest}, backupManifestEntry),
+	}
+	for name, r := range tests {
+		dir := t.TempDir()
+		if _, err := extractBackup(r, filepath.Join(dir, "index"), filepath.Join(dir, "test.db")); err == nil {
+			t.Errorf("%s: extracted without an error", name)
+		}
+	}
+}
+
+func TestSwapRestored(t *testing.T) {
+	dir := t.TempDir()
+	indexDir, tmpIndex := filepath.Join(dir, "index.bleve"), filepath.Join(dir, "index.bleve.restore")
+	dbPath, tmpDB := filepath.Join(dir, "test.db"), filepath.Join(dir, "test.db.restore")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(path string) string {
+		content, _ := os.ReadFile(path)
+		return string(content)
+	}
+	write(filepath.Join(indexDir, "meta"), "old")
+	write(filepath.Join(tmpIndex, "meta"), "restored")
+	write(dbPath, "old")
+	write(tmpDB, "restored")
+
+	// a database that can't be closed leaves the old index in place
+	err := swapRestored(indexDir, tmpIndex, dbPath, tmpDB, func() error { return errors.New("busy") })
+	if err == nil || read(filepath.Join(indexDir, "meta")) != "old" || read(dbPath) != "old" {
+		t.Fatalf("failed swap = %v, index %q, database %q, want both old", err, read(filepath.Join(indexDir, "meta")), read(dbPath))
+	}
+
+	write(filepath.Join(tmpIndex, "meta"), "restored")
+	if err := swapRestored(indexDir, tmpIndex, dbPath, tmpDB, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if read(filepath.Join(indexDir, "meta")) != "restored" || read(dbPath) != "restored" {
+		t.Errorf("index %q, database %q, want both restored", read(filepath.Join(indexDir, "meta")), read(dbPath))
+	}
+	if _, err := os.Stat(indexDir + ".old"); !os.IsNotExist(err) {
+		t.Errorf("the old index is still there: %v", err)
+	}
+}
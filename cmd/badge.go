@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// badge colors, as used by shields.io
+const (
+	badgeBlue   = "#007ec6"
+	badgeGreen  = "#4c1"
+	badgeYellow = "#dfb317"
+	badgeGrey   = "#9f9f9f"
+)
+
+// badgeMetrics are the values a badge can show
+var badgeMetrics = []string{"docs", "updated"}
+
+// handleBadge renders a shields-style SVG badge for a docset, for teams to
+// embed in their READMEs: /badge/platform.svg shows how many documents are
+// indexed, /badge/platform.svg?metric=updated when the newest one changed.
+// label= replaces the text on the left. Badges are reachable without a
+// login, so restricted docsets only have one for members.
+func handleBadge(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("name"), ".svg")
+	if !ok || !canAccessDocset(r.Context(), name) || !docsetConfigured(name) {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "docs"
+	}
+	if !contains(badgeMetrics, metric) {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	tq := bleve.NewTermQuery(name)
+	tq.SetField("Docset")
+	searchRequest := bleve.NewSearchRequestOptions(pagesOnly(tq), 1, 0, false)
+	searchRequest.Fields = []string{"ModifiedAt"}
+	searchRequest.SortBy([]string{"-ModifiedAt"})
+	result, err := index.Search(searchRequest)
+	if err != nil {
+		log.Printf("Error rendering badge for %q: %v", name, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	label, value, color := "docs", strconv.FormatUint(result.Total, 10), badgeBlue
+	if metric == "updated" {
+		label, value, color = "updated", "never", badgeGrey
+		if len(result.Hits) > 0 {
+			s, _ := result.Hits[0].Fields["ModifiedAt"].(string)
+			if modified, err := time.Parse(time.RFC3339, s); err == nil {
+				value, color = modified.Format(time.DateOnly), freshnessColor(time.Since(modified))
+			}
+		}
+	}
+	if l := r.URL.Query().Get("label"); l != "" {
+		label = l
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	// image proxies such as GitHub's camo honour this
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	fmt.Fprint(w, renderBadge(label, value, color))
+}
+
+func docsetConfigured(name string) bool {
+	for _, ds := range config.Docsets {
+		if ds.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// freshnessColor is green for docs changed within a month, yellow within
+// half a year and grey beyond
+func freshnessColor(age time.Duration) string {
+	switch {
+	case age < 30*24*time.Hour:
+		return badgeGreen
+	case age < 180*24*time.Hour:
+		return badgeYellow
+	default:
+		return badgeGrey
+	}
+}
+
+// renderBadge draws a flat two-part badge. Text widths are estimated at 7px
+// a character, close enough for the 11px Verdana badges are set in.
+func renderBadge(label, value, color string) string {
+	lw := 7*utf8.RuneCountInString(label) + 10
+	vw := 7*utf8.RuneCountInString(value) + 10
+	label, value = html.EscapeString(label), html.EscapeString(value)
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">
+<title>%[4]s: %[5]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="%[2]d" height="20" fill="#555"/>
+<rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/>
+<rect width="%[1]d" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text>
+<text x="%[7]d" y="14">%[4]s</text>
+<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[5]s</text>
+<text x="%[8]d" y="14">%[5]s</text>
+</g>
+</svg>
+`, lw+vw, lw, vw, label, value, color, lw/2, lw+vw/2)
+}
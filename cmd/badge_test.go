@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBadge(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, restrictedConfig)
+	withRoot(t, "/docs")
+	idx := withEmptyIndex(t)
+
+	modified := time.Now().AddDate(0, 0, -3).UTC()
+	for _, rel := range []string{"guides/a.html", "guides/b.html", "security/playbooks/c.html"} {
+		path := filepath.Join(root, rel)
+		doc := Document{Title: rel, URL: path, Docset: docsetFor(path), ModifiedAt: modified}
+		if err := idx.Index(path, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	badge := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.SetPathValue("name", strings.TrimPrefix(req.URL.Path, "/badge/"))
+		return serve(http.HandlerFunc(handleBadge), req)
+	}
+
+	rec := badge("/badge/guides.svg")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" || !strings.Contains(rec.Body.String(), "docs: 2") {
+		t.Fatalf("docs badge = %d %q", rec.Code, rec.Body.String())
+	}
+	rec = badge("/badge/guides.svg?metric=updated&label=<b>")
+	if body := rec.Body.String(); !strings.Contains(body, "&lt;b&gt;: "+modified.Format(time.DateOnly)) || !strings.Contains(body, badgeGreen) {
+		t.Errorf("updated badge = %q", body)
+	}
+
+	for target, want := range map[string]int{
+		"/badge/security-playbooks.svg": http.StatusNotFound,
+		"/badge/unknown.svg":            http.StatusNotFound,
+		"/badge/guides.png":             http.StatusNotFound,
+		"/badge/guides.svg?metric=age":  http.StatusBadRequest,
+	} {
+		if rec := badge(target); rec.Code != want {
+			t.Errorf("%s = %d, want %d", target, rec.Code, want)
+		}
+	}
+}
+
+func TestBadgeSkipsLogin(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{Users: []AuthUser{{Name: "alice", Password: "s3cret"}}}})
+
+	if rec := serve(requireAuth(okHandler), httptest.NewRequest(http.MethodGet, "/badge/guides.svg", nil)); rec.Code != http.StatusOK {
+		t.Errorf("badge = %d, want it reachable without a login", rec.Code)
+	}
+}
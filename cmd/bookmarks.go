@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const bookmarksBucket = "bookmarks"
+
+// maxBookmarks caps the reading list of a user
+const maxBookmarks = 500
+
+// Bookmark is a document on a user's reading list
+type Bookmark struct {
+	// URL is the document path below the root, like Document.URL, with the
+	// anchor of an example when one was bookmarked
+	URL   string    `json:"url"`
+	Title string    `json:"title"`
+	Added time.Time `json:"added"`
+}
+
+// bookmarksOf returns the bookmarks of owner, newest first
+func bookmarksOf(owner string) ([]Bookmark, error) {
+	bookmarks := []Bookmark{}
+	if store == nil || owner == "" {
+		return bookmarks, nil
+	}
+	_, err := storeGet(bookmarksBucket, owner, &bookmarks)
+	return bookmarks, err
+}
+
+// visibleBookmarks drops the bookmarks of documents the request can no
+// longer read, e.g. after a docset was restricted
+func visibleBookmarks(r *http.Request, bookmarks []Bookmark) []Bookmark {
+	visible := []Bookmark{}
+	for _, b := range bookmarks {
+		file, _, _ := strings.Cut(b.URL, "#")
+		if canAccessPath(r.Context(), filepath.Join(root, file)) {
+			visible = append(visible, b)
+		}
+	}
+	return visible
+}
+
+// bookmarkedOf is the set of URLs the visitor of r has bookmarked
+func bookmarkedOf(r *http.Request) map[string]bool {
+	owner, _ := visitorKey(r)
+	bookmarks, err := bookmarksOf(owner)
+	if err != nil {
+		log.Printf("Error loading bookmarks: %v", err)
+	}
+	urls := make(map[string]bool, len(bookmarks))
+	for _, b := range bookmarks {
+		urls[b.URL] = true
+	}
+	return urls
+}
+
+var errNotBookmarkable = errors.New("url must be the path of a document, like /guides/start.html")
+
+// bookmarkURL checks that raw names a document the request can read and
+// returns it in the form of Document.URL
+func bookmarkURL(r *http.Request, raw string) (string, error) {
+	file, anchor, _ := strings.Cut(strings.TrimPrefix(raw, "/"), "#")
+	if file == "" || path.Clean("/"+file) != "/"+file {
+		return "", errNotBookmarkable
+	}
+	full := filepath.Join(root, filepath.FromSlash(file))
+	if info, err := statDoc(full); err != nil || info.IsDir() || !canAccessPath(r.Context(), full) {
+		return "", errNotBookmarkable
+	}
+	if anchor != "" {
+		return file + "#" + anchor, nil
+	}
+	return file, nil
+}
+
+var errTooManyBookmarks = fmt.Errorf("too many bookmarks (max %d), remove some first", maxBookmarks)
+
+// addBookmark puts b at the front of owner's bookmarks, replacing an
+// existing bookmark of the same URL
+func addBookmark(owner string, b Bookmark) error {
+	bookmarks, err := bookmarksOf(owner)
+	if err != nil {
+		return err
+	}
+	updated := []Bookmark{b}
+	for _, existing := range bookmarks {
+		if existing.URL != b.URL {
+			updated = append(updated, existing)
+		}
+	}
+	if len(updated) > maxBookmarks {
+		return errTooManyBookmarks
+	}
+	return storePut(bookmarksBucket, owner, updated)
+}
+
+// removeBookmark removes the bookmark of url and reports whether there was
+// one
+func removeBookmark(owner, url string) (bool, error) {
+	bookmarks, err := bookmarksOf(owner)
+	if err != nil {
+		return false, err
+	}
+	kept := []Bookmark{}
+	for _, b := range bookmarks {
+		if b.URL != url {
+			kept = append(kept, b)
+		}
+	}
+	if len(kept) == len(bookmarks) {
+		return false, nil
+	}
+	return true, storePut(bookmarksBucket, owner, kept)
+}
+
+func newBookmark(url, title string) Bookmark {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = path.Base(url)
+	}
+	return Bookmark{URL: url, Title: title, Added: time.Now().UTC()}
+}
+
+func handleListBookmarks(w http.ResponseWriter, r *http.Request) {
+	owner, _ := visitorKey(r)
+	bookmarks, err := bookmarksOf(owner)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, visibleBookmarks(r, bookmarks))
+}
+
+func handleCreateBookmark(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL   string `json:"url"`
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	url, err := bookmarkURL(r, req.URL)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b := newBookmark(url, req.Title)
+	if err := addBookmark(ensureVisitorKey(w, r), b); err == errTooManyBookmarks {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func handleDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	owner, _ := visitorKey(r)
+	url := r.PathValue("url")
+	if fragment := r.URL.Query().Get("anchor"); fragment != "" {
+		url += "#" + fragment
+	}
+	removed, err := removeBookmark(owner, url)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !removed {
+		writeError(w, r, http.StatusNotFound, "no such bookmark")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleToggleBookmark adds or removes a bookmark from the star button of a
+// search result, a served page or the bookmarks page, then goes back there
+func handleToggleBookmark(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	url, err := bookmarkURL(r, r.PostForm.Get("url"))
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	title := r.PostForm.Get("title")
+	if title == "" {
+		// the star of a served page doesn't know the title, the index does
+		file, _, _ := strings.Cut(url, "#")
+		id := filepath.Join(root, filepath.FromSlash(file))
+		if titles, err := indexedTitles([]string{id}); err == nil {
+			title = titles[id]
+		}
+	}
+
+	owner := ensureVisitorKey(w, r)
+	removed, err := removeBookmark(owner, url)
+	if err == nil && !removed {
+		err = addBookmark(owner, newBookmark(url, title))
+	}
+	if err == errTooManyBookmarks {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error updating bookmarks: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	next := r.PostForm.Get("next")
+	if next == "" {
+		next = "/bookmarks"
+	}
+	http.Redirect(w, r, safeRedirectPath(next), http.StatusSeeOther)
+}
+
+// bookmarkStar is the star of a served page, styled inline like tocNav and
+// kept in the top right corner
+var bookmarkStar = template.Must(template.New("star").Parse(`<form class="godochive-star" action="/bookmarks" method="POST" style="position:fixed;top:.5em;right:.5em;margin:0;z-index:1000">` +
+	`<input type="hidden" name="url" value="{{.URL}}"><input type="hidden" name="next" value="/{{.URL}}">` +
+	`<button type="submit" title="{{.Label}}" aria-label="{{.Label}}" style="border:0;background:none;font-size:1.5em;cursor:pointer">{{if .Bookmarked}}★{{else}}☆{{end}}</button></form>`))
+
+// withBookmarkStar returns the HTML page content with a star that toggles
+// the bookmark of the document at path for the visitor of r, filled when
+// it's bookmarked already
+func withBookmarkStar(r *http.Request, path string, content []byte) []byte {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return content
+	}
+	url := filepath.ToSlash(rel)
+	bookmarked := bookmarkedOf(r)[url]
+	label := "bookmarks.add"
+	if bookmarked {
+		label = "bookmarks.remove"
+	}
+	var star bytes.Buffer
+	err = bookmarkStar.Execute(&star, struct {
+		URL, Label string
+		Bookmarked bool
+	}{url, newPage(r, label).T(label), bookmarked})
+	if err != nil {
+		return content
+	}
+	return beforeBodyEnd(content, star.Bytes())
+}
+
+func handleBookmarksPage(w http.ResponseWriter, r *http.Request) {
+	owner, _ := visitorKey(r)
+	bookmarks, err := bookmarksOf(owner)
+	if err != nil {
+		log.Printf("Error loading bookmarks: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "bookmarks.html", struct {
+		Page
+		Bookmarks []Bookmark
+	}{newPage(r, "bookmarks.title"), visibleBookmarks(r, bookmarks)})
+}
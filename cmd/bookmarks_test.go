@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withDocFiles creates files (path relative to root -> title) in a
+// temporary root, for handlers that look at the served files
+func withDocFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for rel, title := range files {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("<title>"+title+"</title>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withRoot(t, dir)
+}
+
+func TestBookmarkURL(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	withDocFiles(t, map[string]string{"guides/pool.html": "Pooling", "security/playbooks/incident.html": "Incidents"})
+
+	tests := map[string]string{
+		"/guides/pool.html":                 "guides/pool.html",
+		"guides/pool.html#example-Pool":     "guides/pool.html#example-Pool",
+		"/guides/missing.html":              "",
+		"/guides":                           "",
+		"/guides/../guides/pool.html":       "",
+		"/../etc/passwd":                    "",
+		"/security/playbooks/incident.html": "",
+	}
+	for raw, want := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/bookmarks", nil)
+		got, err := bookmarkURL(r, raw)
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("bookmarkURL(%q) = %q, %v, want %q", raw, got, err, want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/bookmarks", nil).WithContext(memberContext("security"))
+	if _, err := bookmarkURL(r, "/security/playbooks/incident.html"); err != nil {
+		t.Errorf("members can't bookmark their docset: %v", err)
+	}
+}
+
+func TestBookmarksAPI(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{})
+	withDocFiles(t, map[string]string{"guides/pool.html": "Pooling", "guides/cache.html": "Caching"})
+
+	var visitor *http.Cookie
+	create := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/bookmarks", strings.NewReader(body))
+		if visitor != nil {
+			r.AddCookie(visitor)
+		}
+		return serve(http.HandlerFunc(handleCreateBookmark), r)
+	}
+	rec := create(`{"url": "/guides/pool.html", "title": "Pooling"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body.String())
+	}
+	visitor = rec.Result().Cookies()[0]
+	create(`{"url": "/guides/cache.html"}`)
+	if rec := create(`{"url": "/guides/nope.html"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bookmarking a missing document = %d, want 400", rec.Code)
+	}
+
+	list := func() []Bookmark {
+		r := httptest.NewRequest(http.MethodGet, "/api/bookmarks", nil)
+		r.AddCookie(visitor)
+		var bookmarks []Bookmark
+		if err := json.NewDecoder(serve(http.HandlerFunc(handleListBookmarks), r).Body).Decode(&bookmarks); err != nil {
+			t.Fatal(err)
+		}
+		return bookmarks
+	}
+	got := list()
+	if len(got) != 2 || got[0].URL != "guides/cache.html" || got[0].Title != "cache.html" || got[1].Title != "Pooling" {
+		t.Fatalf("bookmarks = %+v, want both, newest first", got)
+	}
+
+	del := httptest.NewRequest(http.MethodDelete, "/api/bookmarks/guides/pool.html", nil)
+	del.SetPathValue("url", "guides/pool.html")
+	del.AddCookie(visitor)
+	if rec := serve(http.HandlerFunc(handleDeleteBookmark), del); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete = %d", rec.Code)
+	}
+	if rec := serve(http.HandlerFunc(handleDeleteBookmark), del); rec.Code != http.StatusNotFound {
+		t.Errorf("deleting again = %d, want 404", rec.Code)
+	}
+	if got := list(); len(got) != 1 || got[0].URL != "guides/cache.html" {
+		t.Errorf("bookmarks after delete = %+v", got)
+	}
+}
+
+func TestToggleBookmarkFromSearch(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{})
+	withDocFiles(t, map[string]string{"guides/pool.html": "connection pooling"})
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	toggle := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		form := url.Values{"url": {"guides/pool.html"}, "title": {"connection pooling"}, "next": {"/search?q=pooling"}}
+		r := httptest.NewRequest(http.MethodPost, "/bookmarks", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		return serve(http.HandlerFunc(handleToggleBookmark), r)
+	}
+	rec := toggle(nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/search?q=pooling" {
+		t.Fatalf("toggle = %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	visitor := rec.Result().Cookies()[0]
+
+	page := httptest.NewRequest(http.MethodGet, "/search?q=pooling", nil)
+	page.AddCookie(visitor)
+	if body := serve(http.HandlerFunc(handleSearch), page).Body.String(); !strings.Contains(body, `title="Remove bookmark"`) {
+		t.Errorf("search result isn't starred:\n%s", body)
+	}
+	list := httptest.NewRequest(http.MethodGet, "/bookmarks", nil)
+	list.AddCookie(visitor)
+	if body := serve(http.HandlerFunc(handleBookmarksPage), list).Body.String(); !strings.Contains(body, `<a href="/guides/pool.html">connection pooling</a>`) {
+		t.Errorf("bookmarks page doesn't list the document:\n%s", body)
+	}
+
+	toggle(visitor)
+	if got, _ := bookmarksOf("visitor:" + visitor.Value); len(got) != 0 {
+		t.Errorf("bookmarks after toggling again = %+v, want none", got)
+	}
+}
+
+func TestBookmarkStarOnDocuments(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{DocumentBookmark: true})
+	withDocFiles(t, map[string]string{"guides/pool.html": "Pooling"})
+	withIndex(t, map[string]string{"guides/pool.html": "Connection pooling"})
+
+	view := func(cookie *http.Cookie) string {
+		r := httptest.NewRequest(http.MethodGet, "/guides/pool.html", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		return serve(http.HandlerFunc(serveFiles), r).Body.String()
+	}
+	if body := view(nil); !strings.Contains(body, `name="url" value="guides/pool.html"`) || !strings.Contains(body, `title="Bookmark"`) {
+		t.Fatalf("page has no star:\n%s", body)
+	}
+
+	form := url.Values{"url": {"guides/pool.html"}, "next": {"/guides/pool.html"}}
+	r := httptest.NewRequest(http.MethodPost, "/bookmarks", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := serve(http.HandlerFunc(handleToggleBookmark), r)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/guides/pool.html" {
+		t.Fatalf("toggle = %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	visitor := rec.Result().Cookies()[0]
+	if got, _ := bookmarksOf("visitor:" + visitor.Value); len(got) != 1 || got[0].Title != "Connection pooling" {
+		t.Errorf("bookmarks = %+v, want the page with its indexed title", got)
+	}
+	if body := view(visitor); !strings.Contains(body, `title="Remove bookmark"`) {
+		t.Errorf("bookmarked page isn't starred:\n%s", body)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// browseEntry is a file or directory in the browse tree
+type browseEntry struct {
+	// Path is relative to root, with forward slashes
+	Path string
+	// Title is the document title from the index, or the name for
+	// directories and files that aren't indexed
+	Title string
+	Dir   bool
+}
+
+// browseCrumb links to a directory above the one being browsed
+type browseCrumb struct {
+	Name, Path string
+}
+
+type browseView struct {
+	Page
+	Path    string
+	Crumbs  []browseCrumb
+	Entries []browseEntry
+}
+
+// handleBrowse renders a directory of the docs as the top of a tree. Its
+// subdirectories load lazily from /browse/dir as they are expanded.
+func handleBrowse(w http.ResponseWriter, r *http.Request) {
+	if view, ok := browseDir(w, r); ok {
+		renderTemplate(w, "browse.html", view)
+	}
+}
+
+// handleBrowseDir renders only the entries of a directory, for expanding it
+// in the tree
+func handleBrowseDir(w http.ResponseWriter, r *http.Request) {
+	if view, ok := browseDir(w, r); ok {
+		renderTemplate(w, "browse_entries", view)
+	}
+}
+
+// browseDir lists the directory in the path parameter. It renders an error
+// page and returns false when that isn't a directory the caller may see.
+func browseDir(w http.ResponseWriter, r *http.Request) (browseView, bool) {
+	rel := strings.TrimPrefix(path.Clean("/"+r.URL.Query().Get("path")), "/")
+	dir := filepath.Join(root, filepath.FromSlash(rel))
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() || !canAccessDocset(r.Context(), docsetFor(dir)) {
+		renderError(w, r, http.StatusNotFound)
+		return browseView{}, false
+	}
+
+	entries, err := browseEntries(r.Context(), rel)
+	if err != nil {
+		log.Printf("Error listing %s: %v", dir, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return browseView{}, false
+	}
+
+	view := browseView{Page: newPage(r, "browse.title"), Path: rel, Entries: entries}
+	if rel != "" {
+		parts := strings.Split(rel, "/")
+		for i := range parts[:len(parts)-1] {
+			view.Crumbs = append(view.Crumbs, browseCrumb{Name: parts[i], Path: strings.Join(parts[:i+1], "/")})
+		}
+	}
+	return view, true
+}
+
+// browseEntries lists the subdirectories and documents of the directory
+// rel, directories first. Hidden entries, files that wouldn't be indexed
+// and docsets the caller may not see are left out.
+func browseEntries(ctx context.Context, rel string) ([]browseEntry, error) {
+	dir := filepath.Join(root, filepath.FromSlash(rel))
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []browseEntry
+	var ids []string
+	for _, f := range files {
+		full := filepath.Join(dir, f.Name())
+		if strings.HasPrefix(f.Name(), ".") || !canAccessDocset(ctx, docsetFor(full)) {
+			continue
+		}
+		if !f.IsDir() {
+			if !isDocumentName(f.Name()) {
+				continue
+			}
+			ids = append(ids, full)
+		}
+		entries = append(entries, browseEntry{Path: path.Join(rel, f.Name()), Title: f.Name(), Dir: f.IsDir()})
+	}
+
+	titles, err := indexedTitles(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if t := titles[filepath.Join(root, filepath.FromSlash(e.Path))]; t != "" {
+			entries[i].Title = t
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Dir != entries[j].Dir {
+			return entries[i].Dir
+		}
+		return strings.ToLower(entries[i].Title) < strings.ToLower(entries[j].Title)
+	})
+	return entries, nil
+}
+
+// indexedTitles looks up the titles of the documents with the given IDs
+func indexedTitles(ids []string) (map[string]string, error) {
+	titles := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return titles, nil
+	}
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(ids), len(ids), 0, false)
+	searchRequest.Fields = []string{"Title"}
+	result, err := index.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+	for _, hit := range result.Hits {
+		titles[hit.ID], _ = hit.Fields["Title"].(string)
+	}
+	return titles, nil
+}
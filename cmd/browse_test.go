@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBrowseEntries(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	files := map[string]string{
+		"guides/pool.html":                  "Connection pooling",
+		"guides/advanced/retries.md":        "Retries",
+		"guides/notes.bin":                  "",
+		"guides/.draft.html":                "Draft",
+		"security/playbooks/incident.html":  "Incidents",
+		"security/readme.txt":               "Security",
+		"guides/zz-unindexed.html":          "",
+		"guides/advanced/backoff/jitter.md": "Jitter",
+	}
+	withDocFiles(t, files)
+	indexed := map[string]string{}
+	for rel, title := range files {
+		if title != "" {
+			indexed[rel] = title
+		}
+	}
+	withIndex(t, indexed)
+
+	entries, err := browseEntries(memberContext("dev"), "guides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []browseEntry{
+		{Path: "guides/advanced", Title: "advanced", Dir: true},
+		{Path: "guides/pool.html", Title: "Connection pooling"},
+		{Path: "guides/zz-unindexed.html", Title: "zz-unindexed.html"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	// the restricted docset is hidden, its parent directory isn't
+	entries, _ = browseEntries(memberContext("dev"), "security")
+	if len(entries) != 1 || entries[0].Title != "Security" {
+		t.Errorf("security entries = %+v", entries)
+	}
+	entries, _ = browseEntries(memberContext("security"), "security")
+	if len(entries) != 2 {
+		t.Errorf("member's security entries = %+v", entries)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, restrictedConfig)
+	withDocFiles(t, map[string]string{"guides/advanced/retries.md": "Retries", "security/playbooks/incident.html": "Incidents"})
+	withIndex(t, map[string]string{"guides/advanced/retries.md": "Retries"})
+
+	rec := serve(http.HandlerFunc(handleBrowse), httptest.NewRequest(http.MethodGet, "/browse?path=guides/advanced", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, `<a href="/browse?path=guides">guides</a>`) || !strings.Contains(body, `<a href="/guides/advanced/retries.md">Retries</a>`) {
+		t.Errorf("browse = %d %s", rec.Code, body)
+	}
+
+	rec = serve(http.HandlerFunc(handleBrowseDir), httptest.NewRequest(http.MethodGet, "/browse/dir?path=guides", nil))
+	if body := rec.Body.String(); strings.Contains(body, "<html") || !strings.Contains(body, `data-src="/browse/dir?path=guides%2fadvanced"`) {
+		t.Errorf("browse dir = %s", body)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "guides", "file.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// ../../etc is cleaned to etc below the root
+	for _, target := range []string{"/browse?path=security/playbooks", "/browse?path=missing", "/browse?path=guides/file.txt", "/browse?path=../../etc"} {
+		if rec := serve(http.HandlerFunc(handleBrowse), httptest.NewRequest(http.MethodGet, target, nil)); rec.Code != http.StatusNotFound {
+			t.Errorf("%s = %d, want 404", target, rec.Code)
+		}
+	}
+}
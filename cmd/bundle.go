@@ -0,0 +1,412 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bundleSeparator separates the path of a doc bundle from the path of a
+// file inside it, in document ids and URLs like docs/go.zip!/net/http.html
+const bundleSeparator = "!/"
+
+// maxBundleFile bounds the size of a file read from a bundle
+const maxBundleFile = 64 << 20
+
+// bundleExtensions are the archive formats indexed as doc bundles
+var bundleExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+func isBundle(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range bundleExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitBundlePath splits a path into a doc bundle and the file inside it.
+// ok is false when the path doesn't point into a bundle. A path ending at
+// a directory of the bundle points to its index.html.
+func splitBundlePath(p string) (bundle, name string, ok bool) {
+	p = filepath.ToSlash(p)
+	for i := 0; i < len(p); {
+		j := strings.Index(p[i:], bundleSeparator)
+		if j < 0 {
+			break
+		}
+		bundle, name = p[:i+j], p[i+j+len(bundleSeparator):]
+		if isBundle(bundle) {
+			if name == "" || strings.HasSuffix(name, "/") {
+				name += "index.html"
+			}
+			return filepath.FromSlash(bundle), name, fs.ValidPath(name)
+		}
+		i += j + len(bundleSeparator)
+	}
+	return "", "", false
+}
+
+// bundleName is the name a file is found under in a bundle, empty for
+// names that would point outside of it
+func bundleName(raw string) string {
+	name := path.Clean(strings.TrimPrefix(filepath.ToSlash(raw), "./"))
+	if name == "." || !fs.ValidPath(name) {
+		return ""
+	}
+	return name
+}
+
+// eachBundleFile calls fn with every regular file in the bundle at p,
+// without extracting it. fn can return fs.SkipAll to stop early.
+func eachBundleFile(p string, fn func(name string, info fs.FileInfo, r io.Reader) error) error {
+	err := walkBundle(p, fn)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkBundle(p string, fn func(name string, info fs.FileInfo, r io.Reader) error) error {
+	if strings.HasSuffix(strings.ToLower(p), ".zip") {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			name := bundleName(f.Name)
+			if name == "" || !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			err = fn(name, f.FileInfo(), rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if lower := strings.ToLower(p); strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := bundleName(hdr.Name)
+		if name == "" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(name, hdr.FileInfo(), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// readBundleFile reads a file of a bundle whole
+func readBundleFile(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxBundleFile+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxBundleFile {
+		return nil, fmt.Errorf("larger than %d MB", maxBundleFile>>20)
+	}
+	return content, nil
+}
+
+// bundleMember is where the data of a file is in its bundle
+type bundleMember struct {
+	info fs.FileInfo
+	// offset and size locate the data in the bundle, compressed with the
+	// zip method for zips
+	offset, size int64
+	method       uint16
+	// content holds files of compressed tars, which can't be read from
+	// the middle
+	content []byte
+	cached  bool
+}
+
+// bundleIndex lists the files of a bundle, so reading one of them doesn't
+// scan the archive. It's valid while the bundle keeps its modification
+// time and size.
+type bundleIndex struct {
+	modTime time.Time
+	size    int64
+	members map[string]bundleMember
+}
+
+// maxCachedBundle bounds the files of a compressed tar kept in memory;
+// larger ones are scanned again for every file read
+const maxCachedBundle = 64 << 20
+
+var bundleIndexes = struct {
+	sync.Mutex
+	byPath map[string]*bundleIndex
+}{byPath: make(map[string]*bundleIndex)}
+
+// bundleIndexOf returns the index of the bundle at p, building it when the
+// bundle is new or changed
+func bundleIndexOf(p string) (*bundleIndex, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	bundleIndexes.Lock()
+	bi, ok := bundleIndexes.byPath[p]
+	bundleIndexes.Unlock()
+	if ok && bi.modTime.Equal(info.ModTime()) && bi.size == info.Size() {
+		return bi, nil
+	}
+
+	bi = &bundleIndex{modTime: info.ModTime(), size: info.Size(), members: make(map[string]bundleMember)}
+	if err := bi.read(p); err != nil {
+		return nil, err
+	}
+	bundleIndexes.Lock()
+	bundleIndexes.byPath[p] = bi
+	bundleIndexes.Unlock()
+	return bi, nil
+}
+
+// read lists the files of the bundle at p. It leaves members nil for a
+// compressed tar holding more than maxCachedBundle.
+func (bi *bundleIndex) read(p string) error {
+	lower := strings.ToLower(p)
+	if strings.HasSuffix(lower, ".zip") {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			name := bundleName(f.Name)
+			if name == "" || !f.Mode().IsRegular() {
+				continue
+			}
+			offset, err := f.DataOffset()
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			bi.members[name] = bundleMember{info: f.FileInfo(), offset: offset, size: int64(f.CompressedSize64), method: f.Method}
+		}
+		return nil
+	}
+
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		var total int64
+		err := eachBundleFile(p, func(name string, info fs.FileInfo, r io.Reader) error {
+			if total += info.Size(); total > maxCachedBundle {
+				return fs.SkipAll
+			}
+			content, err := readBundleFile(r)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			bi.members[name] = bundleMember{info: info, content: content, cached: true}
+			return nil
+		})
+		if total > maxCachedBundle {
+			bi.members = nil
+		}
+		return err
+	}
+
+	// a plain tar is read where each file's data starts, found by seeking
+	// past the data while listing
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := bundleName(hdr.Name)
+		if name == "" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		bi.members[name] = bundleMember{info: hdr.FileInfo(), offset: offset, size: hdr.Size}
+	}
+}
+
+// readFrom reads the file m of the bundle at p
+func (m bundleMember) readFrom(p string) ([]byte, error) {
+	if m.cached {
+		return m.content, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = io.NewSectionReader(f, m.offset, m.size)
+	switch m.method {
+	case zip.Store:
+	case zip.Deflate:
+		fr := flate.NewReader(r)
+		defer fr.Close()
+		r = fr
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+	return readBundleFile(r)
+}
+
+// openBundleFile reads the file name of the bundle at p
+func openBundleFile(p, name string) ([]byte, fs.FileInfo, error) {
+	bi, err := bundleIndexOf(p)
+	var content []byte
+	var info fs.FileInfo
+	switch {
+	case err != nil:
+	case bi.members == nil:
+		content, info, err = scanBundleFile(p, name)
+	default:
+		m, ok := bi.members[name]
+		if !ok {
+			err = fs.ErrNotExist
+			break
+		}
+		content, err = m.readFrom(p)
+		info = m.info
+	}
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: "open", Path: p + bundleSeparator + name, Err: err}
+	}
+	return content, info, nil
+}
+
+// scanBundleFile finds the file name by reading the bundle at p from the
+// start, for bundles too large to index
+func scanBundleFile(p, name string) ([]byte, fs.FileInfo, error) {
+	var content []byte
+	var info fs.FileInfo
+	err := eachBundleFile(p, func(n string, i fs.FileInfo, r io.Reader) error {
+		if n != name {
+			return nil
+		}
+		var err error
+		if content, err = readBundleFile(r); err != nil {
+			return err
+		}
+		info = i
+		return fs.SkipAll
+	})
+	if err == nil && info == nil {
+		err = fs.ErrNotExist
+	}
+	return content, info, err
+}
+
+// statDoc is os.Stat for documents, which can be files inside bundles
+func statDoc(p string) (os.FileInfo, error) {
+	info, err := os.Stat(p)
+	if !errors.Is(err, fs.ErrNotExist) || !config.Index.Bundles {
+		return info, err
+	}
+	bundle, name, ok := splitBundlePath(p)
+	if !ok {
+		return info, err
+	}
+	_, info, err = openBundleFile(bundle, name)
+	return info, err
+}
+
+// readDoc is os.ReadFile for documents, which can be files inside bundles
+func readDoc(p string) ([]byte, error) {
+	content, err := os.ReadFile(p)
+	if !errors.Is(err, fs.ErrNotExist) || !config.Index.Bundles {
+		return content, err
+	}
+	bundle, name, ok := splitBundlePath(p)
+	if !ok {
+		return content, err
+	}
+	content, _, err = openBundleFile(bundle, name)
+	return content, err
+}
+
+// sourceFile is the file on disk a document comes from: its bundle for
+// files inside one, the document itself otherwise
+func sourceFile(p string) string {
+	if bundle, _, ok := splitBundlePath(p); ok && config.Index.Bundles {
+		return bundle
+	}
+	return p
+}
+
+// serveBundleFile serves the file inside a bundle filePath points to. It
+// reports false when there is none.
+func serveBundleFile(w http.ResponseWriter, r *http.Request, filePath string) bool {
+	if !config.Index.Bundles {
+		return false
+	}
+	// filePath was cleaned of the slash that picks the directory's index
+	if strings.HasSuffix(r.URL.Path, "/") {
+		filePath += "/"
+	}
+	bundle, name, ok := splitBundlePath(filePath)
+	if !ok {
+		return false
+	}
+	content, info, err := openBundleFile(bundle, name)
+	if err != nil {
+		return false
+	}
+	setCacheHeaders(w, info)
+	if rewritesDocuments() {
+		if serveWithTOC(w, r, filePath, info) {
+			return true
+		}
+	}
+	http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(content))
+	return true
+}
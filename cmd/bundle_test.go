@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBundles(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{Index: IndexConfig{Bundles: true}})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	zf, err := os.Create(filepath.Join(dir, "site.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zf)
+	for name, content := range map[string]string{
+		"site/index.html":   "<title>Pooling</title><p>connections are pooled</p>",
+		"site/style.css":    "body { color: black }",
+		"../escape.html":    "<title>Escape</title><p>connections escape</p>",
+		"site/retries.html": "<title>Retries</title><p>requests are retried</p>",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	zf.Close()
+
+	tf, err := os.Create(filepath.Join(dir, "guide.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(tf)
+	tw := tar.NewWriter(gz)
+	guide := "# Timeouts\n\nconnections time out"
+	tw.WriteHeader(&tar.Header{Name: "./guide/timeouts.md", Mode: 0o644, Size: int64(len(guide)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(guide))
+	tw.Close()
+	gz.Close()
+	tf.Close()
+
+	ids, err := buildIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, id := range ids {
+		rel, _ := filepath.Rel(dir, id)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	// the file whose name leads out of the bundle is left out
+	if strings.Join(got, ",") != "guide.tar.gz!/guide/timeouts.md,site.zip!/site/index.html,site.zip!/site/retries.html" {
+		t.Errorf("indexed %v", got)
+	}
+	results, err := performSearch("connections", searchFilter{}, 10, nil)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("results = %+v, %v", results, err)
+	}
+
+	rec := serve(http.HandlerFunc(serveFiles), httptest.NewRequest(http.MethodGet, "/site.zip!/site/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "connections are pooled") {
+		t.Errorf("serving the bundle's index page = %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serve(http.HandlerFunc(serveFiles), httptest.NewRequest(http.MethodGet, "/guide.tar.gz!/guide/timeouts.md", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != guide {
+		t.Errorf("serving a file of a tarball = %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serve(http.HandlerFunc(serveFiles), httptest.NewRequest(http.MethodGet, "/site.zip!/site/missing.html", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("serving a missing file = %d", rec.Code)
+	}
+
+	if n, err := purgeDeletedFiles(index); err != nil || n != 0 {
+		t.Errorf("purge deleted %d files of bundles that exist, %v", n, err)
+	}
+}
+
+func TestSplitBundlePath(t *testing.T) {
+	tests := map[string]string{
+		"docs/go.zip!/net/http.html": "docs/go.zip|net/http.html",
+		"docs/go.zip!/":              "docs/go.zip|index.html",
+		"docs/a!/b.zip!/c/":          "docs/a!/b.zip|c/index.html",
+		"docs/go.zip!/../etc/passwd": "",
+		"docs/page!/x.html":          "",
+	}
+	for in, want := range tests {
+		bundle, name, ok := splitBundlePath(in)
+		got := ""
+		if ok {
+			got = filepath.ToSlash(bundle) + "|" + name
+		}
+		if got != want {
+			t.Errorf("splitBundlePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBundleIndexFollowsChanges(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "guide.tar")
+	write := func(content string, modified time.Time) {
+		t.Helper()
+		f, err := os.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw := tar.NewWriter(f)
+		for _, name := range []string{"guide/pool.md", "guide/retries.md"} {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(content))
+		}
+		tw.Close()
+		f.Close()
+		if err := os.Chtimes(p, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("connections are pooled", time.Now().Add(-time.Hour))
+	if content, _, err := openBundleFile(p, "guide/retries.md"); err != nil || string(content) != "connections are pooled" {
+		t.Fatalf("content = %q, %v", content, err)
+	}
+	write("connections are reused", time.Now())
+	if content, _, err := openBundleFile(p, "guide/retries.md"); err != nil || string(content) != "connections are reused" {
+		t.Errorf("content after replacing the bundle = %q, %v", content, err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// setCacheHeaders adds an ETag and Cache-Control to a served file.
+// http.ServeFile answers If-None-Match and If-Modified-Since with a 304
+// on its own once these are set.
+func setCacheHeaders(w http.ResponseWriter, info os.FileInfo) {
+	w.Header().Set("ETag", fileETag(info))
+
+	cc := config.CacheControl
+	if cc == "" {
+		cc = "no-cache"
+	}
+	// responses behind auth must not be kept by shared caches
+	if authEnabled() {
+		cc = "private, " + cc
+	}
+	w.Header().Set("Cache-Control", cc)
+}
+
+// fileETag derives a validator from the file's size and modification time,
+// which is cheap and changes whenever the file is rewritten
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// contentETag derives a validator from a response body, for pages the
+// server rewrites before serving them
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return fmt.Sprintf(`"%x"`, sum[:16])
+}
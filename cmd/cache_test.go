@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeFilesConditionalRequests(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte("<html>docs</html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, Config{CacheControl: "max-age=60"})
+	withRoot(t, dir)
+
+	rec := serve(http.HandlerFunc(serveFiles), httptest.NewRequest(http.MethodGet, "/page.html", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status = %d, ETag = %q; want 200 with an ETag", rec.Code, etag)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "max-age=60" {
+		t.Errorf("Cache-Control = %q, want max-age=60", got)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/page.html", nil)
+	r.Header.Set("If-None-Match", etag)
+	if rec := serve(http.HandlerFunc(serveFiles), r); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want 304", rec.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/page.html", nil)
+	r.Header.Set("If-Modified-Since", rec.Header().Get("Last-Modified"))
+	if rec := serve(http.HandlerFunc(serveFiles), r); rec.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since status = %d, want 304", rec.Code)
+	}
+}
+
+func TestRewrittenPageValidators(t *testing.T) {
+	dir := t.TempDir()
+	page := `<html><body><h2 id="pool">Pooling</h2><p>reuse</p><h2 id="limits">Limits</h2><p>cap</p></body></html>`
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, Config{DocumentTOC: true})
+	withRoot(t, dir)
+
+	rec := serve(http.HandlerFunc(serveFiles), httptest.NewRequest(http.MethodGet, "/page.html", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag != contentETag(rec.Body.Bytes()) {
+		t.Fatalf("status = %d, ETag = %q; want the ETag of the served page", rec.Code, etag)
+	}
+	if got := rec.Header().Get("Last-Modified"); got != "" {
+		t.Errorf("Last-Modified = %q, want none for a rewritten page", got)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/page.html", nil)
+	r.Header.Set("If-None-Match", etag)
+	if rec := serve(http.HandlerFunc(serveFiles), r); rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want 304", rec.Code)
+	}
+
+	// without the table of contents the page differs, so the old ETag
+	// must not match
+	config.DocumentTOC = false
+	if rec := serve(http.HandlerFunc(serveFiles), r); rec.Code != http.StatusOK {
+		t.Errorf("revalidation after a config change = %d, want 200", rec.Code)
+	}
+}
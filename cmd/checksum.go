@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/index/upsidedown"
+	"github.com/blevesearch/bleve/v2/search"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+// contentChecksum identifies the content of a file. It's stored with every
+// document of the file, so identical copies, like the same page in mirrored
+// trees, are shown once.
+func contentChecksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// buildKey identifies what the documents of a page are built from: the
+// content of the file, its modification time, which they carry, and the
+// settings that change how files are extracted. Index runs skip the pages
+// whose key is unchanged, so a changed setting extracts every page again.
+func buildKey(content []byte, info os.FileInfo, settings string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%s", contentChecksum(content), info.ModTime().UnixNano(), settings)))
+	return hex.EncodeToString(sum[:])
+}
+
+// extractionSettings are the parts of the config that change what is
+// extracted from a file, in a form buildKey can hash
+func extractionSettings() string {
+	settings, _ := json.Marshal(struct {
+		FileTypes       map[string]string
+		Sniff, Bundles  bool
+		Docsets         []DocsetConfig
+		SearchableNotes bool
+	}{config.Index.FileTypes, config.Index.Sniff, config.Index.Bundles, config.Docsets, config.SearchableNotes})
+	return string(settings)
+}
+
+// indexedBuildKey is the build key idx holds for the page at path, empty
+// when it doesn't hold the page
+func indexedBuildKey(idx bleve.Index, path string) string {
+	doc, err := idx.Document(path)
+	if err != nil || doc == nil {
+		return ""
+	}
+	var key string
+	doc.VisitFields(func(f bleveindex.Field) {
+		if f.Name() == "BuildKey" {
+			key = string(f.Value())
+		}
+	})
+	return key
+}
+
+// indexedIDs lists the ids of every document in idx
+func indexedIDs(idx bleve.Index) ([]string, error) {
+	var ids []string
+	for _, shard := range shardsOf(idx) {
+		adv, err := shard.Advanced()
+		if err != nil {
+			return nil, err
+		}
+		reader, err := adv.Reader()
+		if err != nil {
+			return nil, err
+		}
+		all, err := reader.DocIDReaderAll()
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		for {
+			id, err := all.Next()
+			if err == nil && id == nil {
+				break
+			}
+			var ext string
+			if err == nil {
+				ext, err = reader.ExternalID(id)
+			}
+			if err != nil {
+				all.Close()
+				reader.Close()
+				return nil, err
+			}
+			ids = append(ids, ext)
+		}
+		all.Close()
+		reader.Close()
+	}
+	return ids, nil
+}
+
+// openForUpdate creates the index the index command builds into at tmp: a
+// copy of the index at path, so only the files that changed since it was
+// built are indexed again. It fails when the index can't be reused: when
+// there is none, when it was built with other docsets, analysis or schema,
+// or when it's of a type that can't be copied.
+func openForUpdate(path, tmp string) (bleve.Index, error) {
+	if config.Index.Type == upsidedown.Name {
+		return nil, errors.New("upside_down indexes can't be copied")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	current, err := openIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	defer current.Close()
+	if !docsetsUpToDate(current) || !analysisUpToDate(current) || !schemaUpToDate(current) {
+		return nil, errors.New("it was built with other settings")
+	}
+	copyable, ok := current.(bleve.IndexCopyable)
+	if !ok {
+		return nil, errors.New("its type can't be copied")
+	}
+	if err := copyable.CopyTo(bleve.FileSystemDirectory(tmp)); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	idx, err := openIndex(tmp)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	return idx, nil
+}
+
+// deleteStale deletes the documents below dir that are no longer in the
+// docs: those of files that are gone and the examples and sections a
+// changed page lost. kept are the pages that were skipped as unchanged and
+// indexed the ids of the documents written by this run.
+func deleteStale(idx bleve.Index, dir string, kept, indexed map[string]bool) (int, error) {
+	ids, err := indexedIDs(idx)
+	if err != nil {
+		return 0, err
+	}
+	batch := newBatcher(idx)
+	deleted := 0
+	for _, id := range ids {
+		page, _, _ := strings.Cut(id, "#")
+		if kept[page] || indexed[id] || !inDir(dir, page) {
+			continue
+		}
+		if err := batch.Delete(id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, batch.Flush()
+}
+
+// collapseCopies drops the hits that are a copy of a better ranked hit,
+// found by their checksum, and returns the hits left and how many it
+// dropped. Of a page found in two mirrored trees only the first is kept.
+func collapseCopies(hits search.DocumentMatchCollection) (search.DocumentMatchCollection, int) {
+	kept := make(search.DocumentMatchCollection, 0, len(hits))
+	seen := make(map[string]bool)
+	for _, hit := range hits {
+		sum, _ := hit.Fields["Checksum"].(string)
+		if sum != "" && seen[sum] {
+			continue
+		}
+		seen[sum] = true
+		kept = append(kept, hit)
+	}
+	return kept, len(hits) - len(kept)
+}
+
+// checksumFor is the checksum stored with the document id of a page whose
+// content has checksum sum: examples and sections also carry their anchor,
+// so they are only copies of the same part of an identical page
+func checksumFor(id, sum string) string {
+	if _, anchor, ok := strings.Cut(id, "#"); ok {
+		return sum + "#" + anchor
+	}
+	return sum
+}
+
+// inDir reports whether path is dir or below it
+func inDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestIncrementalBuild(t *testing.T) {
+	for _, shards := range []int{1, 2} {
+		withConfig(t, Config{})
+		withRoot(t, t.TempDir())
+		write := func(name, page string) {
+			t.Helper()
+			if err := os.WriteFile(filepath.Join(root, name), []byte(page), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		write("same.html", "<title>Pooling</title><p>connections are pooled</p>")
+		write("changed.html", `<title>Retries</title><p>retries are capped</p><h2 id="budget">Budget</h2><p>ten retries a minute</p>`)
+		write("gone.html", "<title>Proxies</title><p>proxies are honoured</p>")
+
+		path := filepath.Join(t.TempDir(), "index.bleve")
+		idx, err := newIndex(path, shards)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := buildStamped(idx, root); err != nil {
+			t.Fatal(err)
+		}
+		idx.Close()
+
+		write("changed.html", "<title>Retries</title><p>retries are unlimited</p>")
+		os.Remove(filepath.Join(root, "gone.html"))
+		write("new.html", "<title>Timeouts</title><p>requests time out</p>")
+		later := time.Now().Add(time.Hour)
+		os.Chtimes(filepath.Join(root, "same.html"), later, later)
+
+		tmp := path + ".new"
+		idx, err = openForUpdate(path, tmp)
+		if err != nil {
+			t.Fatalf("%d shard(s): %v", shards, err)
+		}
+		ids, err := buildStamped(idx, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 3 {
+			t.Errorf("%d shard(s): files = %v", shards, ids)
+		}
+		for text, want := range map[string]uint64{"pooled": 1, "unlimited": 1, "capped": 0, "minute": 0, "proxies": 0, "requests": 1} {
+			res, err := idx.Search(bleve.NewSearchRequest(bleve.NewMatchQuery(text)))
+			if err != nil || res.Total != want {
+				t.Errorf("%d shard(s): %q found %v times, want %d (%v)", shards, text, res, want, err)
+			}
+		}
+		// only the modification time of same.html changed, which is enough
+		// to index it again, so ModifiedAt isn't stale
+		req := bleve.NewSearchRequest(bleve.NewMatchQuery("pooled"))
+		req.Fields = []string{"ModifiedAt"}
+		res, err := idx.Search(req)
+		if err != nil || len(res.Hits) != 1 {
+			t.Fatal(res, err)
+		}
+		if modified, _ := time.Parse(time.RFC3339, res.Hits[0].Fields["ModifiedAt"].(string)); !modified.After(time.Now()) {
+			t.Errorf("%d shard(s): the touched file kept its old modification time", shards)
+		}
+		idx.Close()
+	}
+}
+
+func TestBuildKeySkips(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	idx := withEmptyIndex(t)
+
+	path := filepath.Join(dir, "pool.html")
+	if err := os.WriteFile(path, []byte("<title>Pooling</title><p>connections are pooled</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	// a page the build skips keeps what the index holds, so plant a title
+	// only an indexing run that skips the page leaves alone
+	planted := func() bool {
+		t.Helper()
+		res, err := idx.Search(bleve.NewSearchRequest(bleve.NewMatchQuery("planted")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Total == 1
+	}
+	plant := func() {
+		t.Helper()
+		if err := idx.Index(path, Document{Title: "planted", URL: path, BuildKey: indexedBuildKey(idx, path)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plant()
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	if !planted() {
+		t.Error("an unchanged page was indexed again")
+	}
+
+	withConfig(t, Config{Docsets: []DocsetConfig{{Name: "guides", Path: "."}}})
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	if planted() {
+		t.Error("a page wasn't indexed again after the docsets changed")
+	}
+}
+
+func TestCollapseCopies(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+
+	page := `<title>Pooling</title><p>connections are pooled</p><h2 id="limits">Limits</h2><p>pooled connections are capped</p>`
+	for _, mirror := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(dir, mirror), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, mirror, "pool.html"), []byte(page), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := performSearch("pooled", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one page and one section, from either mirror
+	if len(results) != 2 {
+		t.Errorf("results = %+v, want the copies collapsed", results)
+	}
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+const indexPath = "index.bleve"
+
+// command is a godochive subcommand
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	// assigned here because runHelp refers back to commands
+	commands = []command{
+		{"serve", "[flags]", "serve the docs and the search UI (the default)", runServe},
+		{"index", "[flags]", "build the index, replacing the current one", runIndex},
+		{"search", "[flags] <query>", "print the documents matching a query", runSearch},
+		{"stats", "[flags]", "report index size and health", runStats},
+		{"optimize", "[flags]", "compact the index to reclaim disk space", runOptimize},
+		{"fetch", "[flags] [source...]", "update the copies of remote docs sources below the docs root", runFetch},
+		{"reshard", "[flags]", "rebuild the index split into a different number of shards", runReshard},
+		{"backup", "[flags] <file>", "save the index and the database to an archive", runBackup},
+		{"restore", "[flags] <file>", "replace the index and the database with a backup", runRestore},
+		{"replay", "[flags] <query log>", "compare the ranking with the clicks in a query log", runReplay},
+		{"mcp", "[flags]", "serve the index to AI assistants over stdio (Model Context Protocol)", runMCP},
+		{"help", "", "show this help", runHelp},
+	}
+}
+
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	runHelp(nil)
+	os.Exit(2)
+}
+
+func runHelp(args []string) error {
+	fmt.Fprintln(os.Stderr, "usage: godochive <command> [flags]\n\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun \"godochive <command> -h\" for the flags of a command")
+	return nil
+}
+
+// options are the flags shared by the commands
+type options struct {
+	path       string
+	extensions string
+	configPath string
+	dbPath     string
+}
+
+// newFlagSet creates the flag set of a command with the shared flags.
+// Only commands that touch server-side data get -db.
+func newFlagSet(name, args string, withDB bool) (*flag.FlagSet, *options) {
+	// current working directory where the binary is run
+	currentDir, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Error getting current working directory: %v", err)
+	}
+
+	o := &options{}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: godochive %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&o.path, "path", currentDir, "Path to the directory")
+	fs.StringVar(&o.extensions, "extensions", "", "Comma-separated list of file extensions to include")
+	fs.StringVar(&o.configPath, "config", "", "Path to a JSON config file")
+	if withDB {
+		fs.StringVar(&o.dbPath, "db", "godochive.db", "Path to the database for alerts and other server-side data")
+	}
+	return fs, o
+}
+
+// apply loads the config and sets the globals every command relies on
+func (o *options) apply() error {
+	if o.configPath != "" {
+		var err error
+		if config, err = loadConfig(o.configPath); err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+	}
+	if err := loadSynonyms(); err != nil {
+		return fmt.Errorf("loading synonyms: %w", err)
+	}
+
+	root = o.path
+	if o.extensions != "" {
+		allowedExtensions = strings.Split(o.extensions, ",")
+		for i, ext := range allowedExtensions {
+			allowedExtensions[i] = strings.TrimSpace(ext)
+			if !strings.HasPrefix(allowedExtensions[i], ".") {
+				allowedExtensions[i] = "." + allowedExtensions[i]
+			}
+		}
+	}
+	return nil
+}
+
+// openIndex opens the index built by the index command
+func openIndex(path string) (bleve.Index, error) {
+	idx, err := openIndexUsing(path, indexRuntimeConfig())
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		return nil, fmt.Errorf("no index at %s, run \"godochive index\" first", path)
+	}
+	return idx, err
+}
+
+// openIndexUsing opens the index at path, sharded or not, like
+// bleve.OpenUsing
+func openIndexUsing(path string, runtimeConfig map[string]interface{}) (bleve.Index, error) {
+	n, err := readShardCount(path)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		s, err := openShardedIndex(path, n, runtimeConfig)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return bleve.OpenUsing(path, runtimeConfig)
+}
+
+func runServe(args []string) error {
+	fs, opts := newFlagSet("serve", "[flags]", true)
+	fs.Parse(args)
+	if err := opts.apply(); err != nil {
+		return err
+	}
+	fmt.Println("Using path:", root)
+
+	var err error
+	store, err = openStore(opts.dbPath)
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+	defer store.Close()
+	if err := loadMaintenance(); err != nil {
+		return fmt.Errorf("loading maintenance state: %w", err)
+	}
+
+	index, err = openIndex(indexPath)
+	rebuilt := false
+	if err == nil {
+		// an index with an older schema is brought up to date before it's
+		// served, one from a newer binary isn't served at all
+		if index, rebuilt, err = upgradeSchema(index, indexPath); err != nil {
+			return err
+		}
+	}
+	primaryOK := err == nil
+	if err != nil && config.StandbyIndexPath != "" {
+		log.Printf("Error opening index, serving from the standby: %v", err)
+		index, err = openIndexUsing(config.StandbyIndexPath, indexRuntimeConfig())
+	}
+	if err != nil {
+		// a missing index is a setup error, an unreadable one is recovered
+		if _, serr := os.Stat(indexPath); os.IsNotExist(serr) {
+			return err
+		}
+		log.Printf("Error opening index, serving the docs without search until it is recovered: %v", err)
+		index = nil
+	}
+	// documents carry their docset, so a stale index would leak restricted
+	// documents into search results
+	if index != nil && !docsetsUpToDate(index) {
+		index.Close()
+		return fmt.Errorf("the docset configuration changed since the index was built, run \"godochive index\"")
+	}
+	// queries are analyzed with the current settings, so they would miss
+	// terms analyzed the old way
+	if index != nil && !analysisUpToDate(index) {
+		index.Close()
+		return fmt.Errorf("the analysis configuration changed since the index was built, run \"godochive index\"")
+	}
+	if n := config.Index.Shards; index != nil && n > 0 && len(shardsOf(index)) != n {
+		log.Printf("The index has %d shard(s) and the config asks for %d, run \"godochive reshard\" to change it", len(shardsOf(index)), n)
+	}
+	if primaryOK && config.StandbyIndexPath != "" {
+		if index, err = withStandby(index, config.StandbyIndexPath, rebuilt); err != nil {
+			return fmt.Errorf("preparing standby index: %w", err)
+		}
+	}
+	live := newLiveIndex(index, indexPath, !primaryOK && index != nil)
+	index = live
+	defer index.Close()
+	go watchIndexSwaps(live)
+	go watchDeletedFiles(live)
+	watchSources(live)
+
+	return runServer()
+}
+
+// runIndex builds a new index next to the current one and swaps it in when
+// complete, so a failed build leaves the current index untouched. It needs
+// the database, which a running server holds, so it fails while one is
+// running; POST /api/admin/ingest reindexes through the server instead.
+func runIndex(args []string) error {
+	fs, opts := newFlagSet("index", "[flags]", true)
+	full := fs.Bool("full", false, "Index every file again, not only the ones that changed")
+	fs.Parse(args)
+	if err := opts.apply(); err != nil {
+		return err
+	}
+	fmt.Println("Using path:", root)
+	fmt.Println("Allowed extensions:", allowedExtensions)
+
+	var err error
+	store, err = openStore(opts.dbPath)
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+	defer store.Close()
+
+	tmp := indexPath + ".new"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if !*full {
+		index, err = openForUpdate(indexPath, tmp)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Indexing every file: the existing index can't be updated, %v\n", err)
+		}
+	}
+	if index == nil {
+		index, err = newIndex(tmp, indexShards(indexPath))
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := indexDocuments(root); err != nil {
+		index.Close()
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := index.Close(); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(indexPath); err != nil {
+		return fmt.Errorf("deleting existing index: %w", err)
+	}
+	if err := os.Rename(tmp, indexPath); err != nil {
+		return err
+	}
+	return refreshStandby()
+}
+
+// refreshStandby recreates the standby index, if there is one, from the
+// index that was just put in place
+func refreshStandby() error {
+	if config.StandbyIndexPath == "" {
+		return nil
+	}
+	idx, err := openIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	f, err := withStandby(idx, config.StandbyIndexPath, true)
+	if err != nil {
+		idx.Close()
+		return fmt.Errorf("syncing standby index: %w", err)
+	}
+	return f.Close()
+}
+
+func runSearch(args []string) error {
+	fs, opts := newFlagSet("search", "[flags] <query>", false)
+	format := fs.String("format", "table", "Output format: table, json or plain")
+	fieldList := fs.String("fields", "", "Comma-separated fields to print: title, url, docset, content (default depends on -format)")
+	limit := fs.Int("n", 10, "Maximum number of results")
+	typeList := fs.String("type", "", "Comma-separated file types to search, e.g. html,md (default all)")
+	tagList := fs.String("tag", "", "Comma-separated tags that results must all have")
+	updated := fs.String("updated", "", "Only documents modified in this many days, e.g. 30d")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := opts.apply(); err != nil {
+		return err
+	}
+
+	fields, err := parseOutputFields(*fieldList, *format)
+	if err != nil {
+		return err
+	}
+	since, _, err := updatedWindow(url.Values{"updated": {*updated}}, time.Now())
+	if err != nil {
+		return err
+	}
+	if index, err = openIndex(indexPath); err != nil {
+		return err
+	}
+	defer index.Close()
+
+	filter := searchFilter{Types: parseTypes(*typeList), Tags: parseTags(*tagList), Since: since}
+	results, err := performSearch(strings.Join(fs.Args(), " "), filter, *limit, nil)
+	if err != nil {
+		return err
+	}
+	return writeResults(os.Stdout, results, *format, fields)
+}
+
+// runStats prints the state of the index. It fails when the index can't be
+// served as is, so scripts can check the exit status.
+func runStats(args []string) error {
+	fs, opts := newFlagSet("stats", "[flags]", false)
+	fs.Parse(args)
+	if err := opts.apply(); err != nil {
+		return err
+	}
+
+	idx, err := openIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	// no docsets are hidden, whoever can run this can read the index files
+	stats, err := collectStats(idx, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Index:        %s\n", indexPath)
+	fmt.Printf("Documents:    %d\n", stats.Documents)
+	fmt.Printf("Size on disk: %d bytes\n", stats.DiskBytes)
+	fmt.Printf("Shards:       %d\n", stats.Shards)
+	fmt.Printf("Schema:       %d\n", stats.SchemaVersion)
+	if b := stats.LastBuild; b != nil {
+		fmt.Printf("Last build:   %s (%dms)\n", b.Finished.Local().Format(time.RFC1123), b.DurationMS)
+	}
+	fmt.Println("Docsets:")
+	for _, ds := range stats.Docsets {
+		name := ds.Name
+		if name == "" {
+			name = "(top level)"
+		}
+		fmt.Printf("  %-30s %d\n", name, ds.Documents)
+	}
+
+	if !stats.DocsetsUpToDate {
+		return fmt.Errorf("the docset configuration changed since the index was built, run \"godochive index\"")
+	}
+	if !stats.AnalysisUpToDate {
+		return fmt.Errorf("the analysis configuration changed since the index was built, run \"godochive index\"")
+	}
+	if !stats.SchemaUpToDate {
+		return fmt.Errorf("the index has schema %d and this version needs %d, run \"godochive index\" or start the server to rebuild it", stats.SchemaVersion, schemaVersion)
+	}
+	fmt.Println("Status:       ok")
+	return nil
+}
+
+// runServer registers the routes and middleware and runs the HTTP server
+func runServer() error {
+	if len(config.Digests) > 0 {
+		if mailEnabled() {
+			go runDigests()
+		} else {
+			log.Println("Digests are configured but smtp is not, no digests will be sent")
+		}
+	}
+
+	if config.Retention.historyDays() > 0 || (config.Archive.Dir != "" && config.Archive.Keep > 0) || analyticsEnabled() {
+		go runRetention()
+	}
+
+	if err := loadTemplates(); err != nil {
+		return fmt.Errorf("parsing templates: %w", err)
+	}
+
+	http.HandleFunc("/", serveFiles)
+	http.Handle("/_static/", staticHandler())
+	http.HandleFunc("GET /widget.js", handleWidget)
+	http.HandleFunc("/search", handleSearch)
+	http.HandleFunc("GET /search/results", handleLiveSearch)
+	http.HandleFunc("GET /search/export", handleExport)
+	http.HandleFunc("GET /feed.atom", handleFeed)
+	http.HandleFunc("GET /sitemap.xml", handleSitemap)
+	http.HandleFunc("GET /browse", handleBrowse)
+	http.HandleFunc("GET /browse/dir", handleBrowseDir)
+	http.HandleFunc("GET /toc", handleTOC)
+	http.HandleFunc("GET /related", handleRelated)
+	http.HandleFunc("GET /archive", handleArchive)
+	http.HandleFunc("GET /archive/{date}/search", handleArchiveSearch)
+	http.HandleFunc("GET /archive/{date}/doc", handleArchiveDoc)
+	http.HandleFunc("GET /badge/{name}", handleBadge)
+	http.HandleFunc("/preferences", handlePreferences)
+	http.HandleFunc("GET /stats", handleStats)
+	http.HandleFunc("POST /search/open", handleOpenResult)
+	http.HandleFunc("GET /admin/analytics", handleAnalytics)
+	http.HandleFunc("GET /admin/zero-results", handleZeroResults)
+	http.HandleFunc("GET /admin/usage", handleUsagePage)
+	http.HandleFunc("POST /admin/synonyms", handleAddSynonymForm)
+	http.HandleFunc("GET /api/stats", handleAPIStats)
+	http.HandleFunc("GET /api/openapi.json", handleOpenAPI)
+	http.HandleFunc("/api/search", handleAPISearch)
+	http.HandleFunc("/api/msearch", handleMultiSearch)
+	http.HandleFunc("/api/count", handleAPICount)
+	http.HandleFunc("/api/terms", handleTopTerms)
+	http.HandleFunc("/api/terms/df", handleDocFreq)
+	http.HandleFunc("GET /api/suggest", handleAPISuggest)
+	http.HandleFunc("GET /api/similar/{path...}", handleAPISimilar)
+	http.HandleFunc("GET /api/doc/{id}/outline", handleAPIOutline)
+	http.HandleFunc("GET /api/semantic", handleAPISemantic)
+	http.HandleFunc("GET /api/context/{path...}", handleHitContext)
+	http.HandleFunc("POST /api/ask", handleAsk)
+	http.HandleFunc("POST /mcp", handleMCP)
+	http.HandleFunc("GET /api/alerts", handleListAlerts)
+	http.HandleFunc("POST /api/alerts", handleCreateAlert)
+	http.HandleFunc("DELETE /api/alerts/{id}", handleDeleteAlert)
+	http.HandleFunc("POST /api/share", handleShare)
+	http.HandleFunc("GET /api/saved", handleListSaved)
+	http.HandleFunc("POST /api/saved", handleCreateSaved)
+	http.HandleFunc("DELETE /api/saved/{id}", handleDeleteSaved)
+	http.HandleFunc("POST /search/saved", handleSaveSearchForm)
+	http.HandleFunc("POST /search/link", handleShortLinkForm)
+	http.HandleFunc("POST /api/links", handleCreateShortLink)
+	http.HandleFunc("GET /s/{id}", handleShortLink)
+	http.HandleFunc("GET /api/history", handleListHistory)
+	http.HandleFunc("DELETE /api/history", handleClearHistory)
+	http.HandleFunc("POST /search/history/clear", handleClearHistoryForm)
+	http.HandleFunc("GET /api/bookmarks", handleListBookmarks)
+	http.HandleFunc("POST /api/bookmarks", handleCreateBookmark)
+	http.HandleFunc("DELETE /api/bookmarks/{url...}", handleDeleteBookmark)
+	http.HandleFunc("GET /bookmarks", handleBookmarksPage)
+	http.HandleFunc("POST /bookmarks", handleToggleBookmark)
+	http.HandleFunc("GET /api/tags/{path...}", handleGetTags)
+	http.HandleFunc("PUT /api/tags/{path...}", handlePutTags)
+	http.HandleFunc("POST /tags", handleTagsForm)
+	http.HandleFunc("GET /api/notes", handleListNotes)
+	http.HandleFunc("POST /api/notes", handleCreateNote)
+	http.HandleFunc("DELETE /api/notes/{id}", handleDeleteNote)
+	http.HandleFunc("GET /notes", handleNotesPage)
+	http.HandleFunc("POST /notes", handleNotesForm)
+	http.HandleFunc("POST /api/admin/optimize", requireAdmin(handleOptimize))
+	http.HandleFunc("POST /api/admin/ingest", requireAdmin(handleIngest))
+	http.HandleFunc("GET /api/admin/usage", requireAdmin(handleUsage))
+	http.HandleFunc("GET /api/admin/analytics", requireAdmin(handleAPIAnalytics))
+	http.HandleFunc("GET /api/admin/zero-results", requireAdmin(handleAPIZeroResults))
+	http.HandleFunc("GET /api/admin/synonyms", requireAdmin(handleGetSynonyms))
+	http.HandleFunc("PUT /api/admin/synonyms", requireAdmin(handlePutSynonyms))
+	http.HandleFunc("POST /api/admin/synonyms/reload", requireAdmin(handleReloadSynonyms))
+	http.HandleFunc("GET /api/admin/trust/{path...}", requireAdmin(handleGetTrust))
+	http.HandleFunc("PUT /api/admin/trust/{path...}", requireAdmin(handlePutTrust))
+	http.HandleFunc("GET /api/admin/maintenance", requireAdmin(handleGetMaintenance))
+	http.HandleFunc("PUT /api/admin/maintenance", requireAdmin(handlePutMaintenance))
+	http.HandleFunc("DELETE /api/admin/maintenance", requireAdmin(handleDeleteMaintenance))
+	http.HandleFunc("POST /trust", handleTrustForm)
+	http.HandleFunc("/api/", handleAPINotFound)
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+
+	var handler http.Handler = duringMaintenance(http.DefaultServeMux)
+	if !config.Compress.Disabled {
+		minSize := config.Compress.MinSize
+		if minSize <= 0 {
+			minSize = 1024
+		}
+		handler = compressResponses(minSize, config.Compress.Types, handler)
+	}
+	if authEnabled() {
+		fmt.Println("Authentication enabled")
+		initSessionSecret()
+		handler = requireAuth(handler)
+	}
+	// after auth, so that failed logins are throttled too
+	if config.RateLimit.RequestsPerSecond > 0 {
+		fmt.Println("Rate limiting enabled")
+		limiter = newRateLimiter(config.RateLimit.RequestsPerSecond, config.RateLimit.Burst)
+		handler = limitRate(limiter, handler)
+	}
+	// outside auth, so failed requests from the widget are readable too
+	handler = allowCORS(handler)
+	// API versions are resolved first, so every check sees unversioned paths
+	handler = withRequestID(versionAPI(handler))
+	if oidcEnabled() {
+		var err error
+		if provider, err = discoverOIDC(config.Auth.OIDC.Issuer); err != nil {
+			return fmt.Errorf("discovering OIDC provider: %w", err)
+		}
+		http.HandleFunc("/auth/login", handleLogin)
+		http.HandleFunc("/auth/callback", handleCallback)
+		http.HandleFunc("/auth/logout", handleLogout)
+	}
+
+	fmt.Println("Server running at http://localhost:3030/search")
+	return http.ListenAndServe(":3030", handler)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressResponses(t *testing.T) {
+	body := strings.Repeat("documentation ", 200)
+	h := compressResponses(1024, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, body)
+		case "/small":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, "tiny")
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, body)
+		}
+	}))
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept-Encoding", accept)
+		return serve(h, r)
+	}
+
+	rec := get("/big", "gzip, deflate")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("large HTML response was not compressed")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != body {
+		t.Error("decompressed body does not match")
+	}
+
+	for _, tt := range []struct{ path, accept string }{
+		{"/small", "gzip"},
+		{"/image", "gzip"},
+		{"/big", "gzip;q=0"},
+		{"/big", ""},
+	} {
+		if rec := get(tt.path, tt.accept); rec.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s with Accept-Encoding %q was compressed", tt.path, tt.accept)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config holds the settings read from the optional JSON config file
+type Config struct {
+	Auth      AuthConfig      `json:"auth"`
+	Docsets   []DocsetConfig  `json:"docsets"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	SMTP      SMTPConfig      `json:"smtp"`
+	Digests   []DigestConfig  `json:"digests"`
+	Webhooks  []WebhookConfig `json:"webhooks"`
+	// StandbyIndexPath is a copy of the index, ideally on another disk,
+	// that searches fail over to when the primary becomes unreadable
+	StandbyIndexPath string         `json:"standby_index_path"`
+	Compress         CompressConfig `json:"compression"`
+	Theme            ThemeConfig    `json:"theme"`
+	Widget           WidgetConfig   `json:"widget"`
+	// CacheControl is sent with served documentation files. Defaults to
+	// "no-cache" so browsers revalidate with the ETag or Last-Modified date.
+	CacheControl string `json:"cache_control"`
+	// BaseURL is the public address of the server, used for links in
+	// notifications
+	BaseURL string `json:"base_url"`
+	// AlertWebhookHosts are the hosts alert webhooks may point at even
+	// though they resolve to loopback, link-local or private addresses
+	AlertWebhookHosts []string `json:"alert_webhook_hosts"`
+	// SearchableNotes indexes the text of shared notes with their document,
+	// so searches match it
+	SearchableNotes bool `json:"searchable_notes"`
+	// DocumentTOC puts a table of contents at the top of served HTML pages
+	DocumentTOC bool            `json:"document_toc"`
+	Archive     ArchiveConfig   `json:"archive"`
+	Retention   RetentionConfig `json:"retention"`
+	Analysis    AnalysisConfig  `json:"analysis"`
+	// DocumentRelated lists related documents at the bottom of served HTML
+	// pages, see similar.go
+	DocumentRelated bool `json:"document_related"`
+	// DocumentBookmark puts a star on served HTML pages that adds them to
+	// the visitor's bookmarks or removes them
+	DocumentBookmark bool `json:"document_bookmark"`
+	// SynonymsFile lists words that mean the same, one group per line like
+	// "k8s, kubernetes"; admins can edit it through the API
+	SynonymsFile string        `json:"synonyms_file"`
+	Ranking      RankingConfig `json:"ranking"`
+	// Embeddings turns on semantic search, see embeddings.go
+	Embeddings EmbeddingsConfig `json:"embeddings"`
+	// LLM is the language model /api/ask writes answers with, see ask.go
+	LLM LLMConfig `json:"llm"`
+	// Home is where / redirects to instead of listing the root directory:
+	// a path like "/search?docset=guides", or the name of a docset to land
+	// on its directory
+	Home string `json:"home"`
+	// Index tunes how the index is stored and built, see tuning.go
+	Index IndexConfig `json:"index"`
+	// Federation lists other instances searched along with this one, see
+	// federation.go
+	Federation FederationConfig `json:"federation"`
+	// Sources are remote docs the fetch command copies below the docs
+	// root, see sources.go
+	Sources []SourceConfig `json:"sources"`
+	// Analytics records searches and opened results for the admin
+	// dashboard, see analytics.go
+	Analytics AnalyticsConfig `json:"analytics"`
+	// SlowQueryMS logs searches that take longer than this many
+	// milliseconds, with where the time went; off when zero
+	SlowQueryMS int `json:"slow_query_ms"`
+}
+
+// AnalyticsConfig turns on search analytics. Searches and opened results
+// are counted per day, without anything that identifies who searched.
+type AnalyticsConfig struct {
+	Enabled bool `json:"enabled"`
+	// Days is how many days of analytics are kept, 90 when unset
+	Days int `json:"days"`
+	// MinSearches leaves queries searched fewer times than this out of the
+	// dashboard, so rare queries that may hold personal details aren't shown
+	MinSearches int `json:"min_searches"`
+}
+
+// SourceConfig is remote documentation kept as a copy below the docs root,
+// so it's indexed and served like local docs
+type SourceConfig struct {
+	Name string `json:"name"`
+	// Type is how the docs are fetched: "crawl" follows the links of a
+	// website from URL, "git" keeps a shallow clone of the repository at
+	// URL, "s3" mirrors the objects of an S3 bucket
+	Type string `json:"type"`
+	// Dir is where the copy is kept, relative to the docs root; the name
+	// when unset
+	Dir   string      `json:"dir"`
+	URL   string      `json:"url"`
+	Crawl CrawlConfig `json:"crawl"`
+	S3    S3Config    `json:"s3"`
+	// Branch is the git branch cloned, the repository's default when unset
+	Branch string `json:"branch"`
+	// RefreshMinutes makes the server fetch the source again this often and
+	// index what changed; only the fetch command updates it when unset
+	RefreshMinutes int `json:"refresh_minutes"`
+}
+
+// S3Config names the bucket of an S3 source. Other S3-compatible services,
+// like MinIO, are reached through Endpoint; buckets are addressed by path.
+type S3Config struct {
+	// Endpoint is the base URL of the service, AWS's in Region when unset
+	Endpoint string `json:"endpoint"`
+	// Region is the bucket's region, us-east-1 when unset
+	Region string `json:"region"`
+	Bucket string `json:"bucket"`
+	// Prefix limits the source to the keys starting with it; it's left out
+	// of the paths of the copies
+	Prefix string `json:"prefix"`
+	// AccessKeyID and SecretAccessKey sign the requests. Unset, they are
+	// read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, and requests
+	// go unsigned without those, for public buckets.
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+// CrawlConfig bounds the crawl of a website. Pages are only fetched from
+// the host of the source's URL and Hosts, where robots.txt allows it.
+type CrawlConfig struct {
+	// MaxDepth is how many links away from the URL pages are fetched, 3
+	// when unset
+	MaxDepth int `json:"max_depth"`
+	// MaxPages stops the crawl after this many pages, 1000 when unset
+	MaxPages int      `json:"max_pages"`
+	Hosts    []string `json:"hosts"`
+	// Concurrency is how many pages are fetched at once, 4 when unset
+	Concurrency int `json:"concurrency"`
+	// DelayMS is how long each fetcher waits between pages; robots.txt can
+	// ask for longer
+	DelayMS int `json:"delay_ms"`
+}
+
+// FederationConfig lists the peer instances /api/search?federated=1 also
+// searches, over their JSON API
+type FederationConfig struct {
+	// Name labels the hits of this instance, "local" when unset
+	Name  string       `json:"name"`
+	Peers []PeerConfig `json:"peers"`
+	// TimeoutMS is how long peers get to answer, 3000 when unset; the hits
+	// of slower ones are left out
+	TimeoutMS int `json:"timeout_ms"`
+}
+
+// PeerConfig is another GoDocHive instance. Its hits are whatever Token may
+// read there for the callers Token is used for, and what anyone may read
+// there for the others.
+type PeerConfig struct {
+	// Name labels the peer's hits
+	Name string `json:"name"`
+	// URL is the peer's address, like "https://docs.payments.example.com"
+	URL   string `json:"url"`
+	Token string `json:"token"`
+	// Groups are the callers Token is sent for; when empty it's sent for
+	// every signed-in caller. Anonymous searches never carry it.
+	Groups []string `json:"groups"`
+}
+
+// IndexConfig selects the index format and bounds the work and memory of
+// builds. Type takes effect when the index is next built, the rest when it
+// is next built or opened.
+type IndexConfig struct {
+	// Type is "scorch", the default, or "upside_down", bleve's older
+	// key/value format. Archives, backups, the standby index and the
+	// optimize command need scorch.
+	Type string `json:"type"`
+	// BatchSize is how many documents are indexed per batch, 500 when
+	// unset. Larger batches index faster and take more memory.
+	BatchSize int `json:"batch_size"`
+	// MemoryQuotaMB applies a batch early once its documents take this
+	// much memory, so a few huge files don't blow up a build
+	MemoryQuotaMB int         `json:"memory_quota_mb"`
+	Merge         MergeConfig `json:"merge"`
+	// Shards splits a new index into this many indexes, for trees of
+	// millions of documents; 1 when unset. Existing indexes keep their
+	// number of shards until the reshard command changes it.
+	Shards int `json:"shards"`
+	// FollowSymlinks indexes the docs below symlinked directories too;
+	// otherwise only symlinked files are
+	FollowSymlinks bool `json:"follow_symlinks"`
+	// MaxDepth is how many directories below the root are walked when
+	// symlinks are followed, 32 when unset
+	MaxDepth int `json:"max_depth"`
+	// Bundles indexes the files inside .zip, .tar and .tar.gz doc bundles,
+	// under URLs like docs/go.zip!/net/http.html, and serves them from the
+	// bundle
+	Bundles bool `json:"bundles"`
+	// FileTypes maps more extensions to the type of document they hold,
+	// "html", "md" or "txt", like {".xhtml": "html"}. Files with these
+	// extensions are indexed too.
+	FileTypes map[string]string `json:"file_types"`
+	// Sniff indexes files without an extension whose content looks like
+	// HTML or text
+	Sniff bool `json:"sniff"`
+}
+
+// MergeConfig is the policy scorch merges index segments with in the
+// background. Unset fields keep bleve's defaults.
+type MergeConfig struct {
+	// MaxSegmentsPerTier is how many segments of about the same size are
+	// kept before they are merged; fewer means more merging and faster
+	// searches
+	MaxSegmentsPerTier int `json:"max_segments_per_tier"`
+	// MaxSegmentDocs is the most documents a merged segment holds
+	MaxSegmentDocs int `json:"max_segment_docs"`
+	// SegmentsPerMergeTask is how many segments are merged at once
+	SegmentsPerMergeTask int `json:"segments_per_merge_task"`
+}
+
+// LLMConfig names an OpenAI-compatible chat completions API. /api/ask is
+// off when URL is empty.
+type LLMConfig struct {
+	// URL is the API base, like "https://api.openai.com/v1" or
+	// "http://localhost:8080/v1"
+	URL    string `json:"url"`
+	Model  string `json:"model"`
+	APIKey string `json:"api_key"`
+}
+
+// EmbeddingsConfig names the model that embeds documents for semantic
+// search. It is off when URL is empty.
+type EmbeddingsConfig struct {
+	// Provider is the API spoken, "openai" when unset: the OpenAI
+	// embeddings API, also offered by llama.cpp's server and other local
+	// model servers
+	Provider string `json:"provider"`
+	// URL is the API base, like "https://api.openai.com/v1" or
+	// "http://localhost:8080/v1"
+	URL    string `json:"url"`
+	Model  string `json:"model"`
+	APIKey string `json:"api_key"`
+	// HybridWeight is the share semantic ranks get in searches with
+	// mode=hybrid, between 0 and 1; 0.5 when unset
+	HybridWeight float64 `json:"hybrid_weight"`
+}
+
+// RankingConfig tunes the rankers of ranking.go
+type RankingConfig struct {
+	// RecencyBoost is the most the recency ranker raises the score of a
+	// just-modified document, 0.2 for 20% when unset
+	RecencyBoost float64 `json:"recency_boost"`
+	// RecencyHalfLifeDays is the age at which the boost has halved, 180
+	// when unset
+	RecencyHalfLifeDays float64 `json:"recency_half_life_days"`
+}
+
+// RetentionConfig bounds the data a long-running server keeps. Archived
+// snapshots are bounded by ArchiveConfig.Keep.
+type RetentionConfig struct {
+	// HistoryDays drops the search history of users who haven't searched
+	// for this many days, 90 when unset; histories are kept when negative
+	HistoryDays int `json:"history_days"`
+}
+
+// defaultHistoryDays is how long idle search histories are kept by default
+const defaultHistoryDays = 90
+
+func (c RetentionConfig) historyDays() int {
+	if c.HistoryDays == 0 {
+		return defaultHistoryDays
+	}
+	return c.HistoryDays
+}
+
+// ArchiveConfig keeps dated copies of the index, so searches can be run
+// against the docs as they were
+type ArchiveConfig struct {
+	// Dir holds one snapshot per day, in directories named like 2024-05-01
+	Dir string `json:"dir"`
+	// Keep is how many snapshots are kept, every one when zero
+	Keep int `json:"keep"`
+}
+
+// ThemeConfig points at directories whose files override the embedded
+// templates and static assets
+type ThemeConfig struct {
+	TemplatesDir string `json:"templates_dir"`
+	StaticDir    string `json:"static_dir"`
+}
+
+// WidgetConfig configures the embeddable search widget at /widget.js
+type WidgetConfig struct {
+	// AllowedOrigins are the sites, like "https://wiki.example.com", whose
+	// pages may call the JSON API through the widget
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+// CompressConfig controls gzip compression of responses
+type CompressConfig struct {
+	Disabled bool `json:"disabled"`
+	// MinSize is the smallest body in bytes that gets compressed
+	MinSize int `json:"min_size"`
+	// Types are content type prefixes to compress, e.g. "text/"
+	Types []string `json:"types"`
+}
+
+// DigestConfig schedules an email summarising new and updated documents
+type DigestConfig struct {
+	Name       string   `json:"name"`
+	Recipients []string `json:"recipients"`
+	// Docsets limits the digest to these docsets. Restricted docsets are
+	// only included when listed here.
+	Docsets       []string `json:"docsets"`
+	IntervalHours int      `json:"interval_hours"`
+}
+
+// WebhookConfig is an outgoing webhook for index lifecycle events. An empty
+// Events list subscribes to every event.
+type WebhookConfig struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// SMTPConfig is the mail server used for email notifications
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// RateLimitConfig enables per-IP rate limiting of /search and /api/*.
+// It is disabled when RequestsPerSecond is zero.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+	TrustProxy        bool    `json:"trust_proxy"`
+	TrustedHops       int     `json:"trusted_hops"`
+}
+
+// DocsetConfig names a directory below the root as a docset. When Groups is
+// set, only members of one of those groups can search or read it.
+type DocsetConfig struct {
+	Name   string   `json:"name"`
+	Path   string   `json:"path"`
+	Groups []string `json:"groups"`
+	// Version marks the docset as one version of the docs, e.g. "v2".
+	// Versions of the same docs share a name and differ in path.
+	Version string `json:"version"`
+	// SnippetSources is the order in which result snippets are picked:
+	// "meta_description", "first_paragraph" and "highlight". The start of
+	// the content is used when none of them has text.
+	SnippetSources []string `json:"snippet_sources"`
+	// Rankers reorder the best hits from the docset, see ranking.go:
+	// "deprecated" and "recency". Unset means ["deprecated"], an empty
+	// list leaves bleve's order.
+	Rankers []string `json:"rankers"`
+	// Trust is the trust level of the docset's documents, "official" or
+	// "community", shown as a badge on results; see trust.go
+	Trust string `json:"trust"`
+}
+
+// AuthConfig lists the credentials accepted by the auth middleware.
+// Auth is disabled when no users, tokens or OIDC issuer are configured.
+type AuthConfig struct {
+	Realm         string      `json:"realm"`
+	Users         []AuthUser  `json:"users"`
+	Tokens        []AuthToken `json:"tokens"`
+	OIDC          OIDCConfig  `json:"oidc"`
+	SessionSecret string      `json:"session_secret"`
+	SessionHours  int         `json:"session_hours"`
+	// AdminGroups may use the /api/admin/ endpoints
+	AdminGroups []string `json:"admin_groups"`
+	// PublicRoutes are the route groups open without logging in, see
+	// routeGroup. Only "read" and "write" can be made public.
+	PublicRoutes []string `json:"public_routes"`
+}
+
+// OIDCConfig configures login through an OpenID Connect provider
+type OIDCConfig struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	GroupsClaim  string   `json:"groups_claim"`
+}
+
+// AuthUser is a username/password pair for HTTP basic auth
+type AuthUser struct {
+	Name     string   `json:"name"`
+	Password string   `json:"password"`
+	Groups   []string `json:"groups"`
+}
+
+// AuthToken is a static bearer token
+type AuthToken struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Groups []string `json:"groups"`
+}
+
+var config Config
+
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+	for _, ds := range cfg.Docsets {
+		for _, name := range ds.Rankers {
+			if !knownRanker(name) {
+				return cfg, fmt.Errorf("docsets: %q has unknown ranker %q", ds.Name, name)
+			}
+		}
+		if ds.Trust != "" && !contains(trustLevels, ds.Trust) {
+			return cfg, fmt.Errorf("docsets: %q has unknown trust level %q", ds.Name, ds.Trust)
+		}
+	}
+	if cfg.Ranking.RecencyBoost < 0 || cfg.Ranking.RecencyHalfLifeDays < 0 {
+		return cfg, fmt.Errorf("ranking: recency_boost and recency_half_life_days can't be negative")
+	}
+	if p := cfg.Embeddings.Provider; p != "" && embeddingProviders[p] == nil {
+		return cfg, fmt.Errorf("embeddings: unknown provider %q", p)
+	}
+	if w := cfg.Embeddings.HybridWeight; w < 0 || w > 1 {
+		return cfg, fmt.Errorf("embeddings: hybrid_weight must be between 0 and 1")
+	}
+	if cfg.SlowQueryMS < 0 {
+		return cfg, fmt.Errorf("slow_query_ms can't be negative")
+	}
+	if err := validateHome(cfg); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Analysis.validate(); err != nil {
+		return cfg, err
+	}
+	cfg.Analysis.normalize()
+	if err := cfg.Index.validate(); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Federation.validate(); err != nil {
+		return cfg, err
+	}
+	if err := validateSources(cfg.Sources); err != nil {
+		return cfg, err
+	}
+	for _, group := range cfg.Auth.PublicRoutes {
+		if group != routeRead && group != routeWrite {
+			return cfg, fmt.Errorf("auth.public_routes: %q can't be public, use %q or %q", group, routeRead, routeWrite)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	defaultCrawlDepth       = 3
+	defaultCrawlPages       = 1000
+	defaultCrawlConcurrency = 4
+	// maxCrawlPage bounds the body read from a page
+	maxCrawlPage = 8 << 20
+	// crawlAgent is the crawler's name in robots.txt and its User-Agent
+	crawlAgent = "godochive"
+)
+
+var crawlClient = &http.Client{Timeout: 30 * time.Second}
+
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+func validateCrawl(s SourceConfig) error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("crawl needs an http or https url, not %q", s.URL)
+	}
+	c := s.Crawl
+	if c.MaxDepth < 0 || c.MaxPages < 0 || c.Concurrency < 0 || c.DelayMS < 0 {
+		return fmt.Errorf("crawl settings can't be negative")
+	}
+	return nil
+}
+
+// fetchCrawl copies the pages of a website into dir, following its links
+// breadth first from the source's URL. Pages are saved under their host and
+// path, and their links to other saved pages are made relative, so the copy
+// is browsable offline; other links are made absolute.
+func fetchCrawl(ctx context.Context, src SourceConfig, dir string) error {
+	return replaceDir(dir, func(tmp string) error {
+		return newCrawler(src, tmp).run(ctx)
+	})
+}
+
+type crawler struct {
+	src         SourceConfig
+	dir         string
+	seed        *url.URL
+	hosts       map[string]bool
+	maxDepth    int
+	maxPages    int64
+	concurrency int
+
+	pages atomic.Int64
+
+	mu     sync.Mutex
+	seen   map[string]bool
+	robots map[string]*robotsRules
+	// nextFetch is when each host may be fetched from again, shared by
+	// the workers so the delay holds for the crawl as a whole
+	nextFetch map[string]time.Time
+	assets    map[string]*crawlAsset
+}
+
+// crawlAsset is an image, script or stylesheet of the crawled pages, saved
+// once however many pages use it
+type crawlAsset struct {
+	done  chan struct{}
+	saved bool
+}
+
+func newCrawler(src SourceConfig, dir string) *crawler {
+	seed, _ := url.Parse(src.URL)
+	seed.Fragment, seed.RawQuery = "", ""
+	c := &crawler{
+		src:         src,
+		dir:         dir,
+		seed:        seed,
+		hosts:       map[string]bool{strings.ToLower(seed.Host): true},
+		maxDepth:    src.Crawl.MaxDepth,
+		maxPages:    int64(src.Crawl.MaxPages),
+		concurrency: src.Crawl.Concurrency,
+		seen:        make(map[string]bool),
+		robots:      make(map[string]*robotsRules),
+		nextFetch:   make(map[string]time.Time),
+		assets:      make(map[string]*crawlAsset),
+	}
+	for _, h := range src.Crawl.Hosts {
+		c.hosts[strings.ToLower(h)] = true
+	}
+	if c.maxDepth == 0 {
+		c.maxDepth = defaultCrawlDepth
+	}
+	if c.maxPages == 0 {
+		c.maxPages = defaultCrawlPages
+	}
+	if c.concurrency == 0 {
+		c.concurrency = defaultCrawlConcurrency
+	}
+	return c
+}
+
+func (c *crawler) run(ctx context.Context) error {
+	c.seen[c.seed.String()] = true
+	level := []*url.URL{c.seed}
+	for depth := 0; len(level) > 0 && depth <= c.maxDepth; depth++ {
+		var next []*url.URL
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, c.concurrency)
+		for _, u := range level {
+			if c.pages.Load() >= c.maxPages || ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(u *url.URL) {
+				defer func() { <-sem; wg.Done() }()
+				links, err := c.fetch(ctx, u)
+				if err != nil {
+					log.Printf("Skipping %s: %v", u, err)
+					return
+				}
+				if depth == c.maxDepth {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				for _, link := range links {
+					if c.visit(link) {
+						next = append(next, link)
+					}
+				}
+			}(u)
+		}
+		wg.Wait()
+		level = next
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.pages.Load() == 0 {
+		return fmt.Errorf("no page could be fetched from %s", c.seed)
+	}
+	return nil
+}
+
+// visit reports whether u is to be crawled: it's on an allowed host and
+// wasn't seen before
+func (c *crawler) visit(u *url.URL) bool {
+	if !c.inScope(u) {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := u.String()
+	if c.seen[key] {
+		return false
+	}
+	c.seen[key] = true
+	return true
+}
+
+func (c *crawler) inScope(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && c.hosts[strings.ToLower(u.Host)]
+}
+
+// waitTurn waits until the host of u may be fetched from again: the
+// source's delay or the host's Crawl-delay after the previous fetch from it
+// by any worker
+func (c *crawler) waitTurn(ctx context.Context, u *url.URL, rules *robotsRules) error {
+	delay := max(time.Duration(c.src.Crawl.DelayMS)*time.Millisecond, rules.delay)
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(time.Until(c.reserve(strings.ToLower(u.Host), delay))):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve books the next fetch from host, delay after the one booked
+// before it, and returns when it may start
+func (c *crawler) reserve(host string, delay time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	at := time.Now()
+	if next := c.nextFetch[host]; next.After(at) {
+		at = next
+	}
+	c.nextFetch[host] = at.Add(delay)
+	return at
+}
+
+// fetch saves the page at u and returns the pages it links to
+func (c *crawler) fetch(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	rules := c.robotsFor(ctx, u)
+	if !rules.allowed(u.EscapedPath()) {
+		return nil, errRobotsDisallowed
+	}
+	if err := c.waitTurn(ctx, u, rules); err != nil {
+		return nil, err
+	}
+	if c.pages.Add(1) > c.maxPages {
+		c.pages.Add(-1)
+		return nil, fmt.Errorf("the crawl reached %d pages", c.maxPages)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		c.pages.Add(-1)
+		return nil, err
+	}
+	req.Header.Set("User-Agent", crawlAgent)
+	res, err := crawlClient.Do(req)
+	if err != nil {
+		c.pages.Add(-1)
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxCrawlPage))
+	if err == nil && res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("answered %s", res.Status)
+	}
+	if err == nil && !c.inScope(res.Request.URL) {
+		err = fmt.Errorf("redirected off the crawled hosts to %s", res.Request.URL)
+	}
+	if err != nil {
+		c.pages.Add(-1)
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	file := crawlPath(u)
+	var links []*url.URL
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		body, links = c.rewriteLinks(ctx, body, res.Request.URL, file)
+	case "text/plain", "text/markdown":
+		if ext := path.Ext(u.Path); ext != ".txt" && ext != ".md" && ext != ".markdown" {
+			file = strings.TrimSuffix(file, "/index.html") + ".txt"
+		}
+	default:
+		c.pages.Add(-1)
+		return nil, fmt.Errorf("%s isn't a document", mediaType)
+	}
+	full := filepath.Join(c.dir, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return nil, err
+	}
+	return links, os.WriteFile(full, body, 0o644)
+}
+
+// crawlPath is where the page at u is saved, relative to the copy: its
+// host and path, with pages without an extension saved as the index.html
+// of a directory, so the links between them keep working
+func crawlPath(u *url.URL) string {
+	host := strings.ReplaceAll(strings.ToLower(u.Host), ":", "_")
+	p := path.Clean("/" + u.Path)
+	switch path.Ext(p) {
+	case ".html", ".htm", ".xhtml", ".md", ".markdown", ".txt":
+		return host + p
+	}
+	return strings.TrimSuffix(host+p, "/") + "/index.html"
+}
+
+// assetPath is where the asset at u is saved, relative to the copy: its
+// host and path, with a hash of the query for assets that differ only in it
+func assetPath(u *url.URL) string {
+	host := strings.ReplaceAll(strings.ToLower(u.Host), ":", "_")
+	p := path.Clean("/" + u.Path)
+	if p == "/" || strings.HasSuffix(u.Path, "/") {
+		p = path.Join(p, "index")
+	}
+	if u.RawQuery != "" {
+		sum := sha256.Sum256([]byte(u.RawQuery))
+		ext := path.Ext(p)
+		p = strings.TrimSuffix(p, ext) + "-" + hex.EncodeToString(sum[:4]) + ext
+	}
+	return host + p
+}
+
+// saveAsset fetches the asset at u into the copy, once for the whole
+// crawl, and reports whether it's there
+func (c *crawler) saveAsset(ctx context.Context, u *url.URL) bool {
+	key := u.String()
+	c.mu.Lock()
+	a, started := c.assets[key]
+	if !started {
+		a = &crawlAsset{done: make(chan struct{})}
+		c.assets[key] = a
+	}
+	c.mu.Unlock()
+	if started {
+		select {
+		case <-a.done:
+			return a.saved
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	defer close(a.done)
+	if err := c.fetchAsset(ctx, u); err != nil {
+		log.Printf("Linking %s instead of saving it: %v", u, err)
+		return false
+	}
+	a.saved = true
+	return true
+}
+
+// fetchAsset saves the asset at u, up to maxCrawlPage
+func (c *crawler) fetchAsset(ctx context.Context, u *url.URL) error {
+	rules := c.robotsFor(ctx, u)
+	if !rules.allowed(u.EscapedPath()) {
+		return errRobotsDisallowed
+	}
+	if err := c.waitTurn(ctx, u, rules); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", crawlAgent)
+	res, err := crawlClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("answered %s", res.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxCrawlPage+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxCrawlPage {
+		return fmt.Errorf("larger than %d MB", maxCrawlPage>>20)
+	}
+	full := filepath.Join(c.dir, filepath.FromSlash(assetPath(u)))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(full, body, 0o644)
+}
+
+// isAsset reports whether the attribute key of n loads something the page
+// needs to display: a src, or the href of a stylesheet
+func isAsset(n *html.Node, key string) bool {
+	if key == "src" {
+		return true
+	}
+	if n.Data != "link" || key != "href" {
+		return false
+	}
+	for _, rel := range strings.Fields(strings.ToLower(attr(n, "rel"))) {
+		if rel == "stylesheet" || rel == "icon" {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteLinks makes the links of the page saved at file relative when they
+// lead to other pages of the crawl, and absolute otherwise. Images, scripts
+// and stylesheets from the crawled hosts are saved next to the pages and
+// referenced there. It returns the rewritten page and the pages it links to.
+func (c *crawler) rewriteLinks(ctx context.Context, body []byte, base *url.URL, file string) ([]byte, []*url.URL) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return body, nil
+	}
+	var links []*url.URL
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, attr := range n.Attr {
+				if attr.Key != "href" && attr.Key != "src" {
+					continue
+				}
+				ref, err := base.Parse(strings.TrimSpace(attr.Val))
+				if err != nil || (ref.Scheme != "http" && ref.Scheme != "https") {
+					continue
+				}
+				n.Attr[i].Val = ref.String()
+				if isAsset(n, attr.Key) && c.inScope(ref) {
+					asset := *ref
+					asset.Fragment = ""
+					if c.saveAsset(ctx, &asset) {
+						if rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(file)), filepath.FromSlash(assetPath(&asset))); err == nil {
+							n.Attr[i].Val = filepath.ToSlash(rel)
+						}
+					}
+					continue
+				}
+				if n.Data != "a" || attr.Key != "href" || !c.inScope(ref) {
+					continue
+				}
+				page := *ref
+				page.Fragment, page.RawQuery = "", ""
+				links = append(links, &page)
+				rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(file)), filepath.FromSlash(crawlPath(&page)))
+				if err != nil {
+					continue
+				}
+				n.Attr[i].Val = filepath.ToSlash(rel)
+				if ref.Fragment != "" {
+					n.Attr[i].Val += "#" + ref.Fragment
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return body, links
+	}
+	return buf.Bytes(), links
+}
+
+// robotsFor returns the robots.txt rules of u's host for the crawler,
+// fetching them the first time
+func (c *crawler) robotsFor(ctx context.Context, u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	rules := c.robots[key]
+	c.mu.Unlock()
+	if rules != nil {
+		return rules
+	}
+	rules = fetchRobots(ctx, key)
+	c.mu.Lock()
+	c.robots[key] = rules
+	c.mu.Unlock()
+	return rules
+}
+
+func fetchRobots(ctx context.Context, site string) *robotsRules {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, site+"/robots.txt", nil)
+	if err != nil {
+		return &robotsRules{disallowAll: true}
+	}
+	req.Header.Set("User-Agent", crawlAgent)
+	res, err := crawlClient.Do(req)
+	if err != nil {
+		log.Printf("Not crawling %s: fetching robots.txt failed: %v", site, err)
+		return &robotsRules{disallowAll: true}
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusOK:
+		return parseRobots(io.LimitReader(res.Body, maxCrawlPage), crawlAgent)
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		// no robots.txt, everything is allowed
+		return &robotsRules{}
+	default:
+		log.Printf("Not crawling %s: robots.txt answered %s", site, res.Status)
+		return &robotsRules{disallowAll: true}
+	}
+}
+
+// robotsRules are the rules of a robots.txt that apply to the crawler
+type robotsRules struct {
+	allow, disallow []string
+	delay           time.Duration
+	// disallowAll is set when robots.txt couldn't be read
+	disallowAll bool
+}
+
+// parseRobots reads the group of robots.txt that names agent, or the one
+// for every crawler when none does
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	groups := make(map[string]*robotsRules)
+	var current []string
+	inAgents := false
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if key == "user-agent" {
+			if !inAgents {
+				current = nil
+			}
+			name := strings.ToLower(value)
+			current = append(current, name)
+			if groups[name] == nil {
+				groups[name] = &robotsRules{}
+			}
+			inAgents = true
+			continue
+		}
+		inAgents = false
+		for _, name := range current {
+			g := groups[name]
+			switch key {
+			case "allow":
+				if value != "" {
+					g.allow = append(g.allow, value)
+				}
+			case "disallow":
+				if value != "" {
+					g.disallow = append(g.disallow, value)
+				}
+			case "crawl-delay":
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+					g.delay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+	if g := groups[strings.ToLower(agent)]; g != nil {
+		return g
+	}
+	if g := groups["*"]; g != nil {
+		return g
+	}
+	return &robotsRules{}
+}
+
+// allowed reports whether the rules allow the path p. The longest matching
+// rule wins, and allow wins a tie.
+func (r *robotsRules) allowed(p string) bool {
+	if r.disallowAll {
+		return false
+	}
+	if p == "" {
+		p = "/"
+	}
+	best, allow := -1, true
+	for _, rule := range r.allow {
+		if len(rule) > best && robotsMatch(rule, p) {
+			best, allow = len(rule), true
+		}
+	}
+	for _, rule := range r.disallow {
+		if len(rule) > best && robotsMatch(rule, p) {
+			best, allow = len(rule), false
+		}
+	}
+	return allow
+}
+
+// robotsMatch matches a path against a robots.txt rule: a prefix, in which
+// * matches anything and a final $ anchors the end
+func robotsMatch(rule, p string) bool {
+	if !strings.ContainsAny(rule, "*$") {
+		return strings.HasPrefix(p, rule)
+	}
+	pattern := regexp.QuoteMeta(rule)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	if strings.HasSuffix(pattern, `\$`) {
+		pattern = strings.TrimSuffix(pattern, `\$`) + "$"
+	}
+	re, err := regexp.Compile("^" + pattern)
+	return err == nil && re.MatchString(p)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCrawl(t *testing.T) {
+	pages := map[string]string{
+		"/":                    `<title>Home</title><a href="/guide/">Guide</a> <a href="/private/secret.html">Secret</a> <a href="https://example.com/">Elsewhere</a> <a href="guide/intro.html#top">Intro</a>`,
+		"/guide/":              `<title>Guide</title><a href="deep">Deep</a><img src="/logo.png"><script src="/gone.js"></script><img src="https://example.com/badge.png">`,
+		"/guide/intro.html":    `<title>Intro</title><a href="../">Home</a>`,
+		"/guide/deep":          `<title>Deep</title><a href="/guide/deeper/">Deeper</a>`,
+		"/guide/deeper/":       `<title>Deeper</title>`,
+		"/private/secret.html": `<title>Secret</title>`,
+	}
+	var mu sync.Mutex
+	fetched := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+			return
+		}
+		mu.Lock()
+		fetched[r.URL.Path] = true
+		mu.Unlock()
+		if r.URL.Path == "/logo.png" {
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "site")
+	src := SourceConfig{Name: "site", Type: "crawl", URL: srv.URL + "/", Crawl: CrawlConfig{MaxDepth: 2, Concurrency: 2}}
+	if err := fetchCrawl(context.Background(), src, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	host := strings.ReplaceAll(u.Host, ":", "_")
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(filepath.Join(dir, host), path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	// deeper is three links away and private is disallowed
+	if got := strings.Join(files, ","); got != "guide/deep/index.html,guide/index.html,guide/intro.html,index.html,logo.png" {
+		t.Errorf("saved %s", got)
+	}
+	if fetched["/private/secret.html"] {
+		t.Error("a page robots.txt disallows was fetched")
+	}
+
+	home, err := os.ReadFile(filepath.Join(dir, host, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`href="guide/index.html"`, `href="guide/intro.html#top"`, `href="https://example.com/"`} {
+		if !strings.Contains(string(home), want) {
+			t.Errorf("home page lacks %s: %s", want, home)
+		}
+	}
+	guide, _ := os.ReadFile(filepath.Join(dir, host, "guide", "index.html"))
+	// the image is saved with the copy; the script that can't be fetched
+	// and the image on another host are linked where they are
+	for _, want := range []string{`src="../logo.png"`, `src="` + srv.URL + `/gone.js"`, `src="https://example.com/badge.png"`} {
+		if !strings.Contains(string(guide), want) {
+			t.Errorf("guide lacks %s: %s", want, guide)
+		}
+	}
+
+	// a failed crawl leaves the copy alone
+	src.URL = srv.URL + "/missing/"
+	if err := fetchCrawl(context.Background(), src, dir); err == nil {
+		t.Error("crawling nothing succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, host, "index.html")); err != nil {
+		t.Errorf("the copy is gone after a failed crawl: %v", err)
+	}
+}
+
+func TestCrawlDelayPerHost(t *testing.T) {
+	c := newCrawler(SourceConfig{URL: "https://docs.example.com/", Crawl: CrawlConfig{Concurrency: 4}}, t.TempDir())
+	// four workers asking at once still get one fetch a second from the
+	// host, while another host has its own turns
+	var slots []time.Time
+	for i := 0; i < 4; i++ {
+		slots = append(slots, c.reserve("docs.example.com", time.Second))
+	}
+	for i := 1; i < len(slots); i++ {
+		if gap := slots[i].Sub(slots[i-1]); gap != time.Second {
+			t.Errorf("fetch %d came %v after the one before, want 1s", i, gap)
+		}
+	}
+	if other := c.reserve("static.example.com", time.Second); other.After(slots[1]) {
+		t.Errorf("another host waited for docs.example.com until %v", other)
+	}
+}
+
+func TestAssetPath(t *testing.T) {
+	tests := map[string]string{
+		"https://docs.example.com/img/logo.png":        "docs.example.com/img/logo.png",
+		"https://docs.example.com:8443/a/../style.css": "docs.example.com_8443/style.css",
+		"https://docs.example.com/js/":                 "docs.example.com/js/index",
+	}
+	for in, want := range tests {
+		u, _ := url.Parse(in)
+		if got := assetPath(u); got != want {
+			t.Errorf("assetPath(%s) = %s, want %s", in, got, want)
+		}
+	}
+	a, _ := url.Parse("https://docs.example.com/chart.png?v=1")
+	b, _ := url.Parse("https://docs.example.com/chart.png?v=2")
+	if assetPath(a) == assetPath(b) || !strings.HasSuffix(assetPath(a), ".png") {
+		t.Errorf("assets differing in their query: %s, %s", assetPath(a), assetPath(b))
+	}
+}
+
+func TestRobotsRules(t *testing.T) {
+	robots := `# comment
+User-agent: other
+Disallow: /
+
+User-agent: godochive
+User-agent: someone
+Disallow: /api/
+Allow: /api/public
+Disallow: /*.pdf$
+Crawl-delay: 2
+`
+	rules := parseRobots(strings.NewReader(robots), crawlAgent)
+	for p, want := range map[string]bool{
+		"/":                 true,
+		"/api/v1":           false,
+		"/api/public/x":     true,
+		"/guide/manual.pdf": false,
+		"/guide/pdf.html":   true,
+	} {
+		if got := rules.allowed(p); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", p, got, want)
+		}
+	}
+	if rules.delay.Seconds() != 2 {
+		t.Errorf("delay = %v", rules.delay)
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	for _, sources := range [][]SourceConfig{
+		{{Name: "a", Type: "ftp", URL: "http://x"}},
+		{{Name: "a", Type: "crawl", URL: "file:///etc"}},
+		{{Name: "a", Type: "crawl", URL: "http://x", Dir: "../outside"}},
+		{{Name: "a", Type: "crawl", URL: "http://x"}, {Name: "b", Type: "crawl", URL: "http://y", Dir: "a"}},
+		{{Name: "a", Type: "s3"}},
+		{{Name: "a", Type: "s3", S3: S3Config{Bucket: "b", AccessKeyID: "id"}}},
+	} {
+		if err := validateSources(sources); err == nil {
+			t.Errorf("%+v is valid", sources)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const searchDefaultsBucket = "search_defaults"
+
+// SearchDefaults are the filters a signed-in user's searches start with.
+// They're kept on the server, so they follow the user between browsers;
+// the pinned version is a preference of its own.
+type SearchDefaults struct {
+	Docsets  []string `json:"docsets"`
+	Language string   `json:"language"`
+}
+
+// languageNames label the languages of languageAnalyzers in filters
+var languageNames = map[string]string{"en": "English", "de": "Deutsch", "ja": "日本語", "zh": "中文", "ko": "한국어"}
+
+// searchDefaultsFor returns the defaults of the signed-in user of r, none
+// for anonymous visitors
+func searchDefaultsFor(r *http.Request) SearchDefaults {
+	var d SearchDefaults
+	p, ok := principalFromContext(r.Context())
+	if !ok || store == nil {
+		return d
+	}
+	if _, err := storeGet(searchDefaultsBucket, p.Name, &d); err != nil {
+		log.Printf("Error reading the search defaults of %s: %v", p.Name, err)
+	}
+	return d
+}
+
+// saveSearchDefaults stores d for the signed-in user of r
+func saveSearchDefaults(r *http.Request, d SearchDefaults) error {
+	p, ok := principalFromContext(r.Context())
+	if !ok || store == nil {
+		return nil
+	}
+	if len(d.Docsets) == 0 && d.Language == "" {
+		return storeDelete(searchDefaultsBucket, p.Name)
+	}
+	return storePut(searchDefaultsBucket, p.Name, d)
+}
+
+// defaultsFromForm reads the docset and language fields of the
+// preferences form, dropping unknown values
+func defaultsFromForm(r *http.Request) SearchDefaults {
+	d := SearchDefaults{Docsets: parseDocsets(r.PostForm["docset"]...)}
+	if lang := r.PostForm.Get("language"); languageNames[lang] != "" {
+		d.Language = lang
+	}
+	return d
+}
+
+// withSearchDefaults returns r with the user's defaults filled in for the
+// docset and language parameters it doesn't have. A parameter that is
+// present, even empty, overrides the default, so "docset=" searches every
+// docset.
+func withSearchDefaults(r *http.Request) *http.Request {
+	d := searchDefaultsFor(r)
+	params := r.URL.Query()
+	changed := false
+	if _, ok := params["docset"]; !ok && len(d.Docsets) > 0 {
+		params["docset"] = d.Docsets
+		changed = true
+	}
+	if _, ok := params["language"]; !ok && d.Language != "" {
+		params.Set("language", d.Language)
+		changed = true
+	}
+	if !changed {
+		return r
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = params.Encode()
+	return r2
+}
+
+// languageFromRequest reads the language parameter, ignoring languages
+// documents aren't detected as
+func languageFromRequest(r *http.Request) string {
+	if lang := r.URL.Query().Get("language"); languageNames[lang] != "" {
+		return lang
+	}
+	return ""
+}
+
+// parseDocsets reads docset names, repeated or comma-separated, keeping
+// the configured ones
+func parseDocsets(values ...string) []string {
+	var docsets []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); docsetConfigured(name) && !contains(docsets, name) {
+				docsets = append(docsets, name)
+			}
+		}
+	}
+	return docsets
+}
+
+// filterDocsets limits q to the given docsets; none means no filter
+func filterDocsets(q query.Query, docsets []string) query.Query {
+	if len(docsets) == 0 {
+		return q
+	}
+	terms := make([]query.Query, 0, len(docsets))
+	for _, name := range docsets {
+		tq := bleve.NewTermQuery(name)
+		tq.SetField("Docset")
+		terms = append(terms, tq)
+	}
+	return bleve.NewConjunctionQuery(q, bleve.NewDisjunctionQuery(terms...))
+}
+
+// filterLanguage limits q to documents detected as lang; empty means no
+// filter
+func filterLanguage(q query.Query, lang string) query.Query {
+	if lang == "" {
+		return q
+	}
+	return bleve.NewConjunctionQuery(q, inLanguage(lang))
+}
+
+// filterOption is a docset checkbox or language choice in a filter form
+type filterOption struct {
+	Value, Label string
+	Checked      bool
+}
+
+// docsetOptions lists the configured docsets the caller may search
+func docsetOptions(r *http.Request, selected []string) []filterOption {
+	var options []filterOption
+	for _, ds := range config.Docsets {
+		if !canAccessDocset(r.Context(), ds.Name) || containsOption(options, ds.Name) {
+			continue
+		}
+		options = append(options, filterOption{Value: ds.Name, Label: ds.Name, Checked: contains(selected, ds.Name)})
+	}
+	return options
+}
+
+func languageOptions(selected string) []filterOption {
+	options := make([]filterOption, 0, len(languages))
+	for _, lang := range languages {
+		options = append(options, filterOption{Value: lang, Label: languageNames[lang], Checked: lang == selected})
+	}
+	return options
+}
+
+func containsOption(options []filterOption, value string) bool {
+	for _, o := range options {
+		if o.Value == value {
+			return true
+		}
+	}
+	return false
+}
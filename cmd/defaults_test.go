@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSearchDefaults(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withStore(t)
+	withConfig(t, Config{Docsets: []DocsetConfig{{Name: "guides", Path: "guides"}, {Name: "api", Path: "api"}}})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+	docs := []Document{
+		{Title: "Pool guide", Content: "pool", URL: "guides/pool.html", Docset: "guides", Language: "en"},
+		{Title: "Pool Anleitung", Content: "pool", URL: "guides/pool.de.html", Docset: "guides", Language: "de"},
+		{Title: "Pool API", Content: "pool", URL: "api/pool.html", Docset: "api", Language: "en"},
+	}
+	for _, doc := range docs {
+		doc.URL = filepath.Join(root, doc.URL)
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// saving from the preferences page, as a signed-in user
+	form := url.Values{"defaults": {"1"}, "docset": {"guides", "unknown"}, "language": {"en"}, "next": {"/search"}}
+	r := httptest.NewRequest(http.MethodPost, "/preferences", strings.NewReader(form.Encode())).WithContext(memberContext())
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if rec := serve(http.HandlerFunc(handlePreferences), r); rec.Code != http.StatusSeeOther {
+		t.Fatalf("saving defaults: status = %d", rec.Code)
+	}
+
+	search := func(rawQuery string, signedIn bool) []string {
+		r := httptest.NewRequest(http.MethodGet, "/search?"+rawQuery, nil)
+		if signedIn {
+			r = r.WithContext(memberContext())
+		}
+		view, ok := runPageSearch(httptest.NewRecorder(), r)
+		if !ok {
+			t.Fatalf("%s: search failed", rawQuery)
+		}
+		var got []string
+		for _, doc := range view.Results {
+			got = append(got, doc.Title)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	tests := []struct {
+		query    string
+		signedIn bool
+		want     string
+	}{
+		{"q=pool", true, "Pool guide"},
+		{"q=pool&language=", true, "Pool Anleitung,Pool guide"},
+		{"q=pool&docset=&language=", true, "Pool API,Pool Anleitung,Pool guide"},
+		{"q=pool&docset=api", true, "Pool API"},
+		{"q=pool", false, "Pool API,Pool Anleitung,Pool guide"},
+		{"q=pool&language=de", false, "Pool Anleitung"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(search(tt.query, tt.signedIn), ","); got != tt.want {
+			t.Errorf("%s (signed in %v): results = %s, want %s", tt.query, tt.signedIn, got, tt.want)
+		}
+	}
+
+	// the permalink spells the defaults out, so it shows the same for others
+	view, _ := runPageSearch(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/search?q=pool", nil).WithContext(memberContext()))
+	if !strings.Contains(view.Permalink, "docset=guides") || !strings.Contains(view.Permalink, "language=en") {
+		t.Errorf("permalink = %s", view.Permalink)
+	}
+
+	// the preferences page shows them, and clearing removes them
+	rec := serve(http.HandlerFunc(handlePreferences), httptest.NewRequest(http.MethodGet, "/preferences", nil).WithContext(memberContext()))
+	if !strings.Contains(rec.Body.String(), `value="guides" checked`) {
+		t.Errorf("preferences page doesn't show the docset default:\n%s", rec.Body.String())
+	}
+	r = httptest.NewRequest(http.MethodPost, "/preferences", strings.NewReader("defaults=1")).WithContext(memberContext())
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	serve(http.HandlerFunc(handlePreferences), r)
+	if d := searchDefaultsFor(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(memberContext())); len(d.Docsets) != 0 || d.Language != "" {
+		t.Errorf("defaults after clearing = %+v", d)
+	}
+}
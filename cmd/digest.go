@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const metaBucket = "meta"
+
+// digestEntry is a new or updated document listed in a digest
+type digestEntry struct {
+	Title string
+	URL   string
+	New   bool
+}
+
+// runDigests checks once an hour whether a digest is due and sends it.
+// The last send time is kept in the store so restarts neither skip nor
+// repeat a digest.
+func runDigests() {
+	for {
+		for _, d := range config.Digests {
+			if err := sendDigestIfDue(d, time.Now().UTC()); err != nil {
+				log.Printf("Error sending digest %q: %v", d.Name, err)
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func sendDigestIfDue(d DigestConfig, now time.Time) error {
+	interval := time.Duration(d.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = 7 * 24 * time.Hour
+	}
+
+	key := "digest_last_sent:" + d.Name
+	var last time.Time
+	found, err := storeGet(metaBucket, key, &last)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// start counting from now rather than mailing the whole history
+		return storePut(metaBucket, key, now)
+	}
+	if now.Sub(last) < interval {
+		return nil
+	}
+
+	entries, err := digestEntries(d, last, now)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		subject := fmt.Sprintf("[GoDocHive] %s: documentation changes since %s", d.Name, last.Format("2006-01-02"))
+		if err := sendMail(d.Recipients, subject, formatDigest(entries, last, now)); err != nil {
+			return err
+		}
+	}
+	return storePut(metaBucket, key, now)
+}
+
+// digestPageSize is how many changed documents are fetched from the index
+// at a time
+const digestPageSize = 1000
+
+// digestEntries collects documents first indexed or modified between since
+// and until, grouped by docset
+func digestEntries(d DigestConfig, since, until time.Time) (map[string][]digestEntry, error) {
+	added, err := documentsSeenBetween(since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	newIDs := make([]string, 0, len(added))
+	for id := range added {
+		newIDs = append(newIDs, id)
+	}
+
+	modified := bleve.NewDateRangeQuery(since, until)
+	modified.SetField("ModifiedAt")
+	var q query.Query = modified
+	if len(newIDs) > 0 {
+		q = bleve.NewDisjunctionQuery(modified, bleve.NewDocIDQuery(newIDs))
+	}
+
+	// restricted docsets are only included when the digest names them
+	var denied []string
+	if len(d.Docsets) > 0 {
+		names := make([]query.Query, 0, len(d.Docsets))
+		for _, name := range d.Docsets {
+			tq := bleve.NewTermQuery(name)
+			tq.SetField("Docset")
+			names = append(names, tq)
+		}
+		q = bleve.NewConjunctionQuery(q, bleve.NewDisjunctionQuery(names...))
+	} else {
+		for _, ds := range config.Docsets {
+			if len(ds.Groups) > 0 {
+				denied = append(denied, ds.Name)
+			}
+		}
+	}
+
+	// every change is listed, a page of hits at a time
+	searchRequest := bleve.NewSearchRequestOptions(restrictQuery(q, denied), digestPageSize, 0, false)
+	searchRequest.Fields = []string{"Title", "Docset"}
+	searchRequest.SortBy([]string{"Docset", "Title", "_id"})
+
+	entries := make(map[string][]digestEntry)
+	for {
+		searchResult, err := index.Search(searchRequest)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range searchResult.Hits {
+			// examples change along with their page, which is listed already
+			if !hitAllowed(hit.ID, denied) || strings.Contains(hit.ID, "#") {
+				continue
+			}
+			rel, err := filepath.Rel(root, hit.ID)
+			if err != nil {
+				continue
+			}
+			title, _ := hit.Fields["Title"].(string)
+			docset, _ := hit.Fields["Docset"].(string)
+			_, isNew := added[hit.ID]
+			entries[docset] = append(entries[docset], digestEntry{
+				Title: title,
+				URL:   absoluteURL(rel),
+				New:   isNew,
+			})
+		}
+		if len(searchResult.Hits) < digestPageSize {
+			break
+		}
+		searchRequest.SearchAfter = searchResult.Hits[len(searchResult.Hits)-1].Sort
+	}
+	return entries, nil
+}
+
+// documentsSeenBetween returns the documents first indexed in the given
+// window, with the time they were first seen
+func documentsSeenBetween(since, until time.Time) (map[string]time.Time, error) {
+	added := make(map[string]time.Time)
+	err := storeEach(seenDocsBucket, func(id string, data []byte) error {
+		var seen time.Time
+		if err := json.Unmarshal(data, &seen); err != nil {
+			return err
+		}
+		if seen.After(since) && !seen.After(until) {
+			added[id] = seen
+		}
+		return nil
+	})
+	return added, err
+}
+
+func formatDigest(entries map[string][]digestEntry, since, until time.Time) string {
+	docsets := make([]string, 0, len(entries))
+	for name := range entries {
+		docsets = append(docsets, name)
+	}
+	sort.Strings(docsets)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Documentation changes from %s to %s\n", since.Format("2006-01-02"), until.Format("2006-01-02"))
+	for _, name := range docsets {
+		heading := name
+		if heading == "" {
+			heading = "(top level)"
+		}
+		fmt.Fprintf(&body, "\n== %s ==\n", heading)
+		for _, e := range entries[name] {
+			label := "updated"
+			if e.New {
+				label = "new"
+			}
+			fmt.Fprintf(&body, "[%s] %s\n  %s\n", label, e.Title, e.URL)
+		}
+	}
+	return body.String()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDigestEntriesListsEveryChange(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	withRoot(t, "/docs")
+	withStore(t)
+	idx := withEmptyIndex(t)
+
+	now := time.Now().UTC()
+	// more than a page, with top-level documents that have no docset
+	for i := 0; i < digestPageSize+20; i++ {
+		rel := fmt.Sprintf("guides/page%04d.html", i)
+		if i%2 == 0 {
+			rel = fmt.Sprintf("page%04d.html", i)
+		}
+		path := filepath.Join(root, rel)
+		doc := Document{Title: rel, Content: "pooling", URL: path, Docset: docsetFor(path), ModifiedAt: now.Add(-time.Hour)}
+		if err := idx.Index(path, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := digestEntries(DigestConfig{Name: "weekly"}, now.AddDate(0, 0, -7), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, docsetEntries := range entries {
+		for _, e := range docsetEntries {
+			seen[e.URL] = true
+		}
+	}
+	if len(seen) != digestPageSize+20 {
+		t.Errorf("digest lists %d documents, want all %d", len(seen), digestPageSize+20)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// docsetFor returns the docset a file belongs to: the configured docset
+// with the longest matching path, otherwise the top-level directory name
+func docsetFor(path string) string {
+	if ds := docsetConfigFor(path); ds != nil {
+		return ds.Name
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return ""
+	}
+	if dir, _, ok := strings.Cut(filepath.ToSlash(rel), "/"); ok && dir != ".." {
+		return dir
+	}
+	return ""
+}
+
+// docsetConfigFor returns the configured docset with the longest path
+// containing path, or nil
+func docsetConfigFor(path string) *DocsetConfig {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+
+	var best *DocsetConfig
+	bestLen := -1
+	for i, ds := range config.Docsets {
+		prefix := strings.Trim(filepath.ToSlash(ds.Path), "/")
+		if (rel == prefix || strings.HasPrefix(rel, prefix+"/")) && len(prefix) > bestLen {
+			best, bestLen = &config.Docsets[i], len(prefix)
+		}
+	}
+	return best
+}
+
+// canAccessDocset reports whether the caller may see documents of the named
+// docset. Docsets without configured groups are open to everyone.
+func canAccessDocset(ctx context.Context, name string) bool {
+	for _, ds := range config.Docsets {
+		if ds.Name != name || len(ds.Groups) == 0 {
+			continue
+		}
+		p, ok := principalFromContext(ctx)
+		if !ok {
+			return false
+		}
+		return p.inAnyGroup(ds.Groups)
+	}
+	return true
+}
+
+// deniedDocsets lists the restricted docsets the caller may not see
+func deniedDocsets(ctx context.Context) []string {
+	var denied []string
+	for _, ds := range config.Docsets {
+		if !canAccessDocset(ctx, ds.Name) {
+			denied = append(denied, ds.Name)
+		}
+	}
+	return denied
+}
+
+// restrictQuery excludes documents from docsets the caller may not see
+func restrictQuery(q query.Query, denied []string) query.Query {
+	if len(denied) == 0 {
+		return q
+	}
+
+	restricted := bleve.NewBooleanQuery()
+	restricted.AddMust(q)
+	for _, name := range denied {
+		tq := bleve.NewTermQuery(name)
+		tq.SetField("Docset")
+		restricted.AddMustNot(tq)
+	}
+	return restricted
+}
+
+// hitAllowed re-derives the docset of a hit from its ID (the file path) so
+// that a hit is never shown when the stored Docset field disagrees with the
+// current config
+func hitAllowed(id string, denied []string) bool {
+	// examples are indexed as "<page>#<anchor>"
+	path, _, _ := strings.Cut(id, "#")
+	ds := docsetFor(path)
+	for _, name := range denied {
+		if ds == name {
+			return false
+		}
+	}
+	return true
+}
+
+// canAccessPath reports whether the caller may read the file or directory at
+// path. Directories without an index.html are listed by the file server, so
+// they are refused when their subtree holds a docset the caller may not see.
+func canAccessPath(ctx context.Context, path string) bool {
+	if !canAccessDocset(ctx, docsetFor(path)) {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return true
+	}
+	if _, err := os.Stat(filepath.Join(path, "index.html")); err == nil {
+		return true
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, ds := range config.Docsets {
+		prefix := strings.Trim(filepath.ToSlash(ds.Path), "/")
+		if (rel == "." || strings.HasPrefix(prefix, rel+"/")) && !canAccessDocset(ctx, ds.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+const docsetsInternalKey = "godochive:docsets"
+
+// docsetsFingerprint identifies the docset layout the index was built with.
+// Groups are left out because they are checked at query time.
+func docsetsFingerprint() []byte {
+	h := sha256.New()
+	for _, ds := range config.Docsets {
+		h.Write([]byte(ds.Name + "\x00" + strings.Trim(filepath.ToSlash(ds.Path), "/") + "\x00"))
+		// left out when unset, so indexes from before versions stay valid
+		if ds.Version != "" {
+			h.Write([]byte("version=" + ds.Version + "\x00"))
+		}
+		if ds.Trust != "" {
+			h.Write([]byte("trust=" + ds.Trust + "\x00"))
+		}
+	}
+	return []byte(hex.EncodeToString(h.Sum(nil)))
+}
+
+// docsetsUpToDate reports whether the index was built with the current
+// docset layout. Indexes from before docsets existed have no stamp at all.
+func docsetsUpToDate(idx bleve.Index) bool {
+	stamp, err := idx.GetInternal([]byte(docsetsInternalKey))
+	if err != nil {
+		return false
+	}
+	return string(stamp) == string(docsetsFingerprint())
+}
+
+func stampDocsets(idx bleve.Index) error {
+	return idx.SetInternal([]byte(docsetsInternalKey), docsetsFingerprint())
+}
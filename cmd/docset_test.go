@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+var restrictedConfig = Config{
+	Docsets: []DocsetConfig{
+		{Name: "security-playbooks", Path: "security/playbooks", Groups: []string{"security"}},
+		{Name: "guides", Path: "guides"},
+	},
+}
+
+// withRoot points the global root at dir for the duration of a test
+func withRoot(t *testing.T, dir string) {
+	t.Helper()
+	old := root
+	root = dir
+	t.Cleanup(func() { root = old })
+}
+
+// withIndex indexes docs (path relative to root -> title) into a fresh
+// in-memory index and installs it as the global index
+func withIndex(t *testing.T, docs map[string]string) {
+	t.Helper()
+	idx, err := bleve.NewMemOnly(newIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, title := range docs {
+		path := filepath.Join(root, rel)
+		doc := Document{Title: title, Content: title, URL: path, Docset: docsetFor(path)}
+		if err := idx.Index(path, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := index
+	index = idx
+	t.Cleanup(func() {
+		idx.Close()
+		index = old
+	})
+}
+
+func memberContext(groups ...string) context.Context {
+	return context.WithValue(context.Background(), principalKey{}, Principal{Name: "u", Groups: groups})
+}
+
+func TestDocsetFor(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	withRoot(t, "/docs")
+
+	tests := map[string]string{
+		"/docs/security/playbooks/incident.html": "security-playbooks",
+		"/docs/security/playbooks":               "security-playbooks",
+		"/docs/security/overview.html":           "security",
+		"/docs/guides/start.html":                "guides",
+		"/docs/readme.md":                        "",
+	}
+	for path, want := range tests {
+		if got := docsetFor(path); got != want {
+			t.Errorf("docsetFor(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRestrictedHitsHiddenFromNonMembers(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{
+		"security/playbooks/incident.html": "incident response",
+		"guides/incident.html":             "incident reporting",
+	})
+
+	outsider, err := performSearch("incident", searchFilter{Denied: deniedDocsets(memberContext("dev"))}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outsider) != 1 || outsider[0].URL != filepath.Join("guides", "incident.html") {
+		t.Errorf("non-member results = %+v, want only the guides hit", outsider)
+	}
+
+	anonymous, err := runAPISearch("incident", defaultAPIFields, searchFilter{Denied: deniedDocsets(context.Background())}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anonymous.Total != 1 || len(anonymous.Hits) != 1 {
+		t.Errorf("anonymous API total = %d, hits = %d, want 1 and 1", anonymous.Total, len(anonymous.Hits))
+	}
+
+	member, err := performSearch("incident", searchFilter{Denied: deniedDocsets(memberContext("security"))}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(member) != 2 {
+		t.Errorf("member results = %d, want 2", len(member))
+	}
+}
+
+func TestHitAllowedIgnoresStaleDocsetField(t *testing.T) {
+	withRoot(t, "/docs")
+	// index while security/playbooks is not yet a configured docset
+	withConfig(t, Config{})
+	withIndex(t, map[string]string{"security/playbooks/incident.html": "incident response"})
+
+	withConfig(t, restrictedConfig)
+	results, err := performSearch("incident", searchFilter{Denied: deniedDocsets(context.Background())}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("stale index leaked %d restricted hits", len(results))
+	}
+	if docsetsUpToDate(index) {
+		t.Error("index built with another docset layout reported as up to date")
+	}
+	if err := stampDocsets(index); err != nil {
+		t.Fatal(err)
+	}
+	if !docsetsUpToDate(index) {
+		t.Error("freshly stamped index reported as stale")
+	}
+}
+
+func TestServeFilesHidesRestrictedDocsets(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{"security/playbooks/incident.html", "security/overview.html", "guides/index.html"} {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("<html></html>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withConfig(t, restrictedConfig)
+	withRoot(t, dir)
+	// the 404 for a hidden path is rendered as an error page
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		groups []string
+		want   int
+	}{
+		{"/security/playbooks/incident.html", nil, http.StatusNotFound},
+		{"/security/playbooks/incident.html", []string{"security"}, http.StatusOK},
+		{"/security/overview.html", nil, http.StatusOK},
+		{"/security/", nil, http.StatusNotFound},
+		{"/security/", []string{"security"}, http.StatusOK},
+		{"/guides/", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil).WithContext(memberContext(tt.groups...))
+		if rec := serve(http.HandlerFunc(serveFiles), r); rec.Code != tt.want {
+			t.Errorf("GET %s as %v: status = %d, want %d", tt.path, tt.groups, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// embedder turns texts into vectors whose closeness reflects how close the
+// texts are in meaning. Providers plug in through embeddingProviders.
+type embedder interface {
+	// Embed returns one vector per text, in order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// embeddingProviders are the names accepted in EmbeddingsConfig.Provider
+var embeddingProviders = map[string]func(EmbeddingsConfig) embedder{
+	"openai": newOpenAIEmbedder,
+}
+
+const (
+	// embeddingsBucket holds a storedEmbedding per page and section, keyed
+	// by the path below the root with the section's anchor
+	embeddingsBucket = "embeddings"
+	// maxEmbeddingText is how many bytes of a document are embedded; models
+	// only read so far anyway
+	maxEmbeddingText = 8000
+	// embeddingBatch is how many texts go in one request to the provider
+	embeddingBatch = 32
+
+	defaultSemantic = 10
+	maxSemantic     = 50
+)
+
+var errNoEmbeddings = errors.New("semantic search is not configured")
+
+// storedEmbedding is the vector of a document. Hash covers the model and
+// the embedded text, so unchanged documents aren't sent again.
+type storedEmbedding struct {
+	Title  string    `json:"title"`
+	Hash   string    `json:"hash"`
+	Vector []float32 `json:"vector"`
+}
+
+// currentEmbedder is the configured provider, nil when semantic search is
+// off
+func currentEmbedder() embedder {
+	cfg := config.Embeddings
+	if cfg.URL == "" {
+		return nil
+	}
+	provider := cfg.Provider
+	if provider == "" {
+		provider = "openai"
+	}
+	if newEmbedder, ok := embeddingProviders[provider]; ok {
+		return newEmbedder(cfg)
+	}
+	return nil
+}
+
+// openAIEmbedder calls an OpenAI-compatible /embeddings endpoint. Besides
+// OpenAI, llama.cpp's server and most local model servers offer one.
+type openAIEmbedder struct {
+	url, model, key string
+	client          *http.Client
+}
+
+func newOpenAIEmbedder(cfg EmbeddingsConfig) embedder {
+	return openAIEmbedder{
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/embeddings",
+		model:  cfg.Model,
+		key:    cfg.APIKey,
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (e openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{"model": e.model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.key != "" {
+		req.Header.Set("Authorization", "Bearer "+e.key)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings provider returned %s", resp.Status)
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings provider returned index %d for %d texts", d.Index, len(texts))
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("embeddings provider returned no vector for text %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// embeddingText is what gets embedded for doc: its title and the start of
+// its content, cut at a character boundary
+func embeddingText(doc Document) string {
+	text := doc.Title + "\n\n" + doc.Content
+	if len(text) <= maxEmbeddingText {
+		return text
+	}
+	cut := maxEmbeddingText
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
+
+func embeddingHash(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// embedDocuments stores a vector for each page and section of the files
+// at paths, asking the provider only for the ones whose text changed, and
+// drops the vectors of documents that are gone
+func embedDocuments(ctx context.Context, e embedder, paths []string) error {
+	type pending struct {
+		key, text string
+		stored    storedEmbedding
+	}
+	var todo []pending
+	keep := make(map[string]bool)
+	for _, path := range paths {
+		info, err := statDoc(path)
+		if err != nil {
+			continue
+		}
+		// notes aren't part of the embedded text
+		docs, err := documentsFor(path, info, nil)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if doc.Kind == kindExample {
+				continue
+			}
+			key := tagKey(doc.URL)
+			keep[key] = true
+			text := embeddingText(doc)
+			hash := embeddingHash(config.Embeddings.Model, text)
+			var old storedEmbedding
+			if found, err := storeGet(embeddingsBucket, key, &old); err != nil {
+				return err
+			} else if found && old.Hash == hash {
+				continue
+			}
+			todo = append(todo, pending{key, text, storedEmbedding{Title: doc.Title, Hash: hash}})
+		}
+	}
+
+	for start := 0; start < len(todo); start += embeddingBatch {
+		batch := todo[start:min(start+embeddingBatch, len(todo))]
+		texts := make([]string, len(batch))
+		for i, p := range batch {
+			texts[i] = p.text
+		}
+		vectors, err := e.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for i, p := range batch {
+			p.stored.Vector = vectors[i]
+			if err := storePut(embeddingsBucket, p.key, p.stored); err != nil {
+				return err
+			}
+		}
+	}
+
+	var gone []string
+	err := storeEach(embeddingsBucket, func(key string, _ []byte) error {
+		if !keep[key] {
+			gone = append(gone, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range gone {
+		if err := storeDelete(embeddingsBucket, key); err != nil {
+			return err
+		}
+	}
+	vectors.reset()
+	return nil
+}
+
+// vectorEntry is a stored embedding ready for search, scaled to length 1
+// so the dot product is the cosine similarity
+type vectorEntry struct {
+	key, title string
+	vector     []float32
+}
+
+// vectors caches the stored embeddings for semantic searches. They're
+// compared one by one, which is fast enough for documentation sized
+// collections.
+var vectors vectorCache
+
+type vectorCache struct {
+	sync.Mutex
+	loaded  bool
+	entries []vectorEntry
+}
+
+func (c *vectorCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.loaded, c.entries = false, nil
+}
+
+func (c *vectorCache) load() ([]vectorEntry, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.loaded {
+		return c.entries, nil
+	}
+	var entries []vectorEntry
+	err := storeEach(embeddingsBucket, func(key string, data []byte) error {
+		var s storedEmbedding
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if v := normalize(s.Vector); v != nil {
+			entries = append(entries, vectorEntry{key, s.Title, v})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.loaded, c.entries = true, entries
+	return entries, nil
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return nil
+	}
+	norm := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+// SemanticHit is a document found by meaning rather than by its words
+type SemanticHit struct {
+	Path  string  `json:"path"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// SemanticResponse is the body of /api/semantic
+type SemanticResponse struct {
+	Query string        `json:"query"`
+	Hits  []SemanticHit `json:"hits"`
+}
+
+// semanticSearch returns the size documents closest in meaning to text,
+// leaving out docsets in denied
+func semanticSearch(ctx context.Context, e embedder, text string, denied []string, size int) ([]SemanticHit, error) {
+	query, err := e.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	q := normalize(query[0])
+	entries, err := vectors.load()
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []SemanticHit{}
+	for _, entry := range entries {
+		// vectors from another model can't be compared
+		if len(entry.vector) != len(q) {
+			continue
+		}
+		path, _, _ := strings.Cut(entry.key, "#")
+		if contains(denied, docsetFor(filepath.Join(root, filepath.FromSlash(path)))) {
+			continue
+		}
+		var dot float64
+		for i, x := range entry.vector {
+			dot += float64(x) * float64(q[i])
+		}
+		hits = append(hits, SemanticHit{Path: entry.key, Title: entry.title, Score: dot})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > size {
+		hits = hits[:size]
+	}
+	return hits, nil
+}
+
+func handleAPISemantic(w http.ResponseWriter, r *http.Request) {
+	e := currentEmbedder()
+	if e == nil {
+		writeError(w, r, http.StatusServiceUnavailable, errNoEmbeddings.Error())
+		return
+	}
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		writeError(w, r, http.StatusBadRequest, "q is required")
+		return
+	}
+	size := defaultSemantic
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSemantic {
+			writeError(w, r, http.StatusBadRequest, "size must be between 1 and "+strconv.Itoa(maxSemantic))
+			return
+		}
+		size = n
+	}
+
+	hits, err := semanticSearch(r.Context(), e, text, deniedDocsets(r.Context()), size)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, SemanticResponse{Query: text, Hits: hits})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeEmbeddings serves an OpenAI-style embeddings API whose vectors have
+// one dimension per topic, and counts the texts it was sent
+func fakeEmbeddings(t *testing.T, sent *int) *httptest.Server {
+	t.Helper()
+	topics := [][]string{{"credential", "secret", "password"}, {"disk", "storage"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer k" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		*sent += len(req.Input)
+		type item struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		var data []item
+		for i, text := range req.Input {
+			v := []float32{0, 0, 0.1}
+			for d, words := range topics {
+				for _, w := range words {
+					v[d] += float32(strings.Count(strings.ToLower(text), w))
+				}
+			}
+			data = append(data, item{i, v})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSemanticSearch(t *testing.T) {
+	var sent int
+	srv := fakeEmbeddings(t, &sent)
+	cfg := restrictedConfig
+	cfg.Embeddings = EmbeddingsConfig{URL: srv.URL + "/v1/", Model: "m", APIKey: "k"}
+	withConfig(t, cfg)
+	dir := t.TempDir()
+	withRoot(t, dir)
+	withStore(t)
+	t.Cleanup(vectors.reset)
+
+	pages := map[string]string{
+		"guides/keys.html":             `<title>Key rollover</title><p>Replace the secrets and passwords every 90 days.</p>`,
+		"guides/volumes.html":          `<title>Volumes</title><p>Add disk storage to a node.</p>`,
+		"security/playbooks/leak.html": `<title>Leak response</title><p>Revoke the credential at once.</p>`,
+	}
+	var paths []string
+	for rel, content := range pages {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	e := currentEmbedder()
+	if err := embedDocuments(context.Background(), e, paths); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 3 {
+		t.Fatalf("embedded %d texts, want 3", sent)
+	}
+
+	hits, err := semanticSearch(context.Background(), e, "how do we rotate credentials", deniedDocsets(memberContext()), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Path != "guides/keys.html" || hits[0].Title != "Key rollover" {
+		t.Errorf("hits = %+v, want the key rollover guide", hits)
+	}
+	hits, _ = semanticSearch(context.Background(), e, "how do we rotate credentials", nil, 1)
+	if len(hits) != 1 || hits[0].Path != "security/playbooks/leak.html" {
+		t.Errorf("hits for a member = %+v, want the playbook", hits)
+	}
+
+	// unchanged documents aren't sent again, removed ones are dropped
+	sent = 0
+	if err := embedDocuments(context.Background(), e, paths[:0]); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := semanticSearch(context.Background(), e, "disk", nil, 5); len(hits) != 0 {
+		t.Errorf("hits after removing every document = %+v", hits)
+	}
+	if err := embedDocuments(context.Background(), e, paths); err != nil {
+		t.Fatal(err)
+	}
+	sent = 0
+	if err := embedDocuments(context.Background(), e, paths); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 0 {
+		t.Errorf("re-embedded %d unchanged texts", sent)
+	}
+}
+
+func TestHandleAPISemantic(t *testing.T) {
+	withConfig(t, Config{})
+	rec := httptest.NewRecorder()
+	handleAPISemantic(rec, httptest.NewRequest("GET", "/api/semantic?q=x", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status without a provider = %d, want 503", rec.Code)
+	}
+
+	var sent int
+	srv := fakeEmbeddings(t, &sent)
+	withConfig(t, Config{Embeddings: EmbeddingsConfig{URL: srv.URL + "/v1", APIKey: "k"}})
+	withRoot(t, t.TempDir())
+	withStore(t)
+	t.Cleanup(vectors.reset)
+	for _, q := range []string{"/api/semantic", "/api/semantic?q=x&size=0"} {
+		rec := httptest.NewRecorder()
+		handleAPISemantic(rec, httptest.NewRequest("GET", q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", q, rec.Code)
+		}
+	}
+	rec = httptest.NewRecorder()
+	handleAPISemantic(rec, httptest.NewRequest("GET", "/api/semantic?q=password", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"hits":[]`) {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// example is a runnable code sample found on a page. Examples are indexed
+// as documents of their own so searches can return them directly.
+type example struct {
+	Name     string
+	Language string
+	Anchor   string
+	Code     string
+}
+
+// markdownFence matches fenced code blocks with a language in raw Markdown
+var markdownFence = regexp.MustCompile("(?ms)^```([\\w+#-]+)[^\\n]*\\n(.*?)^```")
+
+// findExamples collects godoc examples and code blocks tagged with a
+// language. Markdown files aren't rendered, so their fences are read from
+// the raw text.
+func findExamples(doc *html.Node, raw string) []example {
+	var examples []example
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "pre" {
+			if ex, ok := exampleFromPre(n); ok {
+				examples = append(examples, ex)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if len(examples) == 0 {
+		for _, m := range markdownFence.FindAllStringSubmatch(raw, -1) {
+			if code := strings.TrimSpace(m[2]); code != "" {
+				examples = append(examples, example{Name: m[1], Language: m[1], Code: code})
+			}
+		}
+	}
+	return examples
+}
+
+func exampleFromPre(pre *html.Node) (example, bool) {
+	code := strings.TrimSpace(nodeText(pre))
+	if code == "" {
+		return example{}, false
+	}
+
+	// godoc and pkg.go.dev put each Example func below an element with an
+	// id like "example-Foo" or "example_Foo"
+	for n := pre; n != nil; n = n.Parent {
+		id := attr(n, "id")
+		if strings.HasPrefix(id, "example-") || strings.HasPrefix(id, "example_") {
+			return example{Name: id[len("example-"):], Language: "go", Anchor: id, Code: code}, true
+		}
+	}
+
+	// Markdown renderers mark fenced blocks with a language class on the
+	// <pre> or its <code>
+	lang := languageClass(pre)
+	for c := pre.FirstChild; c != nil && lang == ""; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "code" {
+			lang = languageClass(c)
+		}
+	}
+	if lang == "" {
+		return example{}, false
+	}
+
+	ex := example{Name: lang, Language: lang, Code: code}
+	for n := pre; n != nil && ex.Anchor == ""; n = n.Parent {
+		ex.Anchor = attr(n, "id")
+	}
+	return ex, true
+}
+
+func languageClass(n *html.Node) string {
+	for _, class := range strings.Fields(attr(n, "class")) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if lang, ok := strings.CutPrefix(class, prefix); ok && lang != "" {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// exampleDocuments turns the examples of the page at path into documents.
+// Their ID and URL point at the example's anchor on the page.
+func exampleDocuments(page Document, examples []example) []Document {
+	docs := make([]Document, 0, len(examples))
+	seen := make(map[string]bool)
+	for i, ex := range examples {
+		anchor := ex.Anchor
+		if anchor == "" || seen[anchor] {
+			anchor = fmt.Sprintf("example-%d", i+1)
+		}
+		seen[anchor] = true
+
+		docs = append(docs, Document{
+			Title:      fmt.Sprintf("%s: %s", page.Title, ex.Name),
+			Content:    ex.Code,
+			URL:        page.URL + "#" + anchor,
+			Docset:     page.Docset,
+			ModifiedAt: page.ModifiedAt,
+			CodeBlocks: ex.Code,
+			Kind:       kindExample,
+			Deprecated: page.Deprecated,
+			DocType:    page.DocType,
+			Size:       page.Size,
+			Version:    page.Version,
+			Tags:       page.Tags,
+			Authors:    page.Authors,
+			Date:       page.Date,
+			Trust:      page.Trust,
+			Language:   page.Language,
+		})
+	}
+	return docs
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindExamples(t *testing.T) {
+	tests := map[string]struct {
+		page string
+		want []example
+	}{
+		"godoc": {
+			`<div id="example_Client_Do"><p>Code:</p><pre>resp, err := client.Do(req)</pre></div><pre>not an example</pre>`,
+			[]example{{Name: "Client_Do", Language: "go", Anchor: "example_Client_Do", Code: "resp, err := client.Do(req)"}},
+		},
+		"pkg.go.dev": {
+			`<details id="example-package"><pre class="Documentation-exampleCode">fmt.Println("hi")</pre></details>`,
+			[]example{{Name: "package", Language: "go", Anchor: "example-package", Code: `fmt.Println("hi")`}},
+		},
+		"language class": {
+			`<section id="install"><pre><code class="language-sh">go install ./cmd</code></pre></section>`,
+			[]example{{Name: "sh", Language: "sh", Anchor: "install", Code: "go install ./cmd"}},
+		},
+		"markdown": {
+			"# Usage\n\n```go\nx := 1\n```\n\n```\nplain\n```\n",
+			[]example{{Name: "go", Language: "go", Code: "x := 1"}},
+		},
+	}
+	for name, tt := range tests {
+		got := extractPage(tt.page).Examples
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: examples = %+v, want %+v", name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: example %d = %+v, want %+v", name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestExamplesIndexedAsDocuments(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+
+	page := `<title>HTTP client</title><p>Sending requests.</p>
+<div id="example_Client_Do"><pre>resp, err := client.Do(req)</pre></div>
+<div><pre class="language-go">resp, err := client.Get(url)</pre></div>`
+	if err := os.WriteFile(filepath.Join(dir, "client.html"), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := buildIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 {
+		t.Errorf("buildIndex IDs = %v, want only the page", ids)
+	}
+
+	results, err := performSearch("code:client.Do", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var example *Document
+	for i := range results {
+		if results[i].Kind == kindExample {
+			example = &results[i]
+		}
+	}
+	if example == nil {
+		t.Fatalf("results = %+v, want an example", results)
+	}
+	if example.URL != "client.html#example_Client_Do" || example.CodeBlocks != "resp, err := client.Do(req)" {
+		t.Errorf("example = %+v", example)
+	}
+	if !strings.HasPrefix(example.Title, "HTTP client: ") {
+		t.Errorf("example title = %q", example.Title)
+	}
+
+	count, err := index.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the page and both examples, the second one under a numbered anchor
+	if count != 3 {
+		t.Errorf("DocCount = %d, want 3", count)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExplainScores(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{Tokens: []AuthToken{{Name: "ops", Token: "ops-tok"}}, AdminGroups: []string{"admins"}}})
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	search := func(target string, groups ...string) string {
+		rec := serve(http.HandlerFunc(handleSearch), httptest.NewRequest(http.MethodGet, target, nil).WithContext(memberContext(groups...)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", target, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	body := search("/search?q=pooling&explain=1", "admins")
+	if !strings.Contains(body, `class="explain"`) || !strings.Contains(body, "weight(") || !strings.Contains(body, `name="explain" value="1"`) {
+		t.Errorf("admin doesn't get the scoring tree:\n%s", body)
+	}
+	if body := search("/search?q=pooling&explain=1"); strings.Contains(body, `class="explain"`) {
+		t.Errorf("non-admin got the scoring tree")
+	}
+	if body := search("/search?q=pooling", "admins"); strings.Contains(body, `class="explain"`) {
+		t.Errorf("scoring tree shown without explain=1")
+	}
+}
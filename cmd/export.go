@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+)
+
+const (
+	// exportPageSize is how many hits are fetched from the index at a time
+	exportPageSize = 500
+	// maxExportResults caps an export, so one request can't walk the whole
+	// index forever
+	maxExportResults = 50000
+)
+
+// exportResult is one exported search result
+type exportResult struct {
+	Title      string   `json:"title"`
+	URL        string   `json:"url"`
+	Docset     string   `json:"docset"`
+	Type       string   `json:"type"`
+	Modified   string   `json:"modified"`
+	Deprecated bool     `json:"deprecated"`
+	Tags       []string `json:"tags"`
+	Score      float64  `json:"score"`
+}
+
+// exportColumns are the CSV header, in the order of exportResult.row
+var exportColumns = []string{"title", "url", "docset", "type", "modified", "deprecated", "tags", "score"}
+
+func (e exportResult) row() []string {
+	return []string{csvCell(e.Title), csvCell(e.URL), csvCell(e.Docset), csvCell(e.Type), e.Modified,
+		strconv.FormatBool(e.Deprecated), csvCell(strings.Join(e.Tags, ",")), strconv.FormatFloat(e.Score, 'f', 4, 64)}
+}
+
+// csvCell keeps spreadsheets from running text as a formula: a cell that
+// starts like one gets a leading apostrophe
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+var exportFormats = []string{"csv", "json"}
+
+func newExportResult(hit *search.DocumentMatch) exportResult {
+	e := exportResult{Tags: storedTags(hit.Fields["Tags"]), Score: hit.Score}
+	if e.Tags == nil {
+		e.Tags = []string{}
+	}
+	e.URL, _ = hit.Fields["URL"].(string)
+	if rel, err := filepath.Rel(root, e.URL); err == nil {
+		e.URL = "/" + filepath.ToSlash(rel)
+	}
+	e.Title, _ = hit.Fields["Title"].(string)
+	e.Docset, _ = hit.Fields["Docset"].(string)
+	e.Type, _ = hit.Fields["DocType"].(string)
+	e.Modified, _ = hit.Fields["ModifiedAt"].(string)
+	e.Deprecated, _ = hit.Fields["Deprecated"].(bool)
+	return e
+}
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// exportFilename names the download after the query
+func exportFilename(query, format string, now time.Time) string {
+	name := strings.Trim(unsafeFilename.ReplaceAllString(query, "-"), "-")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	if name == "" {
+		name = "results"
+	}
+	return fmt.Sprintf("godochive-%s-%s.%s", name, now.Format("20060102"), format)
+}
+
+// exportWriter streams results in one of exportFormats
+type exportWriter interface {
+	Write(e exportResult) error
+	// Flush sends what was written so far
+	Flush() error
+	// Close ends the document
+	Close() error
+}
+
+type csvExport struct{ w *csv.Writer }
+
+func newCSVExport(w io.Writer) (*csvExport, error) {
+	e := &csvExport{csv.NewWriter(w)}
+	return e, e.w.Write(exportColumns)
+}
+
+func (e *csvExport) Write(r exportResult) error { return e.w.Write(r.row()) }
+func (e *csvExport) Flush() error               { e.w.Flush(); return e.w.Error() }
+func (e *csvExport) Close() error               { return e.Flush() }
+
+// jsonExport writes a JSON array, one result at a time
+type jsonExport struct {
+	w    io.Writer
+	rows int
+}
+
+func (e *jsonExport) Write(r exportResult) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if e.rows == 0 {
+		sep = "[\n"
+	}
+	e.rows++
+	_, err = fmt.Fprintf(e.w, "%s%s", sep, data)
+	return err
+}
+
+func (e *jsonExport) Flush() error { return nil }
+
+func (e *jsonExport) Close() error {
+	end := "\n]\n"
+	if e.rows == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// sortValues are the values of hit for order, to pass as SearchAfter. Bleve
+// leaves a placeholder for the score in hit.Sort, so it's filled in here.
+func sortValues(hit *search.DocumentMatch, order []string) []string {
+	values := append([]string(nil), hit.Sort...)
+	for i, field := range order {
+		if strings.TrimPrefix(field, "-") == "_score" && i < len(values) {
+			values[i] = strconv.FormatFloat(hit.Score, 'g', -1, 64)
+		}
+	}
+	return values
+}
+
+// ExportURL downloads every result of the search in format. Params is
+// encoded already, so it's passed as a URL rather than escaped again.
+func (v searchView) ExportURL(format string) template.URL {
+	return template.URL("/search/export?" + v.Params + "&format=" + format)
+}
+
+// handleExport streams every result of a search page query, not only the
+// first page, as a CSV or JSON download for documentation audits
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	r = withSearchDefaults(r)
+	query := r.URL.Query().Get("q")
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	filter, err := filterFromRequest(r)
+	if query == "" || !contains(exportFormats, format) || err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(filter.apply(filter.textQuery(query)), exportPageSize, 0, false)
+	// a total order, so each page can start after the last hit of the one
+	// before, even when hits have equal scores
+	order := append(preferencesFromRequest(r).sortBy(), "-_score", "_id")
+	searchRequest.SortBy(order)
+	searchRequest.Fields = []string{"Title", "URL", "Docset", "DocType", "ModifiedAt", "Deprecated", "Tags"}
+
+	// the first page is fetched before writing, so a failing search still
+	// gets an error page
+	result, err := index.Search(searchRequest)
+	if err != nil {
+		log.Printf("Error exporting %q: %v", query, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFilename(query, format, time.Now())))
+	var out exportWriter
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		out = &jsonExport{w: w}
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if out, err = newCSVExport(w); err != nil {
+			return
+		}
+	}
+
+	for exported := 0; ; {
+		for _, hit := range result.Hits {
+			if !hitAllowed(hit.ID, filter.Denied) {
+				continue
+			}
+			if err := out.Write(newExportResult(hit)); err != nil {
+				// the client went away
+				return
+			}
+		}
+		exported += len(result.Hits)
+		if len(result.Hits) < exportPageSize || exported >= maxExportResults {
+			break
+		}
+		if err := out.Flush(); err != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		searchRequest.SearchAfter = sortValues(result.Hits[len(result.Hits)-1], order)
+		if result, err = index.Search(searchRequest); err != nil {
+			// the status is sent already, so the connection is cut instead
+			// of ending the download as if it were complete
+			log.Printf("Error exporting %q after %d results: %v", query, exported, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	out.Close()
+}
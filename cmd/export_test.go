@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, restrictedConfig)
+	withRoot(t, "/docs")
+	docs := map[string]string{"security/playbooks/pool.html": "secret pooling"}
+	// more than a page, to check that pages are stitched together
+	for i := 0; i < exportPageSize+20; i++ {
+		docs[fmt.Sprintf("guides/pool%03d.html", i)] = "connection pooling"
+	}
+	withIndex(t, docs)
+
+	rec := serve(http.HandlerFunc(handleExport), httptest.NewRequest(http.MethodGet, "/search/export?q=pooling", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("export = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="godochive-pooling-`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != exportPageSize+21 || strings.Join(rows[0], ",") != strings.Join(exportColumns, ",") {
+		t.Fatalf("got %d rows with header %q, want every visible result", len(rows), rows[0])
+	}
+	seen := map[string]bool{}
+	for _, row := range rows[1:] {
+		if seen[row[1]] || strings.HasPrefix(row[1], "/security/") {
+			t.Fatalf("row %q is repeated or restricted", row)
+		}
+		seen[row[1]] = true
+	}
+
+	rec = serve(http.HandlerFunc(handleExport), httptest.NewRequest(http.MethodGet, "/search/export?q=pooling&format=json", nil))
+	var results []exportResult
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != exportPageSize+20 || results[0].Title != "connection pooling" || results[0].Tags == nil {
+		t.Errorf("got %d JSON results, first %+v", len(results), results[0])
+	}
+
+	rec = serve(http.HandlerFunc(handleExport), httptest.NewRequest(http.MethodGet, "/search/export?q=nothingmatches&format=json", nil))
+	if strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("empty JSON export = %q", rec.Body.String())
+	}
+	for _, target := range []string{"/search/export", "/search/export?q=pool&format=xml"} {
+		if rec := serve(http.HandlerFunc(handleExport), httptest.NewRequest(http.MethodGet, target, nil)); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", target, rec.Code)
+		}
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for query, want := range map[string]string{
+		"connection pool": "godochive-connection-pool-20240501.csv",
+		`"; rm -rf /`:     "godochive-rm-rf-20240501.csv",
+		"日本語":             "godochive-results-20240501.csv",
+	} {
+		if got := exportFilename(query, "csv", day); got != want {
+			t.Errorf("exportFilename(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestExportRowNeutralisesFormulas(t *testing.T) {
+	row := exportResult{Title: "=HYPERLINK(\"http://evil\")", URL: "/guides/pool.html", Docset: "@docs", Type: "-html", Tags: []string{"+a", "b"}}.row()
+	want := []string{"'=HYPERLINK(\"http://evil\")", "/guides/pool.html", "'@docs", "'-html", "", "false", "'+a,b", "0.0000"}
+	if strings.Join(row, "|") != strings.Join(want, "|") {
+		t.Errorf("row = %q, want %q", row, want)
+	}
+}
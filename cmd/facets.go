@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// facetFields maps the facets of /api/search, named like the filter
+// parameters, to their fields in the index
+var facetFields = map[string]string{
+	"docset":   "Docset",
+	"type":     "DocType",
+	"language": "Language",
+	"trust":    "Trust",
+	"tag":      "Tags",
+}
+
+// maxFacetTerms is how many values each facet counts, the most frequent
+// ones; the rest are summed up in Other
+const maxFacetTerms = 20
+
+// APIFacet counts the matching documents per value of a field
+type APIFacet struct {
+	Name  string      `json:"name"`
+	Terms []TermCount `json:"terms"`
+	// Missing is the number of documents without a value, Other those with
+	// values beyond the most frequent ones
+	Missing int    `json:"missing"`
+	Other   int    `json:"other"`
+	Error   string `json:"error,omitempty"`
+}
+
+// parseFacetsParam turns "docset,type" into facet names
+func parseFacetsParam(param string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(param, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || contains(names, name) {
+			continue
+		}
+		if _, ok := facetFields[name]; !ok {
+			return nil, fmt.Errorf("unknown facet %q", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// runFacets counts the documents matching q for each of the named facets
+// in a single search
+func runFacets(ctx context.Context, q query.Query, names []string) ([]APIFacet, error) {
+	req := bleve.NewSearchRequestOptions(q, 0, 0, false)
+	for _, name := range names {
+		req.AddFacet(name, bleve.NewFacetRequest(facetFields[name], maxFacetTerms))
+	}
+	res, err := index.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	facets := make([]APIFacet, 0, len(names))
+	for _, name := range names {
+		facets = append(facets, toAPIFacet(name, res.Facets[name]))
+	}
+	return facets, nil
+}
+
+func toAPIFacet(name string, f *search.FacetResult) APIFacet {
+	facet := APIFacet{Name: name, Terms: []TermCount{}}
+	if f == nil {
+		return facet
+	}
+	facet.Missing, facet.Other = f.Missing, f.Other
+	if f.Terms != nil {
+		for _, t := range f.Terms.Terms() {
+			facet.Terms = append(facet.Terms, TermCount{Term: t.Term, Docs: t.Count})
+		}
+	}
+	return facet
+}
+
+// streamFacets writes resp as the first line of a newline-delimited JSON
+// stream and sends it right away, then computes the facets one at a time
+// and sends each as a line of its own as soon as it's counted. On big
+// indexes the hits show up long before the slowest facet is done. A facet
+// that fails gets its error in place of counts; the client going away
+// stops the rest.
+func streamFacets(w http.ResponseWriter, r *http.Request, resp APISearchResponse, q query.Query, names []string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	if err := enc.Encode(resp); err != nil {
+		return
+	}
+	flush()
+	for _, name := range names {
+		facets, err := runFacets(r.Context(), q, []string{name})
+		if r.Context().Err() != nil {
+			return
+		}
+		facet := APIFacet{Name: name, Terms: []TermCount{}}
+		if err != nil {
+			facet.Error = err.Error()
+		} else {
+			facet = facets[0]
+		}
+		if err := enc.Encode(facet); err != nil {
+			return
+		}
+		flush()
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchFacets(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+	docs := []Document{
+		{Title: "Pool guide", Content: "pool", URL: "guides/pool.html", Docset: "guides", DocType: "html"},
+		{Title: "Pool notes", Content: "pool", URL: "guides/pool.md", Docset: "guides", DocType: "md"},
+		{Title: "Pool API", Content: "pool", URL: "api/pool.html", Docset: "api", DocType: "html"},
+		{Title: "Cache", Content: "cache", URL: "api/cache.html", Docset: "api", DocType: "html"},
+	}
+	for _, doc := range docs {
+		doc.URL = filepath.Join(root, doc.URL)
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts := func(f APIFacet) map[string]int {
+		m := make(map[string]int)
+		for _, term := range f.Terms {
+			m[term.Term] = term.Docs
+		}
+		return m
+	}
+
+	rec := serve(http.HandlerFunc(handleAPISearch), httptest.NewRequest(http.MethodGet, "/api/search?q=pool&facets=docset,type", nil))
+	var resp APISearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Hits) != 3 || len(resp.Facets) != 2 {
+		t.Fatalf("response = %+v", resp)
+	}
+	if got := counts(resp.Facets[0]); resp.Facets[0].Name != "docset" || got["guides"] != 2 || got["api"] != 1 {
+		t.Errorf("docset facet = %+v", resp.Facets[0])
+	}
+	if got := counts(resp.Facets[1]); got["html"] != 2 || got["md"] != 1 {
+		t.Errorf("type facet = %+v", resp.Facets[1])
+	}
+
+	// streamed, the hits come first and each facet follows on a line of
+	// its own
+	rec = serve(http.HandlerFunc(handleAPISearch), httptest.NewRequest(http.MethodGet, "/api/search?q=pool&facets=docset,type&stream=1", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("content type = %q", ct)
+	}
+	lines := bufio.NewScanner(rec.Body)
+	if !lines.Scan() {
+		t.Fatal("empty stream")
+	}
+	var first APISearchResponse
+	if err := json.Unmarshal(lines.Bytes(), &first); err != nil || len(first.Hits) != 3 || first.Facets != nil {
+		t.Fatalf("first line = %s (%v)", lines.Bytes(), err)
+	}
+	var streamed []string
+	for lines.Scan() {
+		var facet APIFacet
+		if err := json.Unmarshal(lines.Bytes(), &facet); err != nil {
+			t.Fatal(err)
+		}
+		if facet.Name == "docset" && counts(facet)["guides"] != 2 {
+			t.Errorf("streamed docset facet = %+v", facet)
+		}
+		streamed = append(streamed, facet.Name)
+	}
+	if len(streamed) != 2 || streamed[0] != "docset" || streamed[1] != "type" {
+		t.Errorf("streamed facets = %v", streamed)
+	}
+
+	rec = serve(http.HandlerFunc(handleAPISearch), httptest.NewRequest(http.MethodGet, "/api/search?q=pool&facets=author", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown facet: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPeerTimeout is how long a federated search waits for peers when
+// the config doesn't say
+const defaultPeerTimeout = 3 * time.Second
+
+// maxPeerResponse bounds the body read from a peer
+const maxPeerResponse = 8 << 20
+
+var peerClient = &http.Client{Timeout: time.Minute}
+
+// PeerStatus tells how a peer answered a federated search
+type PeerStatus struct {
+	Name  string `json:"name"`
+	Total uint64 `json:"total"`
+	// Error is set when the peer failed or was too slow; its hits are
+	// left out
+	Error string `json:"error,omitempty"`
+}
+
+// localOrigin labels the hits of this instance
+func localOrigin() string {
+	if config.Federation.Name != "" {
+		return config.Federation.Name
+	}
+	return "local"
+}
+
+func (c FederationConfig) validate() error {
+	self := c.Name
+	if self == "" {
+		self = "local"
+	}
+	names := map[string]bool{self: true}
+	for _, p := range c.Peers {
+		if p.Name == "" || p.URL == "" {
+			return fmt.Errorf("federation: peers need a name and a url")
+		}
+		if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("federation: peer %q has an invalid url %q", p.Name, p.URL)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("federation: the name %q is used twice", p.Name)
+		}
+		names[p.Name] = true
+	}
+	if c.TimeoutMS < 0 {
+		return fmt.Errorf("federation: timeout_ms can't be negative")
+	}
+	return nil
+}
+
+// peerParams are the parameters of a search forwarded to peers: all but
+// the ones only this instance answers
+func peerParams(q url.Values) url.Values {
+	params := url.Values{}
+	for k, v := range q {
+		if k != "federated" && k != "facets" && k != "stream" {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// peerTokenFor reports whether the caller in ctx searches peer with its
+// token, so it sees what the token may read there. Others search it
+// anonymously, so local users don't see the peer's restricted docsets
+// unless the config grants them.
+func peerTokenFor(ctx context.Context, peer PeerConfig) bool {
+	p, ok := principalFromContext(ctx)
+	if !ok {
+		return false
+	}
+	return len(peer.Groups) == 0 || p.inAnyGroup(peer.Groups)
+}
+
+// searchPeer runs a search on a peer through its JSON API for the caller
+// in ctx. URLs of its hits are made absolute, so they lead to the peer.
+func searchPeer(ctx context.Context, peer PeerConfig, params url.Values) (APISearchResponse, error) {
+	var resp APISearchResponse
+	base := strings.TrimSuffix(peer.URL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/api/v"+defaultAPIVersion+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return resp, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("API-Version", defaultAPIVersion)
+	if peer.Token != "" && peerTokenFor(ctx, peer) {
+		req.Header.Set("Authorization", "Bearer "+peer.Token)
+	}
+	res, err := peerClient.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return resp, fmt.Errorf("answered %s", res.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxPeerResponse)).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("decoding the response: %w", err)
+	}
+	for i := range resp.Hits {
+		resp.Hits[i].Origin = peer.Name
+		if u, ok := resp.Hits[i].Fields["url"].(string); ok {
+			resp.Hits[i].Fields["url"] = base + "/" + strings.TrimPrefix(u, "/")
+		}
+	}
+	return resp, nil
+}
+
+// federate adds the hits of the configured peers to the local response
+// and keeps the best size of all. Peers are searched in parallel; one that
+// fails or doesn't answer in time is reported in Peers and left out.
+func federate(ctx context.Context, local APISearchResponse, params url.Values, size int) APISearchResponse {
+	timeout := defaultPeerTimeout
+	if ms := config.Federation.TimeoutMS; ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	peers := config.Federation.Peers
+	responses := make([]APISearchResponse, len(peers))
+	statuses := make([]PeerStatus, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer PeerConfig) {
+			defer wg.Done()
+			resp, err := searchPeer(ctx, peer, params)
+			statuses[i] = PeerStatus{Name: peer.Name, Total: resp.Total}
+			if err != nil {
+				statuses[i] = PeerStatus{Name: peer.Name, Error: err.Error()}
+				return
+			}
+			responses[i] = resp
+		}(i, peer)
+	}
+	wg.Wait()
+
+	for i := range local.Hits {
+		local.Hits[i].Origin = localOrigin()
+	}
+	sources := [][]APIHit{local.Hits}
+	for i, resp := range responses {
+		if statuses[i].Error == "" {
+			sources = append(sources, resp.Hits)
+			local.Total += resp.Total
+		}
+	}
+	local.Hits = mergeSources(sources, size)
+	local.Peers = statuses
+	return local
+}
+
+// mergeSources ranks the hits of several instances together. Scores
+// depend on the term statistics of each index, so they are scaled to the
+// best hit of their instance before they are compared.
+func mergeSources(sources [][]APIHit, size int) []APIHit {
+	merged := []APIHit{}
+	for _, hits := range sources {
+		var top float64
+		for _, hit := range hits {
+			top = max(top, hit.Score)
+		}
+		for _, hit := range hits {
+			if top > 0 {
+				hit.Score /= top
+			}
+			merged = append(merged, hit)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Score > merged[j].Score })
+	if len(merged) > size {
+		merged = merged[:size]
+	}
+	return merged
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFederatedSearch(t *testing.T) {
+	var authorization string
+	payments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/search" || r.URL.Query().Get("q") != "pooled" || r.URL.Query().Has("federated") {
+			t.Errorf("peer request = %s %v", r.URL, r.Header)
+		}
+		authorization = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"query": "pooled", "total": 2,
+			"hits": []map[string]interface{}{
+				{"id": "/srv/pay/pool.html", "score": 0.4, "fields": map[string]string{"title": "Payment pools", "url": "pay/pool.html"}},
+				{"id": "/srv/pay/retry.html", "score": 0.2, "fields": map[string]string{"title": "Retries", "url": "pay/retry.html"}},
+			},
+		})
+	}))
+	defer payments.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+	path := filepath.Join(root, "guides/pool.html")
+	if err := idx.Index(path, Document{Title: "Pooling", Content: "connections are pooled", URL: path}); err != nil {
+		t.Fatal(err)
+	}
+	search := func(groups ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/search?q=pooled&fields=title,url&federated=1", nil)
+		if groups != nil {
+			r = r.WithContext(memberContext(groups...))
+		}
+		return serve(http.HandlerFunc(handleAPISearch), r)
+	}
+
+	if rec := search(); rec.Code != http.StatusBadRequest {
+		t.Errorf("without peers: %d %s", rec.Code, rec.Body)
+	}
+
+	withConfig(t, Config{Federation: FederationConfig{
+		Name: "platform",
+		Peers: []PeerConfig{
+			{Name: "payments", URL: payments.URL, Token: "s3cret", Groups: []string{"payments"}},
+			{Name: "search", URL: broken.URL},
+		},
+	}})
+	rec := search("payments")
+	if authorization != "Bearer s3cret" {
+		t.Errorf("a member of the peer's groups searched it with %q", authorization)
+	}
+	var resp APISearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("federated search: %d %s", rec.Code, rec.Body)
+	}
+	if resp.Total != 3 || len(resp.Hits) != 3 {
+		t.Fatalf("response = %+v", resp)
+	}
+	// the best hits of both instances tie, then the peer's second best
+	if resp.Hits[0].Origin != "platform" || resp.Hits[1].Origin != "payments" || resp.Hits[2].Score != 0.5 {
+		t.Errorf("hits = %+v", resp.Hits)
+	}
+	if u := resp.Hits[1].Fields["url"]; u != payments.URL+"/pay/pool.html" {
+		t.Errorf("url of the peer's hit = %v", u)
+	}
+	if len(resp.Peers) != 2 || resp.Peers[0].Total != 2 || resp.Peers[0].Error != "" || !strings.Contains(resp.Peers[1].Error, "500") {
+		t.Errorf("peers = %+v", resp.Peers)
+	}
+
+	// everyone else searches the peer as an anonymous user would
+	for _, groups := range [][]string{nil, {"dev"}} {
+		search(groups...)
+		if authorization != "" {
+			t.Errorf("groups %v searched the peer with %q", groups, authorization)
+		}
+	}
+}
+
+func TestFederationConfigValidate(t *testing.T) {
+	for _, c := range []FederationConfig{
+		{Peers: []PeerConfig{{Name: "payments"}}},
+		{Peers: []PeerConfig{{Name: "payments", URL: "docs.example.com"}}},
+		{Peers: []PeerConfig{{Name: "local", URL: "https://docs.example.com"}}},
+		{Name: "platform", Peers: []PeerConfig{{Name: "a", URL: "https://a.example.com"}, {Name: "a", URL: "https://b.example.com"}}},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("%+v is valid", c)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	// feedWindow is how far back the feed looks for changes
+	feedWindow = 30 * 24 * time.Hour
+	// maxFeedEntries is how many of the most recent changes are listed
+	maxFeedEntries = 50
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string        `xml:"title"`
+	ID        string        `xml:"id"`
+	Updated   string        `xml:"updated"`
+	Published string        `xml:"published,omitempty"`
+	Link      atomLink      `xml:"link"`
+	Category  *atomCategory `xml:"category"`
+	Summary   string        `xml:"summary,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// feedItem is a document added or changed within feedWindow
+type feedItem struct {
+	Title, URL, Docset, Summary string
+	// Added is when the document was first indexed, zero if that was
+	// before the window
+	Added, Updated time.Time
+}
+
+// handleFeed publishes the documents added or modified in the last
+// feedWindow as an Atom feed, newest first. q, docset, type and tag narrow
+// it down, so a team can follow only its own docs.
+func handleFeed(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	items, err := feedItems(r.URL.Query().Get("q"), r.URL.Query().Get("docset"), filter, now)
+	if err != nil {
+		log.Printf("Error building feed: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	self := absoluteURL(r.URL.RequestURI())
+	feed := atomFeed{
+		Title:   "GoDocHive: documentation changes",
+		ID:      self,
+		Updated: now.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: absoluteURL("/search")},
+		},
+		Entries: []atomEntry{},
+	}
+	if len(items) > 0 {
+		feed.Updated = items[0].Updated.Format(time.RFC3339)
+	}
+	for _, item := range items {
+		e := atomEntry{
+			Title:   item.Title,
+			ID:      item.URL,
+			Updated: item.Updated.Format(time.RFC3339),
+			Link:    atomLink{Href: item.URL},
+			Summary: item.Summary,
+		}
+		if !item.Added.IsZero() {
+			e.Published = item.Added.Format(time.RFC3339)
+		}
+		if item.Docset != "" {
+			e.Category = &atomCategory{Term: item.Docset}
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("Error encoding feed: %v", err)
+	}
+}
+
+// feedItems finds the documents first indexed or modified since
+// now-feedWindow. A document is dated by whichever came last, so copying
+// in an old file still shows up as new.
+func feedItems(text, docset string, filter searchFilter, now time.Time) ([]feedItem, error) {
+	since := now.Add(-feedWindow)
+	added, err := documentsSeenBetween(since, now)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := bleve.NewDateRangeQuery(since, time.Time{})
+	modified.SetField("ModifiedAt")
+	var q query.Query = modified
+	if len(added) > 0 {
+		ids := make([]string, 0, len(added))
+		for id := range added {
+			ids = append(ids, id)
+		}
+		q = bleve.NewDisjunctionQuery(modified, bleve.NewDocIDQuery(ids))
+	}
+	if strings.TrimSpace(text) != "" {
+		q = bleve.NewConjunctionQuery(q, filter.textQuery(text))
+	}
+	if docset != "" {
+		tq := bleve.NewTermQuery(docset)
+		tq.SetField("Docset")
+		q = bleve.NewConjunctionQuery(q, tq)
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(filter.apply(q), 1000, 0, false)
+	searchRequest.Fields = []string{"Title", "Docset", "Description", "Content", "ModifiedAt"}
+	searchRequest.SortBy([]string{"-ModifiedAt"})
+
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []feedItem
+	for _, hit := range searchResult.Hits {
+		// examples change along with their page, which is listed already
+		if !hitAllowed(hit.ID, filter.Denied) || strings.Contains(hit.ID, "#") {
+			continue
+		}
+		rel, err := filepath.Rel(root, hit.ID)
+		if err != nil {
+			continue
+		}
+		item := feedItem{URL: absoluteURL(rel), Added: added[hit.ID]}
+		item.Title, _ = hit.Fields["Title"].(string)
+		item.Docset, _ = hit.Fields["Docset"].(string)
+		if item.Summary, _ = hit.Fields["Description"].(string); item.Summary == "" {
+			content, _ := hit.Fields["Content"].(string)
+			item.Summary = truncate(strings.Join(strings.Fields(content), " "), 300)
+		}
+		if s, ok := hit.Fields["ModifiedAt"].(string); ok {
+			item.Updated, _ = time.Parse(time.RFC3339, s)
+		}
+		if item.Added.After(item.Updated) {
+			item.Updated = item.Added
+		}
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Updated.After(items[j].Updated) })
+	if len(items) > maxFeedEntries {
+		items = items[:maxFeedEntries]
+	}
+	return items, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFeed(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := restrictedConfig
+	cfg.BaseURL = "https://docs.example.com"
+	withConfig(t, cfg)
+	withRoot(t, "/docs")
+	withStore(t)
+	idx := withEmptyIndex(t)
+
+	now := time.Now().UTC()
+	docs := []struct {
+		rel      string
+		modified time.Time
+	}{
+		{"guides/fresh.html", now.Add(-2 * time.Hour)},
+		{"guides/stale.html", now.AddDate(-1, 0, 0)},
+		// an old file that was only just copied in
+		{"guides/copied.html", now.AddDate(-2, 0, 0)},
+		{"security/playbooks/fresh.html", now.Add(-time.Hour)},
+	}
+	for _, d := range docs {
+		path := filepath.Join(root, d.rel)
+		doc := Document{Title: d.rel, Content: "connection pooling", URL: path, Docset: docsetFor(path), ModifiedAt: d.modified}
+		if err := idx.Index(path, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := storePut(seenDocsBucket, filepath.Join(root, "guides/copied.html"), now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(http.HandlerFunc(handleFeed), httptest.NewRequest(http.MethodGet, "/feed.atom", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/atom+xml; charset=utf-8" {
+		t.Fatalf("feed = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range feed.Entries {
+		got = append(got, e.ID)
+	}
+	want := []string{"https://docs.example.com/guides/copied.html", "https://docs.example.com/guides/fresh.html"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("entries = %q, want %q", got, want)
+	}
+	if e := feed.Entries[0]; e.Published == "" || e.Category == nil || e.Category.Term != "guides" || e.Summary != "connection pooling" {
+		t.Errorf("copied entry = %+v", e)
+	}
+	if feed.Entries[1].Published != "" {
+		t.Errorf("fresh.html was indexed before the window, got published %q", feed.Entries[1].Published)
+	}
+
+	// members of the group see the restricted docset too, and docset= narrows
+	req := httptest.NewRequest(http.MethodGet, "/feed.atom?docset=security-playbooks", nil).WithContext(memberContext("security"))
+	feed = atomFeed{}
+	if err := xml.Unmarshal(serve(http.HandlerFunc(handleFeed), req).Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Entries) != 1 || feed.Entries[0].ID != "https://docs.example.com/security/playbooks/fresh.html" {
+		t.Errorf("docset feed = %+v", feed.Entries)
+	}
+
+	if rec := serve(http.HandlerFunc(handleFeed), httptest.NewRequest(http.MethodGet, "/feed.atom?updated=soon", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad filter = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultFileTypes maps the extensions indexed out of the box to the type
+// of document they hold, which picks the extractor. index.file_types adds
+// to and overrides it.
+var defaultFileTypes = map[string]string{
+	".html":     "html",
+	".htm":      "html",
+	".xhtml":    "html",
+	".md":       "md",
+	".markdown": "md",
+	".txt":      "txt",
+}
+
+// extractors pull the text out of a document of each type
+var extractors = map[string]func(string) pageText{
+	"html": extractPage,
+	"md":   extractMarkdown,
+	"txt":  extractText,
+}
+
+// sniffLength is how much of a file content sniffing looks at, as much as
+// http.DetectContentType reads
+const sniffLength = 512
+
+func validateFileTypes(types map[string]string) error {
+	for ext, t := range types {
+		if !strings.HasPrefix(ext, ".") || ext != strings.ToLower(ext) {
+			return fmt.Errorf("index: file_types: %q must be a lowercase extension like \".xhtml\"", ext)
+		}
+		if extractors[t] == nil {
+			return fmt.Errorf("index: file_types: unknown type %q for %s, use html, md or txt", t, ext)
+		}
+	}
+	return nil
+}
+
+// mappedFileType is the type the extension of name maps to, "" when it
+// has none or isn't mapped
+func mappedFileType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return ""
+	}
+	if t, ok := config.Index.FileTypes[ext]; ok {
+		return t
+	}
+	return defaultFileTypes[ext]
+}
+
+// isDocumentName reports whether the file called name is indexed when its
+// content is a document: its extension is allowed or in index.file_types,
+// or it has none and index.sniff is on
+func isDocumentName(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := config.Index.FileTypes[ext]; ok && ext != "" {
+		return true
+	}
+	return hasAllowedExtension(name, allowedExtensions) || (ext == "" && config.Index.Sniff)
+}
+
+// fileType is the type of the document called name with content: the type
+// its extension maps to, or else what the content sniffs as. Other content
+// with an allowed extension is read as HTML, as every file was before
+// types were told apart. It returns "" for files without an extension that
+// aren't text, like executables.
+func fileType(name string, content []byte) string {
+	if t := mappedFileType(name); t != "" {
+		return t
+	}
+	head := content
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+	mime, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	switch {
+	case mime == "text/html":
+		return "html"
+	case mime == "text/xml" && bytes.Contains(bytes.ToLower(head), []byte("<html")):
+		return "html"
+	case mime == "text/plain":
+		return "txt"
+	case filepath.Ext(name) != "":
+		return "html"
+	}
+	return ""
+}
+
+// extractText reads a text file: the text as is, its first paragraph as
+// the summary and the language guessed from the text. Unlike the HTML
+// extractor it leaves text like "a < b" or "List<T>" alone.
+func extractText(content string) pageText {
+	return pageText{
+		Content:    content,
+		Summary:    textSummary(content, nil),
+		Language:   guessLanguage(content),
+		Deprecated: deprecatedLine.MatchString(content),
+	}
+}
+
+// atxHeading matches a Markdown heading line, like "## Pools ##"
+var atxHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+
+// extractMarkdown reads a Markdown file like a text file, with the first
+// level one heading as the title, the headings and the fenced code blocks
+func extractMarkdown(content string) pageText {
+	page := extractText(content)
+	var headings, code, block []string
+	fence := ""
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				code = append(code, strings.Join(block, "\n"))
+				fence, block = "", nil
+			} else {
+				block = append(block, line)
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if m := atxHeading.FindStringSubmatch(trimmed); m != nil {
+			headings = append(headings, m[2])
+			if page.Title == "" && m[1] == "#" {
+				page.Title = m[2]
+			}
+		}
+	}
+	page.Headings = strings.Join(headings, " ")
+	page.CodeBlocks = strings.Join(code, "\n")
+	page.Summary = textSummary(content, func(p string) bool {
+		return strings.HasPrefix(p, "#") || strings.HasPrefix(p, "```") || strings.HasPrefix(p, "~~~")
+	})
+	return page
+}
+
+// textSummary is the first paragraph of text with at least eight words,
+// or failing that the first one, leaving out those skip reports true for
+func textSummary(text string, skip func(string) bool) string {
+	var first string
+	for _, p := range blankLines.Split(text, -1) {
+		p = strings.Join(strings.Fields(p), " ")
+		if p == "" || (skip != nil && skip(p)) {
+			continue
+		}
+		if len(strings.Fields(p)) >= 8 {
+			return p
+		}
+		if first == "" {
+			first = p
+		}
+	}
+	return first
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFileType(t *testing.T) {
+	withConfig(t, Config{Index: IndexConfig{FileTypes: map[string]string{".rst": "txt"}}})
+
+	tests := []struct {
+		name, content, want string
+	}{
+		{"guide.xhtml", "anything", "html"},
+		{"guide.HTM", "anything", "html"},
+		{"notes.markdown", "# Notes", "md"},
+		{"intro.rst", "<p>not read as html</p>", "txt"},
+		{"README", "Pools keep connections open.", "txt"},
+		{"index", "<!DOCTYPE html><title>Pools</title>", "html"},
+		{"page", `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"></html>`, "html"},
+		{"hiver", "\x7fELF\x02\x01\x01\x00", ""},
+		{"main.go", "package main", "txt"},
+		{"manual.pdf", "%PDF-1.7", "html"},
+	}
+	for _, tt := range tests {
+		if got := fileType(tt.name, []byte(tt.content)); got != tt.want {
+			t.Errorf("fileType(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if err := validateFileTypes(map[string]string{".xht": "html"}); err != nil {
+		t.Errorf("valid file_types: %v", err)
+	}
+	for _, types := range []map[string]string{{"xht": "html"}, {".XHT": "html"}, {".pdf": "pdf"}} {
+		if err := validateFileTypes(types); err == nil {
+			t.Errorf("file_types %v accepted", types)
+		}
+	}
+}
+
+func TestExtractMarkdown(t *testing.T) {
+	page := extractMarkdown("# Pooling\n\nShort intro.\n\n## Sizing ##\n\nA pool keeps a set of open connections ready for reuse.\n\n```go\nif a < b {\n\tpool.Get()\n}\n```\n\n# Not the title\n")
+
+	if page.Title != "Pooling" || page.Headings != "Pooling Sizing Not the title" {
+		t.Errorf("title %q, headings %q", page.Title, page.Headings)
+	}
+	if page.CodeBlocks != "if a < b {\n\tpool.Get()\n}" {
+		t.Errorf("code blocks = %q", page.CodeBlocks)
+	}
+	if page.Summary != "A pool keeps a set of open connections ready for reuse." {
+		t.Errorf("summary = %q", page.Summary)
+	}
+	if !strings.Contains(page.Content, "if a < b {") {
+		t.Errorf("content = %q, want the code as is", page.Content)
+	}
+}
+
+func TestBuildIndexRoutesFileTypes(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{Index: IndexConfig{Sniff: true}})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+
+	files := map[string]string{
+		"guide.xhtml":  `<?xml version="1.0"?><html xmlns="http://www.w3.org/1999/xhtml"><head><title>Draining</title></head><body><p>Drain connections first.</p></body></html>`,
+		"CHANGES":      "Drain connections on shutdown.",
+		"index":        "<!DOCTYPE html><title>Home</title><p>Drain nodes.</p>",
+		"hiver":        "\x7fELF\x02\x01\x01\x00drain",
+		"generics.txt": "Drain a List<T> of connections.",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids, err := buildIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, id := range ids {
+		got = append(got, filepath.Base(id))
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "CHANGES,generics.txt,guide.xhtml,index" {
+		t.Errorf("indexed %v", got)
+	}
+
+	results, err := performSearch("drain", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]string)
+	for _, doc := range results {
+		types[doc.Title] = doc.DocType
+	}
+	if types["Draining"] != "html" || types["Home"] != "html" || types["CHANGES"] != "txt" {
+		t.Errorf("types by title = %v", types)
+	}
+	for _, doc := range results {
+		if doc.Title == "generics.txt" && !strings.Contains(doc.Content, "List<T>") {
+			t.Errorf("text file content = %q", doc.Content)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatter is the metadata block static site generators put at the
+// top of Markdown and HTML files: YAML between "---" lines or TOML between
+// "+++" lines
+type frontMatter struct {
+	Title   string
+	Tags    []string
+	Authors []string
+	Date    time.Time
+}
+
+// frontMatterDates are the layouts of front matter dates written as
+// strings
+var frontMatterDates = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04:05 -0700", "2006-01-02"}
+
+// splitFrontMatter parses the front matter at the start of content and
+// returns it with the rest of content. Content without front matter comes
+// back whole; so does content whose front matter doesn't parse, with the
+// error.
+func splitFrontMatter(content string) (frontMatter, string, error) {
+	rest := strings.TrimPrefix(content, "\ufeff")
+	var fence string
+	var unmarshal func([]byte, interface{}) error
+	switch line, _, _ := strings.Cut(rest, "\n"); strings.TrimRight(line, "\r") {
+	case "---":
+		fence, unmarshal = "---", yaml.Unmarshal
+	case "+++":
+		fence, unmarshal = "+++", toml.Unmarshal
+	default:
+		return frontMatter{}, content, nil
+	}
+	_, rest, _ = strings.Cut(rest, "\n")
+	block, body, ok := cutFenceLine(rest, fence)
+	if !ok {
+		// a "---" rule without a closing one is just a rule
+		return frontMatter{}, content, nil
+	}
+	var fields map[string]interface{}
+	if err := unmarshal([]byte(block), &fields); err != nil {
+		return frontMatter{}, content, err
+	}
+	return frontMatterOf(fields), body, nil
+}
+
+// cutFenceLine cuts s around its first line that is fence, or "..." which
+// may end YAML too
+func cutFenceLine(s, fence string) (string, string, bool) {
+	for i := 0; i < len(s); {
+		next := len(s)
+		if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+			next = i + end + 1
+		}
+		if line := strings.TrimRight(s[i:next], "\r\n"); line == fence || (fence == "---" && line == "...") {
+			return s[:i], s[next:], true
+		}
+		i = next
+	}
+	return "", "", false
+}
+
+// frontMatterOf picks the fields GoDocHive uses out of parsed front matter.
+// Tags that can't be tags are left out. Authors may be given as author or
+// authors, as a name, a list of names or objects with a name, as Hugo
+// writes them.
+func frontMatterOf(fields map[string]interface{}) frontMatter {
+	var fm frontMatter
+	if s, ok := fields["title"].(string); ok {
+		fm.Title = strings.TrimSpace(s)
+	}
+	for _, t := range parseTags(frontMatterStrings(fields["tags"])...) {
+		// tags follow the rules of those users give, "Getting Started"
+		// becomes getting-started
+		t = strings.Join(strings.Fields(t), "-")
+		if validTag.MatchString(t) && !contains(fm.Tags, t) && len(fm.Tags) < maxTags {
+			fm.Tags = append(fm.Tags, t)
+		}
+	}
+	for _, key := range []string{"author", "authors"} {
+		for _, a := range frontMatterStrings(fields[key]) {
+			if a = strings.TrimSpace(a); a != "" && !contains(fm.Authors, a) {
+				fm.Authors = append(fm.Authors, a)
+			}
+		}
+	}
+	switch d := fields["date"].(type) {
+	case time.Time:
+		fm.Date = d.UTC()
+	case string:
+		for _, layout := range frontMatterDates {
+			if t, err := time.Parse(layout, strings.TrimSpace(d)); err == nil {
+				fm.Date = t.UTC()
+				break
+			}
+		}
+	}
+	return fm
+}
+
+// frontMatterStrings reads a front matter value that is a string or a list
+// of strings or of objects with a name
+func frontMatterStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case map[string]interface{}:
+		if name, ok := v["name"].(string); ok {
+			return []string{name}
+		}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, frontMatterStrings(item)...)
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	may := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name, content string
+		want          frontMatter
+		body          string
+	}{
+		{
+			"yaml",
+			"---\ntitle: Connection pooling\ntags: [networking, Getting Started, \"not/a tag\"]\nauthor: Ana Lima\ndate: 2024-05-01\n---\n# Pools\n",
+			frontMatter{Title: "Connection pooling", Tags: []string{"networking", "getting-started"}, Authors: []string{"Ana Lima"}, Date: may},
+			"# Pools\n",
+		},
+		{
+			"yaml authors as objects",
+			"\ufeff---\r\nauthors:\r\n  - name: Ana Lima\r\n  - Kai Berg\r\ndate: \"2024-05-01 12:30:00\"\r\n...\r\nbody",
+			frontMatter{Authors: []string{"Ana Lima", "Kai Berg"}, Date: may.Add(12*time.Hour + 30*time.Minute)},
+			"body",
+		},
+		{
+			"toml",
+			"+++\ntitle = \"Draining\"\ntags = \"ops, networking\"\nauthors = [\"Kai Berg\"]\ndate = 2024-05-01T00:00:00Z\n+++\nbody",
+			frontMatter{Title: "Draining", Tags: []string{"ops", "networking"}, Authors: []string{"Kai Berg"}, Date: may},
+			"body",
+		},
+		{"none", "# Pools\n---\ntitle: x\n---\n", frontMatter{}, "# Pools\n---\ntitle: x\n---\n"},
+		{"a rule, not front matter", "---\nPools keep connections open.\n", frontMatter{}, "---\nPools keep connections open.\n"},
+	}
+	for _, tt := range tests {
+		fm, body, err := splitFrontMatter(tt.content)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if fm.Title != tt.want.Title || strings.Join(fm.Tags, ",") != strings.Join(tt.want.Tags, ",") ||
+			strings.Join(fm.Authors, ",") != strings.Join(tt.want.Authors, ",") || !fm.Date.Equal(tt.want.Date) {
+			t.Errorf("%s: front matter = %+v, want %+v", tt.name, fm, tt.want)
+		}
+		if body != tt.body {
+			t.Errorf("%s: body = %q, want %q", tt.name, body, tt.body)
+		}
+	}
+
+	broken := "---\ntitle: [unclosed\n---\nbody"
+	if fm, body, err := splitFrontMatter(broken); err == nil || body != broken || fm.Title != "" {
+		t.Errorf("broken front matter = %+v, %q, %v", fm, body, err)
+	}
+}
+
+func TestFrontMatterIndexed(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	guide := "---\ntitle: Connection pooling\ntags: [networking]\nauthor: Ana Lima\ndate: 2024-05-01\n---\n# Pools\n\nPools keep connections open.\n"
+	if err := os.WriteFile(filepath.Join(dir, "pool.md"), []byte(guide), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := performSearch("pools", searchFilter{}, 10, nil)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("results = %+v, %v", results, err)
+	}
+	doc := results[0]
+	if doc.Title != "Connection pooling" || strings.Join(doc.Tags, ",") != "networking" || strings.Join(doc.Authors, ",") != "Ana Lima" ||
+		doc.Date.Format("2006-01-02") != "2024-05-01" || strings.Contains(doc.Content, "author:") {
+		t.Errorf("result = %+v", doc)
+	}
+	if found, _ := performSearch("lima", searchFilter{}, 10, nil); len(found) != 0 {
+		t.Errorf("the front matter was indexed as text: %+v", found)
+	}
+
+	rec := httptest.NewRecorder()
+	renderTemplate(rec, "search.html", searchView{Page: Page{Lang: "en"}, Query: "pools", Results: results, Groups: groupBySection(results)})
+	if body := rec.Body.String(); !strings.Contains(body, `by Ana Lima · <time datetime="2024-05-01">2024-05-01</time>`) {
+		t.Errorf("the result doesn't show the author and date: %s", body)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitCommand runs git with args and returns what it printed
+func gitCommand(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// never wait for a password on the terminal
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", err
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func validateGit(s SourceConfig) error {
+	if s.URL == "" {
+		return errors.New("git needs the url of the repository")
+	}
+	if strings.HasPrefix(s.URL, "-") || strings.HasPrefix(s.Branch, "-") {
+		return errors.New("git url and branch can't start with -")
+	}
+	return nil
+}
+
+// fetchGit keeps a shallow clone of the source's branch, or of the
+// repository's default branch, in dir. The first fetch clones it; later
+// ones fetch the latest commit only and check it out.
+func fetchGit(ctx context.Context, src SourceConfig, dir string) error {
+	defer forgetRevision(dir)
+	if origin, err := gitCommand(ctx, "-C", dir, "remote", "get-url", "origin"); err == nil && origin == src.URL {
+		ref := src.Branch
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if _, err := gitCommand(ctx, "-C", dir, "fetch", "--depth", "1", "origin", ref); err != nil {
+			return err
+		}
+		if _, err := gitCommand(ctx, "-C", dir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return err
+		}
+		_, err := gitCommand(ctx, "-C", dir, "clean", "-fd")
+		return err
+	}
+
+	// no clone yet, or one of another repository
+	return replaceDir(dir, func(tmp string) error {
+		args := []string{"clone", "--depth", "1", "--single-branch"}
+		if src.Branch != "" {
+			args = append(args, "--branch", src.Branch)
+		}
+		_, err := gitCommand(ctx, append(args, "--", src.URL, tmp)...)
+		return err
+	})
+}
+
+// gitRevision is the commit checked out in the clone at dir
+func gitRevision(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return "", err
+	}
+	return gitCommand(context.Background(), "-C", dir, "rev-parse", "HEAD")
+}
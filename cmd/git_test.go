@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := gitCommand(context.Background(), append([]string{"-C", repo, "-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	commit := func(name, content string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", name)
+		git("commit", "-q", "-m", "update "+name)
+		return git("rev-parse", "HEAD")
+	}
+	git("init", "-q", "-b", "main")
+	commit("pool.md", "# Pooling\n\nconnections are pooled")
+
+	dir := t.TempDir()
+	withRoot(t, dir)
+	src := SourceConfig{Name: "repo", Type: "git", URL: repo, Branch: "main", Dir: "remote/repo"}
+	withConfig(t, Config{Sources: []SourceConfig{src}})
+	withEmptyIndex(t)
+	if err := fetchGit(context.Background(), src, sourceDir(src)); err != nil {
+		t.Fatal(err)
+	}
+	second := commit("retry.md", "# Retries\n\nrequests are retried")
+	if err := fetchGit(context.Background(), src, sourceDir(src)); err != nil {
+		t.Fatal(err)
+	}
+	if rev := revisionFor(filepath.Join(sourceDir(src), "retry.md")); rev != second {
+		t.Errorf("revision = %q, want %q", rev, second)
+	}
+
+	ids, err := buildIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("indexed %v, want the two docs and nothing of .git", ids)
+	}
+	req := bleve.NewSearchRequest(bleve.NewMatchQuery("retried"))
+	req.Fields = []string{"Revision"}
+	res, err := index.Search(req)
+	if err != nil || len(res.Hits) != 1 || res.Hits[0].Fields["Revision"] != second {
+		t.Errorf("search = %v, %v", res, err)
+	}
+}
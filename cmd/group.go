@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+)
+
+// groupVisible is how many hits of a section are shown before the rest is
+// collapsed
+const groupVisible = 3
+
+// resultGroup is the hits of a search from one directory of the docs. The
+// first Shown hits are listed, the others collapsed.
+type resultGroup struct {
+	Section string
+	Results []Document
+	Shown   int
+}
+
+// Hidden is the number of collapsed hits
+func (g resultGroup) Hidden() int {
+	return len(g.Results) - g.Shown
+}
+
+// groupBySection groups results by their parent directory, so one section
+// of the docs can't crowd out the others. Groups are ordered by their best
+// hit and keep the order of hits within them.
+func groupBySection(results []Document) []resultGroup {
+	var groups []resultGroup
+	index := make(map[string]int)
+	for _, doc := range results {
+		section := sectionOf(doc.URL)
+		i, ok := index[section]
+		if !ok {
+			i = len(groups)
+			index[section] = i
+			groups = append(groups, resultGroup{Section: section})
+		}
+		groups[i].Results = append(groups[i].Results, doc)
+	}
+	for i := range groups {
+		groups[i].Shown = min(len(groups[i].Results), groupVisible)
+	}
+	return groups
+}
+
+// sectionOf returns the directory of a result URL relative to the root,
+// e.g. "/guides/net/"
+func sectionOf(url string) string {
+	dir := path.Dir(filepath.ToSlash(url))
+	if dir == "." {
+		return "/"
+	}
+	return "/" + dir + "/"
+}
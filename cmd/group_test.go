@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestGroupBySection(t *testing.T) {
+	var results []Document
+	for _, url := range []string{"net/a.html", "net/b.html", "index.html", "net/c.html", "net/d.html#example-1", "net/e.html"} {
+		results = append(results, Document{URL: url})
+	}
+
+	groups := groupBySection(results)
+	if len(groups) != 2 {
+		t.Fatalf("groups = %+v, want 2", groups)
+	}
+	net, top := groups[0], groups[1]
+	if net.Section != "/net/" || len(net.Results) != 5 || net.Shown != groupVisible || net.Hidden() != 2 {
+		t.Errorf("net group = %+v", net)
+	}
+	if top.Section != "/" || top.Shown != 1 || top.Hidden() != 0 {
+		t.Errorf("top-level group = %+v", top)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// handleHealthz reports that the process is alive
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports whether searches can be served: the index is open,
+// answers queries and matches the configured docsets
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if index == nil {
+		http.Error(w, "index not open", http.StatusServiceUnavailable)
+		return
+	}
+	probe := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	if _, err := index.SearchInContext(r.Context(), probe); err != nil {
+		http.Error(w, "index unavailable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if !docsetsUpToDate(index) {
+		http.Error(w, "index built with an outdated docset configuration", http.StatusServiceUnavailable)
+		return
+	}
+	if !analysisUpToDate(index) {
+		http.Error(w, "index built with an outdated analysis configuration", http.StatusServiceUnavailable)
+		return
+	}
+	if !schemaUpToDate(index) {
+		http.Error(w, "index built with an outdated schema", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	old := index
+	index = nil
+	t.Cleanup(func() { index = old })
+
+	get := func() int {
+		return serve(http.HandlerFunc(handleReadyz), httptest.NewRequest(http.MethodGet, "/readyz", nil)).Code
+	}
+	if code := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("without an index: status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	idx := withEmptyIndex(t)
+	if code := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("unstamped index: status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	if err := stampDocsets(idx); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("index with an old schema: status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if err := stampSchema(idx, schemaVersion); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Errorf("ready index: status = %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const searchHistoryBucket = "search_history"
+
+// maxHistory is how many recent queries are kept per user
+const maxHistory = 10
+
+// searchHistory is what's stored per user
+type searchHistory struct {
+	// Queries are the recent queries, newest first
+	Queries []string `json:"queries"`
+	// Updated is when the last query was recorded, for retention
+	Updated time.Time `json:"updated"`
+}
+
+// decodeHistory reads a stored history. Histories used to be stored as a
+// bare list of queries, which comes back with a zero Updated.
+func decodeHistory(data []byte) (searchHistory, error) {
+	var h searchHistory
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return h, json.Unmarshal(data, &h.Queries)
+	}
+	return h, json.Unmarshal(data, &h)
+}
+
+// recentQueries returns the recent queries of owner, newest first
+func recentQueries(owner string) ([]string, error) {
+	recent := []string{}
+	if store == nil || owner == "" {
+		return recent, nil
+	}
+	var raw json.RawMessage
+	found, err := storeGet(searchHistoryBucket, owner, &raw)
+	if err != nil || !found {
+		return recent, err
+	}
+	h, err := decodeHistory(raw)
+	if err != nil || h.Queries == nil {
+		return recent, err
+	}
+	return h.Queries, nil
+}
+
+// recordQuery puts query at the front of owner's history
+func recordQuery(owner, query string) error {
+	recent, err := recentQueries(owner)
+	if err != nil {
+		return err
+	}
+	updated := []string{query}
+	for _, q := range recent {
+		if q != query && len(updated) < maxHistory {
+			updated = append(updated, q)
+		}
+	}
+	return storePut(searchHistoryBucket, owner, searchHistory{Queries: updated, Updated: time.Now().UTC()})
+}
+
+func clearHistory(owner string) error {
+	if store == nil || owner == "" {
+		return nil
+	}
+	return storeDelete(searchHistoryBucket, owner)
+}
+
+func handleListHistory(w http.ResponseWriter, r *http.Request) {
+	owner, _ := visitorKey(r)
+	recent, err := recentQueries(owner)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, recent)
+}
+
+func handleClearHistory(w http.ResponseWriter, r *http.Request) {
+	owner, _ := visitorKey(r)
+	if err := clearHistory(owner); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleClearHistoryForm clears the history from the search page and goes
+// back to it
+func handleClearHistoryForm(w http.ResponseWriter, r *http.Request) {
+	owner, _ := visitorKey(r)
+	if err := clearHistory(owner); err != nil {
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/search", http.StatusSeeOther)
+}
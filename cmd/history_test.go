@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordQuery(t *testing.T) {
+	withStore(t)
+
+	for _, q := range []string{"pool", "cache", "pool"} {
+		if err := recordQuery("user:ann", q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := recentQueries("user:ann"); !reflect.DeepEqual(got, []string{"pool", "cache"}) {
+		t.Errorf("recent = %q, want repeats moved to the front", got)
+	}
+
+	for i := 0; i < maxHistory+5; i++ {
+		recordQuery("user:bob", strings.Repeat("q", i+1))
+	}
+	if got, _ := recentQueries("user:bob"); len(got) != maxHistory || got[0] != strings.Repeat("q", maxHistory+5) {
+		t.Errorf("recent = %q, want the last %d queries", got, maxHistory)
+	}
+	if got, _ := recentQueries("user:ann"); len(got) != 2 {
+		t.Errorf("recent of another user = %q", got)
+	}
+}
+
+func TestSearchHistory(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{})
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is kept for visitors who didn't turn the history on
+	rec := serve(http.HandlerFunc(handleSearch), httptest.NewRequest(http.MethodGet, "/search?q=pooling", nil))
+	if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+		t.Fatalf("cookies = %v, want none without opting in", cookies)
+	}
+
+	prefs := &http.Cookie{Name: prefsCookieName, Value: "history=on"}
+	first := httptest.NewRequest(http.MethodGet, "/search?q=pooling", nil)
+	first.AddCookie(prefs)
+	rec = serve(http.HandlerFunc(handleSearch), first)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != visitorCookieName {
+		t.Fatalf("cookies = %v, want the visitor cookie", cookies)
+	}
+	visitor := cookies[0]
+
+	page := httptest.NewRequest(http.MethodGet, "/search", nil)
+	page.AddCookie(visitor)
+	page.AddCookie(prefs)
+	if body := serve(http.HandlerFunc(handleSearch), page).Body.String(); !strings.Contains(body, `<a href="/search?q=pooling">pooling</a>`) {
+		t.Errorf("search page doesn't list the recent query:\n%s", body)
+	}
+
+	live := httptest.NewRequest(http.MethodGet, "/search/results?q=pool", nil)
+	live.AddCookie(visitor)
+	serve(http.HandlerFunc(handleLiveSearch), live)
+
+	api := httptest.NewRequest(http.MethodGet, "/api/history", nil)
+	api.AddCookie(visitor)
+	var recent []string
+	if err := json.NewDecoder(serve(http.HandlerFunc(handleListHistory), api).Body).Decode(&recent); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recent, []string{"pooling"}) {
+		t.Errorf("history = %q, want only the submitted search", recent)
+	}
+
+	clear := httptest.NewRequest(http.MethodDelete, "/api/history", nil)
+	clear.AddCookie(visitor)
+	if rec := serve(http.HandlerFunc(handleClearHistory), clear); rec.Code != http.StatusNoContent {
+		t.Fatalf("clear = %d", rec.Code)
+	}
+	if got, _ := recentQueries("visitor:" + visitor.Value); len(got) != 0 {
+		t.Errorf("history after clearing = %q", got)
+	}
+}
+
+func TestSearchHistoryOptOut(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{})
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	recordQuery("visitor:abc", "cache")
+	visitor := &http.Cookie{Name: visitorCookieName, Value: "abc"}
+
+	form := url.Values{"history": {"off"}}
+	r := httptest.NewRequest(http.MethodPost, "/preferences", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(visitor)
+	rec := serve(http.HandlerFunc(handlePreferences), r)
+	if got, _ := recentQueries("visitor:abc"); len(got) != 0 {
+		t.Errorf("history after opting out = %q, want it cleared", got)
+	}
+
+	page := httptest.NewRequest(http.MethodGet, "/search?q=pooling", nil)
+	page.AddCookie(visitor)
+	for _, c := range rec.Result().Cookies() {
+		page.AddCookie(c)
+	}
+	serve(http.HandlerFunc(handleSearch), page)
+	if got, _ := recentQueries("visitor:abc"); len(got) != 0 {
+		t.Errorf("history = %q, want nothing recorded after opting out", got)
+	}
+}
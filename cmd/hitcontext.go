@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2/analysis"
+	"golang.org/x/net/html"
+)
+
+const (
+	// defaultContextParagraphs and maxContextParagraphs bound how many
+	// paragraphs come before and after the matching one
+	defaultContextParagraphs = 1
+	maxContextParagraphs     = 10
+)
+
+// HitContext is the body of /api/context/{path}
+type HitContext struct {
+	Path string `json:"path"`
+	// Sentence is the sentence that matches the query best, empty when
+	// none does
+	Sentence string `json:"sentence"`
+	// Paragraphs are the paragraph with the sentence and those around it,
+	// or the first ones of the document when nothing matched
+	Paragraphs []string `json:"paragraphs"`
+	// Match is the index in Paragraphs of the one with the sentence
+	Match int `json:"match"`
+}
+
+// paragraphBlocks are the elements whose text makes one paragraph
+var paragraphBlocks = map[string]bool{
+	"p": true, "li": true, "pre": true, "blockquote": true, "dt": true, "dd": true,
+	"td": true, "th": true, "figcaption": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+var blankLines = regexp.MustCompile(`\n\s*\n`)
+
+// findParagraphs lists the text of a page's paragraphs, headings, list
+// items and code blocks in order, leaving out navigation and page chrome.
+// Pages without such elements, like text files, are split at blank lines.
+func findParagraphs(doc *html.Node) []string {
+	var paragraphs []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && summarySkip[n.Data] {
+			return
+		}
+		if n.Type == html.ElementNode && paragraphBlocks[n.Data] {
+			text := strings.TrimSpace(nodeText(n))
+			if n.Data != "pre" {
+				text = strings.Join(strings.Fields(text), " ")
+			}
+			if text != "" {
+				paragraphs = append(paragraphs, text)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if len(paragraphs) > 0 {
+		return paragraphs
+	}
+
+	body := findElement(doc, "body")
+	if body == nil {
+		return nil
+	}
+	for _, p := range blankLines.Split(nodeText(body), -1) {
+		if p = strings.Join(strings.Fields(p), " "); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	return paragraphs
+}
+
+// sentenceEnd finds the end of a sentence and the space after it
+var sentenceEnd = regexp.MustCompile(`[.!?]+\s+`)
+
+func splitSentences(paragraph string) []string {
+	var sentences []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(paragraph, -1) {
+		sentences = append(sentences, strings.TrimSpace(paragraph[start:loc[1]]))
+		start = loc[1]
+	}
+	if rest := strings.TrimSpace(paragraph[start:]); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	return sentences
+}
+
+// analyzedTerms returns the distinct terms of text as analyzer indexes
+// them, or its lowercased words when there's no analyzer
+func analyzedTerms(analyzer analysis.Analyzer, text string) map[string]bool {
+	terms := make(map[string]bool)
+	if analyzer == nil {
+		for _, w := range strings.Fields(strings.ToLower(text)) {
+			terms[w] = true
+		}
+		return terms
+	}
+	for _, token := range analyzer.Analyze([]byte(text)) {
+		terms[string(token.Term)] = true
+	}
+	return terms
+}
+
+// bestSentence finds the sentence sharing the most terms with the query,
+// the first one on a tie. It returns the paragraph's index and -1 when no
+// sentence shares any.
+func bestSentence(paragraphs []string, analyzer analysis.Analyzer, text string) (int, string) {
+	want := analyzedTerms(analyzer, text)
+	best, bestPara, bestSentence := 0, -1, ""
+	for i, p := range paragraphs {
+		for _, s := range splitSentences(p) {
+			matched := 0
+			for term := range analyzedTerms(analyzer, s) {
+				if want[term] {
+					matched++
+				}
+			}
+			if matched > best {
+				best, bestPara, bestSentence = matched, i, s
+			}
+		}
+	}
+	return bestPara, bestSentence
+}
+
+// hitContext returns the sentence of content best matching text with n
+// paragraphs on either side of it
+func hitContext(content, text string, n int) HitContext {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return HitContext{Paragraphs: []string{}}
+	}
+	paragraphs := findParagraphs(doc)
+	lang := detectLanguage(doc, strings.Join(paragraphs, "\n"))
+	at, sentence := bestSentence(paragraphs, contentAnalyzer(index, lang), text)
+
+	ctx := HitContext{Sentence: sentence, Paragraphs: []string{}}
+	if len(paragraphs) == 0 {
+		return ctx
+	}
+	from, to := 0, min(len(paragraphs), 2*n+1)
+	if at >= 0 {
+		from, to = max(0, at-n), min(len(paragraphs), at+n+1)
+		ctx.Match = at - from
+	}
+	ctx.Paragraphs = paragraphs[from:to]
+	return ctx
+}
+
+// handleHitContext returns the sentence of a document matching a query
+// with the paragraphs around it, for integrations that show more of a hit
+// than its snippet. A section's path can end in its #anchor, escaped as
+// %23; the whole page is searched.
+func handleHitContext(w http.ResponseWriter, r *http.Request) {
+	rel, _, _ := strings.Cut(r.PathValue("path"), "#")
+	path, _, err := documentPath(r, rel)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		writeError(w, r, http.StatusBadRequest, "q is required")
+		return
+	}
+	n := defaultContextParagraphs
+	if s := r.URL.Query().Get("paragraphs"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 || v > maxContextParagraphs {
+			writeError(w, r, http.StatusBadRequest, "paragraphs must be between 0 and "+strconv.Itoa(maxContextParagraphs))
+			return
+		}
+		n = v
+	}
+
+	content, err := readDoc(path)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx := hitContext(string(content), text, n)
+	ctx.Path = tagKey(path)
+	writeJSON(w, http.StatusOK, ctx)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const contextPage = `<html lang="en"><body><nav><p>Home · Guides</p></nav>
+<h1>Rotating keys</h1>
+<p>Keys expire after a year.</p>
+<p>Plan ahead. Rotating the signing keys takes a restart of every node.</p>
+<ul><li>Old keys stay valid for a day.</li></ul>
+<p>Ask the security team when unsure.</p>
+</body></html>`
+
+func TestHitContext(t *testing.T) {
+	withEmptyIndex(t)
+
+	got := hitContext(contextPage, "restart nodes", 1)
+	if got.Sentence != "Rotating the signing keys takes a restart of every node." {
+		t.Errorf("sentence = %q", got.Sentence)
+	}
+	want := []string{"Keys expire after a year.", "Plan ahead. Rotating the signing keys takes a restart of every node.", "Old keys stay valid for a day."}
+	if len(got.Paragraphs) != len(want) || got.Match != 1 {
+		t.Fatalf("context = %+v", got)
+	}
+	for i := range want {
+		if got.Paragraphs[i] != want[i] {
+			t.Errorf("paragraph %d = %q, want %q", i, got.Paragraphs[i], want[i])
+		}
+	}
+
+	if got := hitContext(contextPage, "rotating", 0); got.Sentence != "Rotating keys" || got.Match != 0 || len(got.Paragraphs) != 1 {
+		t.Errorf("context of a heading match = %+v", got)
+	}
+	if got := hitContext(contextPage, "kubernetes", 1); got.Sentence != "" || len(got.Paragraphs) != 3 || got.Paragraphs[0] != "Rotating keys" {
+		t.Errorf("context without a match = %+v, want the first paragraphs", got)
+	}
+	if got := hitContext("First part.\n\nSecond part about disks.\n\nThird.", "disks", 0); len(got.Paragraphs) != 1 || got.Paragraphs[0] != "Second part about disks." {
+		t.Errorf("context of a text file = %+v", got)
+	}
+}
+
+func TestHandleHitContext(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	if err := os.MkdirAll(filepath.Join(dir, "guides"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "guides/keys.html"), []byte(contextPage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/context/{path...}", handleHitContext)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/context/guides/keys.html%23plan?q=restart&paragraphs=0", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var got HitContext
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != "guides/keys.html" || len(got.Paragraphs) != 1 || got.Sentence == "" {
+		t.Errorf("context = %+v", got)
+	}
+
+	for target, status := range map[string]int{
+		"/api/context/guides/keys.html":                   http.StatusBadRequest,
+		"/api/context/guides/keys.html?q=a&paragraphs=99": http.StatusBadRequest,
+		"/api/context/guides/missing.html?q=a":            http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != status {
+			t.Errorf("%s: status = %d, want %d", target, rec.Code, status)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// homeTarget is where / redirects to for config.Home: the path as it is,
+// or the directory of the docset it names. It's empty when / lists the
+// root directory.
+func homeTarget() string {
+	home := config.Home
+	if home == "" || strings.HasPrefix(home, "/") {
+		return home
+	}
+	for _, ds := range config.Docsets {
+		if ds.Name == home {
+			return "/" + strings.Trim(ds.Path, "/") + "/"
+		}
+	}
+	return ""
+}
+
+// validateHome checks that home is a path or a configured docset
+func validateHome(cfg Config) error {
+	if cfg.Home == "" || strings.HasPrefix(cfg.Home, "/") {
+		return nil
+	}
+	for _, ds := range cfg.Docsets {
+		if ds.Name == cfg.Home {
+			return nil
+		}
+	}
+	return fmt.Errorf("home: %q is neither a path starting with / nor a docset", cfg.Home)
+}
+
+// redirectHome sends requests for / to the configured home. It reports
+// whether it redirected.
+func redirectHome(w http.ResponseWriter, r *http.Request) bool {
+	target := homeTarget()
+	if r.URL.Path != "/" || target == "" || target == "/" {
+		return false
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+	return true
+}
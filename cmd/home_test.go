@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedirectHome(t *testing.T) {
+	dir := t.TempDir()
+	withRoot(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		serveFiles(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	withConfig(t, Config{})
+	if rec := get("/"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "readme.txt") {
+		t.Errorf("/ without a home: status = %d, want the root listing", rec.Code)
+	}
+
+	for home, want := range map[string]string{"/search?docset=guides": "/search?docset=guides", "guides": "/docs/guides/"} {
+		cfg := Config{Home: home, Docsets: []DocsetConfig{{Name: "guides", Path: "docs/guides"}}}
+		withConfig(t, cfg)
+		rec := get("/")
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != want {
+			t.Errorf("home %q: status = %d, location = %q, want %q", home, rec.Code, rec.Header().Get("Location"), want)
+		}
+		if rec := get("/readme.txt"); rec.Code != http.StatusOK {
+			t.Errorf("home %q: other paths status = %d", home, rec.Code)
+		}
+	}
+}
+
+func TestHomeConfig(t *testing.T) {
+	for body, ok := range map[string]bool{
+		`{"home": "/search"}`: true,
+		`{"home": "guides", "docsets": [{"name": "guides", "path": "guides"}]}`: true,
+		`{"home": "handbook"}`: false,
+	} {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(path); (err == nil) != ok {
+			t.Errorf("loadConfig(%s) error = %v, want ok = %v", body, err, ok)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+const (
+	// hybridDepth is how many keyword and how many semantic hits are fused
+	hybridDepth = rerankDepth
+	// rrfK damps the lead of the very first ranks in reciprocal rank
+	// fusion; 60 is the usual choice
+	rrfK = 60
+	// defaultSemanticWeight gives keyword and semantic ranks equal say
+	defaultSemanticWeight = 0.5
+)
+
+// searchModes are the values of the mode parameter of /api/search
+var searchModes = []string{"keyword", "hybrid"}
+
+// semanticWeightFromRequest reads the share, between 0 and 1, that semantic
+// ranks get in a hybrid search; the rest goes to keyword ranks
+func semanticWeightFromRequest(r *http.Request) (float64, error) {
+	s := r.URL.Query().Get("semantic_weight")
+	if s == "" {
+		if w := config.Embeddings.HybridWeight; w > 0 {
+			return w, nil
+		}
+		return defaultSemanticWeight, nil
+	}
+	w, err := strconv.ParseFloat(s, 64)
+	if err != nil || w < 0 || w > 1 {
+		return 0, fmt.Errorf("semantic_weight must be between 0 and 1")
+	}
+	return w, nil
+}
+
+// fuseRanks scores every id by weighted reciprocal rank fusion of its
+// rank in keyword and in semantic, best first. Ids missing from one list
+// only get the share of the other.
+func fuseRanks(keyword, semantic []string, weight float64) ([]string, map[string]float64) {
+	scores := make(map[string]float64)
+	var order []string
+	add := func(ids []string, w float64) {
+		for rank, id := range ids {
+			if _, seen := scores[id]; !seen {
+				order = append(order, id)
+			}
+			scores[id] += w / float64(rrfK+rank+1)
+		}
+	}
+	add(keyword, 1-weight)
+	add(semantic, weight)
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	return order, scores
+}
+
+// runHybridSearch is runAPISearch with the keyword hits fused with those
+// closest in meaning to the query. Semantic hits still have to pass the
+// filter, and Total counts the distinct hits of both.
+func runHybridSearch(ctx context.Context, e embedder, query string, fields []string, filter searchFilter, size int, weight float64) (APISearchResponse, error) {
+	resp := APISearchResponse{Query: query, Hits: []APIHit{}}
+	if query == "" {
+		return resp, nil
+	}
+	var loaded []string
+	for _, f := range fields {
+		loaded = append(loaded, storedFields[f])
+	}
+
+	keywordReq := bleve.NewSearchRequestOptions(filter.apply(filter.textQuery(query)), hybridDepth, 0, false)
+	keywordReq.Fields = loaded
+	keywordResult, err := searchRanked(index, keywordReq, query, filter.rankers()...)
+	if err != nil {
+		return resp, err
+	}
+	resp.timing = newSearchTiming(keywordReq, keywordResult)
+	stored := make(map[string]map[string]interface{})
+	found := make(map[string]bool)
+	var keyword []string
+	for _, hit := range keywordResult.Hits {
+		stored[hit.ID], found[hit.ID] = hit.Fields, true
+		keyword = append(keyword, hit.ID)
+	}
+
+	similar, err := semanticSearch(ctx, e, query, filter.Denied, hybridDepth)
+	if err != nil {
+		return resp, err
+	}
+	var candidates []string
+	for _, hit := range similar {
+		id := filepath.Join(root, filepath.FromSlash(hit.Path))
+		if !found[id] {
+			candidates = append(candidates, id)
+		}
+	}
+	// the semantic hits the keyword search didn't find are loaded through
+	// the filter, which drops those it excludes
+	if len(candidates) > 0 {
+		req := bleve.NewSearchRequestOptions(filter.apply(bleve.NewDocIDQuery(candidates)), len(candidates), 0, false)
+		req.Fields = loaded
+		result, err := index.SearchInContext(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		for _, hit := range result.Hits {
+			stored[hit.ID], found[hit.ID] = hit.Fields, true
+		}
+	}
+	var semantic []string
+	for _, hit := range similar {
+		if id := filepath.Join(root, filepath.FromSlash(hit.Path)); found[id] {
+			semantic = append(semantic, id)
+		}
+	}
+
+	order, scores := fuseRanks(keyword, semantic, weight)
+	resp.Total = keywordResult.Total + uint64(len(order)-len(keyword))
+	for _, id := range order {
+		if len(resp.Hits) == size {
+			break
+		}
+		if !hitAllowed(id, filter.Denied) {
+			continue
+		}
+		resp.Hits = append(resp.Hits, toAPIHit(id, scores[id], stored[id], fields))
+	}
+	return resp, nil
+}
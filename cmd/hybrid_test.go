@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFuseRanks(t *testing.T) {
+	order, scores := fuseRanks([]string{"a", "b", "c"}, []string{"c", "d"}, 0.5)
+	if want := []string{"c", "a", "b", "d"}; len(order) != 4 || order[0] != want[0] || order[1] != want[1] || order[3] != want[3] {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if scores["a"] != 0.5/61 {
+		t.Errorf("score of a = %v", scores["a"])
+	}
+	if order, _ := fuseRanks([]string{"a", "b"}, []string{"b", "a"}, 1); order[0] != "b" {
+		t.Errorf("order with all weight on semantic ranks = %v", order)
+	}
+}
+
+func TestHybridSearch(t *testing.T) {
+	var sent int
+	srv := fakeEmbeddings(t, &sent)
+	withConfig(t, Config{Embeddings: EmbeddingsConfig{URL: srv.URL + "/v1", APIKey: "k"}})
+	dir := t.TempDir()
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	withStore(t)
+	t.Cleanup(vectors.reset)
+
+	pages := map[string]string{
+		"keys.html":  `<title>Key rollover</title><p>Replace the secrets and passwords every 90 days.</p>`,
+		"logs.html":  `<title>Log rotation</title><p>How we rotate logs on every node.</p>`,
+		"vault.md":   "Keep every password in the vault.",
+		"disks.html": `<title>Disks</title><p>Add disk storage to a node.</p>`,
+	}
+	var paths []string
+	for rel, content := range pages {
+		path := filepath.Join(dir, rel)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := embedDocuments(context.Background(), currentEmbedder(), paths); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(params string) APISearchResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleAPISearch(rec, httptest.NewRequest("GET", "/api/search?fields=url&q=how+do+we+rotate+credentials&"+params, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", params, rec.Code, rec.Body)
+		}
+		var resp APISearchResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	urls := func(resp APISearchResponse) []interface{} {
+		var got []interface{}
+		for _, h := range resp.Hits {
+			got = append(got, h.Fields["url"])
+		}
+		return got
+	}
+
+	if got := urls(search("")); len(got) != 1 || got[0] != "logs.html" {
+		t.Errorf("keyword hits = %v, want only the log rotation page", got)
+	}
+	got := urls(search("mode=hybrid"))
+	if !containsHit(got, "keys.html") || !containsHit(got, "vault.md") || !containsHit(got, "logs.html") {
+		t.Errorf("hybrid hits = %v, want the pages about credentials and the log rotation page", got)
+	}
+	if got := urls(search("mode=hybrid&semantic_weight=1")); got[0] != "vault.md" {
+		t.Errorf("hits with all weight on semantic ranks = %v, want the vault page first", got)
+	}
+	if got := urls(search("mode=hybrid&type=html")); containsHit(got, "vault.md") {
+		t.Errorf("hybrid hits = %v, include a file type that was filtered out", got)
+	}
+
+	for params, status := range map[string]int{"mode=fuzzy": 400, "mode=hybrid&semantic_weight=2": 400} {
+		rec := httptest.NewRecorder()
+		handleAPISearch(rec, httptest.NewRequest("GET", "/api/search?q=x&"+params, nil))
+		if rec.Code != status {
+			t.Errorf("%s: status = %d, want %d", params, rec.Code, status)
+		}
+	}
+}
+
+func containsHit(urls []interface{}, url string) bool {
+	for _, u := range urls {
+		if u == url {
+			return true
+		}
+	}
+	return false
+}
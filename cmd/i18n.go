@@ -0,0 +1,90 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+const defaultLang = "en"
+
+// catalogs maps a language to its UI messages, keyed by message ID
+var catalogs map[string]map[string]string
+
+func loadCatalogs() error {
+	files, err := localeFS.ReadDir("locales")
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]map[string]string)
+	for _, f := range files {
+		data, err := localeFS.ReadFile("locales/" + f.Name())
+		if err != nil {
+			return err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		loaded[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = messages
+	}
+	catalogs = loaded
+	return nil
+}
+
+// translate looks key up in lang, then in English. Unknown keys are
+// returned as is so a missing translation is visible but harmless.
+func translate(lang, key string, args ...interface{}) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		if msg, ok = catalogs[defaultLang][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// negotiateLanguage picks the UI language: ?lang= when it names a catalog,
+// otherwise the best match from Accept-Language, otherwise English
+func negotiateLanguage(r *http.Request) string {
+	if lang := r.URL.Query().Get("lang"); catalogs[lang] != nil {
+		return lang
+	}
+
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		// only the primary subtag matters, "de-AT" is served German
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if q > 0 && catalogs[primary] != nil {
+			accepted = append(accepted, weighted{primary, q})
+		}
+	}
+	if len(accepted) == 0 {
+		return defaultLang
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+	return accepted[0].lang
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	if err := loadCatalogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url, acceptLanguage, want string
+	}{
+		{"/search", "", "en"},
+		{"/search", "de-AT,de;q=0.9,en;q=0.8", "de"},
+		{"/search", "fr-FR,ja;q=0.5,en;q=0.3", "ja"},
+		{"/search", "de;q=0,en", "en"},
+		{"/search", "xx", "en"},
+		{"/search?lang=ja", "de", "ja"},
+		{"/search?lang=xx", "de", "de"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+		if got := negotiateLanguage(r); got != tt.want {
+			t.Errorf("%s with Accept-Language %q = %q, want %q", tt.url, tt.acceptLanguage, got, tt.want)
+		}
+	}
+}
+
+func TestCatalogsHaveEveryMessage(t *testing.T) {
+	if err := loadCatalogs(); err != nil {
+		t.Fatal(err)
+	}
+	for lang, messages := range catalogs {
+		for key := range catalogs[defaultLang] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("%s catalog is missing %q", lang, key)
+			}
+		}
+	}
+}
+
+func TestErrorPageIsLocalized(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/missing.html", nil)
+	r.Header.Set("Accept-Language", "de")
+	rec := httptest.NewRecorder()
+	renderError(rec, r, http.StatusNotFound)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "existiert nicht") || !strings.Contains(body, `lang="de"`) {
+		t.Errorf("error page is not in German:\n%s", body)
+	}
+}
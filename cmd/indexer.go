@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// indexDocuments builds the index below root and runs everything that
+// follows a build: stamping the docset layout, embedding documents for
+// semantic search, recording new and removed documents for alerts, and
+// firing lifecycle webhooks. It returns the IDs of the indexed documents.
+func indexDocuments(root string) ([]string, error) {
+	start := time.Now()
+	fireWebhooks("index.started", map[string]interface{}{"root": root})
+
+	ids, err := buildStamped(index, root)
+	if err != nil {
+		fireWebhooks("index.failed", map[string]interface{}{
+			"root":  root,
+			"error": err.Error(),
+		})
+		return nil, err
+	}
+
+	perDocset := make(map[string]int)
+	for _, id := range ids {
+		perDocset[docsetFor(id)]++
+	}
+	for name, count := range perDocset {
+		fireWebhooks("docset.ingested", map[string]interface{}{
+			"docset":    name,
+			"documents": count,
+		})
+	}
+	fireWebhooks("index.completed", map[string]interface{}{
+		"root":        root,
+		"documents":   len(ids),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+
+	// the served index is a liveIndex, possibly wrapping a failoverIndex
+	if s, ok := index.(interface{ syncStandby() error }); ok {
+		if err := s.syncStandby(); err != nil {
+			log.Printf("Error syncing standby index: %v", err)
+		}
+	}
+	if config.Archive.Dir != "" {
+		if err := archiveIndex(index, config.Archive, time.Now().UTC()); err != nil {
+			log.Printf("Error archiving index: %v", err)
+		}
+	}
+
+	if e := currentEmbedder(); e != nil {
+		if err := embedDocuments(context.Background(), e, ids); err != nil {
+			log.Printf("Error embedding documents: %v", err)
+		}
+	}
+
+	newIDs, err := recordNewDocuments(ids)
+	if err != nil {
+		log.Printf("Error recording indexed documents: %v", err)
+	}
+	if err := forgetRemovedDocuments(ids); err != nil {
+		log.Printf("Error forgetting removed documents: %v", err)
+	}
+	notifyAlerts(newIDs)
+	return ids, nil
+}
+
+// buildStamped builds the index below root into idx and stamps it with the
+// configuration it was built with and when
+func buildStamped(idx bleve.Index, root string) ([]string, error) {
+	start := time.Now()
+	ids, err := buildIndexInto(idx, root)
+	if err == nil {
+		err = stampDocsets(idx)
+	}
+	if err == nil {
+		err = stampAnalysis(idx)
+	}
+	if err == nil {
+		err = stampSchema(idx, schemaVersion)
+	}
+	if err == nil {
+		err = stampBuild(idx, BuildInfo{Finished: time.Now().UTC(), DurationMS: time.Since(start).Milliseconds()})
+	}
+	return ids, err
+}
+
+// rebuildIndex replaces the index at path with one freshly built from the
+// docs, for a server whose index became unreadable. Only the index is
+// rebuilt; webhooks, alerts and embeddings wait for the next run of the
+// index command.
+func rebuildIndex(path string) error {
+	return rebuildShards(path, indexShards(path))
+}
+
+// rebuildShards is rebuildIndex into an index split into shards
+func rebuildShards(path string, shards int) error {
+	tmp := path + ".rebuild"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	idx, err := newIndex(tmp, shards)
+	if err != nil {
+		return err
+	}
+	if _, err := buildStamped(idx, root); err != nil {
+		idx.Close()
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := idx.Close(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
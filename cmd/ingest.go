@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ingesting is held while the server reindexes its docs or refreshes a
+// source, so two runs never write the index at the same time
+var ingesting sync.Mutex
+
+// IngestResponse reports a reindex of the docs by the running server
+type IngestResponse struct {
+	Documents  int   `json:"documents"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// handleIngest reindexes the docs into the live index, like the index
+// command but without stopping the server. Unchanged files are skipped, and
+// the webhooks, alerts and embeddings of a build follow as usual. Searches
+// keep being served while it runs.
+func handleIngest(w http.ResponseWriter, r *http.Request) {
+	if !ingesting.TryLock() {
+		writeError(w, r, http.StatusConflict, "the docs are already being indexed")
+		return
+	}
+	defer ingesting.Unlock()
+
+	start := time.Now()
+	ids, err := indexDocuments(root)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, IngestResponse{Documents: len(ids), DurationMS: time.Since(start).Milliseconds()})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestIngestArchivesAndSyncsLiveIndex(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{
+		Archive:          ArchiveConfig{Dir: filepath.Join(dir, "archive")},
+		StandbyIndexPath: filepath.Join(dir, "standby.bleve"),
+	})
+	withStore(t)
+	withDocFiles(t, map[string]string{"guides/pool.html": "Pooling", "guides/shard.html": "Sharding"})
+
+	path := filepath.Join(dir, "index.bleve")
+	idx, err := bleve.New(path, newIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := withStandby(idx, config.StandbyIndexPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLiveIndex(f, path, false)
+	defer l.Close()
+	old := index
+	index = l
+	t.Cleanup(func() { index = old })
+
+	rec := serve(http.HandlerFunc(handleIngest), httptest.NewRequest(http.MethodPost, "/api/admin/ingest", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest = %d %s", rec.Code, rec.Body.String())
+	}
+
+	snapshots, err := archiveSnapshots(config.Archive.Dir)
+	if err != nil || len(snapshots) != 1 {
+		t.Errorf("snapshots = %q, %v, want one", snapshots, err)
+	}
+	f.mu.Lock()
+	standby := f.standby
+	f.mu.Unlock()
+	res, err := standby.Search(bleve.NewSearchRequest(bleve.NewMatchQuery("sharding")))
+	if err != nil || res.Total != 1 {
+		t.Errorf("standby search = %v, %v, want the ingested page", res, err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/lang/de"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"golang.org/x/net/html"
+)
+
+// languageAnalyzers are the languages documents are detected as and the
+// analyzer of their text. Chinese, Japanese and Korean have no spaces
+// between words, so they are indexed as overlapping character pairs.
+var languageAnalyzers = map[string]string{
+	"en": en.AnalyzerName,
+	"de": de.AnalyzerName,
+	"ja": cjk.AnalyzerName,
+	"zh": cjk.AnalyzerName,
+	"ko": cjk.AnalyzerName,
+}
+
+// languages are the keys of languageAnalyzers in a fixed order
+var languages = []string{"en", "de", "ja", "zh", "ko"}
+
+// Type picks the document mapping of d's language, see newIndexMapping.
+// Documents of no detected language get the default mapping.
+func (d Document) Type() string {
+	return d.Language
+}
+
+// germanWords and englishWords are frequent words that tell the two apart
+var (
+	germanWords  = wordSet("der die das und ist nicht mit den von zu ein eine auf für sich des dem werden wird oder auch kann sie es im")
+	englishWords = wordSet("the and is are of to in that for with this it be on as by or can you not from an")
+)
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// minLanguageWords is how many frequent words a text needs before it is
+// taken to be German or English
+const minLanguageWords = 3
+
+// detectLanguage returns the language of a page: the lang attribute of
+// its <html> element when that is a language in languageAnalyzers, or
+// else a guess from the text. It returns "" when neither tells.
+func detectLanguage(doc *html.Node, text string) string {
+	if doc != nil {
+		if root := findElement(doc, "html"); root != nil {
+			declared := strings.ToLower(attr(root, "lang"))
+			declared, _, _ = strings.Cut(strings.ReplaceAll(declared, "_", "-"), "-")
+			if _, ok := languageAnalyzers[declared]; ok {
+				return declared
+			}
+		}
+	}
+	return guessLanguage(text)
+}
+
+// guessLanguage tells CJK languages apart by their scripts and German
+// from English by their most frequent words
+func guessLanguage(text string) string {
+	var letters, kana, hangul, han int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if cjkChars := kana + hangul + han; letters > 0 && cjkChars*5 >= letters {
+		switch {
+		case kana > 0:
+			return "ja"
+		case hangul > 0:
+			return "ko"
+		default:
+			return "zh"
+		}
+	}
+
+	var german, english int
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if germanWords[w] {
+			german++
+		}
+		if englishWords[w] {
+			english++
+		}
+	}
+	switch {
+	case german >= minLanguageWords && german > english:
+		return "de"
+	case english >= minLanguageWords && english >= german:
+		return "en"
+	}
+	return ""
+}
+
+// findElement returns the first element named name below n
+func findElement(n *html.Node, name string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == name {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// matchInLanguages is match once per language, each analyzed like the
+// documents of that language and limited to them, plus once with the
+// default analyzer for documents of no detected language. Every document
+// is scored by one clause only.
+func matchInLanguages(match func(analyzer string) query.Query) query.Query {
+	clauses := make([]query.Query, 0, len(languages)+1)
+	unknown := bleve.NewBooleanQuery()
+	unknown.AddMust(match(defaultTextAnalyzer()))
+	for _, lang := range languages {
+		clauses = append(clauses, bleve.NewConjunctionQuery(match(languageAnalyzers[lang]), inLanguage(lang)))
+		unknown.AddMustNot(inLanguage(lang))
+	}
+	return bleve.NewDisjunctionQuery(append(clauses, unknown)...)
+}
+
+// inLanguage matches the documents of lang without adding to their score,
+// which would favour the languages with fewer documents
+func inLanguage(lang string) query.Query {
+	tq := bleve.NewTermQuery(lang)
+	tq.SetField("Language")
+	tq.SetBoost(0)
+	return tq
+}
+
+// contentAnalyzer is the analyzer the content of documents in lang was
+// indexed with, nil when the index doesn't know it
+func contentAnalyzer(idx bleve.Index, lang string) analysis.Analyzer {
+	name := defaultTextAnalyzer()
+	if a, ok := languageAnalyzers[lang]; ok {
+		name = a
+	}
+	return idx.Mapping().AnalyzerNamed(fieldAnalyzer("Content", name))
+}
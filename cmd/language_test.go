@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		page string
+		want string
+	}{
+		{`<html lang="de-AT"><p>Short.</p></html>`, "de"},
+		{`<html lang="fr"><p>The pool is shared by all of the clients and it can grow.</p></html>`, "en"},
+		{`<p>Die Verbindungen werden für jeden Client wiederverwendet und sind nicht begrenzt.</p>`, "de"},
+		{`<p>The connections are reused for each client and the pool is not limited.</p>`, "en"},
+		{`<p>接続プールはクライアントごとに共有されます。</p>`, "ja"},
+		{`<p>连接池由所有客户端共享。</p>`, "zh"},
+		{`<p>연결 풀은 공유됩니다.</p>`, "ko"},
+		{`<p>ctx, cancel := context.WithTimeout(ctx, d)</p>`, ""},
+	}
+	for _, tt := range tests {
+		if got := extractPage(tt.page).Language; got != tt.want {
+			t.Errorf("%s: language = %q, want %q", tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestSearchAcrossLanguages(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	pages := map[string]string{
+		"de.html":      `<html lang="de"><title>Verbindungen</title><p>Die Verbindungen werden wiederverwendet.</p></html>`,
+		"en.html":      `<html lang="en"><title>Connections</title><p>Connections are reused by the pool.</p></html>`,
+		"ja.html":      `<html lang="ja"><title>接続</title><p>接続プールの設定を変更します。</p></html>`,
+		"unknown.html": `<title>pool</title><p>pool_size = 10</p>`,
+	}
+	for name, html := range pages {
+		page := extractPage(html)
+		doc := Document{Title: page.Title, Content: page.Content, URL: filepath.Join(root, name), Language: page.Language}
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// stemmed like the documents of each language
+		{"Verbindung", []string{"de.html"}},
+		{"connection", []string{"en.html"}},
+		// a pair of characters from the middle of the text
+		{"プール", []string{"ja.html"}},
+		{"pool", []string{"en.html", "unknown.html"}},
+	}
+	for _, tt := range tests {
+		results, err := performSearch(tt.query, searchFilter{}, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.URL)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: results = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func mailEnabled() bool {
+	return config.SMTP.Host != "" && config.SMTP.From != ""
+}
+
+// sendMail sends a plain text message through the configured SMTP server
+func sendMail(to []string, subject, body string) error {
+	if !mailEnabled() {
+		return errors.New("smtp is not configured")
+	}
+
+	port := config.SMTP.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(config.SMTP.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if config.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", config.SMTP.Username, config.SMTP.Password, config.SMTP.Host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", config.SMTP.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.NewReplacer("\r", "", "\n", "").Replace(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(addr, auth, config.SMTP.From, to, []byte(msg.String()))
+}
+
+// absoluteURL turns a path relative to the docs root into a link using the
+// configured base URL
+func absoluteURL(rel string) string {
+	base := config.BaseURL
+	if base == "" {
+		base = "http://localhost:3030"
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(filepath.ToSlash(rel), "/")
+}
@@ -1,112 +1,95 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/blevesearch/bleve/v2"
-	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/search"
 	"golang.org/x/net/html"
 )
 
 // Document is
 type Document struct {
-	Title   string
-	Content string
-	URL     string
+	Title      string
+	Content    string
+	URL        string
+	Docset     string
+	ModifiedAt time.Time
+	// Headings is the text of h1-h6, indexed again for a relevance boost
+	Headings string
+	// Symbol is the class a Javadoc or Doxygen page documents and Members
+	// the names of its methods and fields, indexed again like the headings
+	Symbol  string
+	Members string
+	// CodeBlocks is the text of <pre> and <code>, searched with code:
+	CodeBlocks string
+	// Kind is empty for pages, kindExample for code examples and
+	// kindSection for the sections below a page's headings
+	Kind string
+	// Deprecated is set for pages with a "Deprecated:" marker or banner
+	Deprecated bool
+	// DocType is the file type, see docType
+	DocType string
+	// Size is the size of the file in bytes
+	Size int64
+	// Version is the version of the docset, empty for unversioned docs
+	Version string
+	// Tags are the labels users gave the document, see tags.go, and
+	// those of its front matter
+	Tags []string
+	// Authors and Date are those of the front matter, see frontmatter.go
+	Authors []string
+	Date    time.Time
+	// Trust is the trust level, see trust.go, empty when unset
+	Trust string
+	// Language is the detected language, see language.go, empty when
+	// unknown. It picks the analyzer of the title and content.
+	Language string
+	// Notes is the text of the shared notes on the document, see notes.go
+	Notes string
+	// Description and Summary, the first substantive paragraph, are stored
+	// for snippets only
+	Description string
+	Summary     string
+	// TOC is the page's table of contents as JSON, see toc.go. It's stored
+	// only, and shown in the result's side panel.
+	TOC string
+	// Checksum identifies the content of the file, see checksum.go. It's
+	// stored only.
+	Checksum string
+	// BuildKey identifies what the page's documents were built from, see
+	// buildKey. It's stored only, with the page.
+	BuildKey string
+	// Revision is the revision of the source the document was fetched at,
+	// like a git commit, see sources.go. It's stored only.
+	Revision string
+	// Snippet is the summary shown in search results, it isn't indexed
+	Snippet template.HTML `json:"-"`
+	// Score and Explanation are the final score of a result and how bleve
+	// came to its score before reranking, shown with ?explain=1
+	Score       float64             `json:"-"`
+	Explanation *search.Explanation `json:"-"`
 }
 
+const kindExample = "example"
+
 // List of allowed file extensions
-var allowedExtensions = []string{".html", ".htm", ".txt", ".md"}
+var allowedExtensions = []string{".html", ".htm", ".xhtml", ".txt", ".md", ".markdown"}
 
 var index bleve.Index
 
 var root string
 
-func main() {
-	var err error
-
-	// current working directory where the binary is run
-	currentDir, err := os.Getwd()
-	if err != nil {
-		log.Fatalf("Error getting current working directory: %v", err)
-	}
-
-	path := flag.String("path", currentDir, "Path to the directory")
-	refresh := flag.Bool("refresh", false, "refresh/rebuild the index")
-	extensions := flag.String("extensions", "", "Comma-separated list of file extensions to include")
-
-	flag.Parse()
-
-	root = *path
-	if *extensions != "" {
-		allowedExtensions = strings.Split(*extensions, ",")
-		for i, ext := range allowedExtensions {
-			allowedExtensions[i] = strings.TrimSpace(ext)
-			if !strings.HasPrefix(allowedExtensions[i], ".") {
-				allowedExtensions[i] = "." + allowedExtensions[i]
-			}
-		}
-	}
-
-	fmt.Println("Using path:", *path)
-	fmt.Println("Rebuild the index ? :", *refresh)
-	fmt.Println("Allowed extensions:", allowedExtensions)
-
-	indexPath := "index.bleve"
-	if *refresh {
-
-		log.Println(err)
-		if _, err := os.Stat(indexPath); err == nil {
-
-			err = os.RemoveAll(indexPath)
-			if err != nil {
-				log.Fatalf("Error deleting existing index: %v", err)
-			}
-		} else if !os.IsNotExist(err) {
-			log.Fatalf("Error checking index path: %v", err)
-		}
-
-	}
-
-	index, err = bleve.Open(indexPath)
-	if err == bleve.ErrorIndexPathDoesNotExist {
-
-		indexMapping := bleve.NewIndexMapping()
-		documentMapping := bleve.NewDocumentMapping()
-
-		textFieldMapping := bleve.NewTextFieldMapping()
-		textFieldMapping.Analyzer = standard.Name
-
-		documentMapping.AddFieldMappingsAt("Title", textFieldMapping)
-		documentMapping.AddFieldMappingsAt("Content", textFieldMapping)
-		documentMapping.AddFieldMappingsAt("URL", textFieldMapping)
-
-		indexMapping.AddDocumentMapping("document", documentMapping)
-
-		index, err = bleve.New("index.bleve", indexMapping)
-		if err != nil {
-			log.Fatal(err)
-		}
-		buildIndex(root)
-	} else if err != nil {
-		log.Fatal(err)
-	}
-	defer index.Close()
-
-	http.HandleFunc("/", serveFiles)
-	http.HandleFunc("/search", handleSearch)
-
-	fmt.Println("Server running at http://localhost:3030/search")
-	log.Fatal(http.ListenAndServe(":3030", nil))
-}
-
 func hasAllowedExtension(filename string, extensions []string) bool {
 	for _, ext := range extensions {
 		if strings.HasSuffix(filename, ext) {
@@ -116,65 +99,233 @@ func hasAllowedExtension(filename string, extensions []string) bool {
 	return false
 }
 
-func buildIndex(root string) {
-	batch := index.NewBatch()
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+// buildIndex indexes every allowed file below root and returns the IDs of
+// the indexed documents
+func buildIndex(root string) ([]string, error) {
+	return buildIndexInto(index, root)
+}
+
+// buildIndexInto is buildIndex for an index other than the global one. Files
+// idx already holds as they are now are skipped, and the documents of files
+// that are gone are deleted, so it also updates an index built before.
+func buildIndexInto(idx bleve.Index, root string) ([]string, error) {
+	var ids []string
+	batch := newBatcher(idx)
+	kept := make(map[string]bool)
+	indexed := make(map[string]bool)
+	settings := extractionSettings()
+	notes := sharedNoteTexts()
+	add := func(path string, info os.FileInfo, content []byte) error {
+		key := buildKey(content, info, settings)
+		if indexedBuildKey(idx, path) == key {
+			ids = append(ids, path)
+			kept[path] = true
+			return nil
+		}
+		docs := documentsOf(path, info, content, notes)
+		if len(docs) == 0 {
+			return nil
+		}
+		docs[0].BuildKey = key
+		ids = append(ids, path)
+		for _, doc := range docs {
+			if err := batch.Index(doc.URL, doc); err != nil {
+				return err
+			}
+			indexed[doc.URL] = true
+		}
+		return nil
+	}
+	err := walkTree(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		// the metadata of git sources
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
 
-		if !info.IsDir() && hasAllowedExtension(info.Name(), allowedExtensions) {
-			// if !info.IsDir() && strings.HasSuffix(info.Name(), ".html") {
+		if !info.IsDir() && isDocumentName(info.Name()) {
 			content, err := os.ReadFile(path)
 			if err != nil {
 				return err
 			}
-
-			title, bodyContent := extractTitleAndContent(string(content))
-			if title == "" {
-				title = info.Name()
-			}
-
-			doc := Document{
-				Title:   title,
-				Content: bodyContent,
-				URL:     path,
-			}
-
-			err = batch.Index(path, doc)
+			return add(path, info, content)
+		}
+		if !info.IsDir() && config.Index.Bundles && isBundle(info.Name()) {
+			err := eachBundleFile(path, func(name string, info fs.FileInfo, r io.Reader) error {
+				if !isDocumentName(name) {
+					return nil
+				}
+				content, err := readBundleFile(r)
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				return add(path+bundleSeparator+name, info, content)
+			})
 			if err != nil {
-				return err
+				log.Printf("Skipping the rest of the bundle %s: %v", path, err)
 			}
 		}
 		return nil
 	})
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	err = index.Batch(batch)
+	if err := batch.Flush(); err != nil {
+		return nil, err
+	}
+	removed, err := deleteStale(idx, root, kept, indexed)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if removed > 0 {
+		log.Printf("Removed %d documents of deleted or changed files", removed)
 	}
+	return ids, nil
 }
 
-func extractTitleAndContent(content string) (string, string) {
+// documentsFor reads the file at path and returns its document followed by
+// one document per code example and one per linkable section of the page,
+// with the text of its notes from notes
+func documentsFor(path string, info os.FileInfo, notes noteTexts) ([]Document, error) {
+	content, err := readDoc(path)
+	if err != nil {
+		return nil, err
+	}
+	return documentsOf(path, info, content, notes), nil
+}
+
+// documentsOf is documentsFor for a file already read. The extractor is
+// picked by the type of the file, see fileType; files that aren't documents
+// and navigation pages have none.
+func documentsOf(path string, info os.FileInfo, content []byte, notes noteTexts) []Document {
+	typ := fileType(path, content)
+	extract := extractors[typ]
+	if extract == nil {
+		return nil
+	}
+	fm, body, err := splitFrontMatter(string(content))
+	if err != nil {
+		log.Printf("Ignoring the front matter of %s: %v", path, err)
+	}
+	page := extract(body)
+	if page.Navigation {
+		return nil
+	}
+	if fm.Title != "" {
+		page.Title = fm.Title
+	}
+	if page.Title == "" {
+		page.Title = info.Name()
+	}
+
+	doc := Document{
+		Title:       page.Title,
+		Content:     page.Content,
+		URL:         path,
+		Docset:      docsetFor(path),
+		ModifiedAt:  info.ModTime().UTC(),
+		Headings:    page.Headings,
+		Symbol:      page.Symbol,
+		Members:     strings.Join(page.Members, " "),
+		CodeBlocks:  page.CodeBlocks,
+		Description: page.Description,
+		Summary:     page.Summary,
+		TOC:         encodeTOC(page.TOC),
+		Language:    page.Language,
+		Deprecated:  page.Deprecated,
+		DocType:     docTypeOf(path, typ),
+		Size:        info.Size(),
+		Version:     versionFor(path),
+		Tags:        parseTags(append(tagsFor(path), fm.Tags...)...),
+		Authors:     fm.Authors,
+		Date:        fm.Date,
+		Trust:       trustFor(path),
+		Notes:       notes[tagKey(path)],
+		Checksum:    contentChecksum(content),
+		Revision:    revisionFor(path),
+	}
+	docs := append([]Document{doc}, exampleDocuments(doc, page.Examples)...)
+	taken := make(map[string]bool)
+	for _, d := range docs[1:] {
+		_, anchor, _ := strings.Cut(d.URL, "#")
+		taken[anchor] = true
+	}
+	docs = append(docs, sectionDocuments(doc, page.Sections, taken)...)
+	for i := range docs[1:] {
+		docs[i+1].Checksum = checksumFor(docs[i+1].URL, doc.Checksum)
+		docs[i+1].Revision = doc.Revision
+	}
+	return docs
+}
+
+// pageText is the text pulled out of a page for indexing
+type pageText struct {
+	Title       string
+	Content     string
+	Headings    string
+	CodeBlocks  string
+	Description string
+	Summary     string
+	Examples    []example
+	Sections    []pageSection
+	TOC         []tocEntry
+	Language    string
+	Deprecated  bool
+	// Symbol and Members are the class a Javadoc or Doxygen page documents
+	// and the names of its members, see apidocs.go
+	Symbol  string
+	Members []string
+	// Navigation is set for pages of those sites that are only
+	// navigation, which aren't indexed
+	Navigation bool
+}
+
+// extractPage reads an HTML page. Javadoc and Doxygen pages lose their
+// navigation first and have their class and member names picked out.
+func extractPage(content string) pageText {
 	doc, err := html.Parse(strings.NewReader(content))
 	if err != nil {
-		return "", ""
+		return pageText{}
 	}
 
-	var title string
-	var bodyContent strings.Builder
+	var page pageText
+	site, api := apiSites[detectSite(doc)]
+	if api {
+		if site.navigation(doc) {
+			return pageText{Navigation: true}
+		}
+		removeNodes(doc, site.chrome)
+		page.Symbol, page.Members = site.symbols(doc)
+	}
+	var bodyContent, headings strings.Builder
+	var codeBlocks []string
 
 	var extract func(*html.Node)
 	extract = func(n *html.Node) {
+		if isDeprecationMarker(n) {
+			page.Deprecated = true
+		}
 		if n.Type == html.ElementNode {
-			if n.Data == "title" && n.FirstChild != nil {
-				title = n.FirstChild.Data
-			} else if n.Data == "body" {
-				extractText(n, &bodyContent)
+			switch {
+			case n.Data == "title" && n.FirstChild != nil:
+				page.Title = n.FirstChild.Data
+			case n.Data == "meta" && page.Description == "":
+				if name := strings.ToLower(attr(n, "name")); name == "description" || attr(n, "property") == "og:description" {
+					page.Description = strings.TrimSpace(attr(n, "content"))
+				}
+			case n.Data == "body":
+				appendText(n, &bodyContent)
+			}
+			if len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6' {
+				appendText(n, &headings)
+			}
+			// inline <code> inside a <pre> is part of that block already
+			if n.Data == "pre" || (n.Data == "code" && !hasAncestor(n, "pre")) {
+				codeBlocks = append(codeBlocks, nodeText(n))
 			}
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
@@ -183,118 +334,328 @@ func extractTitleAndContent(content string) (string, string) {
 	}
 
 	extract(doc)
-	return title, bodyContent.String()
+	page.Content = bodyContent.String()
+	page.Headings = headings.String()
+	page.CodeBlocks = strings.Join(codeBlocks, "\n")
+	page.Summary = findSummary(doc)
+	page.Examples = findExamples(doc, content)
+	page.Sections = findSections(doc)
+	page.TOC = findTOC(doc)
+	page.Language = detectLanguage(doc, page.Content)
+	return page
+}
+
+// deprecatedLine matches the godoc convention of a paragraph starting with
+// "Deprecated:"
+var deprecatedLine = regexp.MustCompile(`(?m)^\s*Deprecated:`)
+
+// isDeprecationMarker reports whether n is a "Deprecated:" paragraph or a
+// deprecation banner, i.e. an element with a class like "deprecated" or
+// "deprecation-notice"
+func isDeprecationMarker(n *html.Node) bool {
+	switch n.Type {
+	case html.TextNode:
+		return deprecatedLine.MatchString(n.Data)
+	case html.ElementNode:
+		for _, class := range strings.Fields(strings.ToLower(attr(n, "class"))) {
+			if strings.HasPrefix(class, "deprecat") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func extractText(n *html.Node, sb *strings.Builder) {
+// summarySkip are elements whose paragraphs are boilerplate, not content
+var summarySkip = map[string]bool{"nav": true, "header": true, "footer": true, "aside": true, "script": true, "style": true}
+
+// findSummary returns the first paragraph with at least eight words outside
+// navigation and page chrome, or failing that the first non-empty one
+func findSummary(doc *html.Node) string {
+	var first string
+	var found string
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if found != "" || (n.Type == html.ElementNode && summarySkip[n.Data]) {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "p" {
+			var sb strings.Builder
+			appendText(n, &sb)
+			words := strings.Fields(sb.String())
+			if len(words) >= 8 {
+				found = strings.Join(words, " ")
+			} else if first == "" && len(words) > 0 {
+				first = strings.Join(words, " ")
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	walk(doc)
+	if found != "" {
+		return found
+	}
+	return first
+}
+
+func appendText(n *html.Node, sb *strings.Builder) {
 	if n.Type == html.TextNode {
 		sb.WriteString(n.Data)
 		sb.WriteString(" ")
 	}
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		extractText(c, sb)
+		appendText(c, sb)
+	}
+}
+
+// nodeText concatenates the text below n as is, keeping code intact when a
+// highlighter split it into spans
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
 	}
+	return sb.String()
+}
+
+func hasAncestor(n *html.Node, tag string) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
 }
 
 func serveFiles(w http.ResponseWriter, r *http.Request) {
+	if redirectHome(w, r) {
+		return
+	}
 	filePath := filepath.Join(root, r.URL.Path)
+	if !canAccessPath(r.Context(), filePath) {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	if redirectToPinnedVersion(w, r, filePath) {
+		return
+	}
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		if serveBundleFile(w, r, filePath) {
+			return
+		}
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	if err == nil && !info.IsDir() {
+		setCacheHeaders(w, info)
+		if rewritesDocuments() && serveWithTOC(w, r, filePath, info) {
+			return
+		}
+	}
 	http.ServeFile(w, r, filePath)
 }
 
+// searchView is the data of the search page and its live results
+type searchView struct {
+	Page
+	Query    string
+	Results  []Document
+	Groups   []resultGroup
+	Types    []typeOption
+	Versions []string
+	// Next brings the version selector back to this search. It leaves out
+	// the view settings of a permalink, which would override the new choice.
+	Next string
+	// Updated is the selected updated=, one of UpdatedRanges or empty
+	Updated       string
+	UpdatedRanges []string
+	// Params are the search parameters, for saving the search
+	Params string
+	Saved  []SavedSearch
+	// Recent are the last queries, newest first
+	Recent []string
+	// Bookmarked are the result URLs on the visitor's reading list
+	Bookmarked map[string]bool
+	// Tags are the tags filtered by
+	Tags []tagFilter
+	// CodeOnly is set when the query only matches code blocks
+	CodeOnly bool
+	// Docsets and Languages are the docset and language filters, with the
+	// user's defaults applied
+	Docsets, Languages []filterOption
+	// TrustLevels are the trust level choices of the filter
+	TrustLevels []filterOption
+	// Admin shows the trust level form under results
+	Admin bool
+	// PageNum is the page of results shown, from 1; PrevPage and NextPage
+	// link to its neighbours and are empty at either end
+	PageNum            int
+	PrevPage, NextPage string
+	// Permalink reproduces this exact view, ShortLink is its short form
+	// once one was made
+	Permalink, ShortLink string
+	// Analytics makes result links report when they're opened
+	Analytics bool
+	// Explain shows how each result was scored, for admins who asked
+	// with explain=1
+	Explain bool
+	// timing is for the slow-query log
+	timing searchTiming
+}
+
 func handleSearch(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	results, err := performSearch(query)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	start := time.Now()
+	data, ok := runPageSearch(w, r)
+	if !ok {
 		return
 	}
-
-	tmpl := template.New("search")
-
-	tmpl.Funcs(template.FuncMap{
-		"truncate": func(s string, l int) string {
-			if len(s) > l {
-				return s[:l] + "..."
+	if data.Query != "" && data.Prefs.History == "on" && store != nil {
+		if err := recordQuery(ensureVisitorKey(w, r), data.Query); err != nil {
+			log.Printf("Error recording search history: %v", err)
+		}
+	}
+	// later pages would count the same search again
+	if data.Query != "" && data.Analytics && data.PageNum == 1 {
+		recordSearchAnalytics(data.Query, len(data.Results))
+	}
+	if owner, ok := visitorKey(r); ok {
+		saved, err := savedSearchesOf(owner)
+		if err != nil {
+			log.Printf("Error loading saved searches: %v", err)
+		}
+		data.Saved = saved
+		if data.Prefs.History == "on" {
+			if data.Recent, err = recentQueries(owner); err != nil {
+				log.Printf("Error loading search history: %v", err)
 			}
-			return s
-		},
-	})
-
-	tmpl, err = tmpl.Parse(`
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Go Doc Server :: Search</title>
-</head>
-<body>
-    <div class="row">
-        <form action="/search" method="GET">
-            <input type="search" id="search_textbox" name="q" value="{{.Query}}">
-            <button type="submit">Search</button>
-        </form>
-    </div>
-    <ul>
-        {{range .Results}}
-        <li>
-            <h3><a href="/{{.URL}}">{{.Title}}</a></h3>
-            <p>{{truncate .Content 150}}</p>
-
-        </li>
-        {{end}}
-    </ul>
-    <style>
-        .row {
-            padding: 1%;
-        }
-    </style>
-</body>
-</html>
-`)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		}
 	}
+	rendering := time.Now()
+	renderTemplate(w, "search.html", data)
+	logSlowSearch(r, data.Query, data.timing, start, time.Since(rendering))
+}
 
-	data := struct {
-		Query   string
-		Results []Document
-	}{
-		Query:   query,
-		Results: results,
+// handleLiveSearch renders only the results of the search page, which the
+// search box fetches while the user types
+func handleLiveSearch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if data, ok := runPageSearch(w, r); ok {
+		rendering := time.Now()
+		renderTemplate(w, "results", data)
+		logSlowSearch(r, data.Query, data.timing, start, time.Since(rendering))
 	}
+}
 
-	err = tmpl.Execute(w, data)
+// runPageSearch searches for the q parameter with the caller's preferences.
+// It renders an error page and returns false when the search fails.
+func runPageSearch(w http.ResponseWriter, r *http.Request) (searchView, bool) {
+	r = withSearchDefaults(r)
+	query := r.URL.Query().Get("q")
+	filter, err := filterFromRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		renderError(w, r, http.StatusBadRequest)
+		return searchView{}, false
 	}
-}
-
-func handleCLISearch(query string) {
-	results, err := performSearch(query)
+	pageNum, err := pageFromRequest(r)
 	if err != nil {
-		log.Fatalf("Error performing search: %v", err)
+		renderError(w, r, http.StatusBadRequest)
+		return searchView{}, false
 	}
-
-	for _, result := range results {
-		fmt.Printf("Title: %s\nContent: %s\nURL: %s\n\n", result.Title, result.Content, result.URL)
+	page := newPage(r, "search.title")
+	// explanations tell a lot about the index, so only admins get them
+	explain := r.URL.Query().Get("explain") == "1" && isAdmin(r.Context())
+	results, timing, err := performTimedSearch(query, filter, (pageNum-1)*page.Prefs.PerPage, page.Prefs.PerPage, page.Prefs.sortBy(), explain)
+	if err != nil {
+		log.Printf("Error searching for %q: %v", query, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return searchView{}, false
+	}
+	view := searchView{Page: page, Query: query, Results: results, Groups: groupBySection(results), Types: typeOptions(filter.Types), Versions: versions(), Next: "/search?" + withoutViewParams(r.URL.Query()),
+		Updated: r.URL.Query().Get("updated"), UpdatedRanges: updatedRanges, Params: searchParams(r.URL.Query()), Bookmarked: bookmarkedOf(r),
+		Tags: tagFilters(r.URL.Query()), CodeOnly: filter.CodeOnly, Docsets: docsetOptions(r, filter.Docsets), Languages: languageOptions(filter.Language),
+		TrustLevels: trustOptions(filter.Trust), Admin: isAdmin(r.Context()), PageNum: pageNum, Analytics: analyticsEnabled(), Explain: explain, timing: timing}
+	if query != "" {
+		view.Permalink = "/search?" + permalinkParams(r.URL.Query(), page.Prefs, pageNum)
+		view.ShortLink = shortLinkFor(r.URL.Query().Get("short"), view.Permalink)
+		if pageNum > 1 {
+			view.PrevPage = "/search?" + permalinkParams(r.URL.Query(), page.Prefs, pageNum-1)
+		}
+		// a full page suggests there are more; a short one is the last
+		if len(results) == page.Prefs.PerPage && pageNum < maxPage {
+			view.NextPage = "/search?" + permalinkParams(r.URL.Query(), page.Prefs, pageNum+1)
+		}
+		if explain {
+			for _, link := range []*string{&view.PrevPage, &view.NextPage} {
+				if *link != "" {
+					*link += "&explain=1"
+				}
+			}
+		}
 	}
+	return view, true
+}
+
+// performSearch returns up to size matching documents that pass filter.
+// sortBy takes bleve sort keys; nil sorts by relevance.
+func performSearch(query string, filter searchFilter, size int, sortBy []string) ([]Document, error) {
+	return performSearchPage(query, filter, 0, size, sortBy)
 }
 
-func performSearch(query string) ([]Document, error) {
+// performSearchPage is performSearch skipping the first from hits
+func performSearchPage(query string, filter searchFilter, from, size int, sortBy []string) ([]Document, error) {
+	results, _, err := performTimedSearch(query, filter, from, size, sortBy, false)
+	return results, err
+}
+
+// performTimedSearch is performSearchPage that also tells how the search
+// went, for the slow-query log. With explain, the results carry their
+// score and its explanation.
+func performTimedSearch(query string, filter searchFilter, from, size int, sortBy []string, explain bool) ([]Document, searchTiming, error) {
 	var results []Document
+	var timing searchTiming
 
 	if query != "" {
-		searchQuery := bleve.NewMatchQuery(query)
-		searchRequest := bleve.NewSearchRequest(searchQuery)
-		searchRequest.Fields = []string{"Title", "Content", "URL"}
+		searchQuery := filter.apply(filter.textQuery(query))
+		searchRequest := bleve.NewSearchRequestOptions(searchQuery, size, from, explain)
+		if len(sortBy) > 0 {
+			searchRequest.SortBy(sortBy)
+		}
+		searchRequest.Fields = []string{"Title", "Content", "URL", "Docset", "Description", "Summary", "Kind", "CodeBlocks", "Deprecated", "Tags", "Trust", "DocType", "Size", "Revision", "Authors", "Date"}
 		searchRequest.Highlight = bleve.NewHighlight()
-		searchResult, err := index.Search(searchRequest)
+		var searchResult *bleve.SearchResult
+		var err error
+		if len(sortBy) == 0 {
+			searchResult, err = searchRanked(index, searchRequest, query, filter.rankers()...)
+		} else {
+			searchResult, err = index.Search(searchRequest)
+		}
 		if err != nil {
-			return nil, err
+			return nil, timing, err
 		}
+		timing = newSearchTiming(searchRequest, searchResult)
 
 		for _, hit := range searchResult.Hits {
+			if !hitAllowed(hit.ID, filter.Denied) {
+				continue
+			}
 			relativeURL, err := filepath.Rel(root, hit.Fields["URL"].(string))
 			if err != nil {
 				log.Printf("Error creating relative URL: %v", err)
@@ -305,9 +666,29 @@ func performSearch(query string) ([]Document, error) {
 				Content: hit.Fields["Content"].(string),
 				URL:     relativeURL,
 			}
+			doc.Docset, _ = hit.Fields["Docset"].(string)
+			doc.Deprecated, _ = hit.Fields["Deprecated"].(bool)
+			doc.Tags = storedTags(hit.Fields["Tags"])
+			doc.Trust, _ = hit.Fields["Trust"].(string)
+			doc.DocType, _ = hit.Fields["DocType"].(string)
+			doc.Revision, _ = hit.Fields["Revision"].(string)
+			doc.Authors = storedTags(hit.Fields["Authors"])
+			if s, ok := hit.Fields["Date"].(string); ok {
+				doc.Date, _ = time.Parse(time.RFC3339, s)
+			}
+			if size, ok := hit.Fields["Size"].(float64); ok {
+				doc.Size = int64(size)
+			}
+			if doc.Kind, _ = hit.Fields["Kind"].(string); doc.Kind == kindExample {
+				doc.CodeBlocks, _ = hit.Fields["CodeBlocks"].(string)
+			}
+			doc.Snippet = snippetFor(doc.Docset, hit)
+			if explain {
+				doc.Score, doc.Explanation = hit.Score, hit.Expl
+			}
 			results = append(results, doc)
 		}
 	}
 
-	return results, nil
+	return results, timing, nil
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maintenanceKey keeps the maintenance state in the meta bucket, so a
+// restart doesn't end it
+const maintenanceKey = "maintenance"
+
+// maintenanceRetryAfter is the Retry-After, in seconds, of searches turned
+// away during maintenance
+const maintenanceRetryAfter = "120"
+
+// Maintenance is the body of /api/admin/maintenance
+type Maintenance struct {
+	Enabled bool `json:"enabled"`
+	// Message is shown instead of the default maintenance notice
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	// UntilSwap ends maintenance once a new index has been swapped in
+	UntilSwap bool `json:"until_swap"`
+}
+
+var maintenance struct {
+	sync.RWMutex
+	state Maintenance
+}
+
+// maintenancePaths are the searches turned away during maintenance. The
+// docs themselves are still served.
+var maintenancePaths = []string{
+	"/search", "/search/results", "/search/export",
+	"/api/search", "/api/msearch", "/api/count", "/api/semantic", "/api/ask",
+	"/mcp",
+}
+
+func currentMaintenance() Maintenance {
+	maintenance.RLock()
+	defer maintenance.RUnlock()
+	return maintenance.state
+}
+
+// setMaintenance changes the maintenance state and keeps it in the store
+func setMaintenance(m Maintenance) error {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+	if store != nil {
+		if err := storePut(metaBucket, maintenanceKey, m); err != nil {
+			return err
+		}
+	}
+	maintenance.state = m
+	return nil
+}
+
+// loadMaintenance restores the maintenance state at startup. The index was
+// just opened anew, so a maintenance waiting for a swap is over.
+func loadMaintenance() error {
+	var m Maintenance
+	if _, err := storeGet(metaBucket, maintenanceKey, &m); err != nil {
+		return err
+	}
+	if m.Enabled && m.UntilSwap {
+		log.Println("Index reopened, leaving maintenance mode")
+		m = Maintenance{}
+	}
+	return setMaintenance(m)
+}
+
+// endMaintenanceAfterSwap ends a maintenance that was waiting for the
+// index to be swapped
+func endMaintenanceAfterSwap() {
+	if m := currentMaintenance(); !m.Enabled || !m.UntilSwap {
+		return
+	}
+	if err := setMaintenance(Maintenance{}); err != nil {
+		log.Printf("Error leaving maintenance mode: %v", err)
+		return
+	}
+	log.Println("Index swapped, leaving maintenance mode")
+}
+
+// duringMaintenance answers searches with a notice while maintenance mode
+// is on or the index is being recovered: pages get a friendly page, the
+// API an error
+func duringMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := currentMaintenance()
+		if (!m.Enabled && !searchUnavailable()) || !contains(maintenancePaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/mcp" {
+			msg := m.Message
+			switch {
+			case !m.Enabled:
+				msg = errIndexUnavailable.Error()
+			case msg == "":
+				msg = "search is down for maintenance"
+			}
+			writeError(w, r, http.StatusServiceUnavailable, msg)
+			return
+		}
+		if m.Enabled {
+			renderSearchDown(w, r, "maintenance", m.Message)
+		} else {
+			renderSearchDown(w, r, "unavailable", "")
+		}
+	})
+}
+
+// renderSearchDown shows the page telling that search is down, with the
+// title and default message of the locale keys under kind
+func renderSearchDown(w http.ResponseWriter, r *http.Request, kind, message string) {
+	data := struct {
+		Page
+		Message string
+	}{
+		Page:    newPage(r, kind+".title"),
+		Message: message,
+	}
+	if data.Message == "" {
+		data.Message = data.T(kind + ".message")
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := templates.ExecuteTemplate(w, "maintenance.html", data); err != nil {
+		log.Printf("Error rendering maintenance page: %v", err)
+	}
+}
+
+func handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentMaintenance())
+}
+
+// handlePutMaintenance turns maintenance mode on, or updates its message
+func handlePutMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req Maintenance
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	m := Maintenance{Enabled: true, Message: strings.TrimSpace(req.Message), UntilSwap: req.UntilSwap}
+	if len(m.Message) > 500 {
+		writeError(w, r, http.StatusBadRequest, "message is too long (max 500 bytes)")
+		return
+	}
+	// updating the message doesn't restart the clock
+	if cur := currentMaintenance(); cur.Enabled {
+		m.Since = cur.Since
+	} else {
+		now := time.Now().UTC()
+		m.Since = &now
+	}
+	if err := setMaintenance(m); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// handleDeleteMaintenance turns maintenance mode off
+func handleDeleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	if err := setMaintenance(Maintenance{}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, Maintenance{})
+}
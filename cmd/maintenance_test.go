@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func withMaintenance(t *testing.T) {
+	t.Helper()
+	old := currentMaintenance()
+	t.Cleanup(func() {
+		maintenance.Lock()
+		maintenance.state = old
+		maintenance.Unlock()
+	})
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, Config{})
+	withStore(t)
+	withMaintenance(t)
+	handler := duringMaintenance(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	}))
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	if rec := get("/api/search?q=pool"); rec.Body.String() != "served" {
+		t.Fatalf("search before maintenance = %d %s", rec.Code, rec.Body)
+	}
+
+	rec := httptest.NewRecorder()
+	handlePutMaintenance(rec, httptest.NewRequest("PUT", "/api/admin/maintenance", strings.NewReader(`{"message": "Moving to the new cluster", "until_swap": true}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put: %d %s", rec.Code, rec.Body)
+	}
+	m := currentMaintenance()
+	if !m.Enabled || !m.UntilSwap || m.Since == nil {
+		t.Fatalf("maintenance = %+v", m)
+	}
+
+	rec = get("/api/search?q=pool")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" || !strings.Contains(rec.Body.String(), "Moving to the new cluster") {
+		t.Errorf("api search: %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+	rec = get("/search?q=pool")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), "Moving to the new cluster") {
+		t.Errorf("search page: %d %s", rec.Code, rec.Body)
+	}
+	for _, path := range []string{"/guides/pool.html", "/healthz", "/api/admin/maintenance"} {
+		if rec := get(path); rec.Body.String() != "served" {
+			t.Errorf("%s during maintenance = %d", path, rec.Code)
+		}
+	}
+
+	// kept across restarts, unless it was waiting for a new index
+	var stored Maintenance
+	if ok, _ := storeGet(metaBucket, maintenanceKey, &stored); !ok || !stored.Enabled {
+		t.Errorf("stored maintenance = %+v", stored)
+	}
+	if err := setMaintenance(Maintenance{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadMaintenance(); err != nil || !currentMaintenance().Enabled {
+		t.Errorf("maintenance after a restart = %+v, %v", currentMaintenance(), err)
+	}
+	setMaintenance(Maintenance{Enabled: true, UntilSwap: true})
+	if err := loadMaintenance(); err != nil || currentMaintenance().Enabled {
+		t.Errorf("maintenance until a swap after a restart = %+v, %v", currentMaintenance(), err)
+	}
+
+	setMaintenance(Maintenance{Enabled: true})
+	rec = httptest.NewRecorder()
+	handleDeleteMaintenance(rec, httptest.NewRequest("DELETE", "/api/admin/maintenance", nil))
+	if rec.Code != http.StatusOK || currentMaintenance().Enabled {
+		t.Errorf("delete: %d %+v", rec.Code, currentMaintenance())
+	}
+	if rec := get("/search?q=pool"); rec.Body.String() != "served" {
+		t.Errorf("search after maintenance = %d", rec.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/regexp"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+const codeAnalyzer = "code"
+
+func newIndexMapping() mapping.IndexMapping {
+	indexMapping := bleve.NewIndexMapping()
+
+	// code is split on anything that can't be part of an identifier, so
+	// "context.WithTimeout" becomes the phrase "context withtimeout"
+	err := indexMapping.AddCustomTokenizer("code_identifiers", map[string]interface{}{
+		"type":   regexp.Name,
+		"regexp": `[\p{L}\p{N}_]+`,
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = indexMapping.AddCustomAnalyzer(codeAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     "code_identifiers",
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if err := addTextAnalyzer(indexMapping); err != nil {
+		panic(err)
+	}
+
+	documentMapping := newDocumentMapping(defaultTextAnalyzer())
+	indexMapping.AddDocumentMapping("document", documentMapping)
+	// documents of no detected language are indexed with the default mapping
+	indexMapping.DefaultMapping = documentMapping
+	for lang, analyzer := range languageAnalyzers {
+		indexMapping.AddDocumentMapping(lang, newDocumentMapping(analyzer))
+	}
+
+	return indexMapping
+}
+
+// newDocumentMapping maps the fields of Document, analyzing the title,
+// content and headings with textAnalyzer unless the config sets their
+// analyzers
+func newDocumentMapping(textAnalyzer string) *mapping.DocumentMapping {
+	documentMapping := bleve.NewDocumentMapping()
+
+	titleFieldMapping := bleve.NewTextFieldMapping()
+	titleFieldMapping.Analyzer = fieldAnalyzer("Title", textAnalyzer)
+	contentFieldMapping := bleve.NewTextFieldMapping()
+	contentFieldMapping.Analyzer = fieldAnalyzer("Content", textAnalyzer)
+
+	// URLs aren't in any language
+	urlFieldMapping := bleve.NewTextFieldMapping()
+	urlFieldMapping.Analyzer = standard.Name
+
+	keywordFieldMapping := bleve.NewKeywordFieldMapping()
+	keywordFieldMapping.IncludeInAll = false
+
+	documentMapping.AddFieldMappingsAt("Title", titleFieldMapping)
+	documentMapping.AddFieldMappingsAt("Content", contentFieldMapping)
+	documentMapping.AddFieldMappingsAt("URL", urlFieldMapping)
+	documentMapping.AddFieldMappingsAt("Docset", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("Kind", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("DocType", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("Version", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("Tags", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("Authors", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("Language", keywordFieldMapping)
+	documentMapping.AddFieldMappingsAt("Trust", keywordFieldMapping)
+
+	// heading text is in Content already, this copy is only for boosting
+	headingsFieldMapping := bleve.NewTextFieldMapping()
+	headingsFieldMapping.Analyzer = fieldAnalyzer("Headings", textAnalyzer)
+	headingsFieldMapping.Store = false
+	headingsFieldMapping.IncludeInAll = false
+	documentMapping.AddFieldMappingsAt("Headings", headingsFieldMapping)
+
+	// notes are only searched, the notes page reads them from the database
+	notesFieldMapping := bleve.NewTextFieldMapping()
+	notesFieldMapping.Analyzer = standard.Name
+	notesFieldMapping.Store = false
+	documentMapping.AddFieldMappingsAt("Notes", notesFieldMapping)
+
+	codeFieldMapping := bleve.NewTextFieldMapping()
+	codeFieldMapping.Analyzer = codeAnalyzer
+	codeFieldMapping.IncludeInAll = false
+	documentMapping.AddFieldMappingsAt("CodeBlocks", codeFieldMapping)
+
+	// class and member names are in Content already, split like code here
+	// so java.util.HashMap matches hashmap, only for boosting
+	symbolsFieldMapping := bleve.NewTextFieldMapping()
+	symbolsFieldMapping.Analyzer = codeAnalyzer
+	symbolsFieldMapping.Store = false
+	symbolsFieldMapping.IncludeInAll = false
+	documentMapping.AddFieldMappingsAt("Symbol", symbolsFieldMapping)
+	documentMapping.AddFieldMappingsAt("Members", symbolsFieldMapping)
+
+	// kept for result snippets, not searched
+	storedOnlyFieldMapping := bleve.NewTextFieldMapping()
+	storedOnlyFieldMapping.Index = false
+	storedOnlyFieldMapping.IncludeInAll = false
+	documentMapping.AddFieldMappingsAt("Description", storedOnlyFieldMapping)
+	documentMapping.AddFieldMappingsAt("Summary", storedOnlyFieldMapping)
+	documentMapping.AddFieldMappingsAt("TOC", storedOnlyFieldMapping)
+	documentMapping.AddFieldMappingsAt("Checksum", storedOnlyFieldMapping)
+	documentMapping.AddFieldMappingsAt("BuildKey", storedOnlyFieldMapping)
+	documentMapping.AddFieldMappingsAt("Revision", storedOnlyFieldMapping)
+
+	booleanFieldMapping := bleve.NewBooleanFieldMapping()
+	booleanFieldMapping.IncludeInAll = false
+	documentMapping.AddFieldMappingsAt("Deprecated", booleanFieldMapping)
+
+	sizeFieldMapping := bleve.NewNumericFieldMapping()
+	sizeFieldMapping.IncludeInAll = false
+	documentMapping.AddFieldMappingsAt("Size", sizeFieldMapping)
+
+	dateFieldMapping := bleve.NewDateTimeFieldMapping()
+	dateFieldMapping.IncludeInAll = false
+	documentMapping.AddFieldMappingsAt("ModifiedAt", dateFieldMapping)
+	documentMapping.AddFieldMappingsAt("Date", dateFieldMapping)
+
+	return documentMapping
+}
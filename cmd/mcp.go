@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision spoken
+const mcpProtocolVersion = "2025-03-26"
+
+const (
+	// maxMCPResults bounds the limit argument of search_docs
+	maxMCPResults = 50
+	// maxDocumentText is how many characters of a document get_document
+	// returns
+	maxDocumentText = 200 << 10
+)
+
+// mcpRequest is a JSON-RPC 2.0 request or, without an ID, a notification
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// mcpTool describes a tool to the client
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "search_docs",
+		Description: "Search the documentation. Returns the best matching documents with their path, title and the start of their text.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{"type": "string", "description": "Words to search for; tag:<name> and code:<snippet> narrow the search"},
+				"limit": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": maxMCPResults, "description": "How many documents to return, 10 by default"},
+				"type":  map[string]interface{}{"type": "string", "description": "Comma-separated file types to search, like md,html"},
+			},
+			"required": []string{"query"},
+		},
+	},
+	{
+		Name:        "get_document",
+		Description: "Read a document found with search_docs, as plain text.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{"type": "string", "description": "The document path returned by search_docs, like guides/start.html"},
+			},
+			"required": []string{"path"},
+		},
+	},
+}
+
+// mcpToolResult is the result of tools/call. Tool failures are results
+// with IsError set, so the model sees them, rather than protocol errors.
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func mcpText(text string, isError bool) mcpToolResult {
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}, IsError: isError}
+}
+
+// handleMCPRequest answers one request for the caller in ctx. It returns
+// nil for notifications, which get no answer.
+func handleMCPRequest(ctx context.Context, req mcpRequest) *mcpResponse {
+	if len(req.ID) == 0 {
+		return nil
+	}
+	resp := &mcpResponse{JSONRPC: "2.0", ID: req.ID}
+	fail := func(code int, message string) *mcpResponse {
+		resp.Error = &mcpError{Code: code, Message: message}
+		return resp
+	}
+	if req.JSONRPC != "2.0" {
+		return fail(rpcInvalidRequest, "jsonrpc must be 2.0")
+	}
+
+	switch req.Method {
+	case "initialize":
+		resp.Result = map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "godochive", "version": defaultAPIVersion},
+		}
+	case "ping":
+		resp.Result = map[string]interface{}{}
+	case "tools/list":
+		resp.Result = map[string]interface{}{"tools": mcpTools}
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return fail(rpcInvalidParams, err.Error())
+		}
+		switch params.Name {
+		case "search_docs":
+			resp.Result = mcpSearchDocs(ctx, params.Arguments)
+		case "get_document":
+			resp.Result = mcpGetDocument(ctx, params.Arguments)
+		default:
+			return fail(rpcInvalidParams, fmt.Sprintf("unknown tool %q", params.Name))
+		}
+	default:
+		return fail(rpcMethodNotFound, fmt.Sprintf("unknown method %q", req.Method))
+	}
+	return resp
+}
+
+// mcpSearchDocs runs the search_docs tool
+func mcpSearchDocs(ctx context.Context, arguments json.RawMessage) mcpToolResult {
+	var args struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+		Type  string `json:"type"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil || strings.TrimSpace(args.Query) == "" {
+		return mcpText("query is required", true)
+	}
+	if args.Limit == 0 {
+		args.Limit = 10
+	}
+	if args.Limit < 1 || args.Limit > maxMCPResults {
+		return mcpText(fmt.Sprintf("limit must be between 1 and %d", maxMCPResults), true)
+	}
+
+	filter := searchFilter{Types: parseTypes(args.Type), Denied: deniedDocsets(ctx)}
+	resp, err := runAPISearch(args.Query, []string{"title", "url", "content"}, filter, args.Limit)
+	if err != nil {
+		return mcpText("search failed: "+err.Error(), true)
+	}
+	if len(resp.Hits) == 0 {
+		return mcpText("No documents match.", false)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d documents match, the best %d:\n", resp.Total, len(resp.Hits))
+	for i, hit := range resp.Hits {
+		title, _ := hit.Fields["title"].(string)
+		path, _ := hit.Fields["url"].(string)
+		content, _ := hit.Fields["content"].(string)
+		fmt.Fprintf(&sb, "\n%d. %s\n   path: %s\n   %s\n", i+1, title, path, truncate(strings.Join(strings.Fields(content), " "), 200))
+	}
+	return mcpText(sb.String(), false)
+}
+
+// mcpGetDocument runs the get_document tool. Pages are returned as their
+// paragraphs, text files as they are.
+func mcpGetDocument(ctx context.Context, arguments json.RawMessage) mcpToolResult {
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil || args.Path == "" {
+		return mcpText("path is required", true)
+	}
+	rel, _, _ := strings.Cut(args.Path, "#")
+	path, _, err := documentPathFor(ctx, rel)
+	if err != nil {
+		return mcpText(err.Error(), true)
+	}
+	content, err := readDoc(path)
+	if err != nil {
+		return mcpText("reading the document failed: "+err.Error(), true)
+	}
+
+	text := string(content)
+	if docTypeOf(path, fileType(path, content)) == "html" {
+		doc, err := html.Parse(strings.NewReader(text))
+		if err != nil {
+			return mcpText("parsing the document failed: "+err.Error(), true)
+		}
+		text = strings.Join(findParagraphs(doc), "\n\n")
+		if t := findElement(doc, "title"); t != nil && strings.TrimSpace(nodeText(t)) != "" {
+			text = "# " + strings.TrimSpace(nodeText(t)) + "\n\n" + text
+		}
+	}
+	if cut := truncate(text, maxDocumentText); cut != text {
+		text = cut + "\n\n[the document is longer and was cut here]"
+	}
+	return mcpText(text, false)
+}
+
+// serveMCP reads newline-delimited requests from in and writes the
+// answers to out, as the stdio transport does, until in ends. Callers are
+// anonymous, so restricted docsets stay hidden.
+func serveMCP(ctx context.Context, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	enc := json.NewEncoder(out)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req mcpRequest
+		var resp *mcpResponse
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			resp = &mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{Code: rpcParseError, Message: err.Error()}}
+		} else {
+			resp = handleMCPRequest(ctx, req)
+		}
+		if resp == nil {
+			continue
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// handleMCP is the Streamable HTTP transport: each POST carries one
+// request and gets a JSON answer. The server doesn't send requests of its
+// own, so there's no event stream to GET.
+func handleMCP(w http.ResponseWriter, r *http.Request) {
+	var req mcpRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{Code: rpcParseError, Message: err.Error()}})
+		return
+	}
+	resp := handleMCPRequest(r.Context(), req)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// runMCP serves the index to AI assistants over stdio with the Model
+// Context Protocol. Nothing else may be written to stdout.
+func runMCP(args []string) error {
+	fs, opts := newFlagSet("mcp", "[flags]", false)
+	fs.Parse(args)
+	if err := opts.apply(); err != nil {
+		return err
+	}
+	var err error
+	if index, err = openIndex(indexPath); err != nil {
+		return err
+	}
+	defer index.Close()
+	return serveMCP(context.Background(), os.Stdin, os.Stdout)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withMCPDocs(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	withConfig(t, restrictedConfig)
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	for rel, content := range map[string]string{
+		"guides/keys.html":             contextPage,
+		"guides/notes.md":              "# Key notes\n\nKeys are kept in the vault.",
+		"security/playbooks/leak.html": `<title>Leaked keys</title><p>Revoke leaked keys at once.</p>`,
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeMCP(t *testing.T) {
+	withMCPDocs(t)
+	in := strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-03-26"}}`,
+		`{"jsonrpc": "2.0", "method": "notifications/initialized"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "tools/list"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "tools/call", "params": {"name": "search_docs", "arguments": {"query": "keys", "type": "html"}}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {"name": "get_document", "arguments": {"path": "guides/keys.html"}}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "tools/call", "params": {"name": "get_document", "arguments": {"path": "../secrets.txt"}}}`,
+		`{"jsonrpc": "2.0", "id": 6, "method": "resources/list"}`,
+		`not json`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := serveMCP(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	type answer struct {
+		ID     json.RawMessage
+		Result struct {
+			ProtocolVersion string
+			Tools           []mcpTool
+			Content         []mcpContent
+			IsError         bool
+		}
+		Error *mcpError
+	}
+	var answers []answer
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var a answer
+		if err := dec.Decode(&a); err != nil {
+			t.Fatal(err)
+		}
+		answers = append(answers, a)
+	}
+	if len(answers) != 7 {
+		t.Fatalf("got %d answers, want 7: the notification gets none", len(answers))
+	}
+	if answers[0].Result.ProtocolVersion != mcpProtocolVersion {
+		t.Errorf("initialize = %+v", answers[0])
+	}
+	if tools := answers[1].Result.Tools; len(tools) != 2 || tools[0].Name != "search_docs" || tools[1].Name != "get_document" {
+		t.Errorf("tools = %+v", tools)
+	}
+	search := answers[2].Result.Content[0].Text
+	if !strings.Contains(search, "path: guides/keys.html") || strings.Contains(search, "playbooks") || strings.Contains(search, "notes.md") {
+		t.Errorf("search_docs = %q, want the html pages anyone may see", search)
+	}
+	if doc := answers[3].Result.Content[0].Text; !strings.Contains(doc, "Rotating keys\n\nKeys expire after a year.") || strings.Contains(doc, "Home · Guides") {
+		t.Errorf("get_document = %q", doc)
+	}
+	if !answers[4].Result.IsError {
+		t.Errorf("get_document outside the root = %+v, want a tool error", answers[4])
+	}
+	if answers[5].Error == nil || answers[5].Error.Code != rpcMethodNotFound {
+		t.Errorf("unknown method = %+v", answers[5])
+	}
+	if answers[6].Error == nil || answers[6].Error.Code != rpcParseError {
+		t.Errorf("invalid json = %+v", answers[6])
+	}
+}
+
+func TestHandleMCP(t *testing.T) {
+	withMCPDocs(t)
+	call := func(body string, groups ...string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleMCP(rec, httptest.NewRequest("POST", "/mcp", strings.NewReader(body)).WithContext(memberContext(groups...)))
+		return rec
+	}
+
+	rec := call(`{"jsonrpc": "2.0", "id": "a", "method": "tools/call", "params": {"name": "search_docs", "arguments": {"query": "keys"}}}`, "security")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":"a"`) {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "guides/keys.html") || !strings.Contains(body, "security/playbooks/leak.html") {
+		t.Errorf("search_docs for a member = %s", body)
+	}
+	getLeak := `{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "get_document", "arguments": {"path": "security/playbooks/leak.html"}}}`
+	if rec := call(getLeak); !strings.Contains(rec.Body.String(), `"isError":true`) {
+		t.Errorf("get_document of a restricted page for a non-member = %s", rec.Body)
+	}
+	rec = call(getLeak, "security")
+	if body := rec.Body.String(); !strings.Contains(body, "Revoke leaked keys at once.") || strings.Contains(body, `"isError"`) {
+		t.Errorf("get_document of a restricted page for a member = %s", body)
+	}
+	if rec := call(`{"jsonrpc": "2.0", "method": "notifications/initialized"}`); rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+		t.Errorf("notification: status = %d, body = %q", rec.Code, rec.Body)
+	}
+}
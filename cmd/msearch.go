@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const maxMultiSearchQueries = 50
+
+// MultiSearchQuery is one entry of a /api/msearch request
+type MultiSearchQuery struct {
+	Q       string `json:"q"`
+	Fields  string `json:"fields"`
+	Type    string `json:"type"`
+	Updated string `json:"updated"`
+	Tag     string `json:"tag"`
+	Size    *int   `json:"size"`
+}
+
+// MultiSearchRequest is the body of POST /api/msearch
+type MultiSearchRequest struct {
+	Queries []MultiSearchQuery `json:"queries"`
+}
+
+// MultiSearchResponse holds one response per query, in request order
+type MultiSearchResponse struct {
+	Responses []APISearchResponse `json:"responses"`
+}
+
+func handleMultiSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req MultiSearchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Queries) > maxMultiSearchQueries {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Too many queries (max %d)", maxMultiSearchQueries))
+		return
+	}
+
+	// limitRate charged one token for the request, charge the rest per query
+	if limiter != nil && len(req.Queries) > 1 {
+		if ok, wait := limiter.allowN(clientIP(r), len(req.Queries)-1); !ok {
+			tooManyRequests(w, r, wait)
+			return
+		}
+	}
+
+	base, err := filterFromRequest(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp := MultiSearchResponse{Responses: make([]APISearchResponse, 0, len(req.Queries))}
+	for i, q := range req.Queries {
+		fields, err := parseFieldsParam(q.Fields)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("query %d: %v", i, err))
+			return
+		}
+
+		// size 0 is allowed so dashboards can fetch hit counts only
+		size := 10
+		if q.Size != nil {
+			size = *q.Size
+		}
+		if size < 0 || size > 100 {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("query %d: size must be between 0 and 100", i))
+			return
+		}
+
+		filter := base
+		filter.Types = parseTypes(q.Type)
+		filter.Tags = parseTags(q.Tag)
+		if filter.Since, _, err = updatedWindow(url.Values{"updated": {q.Updated}}, time.Now()); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("query %d: %v", i, err))
+			return
+		}
+		result, err := runAPISearch(q.Q, fields, filter, size)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp.Responses = append(resp.Responses, result)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
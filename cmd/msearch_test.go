@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiSearch(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+	for _, doc := range []Document{
+		{Title: "Pooling", Content: "connection pooling", URL: "guides/pool.html", DocType: "html"},
+		{Title: "Cache", Content: "cache eviction", URL: "guides/cache.html", DocType: "html"},
+		{Title: "Notes", Content: "pooling notes", URL: "notes/pool.md", DocType: "md"},
+	} {
+		doc.URL = filepath.Join(root, doc.URL)
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msearch := func(body string) *httptest.ResponseRecorder {
+		return serve(http.HandlerFunc(handleMultiSearch), httptest.NewRequest(http.MethodPost, "/api/msearch", strings.NewReader(body)))
+	}
+
+	rec := msearch(`{"queries": [{"q": "pooling"}, {"q": "pooling", "type": "md"}, {"q": "cache", "size": 0}, {"q": ""}]}`)
+	var resp MultiSearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("msearch = %d, %v", rec.Code, err)
+	}
+	if len(resp.Responses) != 4 {
+		t.Fatalf("responses = %+v, want one per query", resp.Responses)
+	}
+	for i, want := range []struct {
+		total uint64
+		hits  int
+	}{{2, 2}, {1, 1}, {1, 0}, {0, 0}} {
+		if got := resp.Responses[i]; got.Total != want.total || len(got.Hits) != want.hits {
+			t.Errorf("query %d: total %d, %d hits, want %d, %d", i, got.Total, len(got.Hits), want.total, want.hits)
+		}
+	}
+	if r := resp.Responses[1]; len(r.Hits) != 1 || r.Hits[0].ID != "notes/pool.md" {
+		t.Errorf("filtered query = %+v, want only the notes", r)
+	}
+
+	// one bad query fails the whole request and is named in the error
+	for _, body := range []string{
+		`{"queries": [{"q": "pooling"}, {"q": "cache", "size": 500}]}`,
+		`{"queries": [{"q": "pooling"}, {"q": "cache", "fields": "secret"}]}`,
+		`{"queries": [{"q": "pooling"}, {"q": "cache", "updated": "someday"}]}`,
+	} {
+		if rec := msearch(body); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "query 1") {
+			t.Errorf("%s: %d %s, want an error about query 1", body, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := msearch(`{"queries": [`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid body: status = %d", rec.Code)
+	}
+	rec = serve(http.HandlerFunc(handleMultiSearch), httptest.NewRequest(http.MethodGet, "/api/msearch", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("GET: status = %d, Allow = %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestMultiSearchLimit(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+
+	batch := func(n int) string {
+		queries := make([]string, n)
+		for i := range queries {
+			queries[i] = `{"q": "pooling", "size": 0}`
+		}
+		return `{"queries": [` + strings.Join(queries, ",") + `]}`
+	}
+	for n, want := range map[int]int{maxMultiSearchQueries: http.StatusOK, maxMultiSearchQueries + 1: http.StatusBadRequest} {
+		rec := serve(http.HandlerFunc(handleMultiSearch), httptest.NewRequest(http.MethodPost, "/api/msearch", strings.NewReader(batch(n))))
+		if rec.Code != want {
+			t.Errorf("%d queries: status = %d, want %d", n, rec.Code, want)
+		}
+	}
+}
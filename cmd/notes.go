@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const notesBucket = "document_notes"
+
+const (
+	// maxNoteLength caps the text of a note, in bytes
+	maxNoteLength = 4000
+	// maxNotesPerDocument caps the notes on one document
+	maxNotesPerDocument = 100
+)
+
+// Note is free text attached to a document. Shared notes are visible to
+// everyone who can read the document, others only to their author.
+type Note struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+	// Author is the visitorKey of whoever wrote the note
+	Author string `json:"-"`
+	// AuthorName is the login name, empty for anonymous visitors
+	AuthorName string    `json:"author,omitempty"`
+	Text       string    `json:"text"`
+	Shared     bool      `json:"shared"`
+	Created    time.Time `json:"created"`
+}
+
+// storedNote keeps the author, which the API doesn't expose
+type storedNote struct {
+	Note
+	Author string `json:"author_key"`
+}
+
+// notesOf returns the notes of the document at path that match keep,
+// oldest first
+func notesOf(path string, keep func(Note) bool) ([]Note, error) {
+	notes := []Note{}
+	if store == nil {
+		return notes, nil
+	}
+	key := tagKey(path)
+	err := storeEach(notesBucket, func(_ string, data []byte) error {
+		var s storedNote
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		s.Note.Author = s.Author
+		if s.Path == key && keep(s.Note) {
+			notes = append(notes, s.Note)
+		}
+		return nil
+	})
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Created.Before(notes[j].Created) })
+	return notes, err
+}
+
+// visibleTo keeps shared notes and those of the visitor of r
+func visibleTo(r *http.Request) func(Note) bool {
+	owner, _ := visitorKey(r)
+	return func(n Note) bool { return n.Shared || (owner != "" && n.Author == owner) }
+}
+
+// noteTexts maps the tagKey of documents to what gets indexed of their
+// notes
+type noteTexts map[string]string
+
+// sharedNoteTexts reads the notes once for a build: the text of each
+// document's shared notes, oldest first, when searchable_notes is on.
+// Private notes are never indexed, since search results would reveal them.
+func sharedNoteTexts() noteTexts {
+	texts := make(noteTexts)
+	if !config.SearchableNotes || store == nil {
+		return texts
+	}
+	var notes []Note
+	err := storeEach(notesBucket, func(_ string, data []byte) error {
+		var s storedNote
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s.Shared {
+			notes = append(notes, s.Note)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error loading notes: %v", err)
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Created.Before(notes[j].Created) })
+	byPath := make(map[string][]string)
+	for _, n := range notes {
+		byPath[n.Path] = append(byPath[n.Path], n.Text)
+	}
+	for path, t := range byPath {
+		texts[path] = strings.Join(t, "\n")
+	}
+	return texts
+}
+
+var errTooManyNotes = fmt.Errorf("too many notes on this document (max %d)", maxNotesPerDocument)
+
+// newNote validates a note by the visitor of r
+func newNote(r *http.Request, author, path, text string, shared bool) (Note, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Note{}, errors.New("text is required")
+	}
+	if len(text) > maxNoteLength {
+		return Note{}, fmt.Errorf("text is too long (max %d bytes)", maxNoteLength)
+	}
+	n := Note{ID: randomString(12), Path: tagKey(path), Author: author, Text: text, Shared: shared, Created: time.Now().UTC()}
+	if p, ok := principalFromContext(r.Context()); ok {
+		n.AuthorName = p.Name
+	}
+	return n, nil
+}
+
+// putNote stores n and reindexes its document when the index holds notes
+func putNote(path string, info os.FileInfo, n Note) error {
+	existing, err := notesOf(path, func(Note) bool { return true })
+	if err != nil {
+		return err
+	}
+	if len(existing) >= maxNotesPerDocument {
+		return errTooManyNotes
+	}
+	if err := storePut(notesBucket, n.ID, storedNote{Note: n, Author: n.Author}); err != nil {
+		return err
+	}
+	if n.Shared && config.SearchableNotes {
+		return reindexDocument(path, info)
+	}
+	return nil
+}
+
+func handleListNotes(w http.ResponseWriter, r *http.Request) {
+	path, _, err := documentPath(r, r.URL.Query().Get("path"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	notes, err := notesOf(path, visibleTo(r))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, notes)
+}
+
+func handleCreateNote(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path   string `json:"path"`
+		Text   string `json:"text"`
+		Shared bool   `json:"shared"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	path, info, err := documentPath(r, req.Path)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	n, err := newNote(r, ensureVisitorKey(w, r), path, req.Text, req.Shared)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := putNote(path, info, n); err == errTooManyNotes {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, n)
+}
+
+// deleteNote removes the note with the given ID if the visitor of r wrote
+// it. Admins may remove any note.
+func deleteNote(r *http.Request, id string) (bool, error) {
+	var s storedNote
+	found, err := storeGet(notesBucket, id, &s)
+	if err != nil || !found {
+		return false, err
+	}
+	owner, _ := visitorKey(r)
+	if (owner == "" || s.Author != owner) && !isAdmin(r.Context()) {
+		return false, nil
+	}
+	if err := storeDelete(notesBucket, id); err != nil {
+		return false, err
+	}
+	if s.Shared && config.SearchableNotes {
+		path, info, err := documentPath(r, s.Path)
+		if err == nil {
+			return true, reindexDocument(path, info)
+		}
+	}
+	return true, nil
+}
+
+func handleDeleteNote(w http.ResponseWriter, r *http.Request) {
+	deleted, err := deleteNote(r, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !deleted {
+		writeError(w, r, http.StatusNotFound, "no such note")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notesPage is the page listing the notes of a document
+type notesPage struct {
+	Page
+	Path  string
+	Notes []Note
+	Owner string
+}
+
+func handleNotesPage(w http.ResponseWriter, r *http.Request) {
+	path, _, err := documentPath(r, r.URL.Query().Get("path"))
+	if err != nil {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	notes, err := notesOf(path, visibleTo(r))
+	if err != nil {
+		log.Printf("Error loading notes: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	owner, _ := visitorKey(r)
+	renderTemplate(w, "notes.html", notesPage{Page: newPage(r, "notes.title"), Path: tagKey(path), Notes: notes, Owner: owner})
+}
+
+// handleNotesForm adds a note from the notes page, or deletes one when the
+// form carries a delete ID, and goes back to the page
+func handleNotesForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	path, info, err := documentPath(r, r.PostForm.Get("path"))
+	if err != nil {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+
+	if id := r.PostForm.Get("delete"); id != "" {
+		if deleted, err := deleteNote(r, id); err != nil {
+			log.Printf("Error deleting note: %v", err)
+			renderError(w, r, http.StatusInternalServerError)
+			return
+		} else if !deleted {
+			renderError(w, r, http.StatusNotFound)
+			return
+		}
+	} else {
+		n, err := newNote(r, ensureVisitorKey(w, r), path, r.PostForm.Get("text"), r.PostForm.Get("shared") == "on")
+		if err != nil {
+			renderError(w, r, http.StatusBadRequest)
+			return
+		}
+		if err := putNote(path, info, n); err == errTooManyNotes {
+			renderError(w, r, http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Printf("Error saving note: %v", err)
+			renderError(w, r, http.StatusInternalServerError)
+			return
+		}
+	}
+	http.Redirect(w, r, "/notes?path="+url.QueryEscape(tagKey(path)), http.StatusSeeOther)
+}
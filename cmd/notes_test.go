@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNotes(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{SearchableNotes: true})
+	withDocFiles(t, map[string]string{"guides/pool.html": "connection pooling"})
+	withEmptyIndex(t)
+	if _, err := buildIndex(root); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/notes", strings.NewReader(body))
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		return serve(http.HandlerFunc(handleCreateNote), r)
+	}
+	rec := create(`{"path": "guides/pool.html", "text": "see also the haproxy runbook", "shared": true}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body.String())
+	}
+	ann := rec.Result().Cookies()[0]
+	var shared Note
+	json.NewDecoder(rec.Body).Decode(&shared)
+	create(`{"path": "guides/pool.html", "text": "ask bob about the zookeeper outage"}`, ann)
+	if rec := create(`{"path": "guides/pool.html", "text": "  "}`, ann); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty note = %d, want 400", rec.Code)
+	}
+
+	list := func(cookie *http.Cookie) []Note {
+		r := httptest.NewRequest(http.MethodGet, "/api/notes?path=guides/pool.html", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		var notes []Note
+		if err := json.NewDecoder(serve(http.HandlerFunc(handleListNotes), r).Body).Decode(&notes); err != nil {
+			t.Fatal(err)
+		}
+		return notes
+	}
+	if got := list(ann); len(got) != 2 {
+		t.Errorf("author sees %d notes, want both", len(got))
+	}
+	bob := &http.Cookie{Name: visitorCookieName, Value: "bob"}
+	if got := list(bob); len(got) != 1 || !got[0].Shared {
+		t.Errorf("others see %+v, want the shared note only", got)
+	}
+
+	search := func(query string) int {
+		results, err := performSearch(query, searchFilter{}, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(results)
+	}
+	if search("haproxy") != 1 {
+		t.Error("shared note isn't searchable")
+	}
+	if search("zookeeper") != 0 {
+		t.Error("private note is searchable")
+	}
+
+	del := func(cookie *http.Cookie) int {
+		r := httptest.NewRequest(http.MethodDelete, "/api/notes/"+shared.ID, nil)
+		r.SetPathValue("id", shared.ID)
+		r.AddCookie(cookie)
+		return serve(http.HandlerFunc(handleDeleteNote), r).Code
+	}
+	if code := del(bob); code != http.StatusNotFound {
+		t.Errorf("deleting someone else's note = %d, want 404", code)
+	}
+	if code := del(ann); code != http.StatusNoContent {
+		t.Errorf("deleting own note = %d, want 204", code)
+	}
+	if search("haproxy") != 0 {
+		t.Error("deleted note is still searchable")
+	}
+}
+
+func TestNotesPage(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{})
+	withDocFiles(t, map[string]string{"guides/pool.html": "connection pooling"})
+	withEmptyIndex(t)
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"path": {"guides/pool.html"}, "text": {"<b>check</b> the limits"}, "shared": {"on"}}
+	r := httptest.NewRequest(http.MethodPost, "/notes", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := serve(http.HandlerFunc(handleNotesForm), r)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/notes?path=guides%2Fpool.html" {
+		t.Fatalf("add = %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	page := httptest.NewRequest(http.MethodGet, "/notes?path=guides/pool.html", nil)
+	page.AddCookie(rec.Result().Cookies()[0])
+	body := serve(http.HandlerFunc(handleNotesPage), page).Body.String()
+	if !strings.Contains(body, "&lt;b&gt;check&lt;/b&gt; the limits") || !strings.Contains(body, `name="delete"`) {
+		t.Errorf("notes page doesn't show the escaped note with a delete button:\n%s", body)
+	}
+
+	if rec := serve(http.HandlerFunc(handleNotesPage), httptest.NewRequest(http.MethodGet, "/notes?path=../etc/passwd", nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("notes of a path outside the root = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const oidcStateCookieName = "godochive_oidc_state"
+
+// oidcProvider holds the endpoints discovered from the issuer
+type oidcProvider struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+var provider *oidcProvider
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+func oidcEnabled() bool {
+	return config.Auth.OIDC.Issuer != ""
+}
+
+// discoverOIDC fetches the issuer's OpenID configuration document
+func discoverOIDC(issuer string) (*oidcProvider, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := oidcClient.Get(wellKnown)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery returned %s", resp.Status)
+	}
+
+	var p oidcProvider
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return nil, err
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("discovery document at %s is missing required endpoints", wellKnown)
+	}
+	return &p, nil
+}
+
+// handleLogin starts the authorization code flow
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	state := randomString(24)
+	next := safeRedirectPath(r.URL.Query().Get("next"))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    sign([]byte(state + "|" + next)),
+		Path:     "/auth/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	scopes := config.Auth.OIDC.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {config.Auth.OIDC.ClientID},
+		"redirect_uri":  {config.Auth.OIDC.RedirectURL},
+		"scope":         {strings.Join(scopes, " ")},
+		"state":         {state},
+	}
+	http.Redirect(w, r, provider.AuthorizationEndpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+// safeRedirectPath returns next if it is a local path, otherwise /search.
+// Backslashes and control characters are rejected because browsers treat
+// "/\host" and "/\t/host" like "//host".
+func safeRedirectPath(next string) string {
+	if next == "" || strings.ContainsAny(next, "\\\t\r\n") {
+		return "/search"
+	}
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil ||
+		!strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return "/search"
+	}
+	return next
+}
+
+// handleCallback exchanges the authorization code, looks up the user and
+// starts a session
+func handleCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		http.Error(w, "Missing login state, please try again", http.StatusBadRequest)
+		return
+	}
+	payload, err := verify(cookie.Value)
+	if err != nil {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	state, next, _ := strings.Cut(string(payload), "|")
+	if r.URL.Query().Get("state") != state {
+		http.Error(w, "Login state mismatch", http.StatusBadRequest)
+		return
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		http.Error(w, "Login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+
+	accessToken, err := exchangeCode(r.URL.Query().Get("code"))
+	if err != nil {
+		log.Printf("Error exchanging OIDC code: %v", err)
+		http.Error(w, "Login failed", http.StatusBadGateway)
+		return
+	}
+
+	name, groups, err := fetchUserinfo(accessToken)
+	if err != nil {
+		log.Printf("Error fetching OIDC userinfo: %v", err)
+		http.Error(w, "Login failed", http.StatusBadGateway)
+		return
+	}
+
+	ttl := time.Duration(config.Auth.SessionHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 12 * time.Hour
+	}
+	s := session{Name: name, Groups: groups, Expires: time.Now().Add(ttl).Unix()}
+	if err := setSessionCookie(w, r, s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookieName, Path: "/auth/", MaxAge: -1})
+
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	clearSessionCookie(w, r)
+	if provider != nil && provider.EndSessionEndpoint != "" {
+		http.Redirect(w, r, provider.EndSessionEndpoint, http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/search", http.StatusFound)
+}
+
+func exchangeCode(code string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {config.Auth.OIDC.RedirectURL},
+	}
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(config.Auth.OIDC.ClientID), url.QueryEscape(config.Auth.OIDC.ClientSecret))
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token response has no access_token")
+	}
+	return token.AccessToken, nil
+}
+
+// fetchUserinfo returns the display name for the session (the email if
+// present, otherwise the subject) and the groups claim
+func fetchUserinfo(accessToken string) (string, []string, error) {
+	req, err := http.NewRequest(http.MethodGet, provider.UserinfoEndpoint, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("userinfo endpoint returned %s", resp.Status)
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return "", nil, err
+	}
+
+	groupsClaim := config.Auth.OIDC.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	var groups []string
+	if list, ok := claims[groupsClaim].([]interface{}); ok {
+		for _, g := range list {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+
+	if email, ok := claims["email"].(string); ok && email != "" {
+		return email, groups, nil
+	}
+	if sub, ok := claims["sub"].(string); ok && sub != "" {
+		return sub, groups, nil
+	}
+	return "", nil, fmt.Errorf("userinfo response has no subject")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSafeRedirectPath(t *testing.T) {
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"/guide/index.html?x=1", "/guide/index.html?x=1"},
+		{"/search?q=pool", "/search?q=pool"},
+		{"", "/search"},
+		{"https://evil.com/", "/search"},
+		{"//evil.com", "/search"},
+		{`/\evil.com`, "/search"},
+		{"/\t/evil.com", "/search"},
+		{"relative/path", "/search"},
+		{"javascript:alert(1)", "/search"},
+	}
+	for _, tt := range tests {
+		if got := safeRedirectPath(tt.next); got != tt.want {
+			t.Errorf("safeRedirectPath(%q) = %q, want %q", tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestHandleLoginRejectsForeignNext(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{OIDC: OIDCConfig{Issuer: "https://idp.example.com", ClientID: "docs"}}})
+	oldProvider, oldSecret := provider, sessionSecret
+	provider = &oidcProvider{AuthorizationEndpoint: "https://idp.example.com/authorize"}
+	sessionSecret = []byte("test-secret")
+	t.Cleanup(func() { provider, sessionSecret = oldProvider, oldSecret })
+
+	rec := serve(http.HandlerFunc(handleLogin), httptest.NewRequest(http.MethodGet, `/auth/login?next=/\evil.com`, nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusFound)
+	}
+
+	var stateCookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcStateCookieName {
+			stateCookie = c
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("no state cookie set")
+	}
+	payload, err := verify(stateCookie.Value)
+	if err != nil {
+		t.Fatalf("state cookie does not verify: %v", err)
+	}
+	if _, next, _ := strings.Cut(string(payload), "|"); next != "/search" {
+		t.Errorf("stored next = %q, want /search", next)
+	}
+}
+
+func TestRequireAuthOIDCOnly(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{OIDC: OIDCConfig{Issuer: "https://idp.example.com"}}})
+	h := requireAuth(okHandler)
+
+	rec := serve(h, httptest.NewRequest(http.MethodGet, "/api/search?q=x", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("api status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if got := rec.Header().Get("WWW-Authenticate"); got != "" {
+		t.Errorf("unexpected basic challenge %q without basic auth users", got)
+	}
+
+	rec = serve(h, httptest.NewRequest(http.MethodGet, "/search?q=x", nil))
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), "/auth/login?next=") {
+		t.Errorf("browser request: status %d, location %q; want redirect to login", rec.Code, rec.Header().Get("Location"))
+	}
+}
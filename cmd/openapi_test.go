@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	rec := serve(http.HandlerFunc(handleOpenAPI), httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas struct {
+				Error struct {
+					Properties struct {
+						Error struct {
+							Properties struct {
+								Code struct {
+									Enum []string `json:"enum"`
+								} `json:"code"`
+							} `json:"properties"`
+						} `json:"error"`
+					} `json:"properties"`
+				} `json:"Error"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") || !contains(apiVersions, spec.Info.Version) {
+		t.Errorf("openapi %q, version %q", spec.OpenAPI, spec.Info.Version)
+	}
+	for _, path := range []string{"/search", "/count", "/msearch", "/saved", "/bookmarks", "/history", "/share", "/links"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec doesn't describe %s", path)
+		}
+	}
+	for status, code := range errorCodes {
+		if !contains(spec.Components.Schemas.Error.Properties.Error.Properties.Code.Enum, code) {
+			t.Errorf("spec is missing error code %q (%d)", code, status)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/index/scorch/mergeplan"
+)
+
+// OptimizeResponse reports the outcome of a forced merge
+type OptimizeResponse struct {
+	BytesBefore uint64 `json:"bytes_before"`
+	BytesAfter  uint64 `json:"bytes_after"`
+	DurationMS  int64  `json:"duration_ms"`
+}
+
+// mergeableIndex is the part of the scorch index API used for compaction
+type mergeableIndex interface {
+	ForceMerge(ctx context.Context, mo *mergeplan.MergePlanOptions) error
+	StatsMap() map[string]interface{}
+}
+
+// optimizeIndex merges all segments of idx, of each of its shards, into
+// one, dropping the space still held by deleted and replaced documents
+func optimizeIndex(ctx context.Context, idx bleve.Index) (OptimizeResponse, error) {
+	var merges []mergeableIndex
+	for _, shard := range shardsOf(idx) {
+		adv, err := shard.Advanced()
+		if err != nil {
+			return OptimizeResponse{}, err
+		}
+		m, ok := adv.(mergeableIndex)
+		if !ok {
+			return OptimizeResponse{}, errors.New("index type does not support compaction")
+		}
+		merges = append(merges, m)
+	}
+
+	start := time.Now()
+	var res OptimizeResponse
+	for _, m := range merges {
+		res.BytesBefore += diskBytes(m)
+	}
+	for _, m := range merges {
+		// nil options merge down to a single segment
+		if err := m.ForceMerge(ctx, nil); err != nil {
+			return res, err
+		}
+		res.BytesAfter += diskBytes(m)
+	}
+	res.DurationMS = time.Since(start).Milliseconds()
+	return res, nil
+}
+
+func diskBytes(m mergeableIndex) uint64 {
+	n, _ := m.StatsMap()["CurOnDiskBytes"].(uint64)
+	return n
+}
+
+// runOptimize is the "optimize" command. It needs the server to be stopped,
+// since only one process can hold the index open.
+func runOptimize(args []string) error {
+	fs, opts := newFlagSet("optimize", "[flags]", false)
+	fs.Parse(args)
+	if err := opts.apply(); err != nil {
+		return err
+	}
+
+	idx, err := openIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	res, err := optimizeIndex(context.Background(), idx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Optimized %s in %dms: %d bytes before, %d bytes after\n", indexPath, res.DurationMS, res.BytesBefore, res.BytesAfter)
+	return nil
+}
+
+// handleOptimize compacts the live index. Searches keep being served
+// while the merge runs.
+func handleOptimize(w http.ResponseWriter, r *http.Request) {
+	res, err := optimizeIndex(r.Context(), index)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
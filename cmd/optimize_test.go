@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// newSegmentedIndex creates an index at path and indexes a few pages into
+// it one at a time
+func newSegmentedIndex(t *testing.T, path string) bleve.Index {
+	t.Helper()
+	idx, err := bleve.New(path, newIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"Pooling", "Sharding", "Caching"} {
+		doc := filepath.Join(root, strings.ToLower(title)+".html")
+		if err := idx.Index(doc, Document{Title: title, Content: title, URL: doc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return idx
+}
+
+func TestOptimizeCommand(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := newSegmentedIndex(t, indexPath).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := runOptimize([]string{"-config", filepath.Join(dir, "missing.json")}); err == nil || !strings.Contains(err.Error(), "loading config") {
+		t.Errorf("missing config: err = %v, want a config error", err)
+	}
+
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"slow_query_ms": 250}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	docs := filepath.Join(dir, "docs")
+	if err := runOptimize([]string{"-config", cfgPath, "-path", docs}); err != nil {
+		t.Fatal(err)
+	}
+	if config.SlowQueryMS != 250 || root != docs {
+		t.Errorf("config and root not applied: slow_query_ms = %d, root = %s", config.SlowQueryMS, root)
+	}
+}
+
+func TestHandleOptimize(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := newSegmentedIndex(t, filepath.Join(t.TempDir(), "index.bleve"))
+	defer idx.Close()
+	old := index
+	index = idx
+	t.Cleanup(func() { index = old })
+
+	rec := serve(http.HandlerFunc(handleOptimize), httptest.NewRequest(http.MethodPost, "/api/admin/optimize", nil))
+	var res OptimizeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("optimize = %d %+v, %v", rec.Code, res, err)
+	}
+	if res.BytesBefore == 0 || res.BytesAfter == 0 {
+		t.Errorf("sizes not reported: %+v", res)
+	}
+	if n, err := idx.DocCount(); err != nil || n != 3 {
+		t.Errorf("documents after optimizing = %d, %v, want 3", n, err)
+	}
+}
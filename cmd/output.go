@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// outputFields maps the -fields names of the search command to values
+var outputFields = map[string]func(Document) string{
+	"title":   func(d Document) string { return d.Title },
+	"url":     func(d Document) string { return d.URL },
+	"docset":  func(d Document) string { return d.Docset },
+	"content": func(d Document) string { return d.Content },
+}
+
+// defaultOutputFields keep the table readable and give scripts everything
+var defaultOutputFields = map[string][]string{
+	"table": {"title", "url", "docset"},
+	"json":  {"title", "url", "docset", "content"},
+	"plain": {"title", "url"},
+}
+
+func parseOutputFields(list, format string) ([]string, error) {
+	defaults, ok := defaultOutputFields[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, want table, json or plain", format)
+	}
+	if list == "" {
+		return defaults, nil
+	}
+
+	var fields []string
+	for _, f := range strings.Split(list, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if _, ok := outputFields[f]; !ok {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// writeResults prints search results for the terminal or for other tools:
+// an aligned table, a JSON array, or one tab-separated line per result
+func writeResults(w io.Writer, results []Document, format string, fields []string) error {
+	switch format {
+	case "json":
+		rows := make([]map[string]string, 0, len(results))
+		for _, doc := range results {
+			row := make(map[string]string, len(fields))
+			for _, f := range fields {
+				row[f] = outputFields[f](doc)
+			}
+			rows = append(rows, row)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(fields, "\t")))
+		for _, doc := range results {
+			fmt.Fprintln(tw, strings.Join(resultRow(doc, fields, 60), "\t"))
+		}
+		return tw.Flush()
+
+	default:
+		for _, doc := range results {
+			if _, err := fmt.Fprintln(w, strings.Join(resultRow(doc, fields, 0), "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// resultRow returns the fields of doc on a single line each, cut to max
+// characters when max is positive
+func resultRow(doc Document, fields []string, max int) []string {
+	row := make([]string, len(fields))
+	for i, f := range fields {
+		v := strings.Join(strings.Fields(outputFields[f](doc)), " ")
+		if max > 0 {
+			v = truncate(v, max)
+		}
+		row[i] = v
+	}
+	return row
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+var outputDocs = []Document{
+	{Title: "Connection pooling", URL: "guides/pool.html", Docset: "guides", Content: "Pools keep\n connections open."},
+	{Title: "Timeouts", URL: "guides/timeouts.html", Docset: "guides"},
+}
+
+func TestWriteResultsPlain(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeResults(&buf, outputDocs, "plain", []string{"url", "content"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "guides/pool.html\tPools keep connections open.\nguides/timeouts.html\t\n"
+	if buf.String() != want {
+		t.Errorf("plain output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteResultsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeResults(&buf, outputDocs, "json", []string{"title", "docset"}); err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["title"] != "Connection pooling" || rows[1]["docset"] != "guides" || len(rows[0]) != 2 {
+		t.Errorf("json rows = %v", rows)
+	}
+}
+
+func TestParseOutputFields(t *testing.T) {
+	if _, err := parseOutputFields("", "yaml"); err == nil {
+		t.Error("unknown format was accepted")
+	}
+	if _, err := parseOutputFields("title,score", "json"); err == nil {
+		t.Error("unknown field was accepted")
+	}
+	if fields, _ := parseOutputFields(" URL, title", "table"); len(fields) != 2 || fields[0] != "url" {
+		t.Errorf("fields = %v", fields)
+	}
+}
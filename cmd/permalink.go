@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const shortLinksBucket = "short_links"
+
+// maxPage is the last page of results that can be shown; deep pages get
+// slow and nobody reads them
+const maxPage = 100
+
+// viewParamNames are the preferences a URL may override for one request
+var viewParamNames = []string{"sort", "per_page", "version"}
+
+// ShortLink is a short name for a permalink
+type ShortLink struct {
+	ID      string    `json:"id"`
+	URL     string    `json:"url"`
+	Params  string    `json:"params"`
+	Created time.Time `json:"created"`
+}
+
+// pageFromRequest reads page=, 1 when missing
+func pageFromRequest(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("page")
+	if v == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxPage {
+		return 0, errors.New("page must be between 1 and " + strconv.Itoa(maxPage))
+	}
+	return n, nil
+}
+
+// permalinkParams spells out everything that decides what a search page
+// shows: the search parameters, the view preferences in effect and the
+// page. The version is kept even when empty, so the link also unpins a
+// version pinned by whoever opens it.
+func permalinkParams(params url.Values, prefs Preferences, page int) string {
+	kept, _ := url.ParseQuery(searchParams(params))
+	kept.Set("sort", prefs.Sort)
+	kept.Set("per_page", strconv.Itoa(prefs.PerPage))
+	kept.Set("version", prefs.Version)
+	if page > 1 {
+		kept.Set("page", strconv.Itoa(page))
+	}
+	return kept.Encode()
+}
+
+// withoutViewParams is params without the view overrides of a permalink
+func withoutViewParams(params url.Values) string {
+	rest := make(url.Values, len(params))
+	for k, v := range params {
+		if !contains(viewParamNames, k) {
+			rest[k] = v
+		}
+	}
+	return rest.Encode()
+}
+
+// canonicalParams validates the query of a search URL and puts it in the
+// order permalinkParams uses, so equal views get equal short links
+func canonicalParams(raw string) (string, error) {
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "/search"), "?")
+	params, err := url.ParseQuery(raw)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(params.Get("q")) == "" {
+		return "", errors.New("params must include q")
+	}
+	r := &http.Request{URL: &url.URL{RawQuery: raw}}
+	page, err := pageFromRequest(r)
+	if err != nil {
+		return "", err
+	}
+	// the preferences come from the parameters alone, not the caller's
+	// cookie, so what is linked is what was asked for
+	return permalinkParams(params, preferencesFromRequest(r), page), nil
+}
+
+// shortLinkID derives the ID from the params, so the same view always gets
+// the same link and links can't be enumerated
+func shortLinkID(params string) string {
+	sum := sha256.Sum256([]byte(params))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:10]
+}
+
+// createShortLink stores a short link for params, or returns the existing
+// one
+func createShortLink(params string) (ShortLink, error) {
+	canonical, err := canonicalParams(params)
+	if err != nil {
+		return ShortLink{}, err
+	}
+	var link ShortLink
+	id := shortLinkID(canonical)
+	found, err := storeGet(shortLinksBucket, id, &link)
+	if err != nil || found {
+		return link, err
+	}
+	link = ShortLink{ID: id, URL: absoluteURL("/s/" + id), Params: canonical, Created: time.Now().UTC()}
+	return link, storePut(shortLinksBucket, id, link)
+}
+
+// shortLinkFor returns the short link named by id when it points at
+// permalink, for showing it on the page it leads to
+func shortLinkFor(id, permalink string) string {
+	if id == "" || store == nil {
+		return ""
+	}
+	var link ShortLink
+	if found, err := storeGet(shortLinksBucket, id, &link); err != nil || !found || "/search?"+link.Params != permalink {
+		return ""
+	}
+	return link.URL
+}
+
+func handleCreateShortLink(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Params string `json:"params"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if store == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "short links need a database")
+		return
+	}
+	link, err := createShortLink(req.Params)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, link)
+}
+
+// handleShortLinkForm makes a short link for the search page and goes back
+// to it, where the link is shown
+func handleShortLinkForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || store == nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	link, err := createShortLink(r.PostForm.Get("params"))
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/search?"+link.Params+"&short="+link.ID, http.StatusSeeOther)
+}
+
+// handleShortLink sends a short link on to the search it names
+func handleShortLink(w http.ResponseWriter, r *http.Request) {
+	var link ShortLink
+	found := false
+	if store != nil {
+		var err error
+		if found, err = storeGet(shortLinksBucket, r.PathValue("id"), &link); err != nil {
+			log.Printf("Error loading short link: %v", err)
+			renderError(w, r, http.StatusInternalServerError)
+			return
+		}
+	}
+	if !found {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, "/search?"+link.Params, http.StatusFound)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPermalinkParams(t *testing.T) {
+	params, _ := url.ParseQuery("type=md&q=pool&lang=de&short=x&page=4")
+	prefs := Preferences{Sort: "newest", PerPage: 20}
+	if got, want := permalinkParams(params, prefs, 2), "page=2&per_page=20&q=pool&sort=newest&type=md&version="; got != want {
+		t.Errorf("permalinkParams = %q, want %q", got, want)
+	}
+
+	canonical, err := canonicalParams("/search?sort=newest&q=pool")
+	if err != nil || canonical != "per_page=10&q=pool&sort=newest&version=" {
+		t.Errorf("canonicalParams = %q, %v", canonical, err)
+	}
+	for _, bad := range []string{"type=md", "q=pool&page=0", "q=pool&page=1000"} {
+		if _, err := canonicalParams(bad); err == nil {
+			t.Errorf("canonicalParams(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestPreferencesFromURL(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/search?q=pool&sort=newest&per_page=50&theme=dark", nil)
+	r.AddCookie(&http.Cookie{Name: prefsCookieName, Value: "sort=relevance&per_page=20&theme=light"})
+	prefs := preferencesFromRequest(r)
+	// only the view settings can be overridden
+	if prefs.Sort != "newest" || prefs.PerPage != 50 || prefs.Theme != "light" {
+		t.Errorf("prefs = %+v", prefs)
+	}
+	if got := withoutViewParams(r.URL.Query()); got != "q=pool&theme=dark" {
+		t.Errorf("withoutViewParams = %q", got)
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, Config{})
+	withRoot(t, "/docs")
+	docs := map[string]string{}
+	for i := 0; i < 25; i++ {
+		docs[fmt.Sprintf("pool%02d.html", i)] = "connection pooling"
+	}
+	withIndex(t, docs)
+
+	search := func(target string) (searchView, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		view, _ := runPageSearch(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return view, rec
+	}
+
+	first, _ := search("/search?q=pooling")
+	if len(first.Results) != 10 || first.PrevPage != "" || first.NextPage != "/search?page=2&per_page=10&q=pooling&sort=relevance&version=" {
+		t.Errorf("page 1: %d results, prev %q, next %q", len(first.Results), first.PrevPage, first.NextPage)
+	}
+	last, _ := search("/search?q=pooling&page=3")
+	if len(last.Results) != 5 || last.PrevPage == "" || last.NextPage != "" || last.PageNum != 3 {
+		t.Errorf("page 3: %d results, prev %q, next %q", len(last.Results), last.PrevPage, last.NextPage)
+	}
+	seen := map[string]bool{}
+	for _, target := range []string{"/search?q=pooling", "/search?q=pooling&page=2", "/search?q=pooling&page=3"} {
+		view, _ := search(target)
+		for _, doc := range view.Results {
+			if seen[doc.URL] {
+				t.Errorf("%s repeats %s", target, doc.URL)
+			}
+			seen[doc.URL] = true
+		}
+	}
+	if _, rec := search("/search?q=pooling&page=-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("page=-1 = %d, want 400", rec.Code)
+	}
+}
+
+func TestShortLinks(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, Config{BaseURL: "https://docs.example.com"})
+	withStore(t)
+
+	link, err := createShortLink("q=pool&sort=newest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := createShortLink("/search?sort=newest&q=pool&per_page=10")
+	if err != nil || again.ID != link.ID || link.URL != "https://docs.example.com/s/"+link.ID {
+		t.Errorf("links for the same view = %+v, %+v, %v", link, again, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/s/"+link.ID, nil)
+	req.SetPathValue("id", link.ID)
+	rec := serve(http.HandlerFunc(handleShortLink), req)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/search?"+link.Params {
+		t.Errorf("short link = %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := shortLinkFor(link.ID, "/search?"+link.Params); got != link.URL {
+		t.Errorf("shortLinkFor = %q", got)
+	}
+	if got := shortLinkFor(link.ID, "/search?q=other"); got != "" {
+		t.Errorf("shortLinkFor another view = %q, want none", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/s/nope", nil)
+	req.SetPathValue("id", "nope")
+	if rec := serve(http.HandlerFunc(handleShortLink), req); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown short link = %d, want 404", rec.Code)
+	}
+
+	form := httptest.NewRequest(http.MethodPost, "/search/link", strings.NewReader("params="+url.QueryEscape("/search?q=pool&sort=newest")))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = serve(http.HandlerFunc(handleShortLinkForm), form)
+	if rec.Code != http.StatusSeeOther || !strings.HasSuffix(rec.Header().Get("Location"), "&short="+link.ID) {
+		t.Errorf("short link form = %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	api := httptest.NewRequest(http.MethodPost, "/api/links", strings.NewReader(`{"params": "type=md"}`))
+	if rec := serve(http.HandlerFunc(handleCreateShortLink), api); rec.Code != http.StatusBadRequest {
+		t.Errorf("short link without q = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const prefsCookieName = "godochive_prefs"
+
+// Preferences are per-browser display settings, kept in a cookie so they
+// work without logging in
+type Preferences struct {
+	Theme   string // "auto", "light" or "dark"
+	PerPage int
+	Sort    string // "relevance", "recent" or "newest"
+	// Version is the pinned docset version, empty for all versions
+	Version string
+	// History is "on" to remember recent queries. It is "off" until turned
+	// on, so clients that never opt in leave nothing in the database.
+	History string
+}
+
+var (
+	themes        = []string{"auto", "light", "dark"}
+	perPageSizes  = []int{10, 20, 50}
+	sortOrders    = []string{"relevance", "recent", "newest"}
+	historyModes  = []string{"on", "off"}
+	defaultPrefs  = Preferences{Theme: "auto", PerPage: 10, Sort: "relevance", History: "off"}
+	sortOrderKeys = map[string][]string{
+		// left to bleve's order and the rankers, see searchRanked
+		"relevance": nil,
+		"recent":    nil,
+		"newest":    {"-ModifiedAt", "-_score"},
+	}
+)
+
+// preferencesFromRequest reads the preferences cookie, falling back to the
+// default for every missing or unknown value. The view settings in
+// viewParamNames may be overridden by the URL, so a permalink shows the
+// same results whatever the cookie says.
+func preferencesFromRequest(r *http.Request) Preferences {
+	prefs := defaultPrefs
+	if c, err := r.Cookie(prefsCookieName); err == nil {
+		if values, err := url.ParseQuery(c.Value); err == nil {
+			prefs = prefs.merge(values)
+		}
+	}
+	overrides := url.Values{}
+	for _, name := range viewParamNames {
+		if v, ok := r.URL.Query()[name]; ok {
+			overrides[name] = v
+		}
+	}
+	return prefs.merge(overrides)
+}
+
+// merge overrides p with the valid settings in values
+func (p Preferences) merge(values url.Values) Preferences {
+	if theme := values.Get("theme"); contains(themes, theme) {
+		p.Theme = theme
+	}
+	if n, err := strconv.Atoi(values.Get("per_page")); err == nil {
+		for _, size := range perPageSizes {
+			if n == size {
+				p.PerPage = n
+			}
+		}
+	}
+	if sort := values.Get("sort"); contains(sortOrders, sort) {
+		p.Sort = sort
+	}
+	if history := values.Get("history"); contains(historyModes, history) {
+		p.History = history
+	}
+	// an empty version unpins, so check for presence rather than value
+	if v, ok := values["version"]; ok && (v[0] == "" || contains(versions(), v[0])) {
+		p.Version = v[0]
+	}
+	return p
+}
+
+func (p Preferences) sortBy() []string {
+	return sortOrderKeys[p.Sort]
+}
+
+func handlePreferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		prefs := preferencesFromRequest(r)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		prefs = prefs.merge(r.PostForm)
+		if r.PostForm.Get("defaults") == "1" {
+			if err := saveSearchDefaults(r, defaultsFromForm(r)); err != nil {
+				log.Printf("Error saving search defaults: %v", err)
+				renderError(w, r, http.StatusInternalServerError)
+				return
+			}
+		}
+		if prefs.History == "off" {
+			owner, _ := visitorKey(r)
+			if err := clearHistory(owner); err != nil {
+				log.Printf("Error clearing search history: %v", err)
+			}
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name: prefsCookieName,
+			Value: url.Values{
+				"theme":    {prefs.Theme},
+				"per_page": {strconv.Itoa(prefs.PerPage)},
+				"sort":     {prefs.Sort},
+				"version":  {prefs.Version},
+				"history":  {prefs.History},
+			}.Encode(),
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			Secure:   isSecureRequest(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, safeRedirectPath(r.PostForm.Get("next")), http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Page
+		Themes       []string
+		PerPageSizes []int
+		SortOrders   []string
+		HistoryModes []string
+		Versions     []string
+		Next         string
+		// SignedIn users also get search defaults, kept on the server
+		SignedIn           bool
+		Docsets, Languages []filterOption
+	}{
+		Page:         newPage(r, "prefs.title"),
+		Themes:       themes,
+		PerPageSizes: perPageSizes,
+		SortOrders:   sortOrders,
+		HistoryModes: historyModes,
+		Versions:     versions(),
+		Next:         "/search",
+	}
+	if _, ok := principalFromContext(r.Context()); ok && store != nil {
+		defaults := searchDefaultsFor(r)
+		data.SignedIn = true
+		data.Docsets = docsetOptions(r, defaults.Docsets)
+		data.Languages = languageOptions(defaults.Language)
+	}
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && ref.Path != "/preferences" {
+		ref.RawQuery = withoutViewParams(ref.Query())
+		data.Next = safeRedirectPath(ref.RequestURI())
+	}
+	renderTemplate(w, "preferences.html", data)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPreferencesCookieRoundTrip(t *testing.T) {
+	form := url.Values{"theme": {"dark"}, "per_page": {"50"}, "sort": {"newest"}, "history": {"on"}, "next": {"/search?q=pool"}}
+	r := httptest.NewRequest(http.MethodPost, "/preferences", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := serve(http.HandlerFunc(handlePreferences), r)
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/search?q=pool" {
+		t.Fatalf("got %d to %q, want redirect back to the search", rec.Code, rec.Header().Get("Location"))
+	}
+
+	next := httptest.NewRequest(http.MethodGet, "/search", nil)
+	for _, c := range rec.Result().Cookies() {
+		next.AddCookie(c)
+	}
+	want := Preferences{Theme: "dark", PerPage: 50, Sort: "newest", History: "on"}
+	if got := preferencesFromRequest(next); got != want {
+		t.Errorf("preferences = %+v, want %+v", got, want)
+	}
+}
+
+func TestPreferencesRejectInvalidValues(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/search", nil)
+	r.AddCookie(&http.Cookie{Name: prefsCookieName, Value: "theme=neon&per_page=100000&sort=-_id"})
+
+	if got := preferencesFromRequest(r); got != defaultPrefs {
+		t.Errorf("preferences = %+v, want the defaults", got)
+	}
+}
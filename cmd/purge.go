@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// purgeInterval is how often the server looks for documents whose files
+// were deleted
+const purgeInterval = 5 * time.Minute
+
+// purgeDeletedFiles deletes the documents of files that were deleted or
+// renamed since idx was built, with their examples and sections, and
+// returns how many it deleted
+func purgeDeletedFiles(idx bleve.Index) (int, error) {
+	ids, err := indexedIDs(idx)
+	if err != nil {
+		return 0, err
+	}
+	batch := newBatcher(idx)
+	gone := make(map[string]bool)
+	deleted := 0
+	for _, id := range ids {
+		page, _, _ := strings.Cut(id, "#")
+		missing, checked := gone[page]
+		if !checked {
+			_, err := os.Stat(sourceFile(page))
+			missing = errors.Is(err, os.ErrNotExist)
+			gone[page] = missing
+		}
+		if !missing {
+			continue
+		}
+		if err := batch.Delete(id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, batch.Flush()
+}
+
+// watchDeletedFiles purges the documents of deleted files from the served
+// index between runs of the index command, so results don't link to pages
+// that are gone
+func watchDeletedFiles(l *liveIndex) {
+	for range time.Tick(purgeInterval) {
+		if l.unavailable.Load() {
+			continue
+		}
+		n, err := purgeDeletedFiles(l)
+		if err != nil {
+			log.Printf("Error purging the documents of deleted files: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Purged %d documents of deleted files", n)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPurgeDeletedFiles(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+
+	pages := map[string]string{
+		"pool.html":  `<title>Pooling</title><p>connections are pooled</p><h2 id="limits">Limits</h2><p>pools are capped</p>`,
+		"retry.html": "<title>Retries</title><p>requests are retried</p>",
+	}
+	for name, page := range pages {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(page), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := purgeDeletedFiles(index); err != nil || n != 0 {
+		t.Fatalf("purge with every file present deleted %d, %v", n, err)
+	}
+	if err := os.Rename(filepath.Join(dir, "pool.html"), filepath.Join(dir, "pooling.html")); err != nil {
+		t.Fatal(err)
+	}
+	// the page and its section
+	if n, err := purgeDeletedFiles(index); err != nil || n != 2 {
+		t.Fatalf("purge deleted %d, %v, want 2", n, err)
+	}
+	ids, err := indexedIDs(index)
+	if err != nil || len(ids) != 1 || ids[0] != filepath.Join(dir, "retry.html") {
+		t.Errorf("documents left = %v, %v", ids, err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// headingsBoost is how much more a match in a heading counts than one in
+// the body text. It and deprecatedPenalty are only changed by "godochive
+// replay", to try other values.
+var headingsBoost = 3.0
+
+// symbolBoost and membersBoost are how much more a match in the name of
+// the class an API page documents, or of one of its members, counts than
+// one in the body text. The class page should come before the pages that
+// only mention it.
+var (
+	symbolBoost  = 5.0
+	membersBoost = 2.0
+)
+
+// deprecatedPenalty scales the score of deprecated documents, so they rank
+// below current documents that match about as well
+var deprecatedPenalty = 0.8
+
+// codeOperator finds code:<snippet> and code:"<snippet with spaces>"
+var codeOperator = regexp.MustCompile(`(?:^|\s)code:("[^"]*"|\S+)`)
+
+// newTextQuery turns what a user typed into a query. Each code:<snippet>
+// must appear in a code block and each tag:<name> be on the document, the
+// remaining words and their synonyms anywhere in the document.
+func newTextQuery(text string) query.Query {
+	var must []query.Query
+	for _, m := range codeOperator.FindAllStringSubmatch(text, -1) {
+		if code := strings.Trim(m[1], `"`); code != "" {
+			pq := bleve.NewMatchPhraseQuery(code)
+			pq.SetField("CodeBlocks")
+			must = append(must, pq)
+		}
+	}
+
+	rest := codeOperator.ReplaceAllString(text, " ")
+	for _, m := range tagOperator.FindAllStringSubmatch(rest, -1) {
+		tq := bleve.NewTermQuery(strings.ToLower(m[1]))
+		tq.SetField("Tags")
+		must = append(must, tq)
+	}
+	rest = strings.TrimSpace(tagOperator.ReplaceAllString(rest, " "))
+	if rest != "" || len(must) == 0 {
+		must = append(must, matchAnywhere(expandSynonyms(rest)))
+	}
+	if len(must) == 1 {
+		return must[0]
+	}
+	return bleve.NewConjunctionQuery(must...)
+}
+
+// codeWord finds the quoted snippets and words of a query
+var codeWord = regexp.MustCompile(`"[^"]*"|\S+`)
+
+// codeOnly rewrites text so that every word and quoted snippet has to be
+// in a code block, as if each had the code: operator. tag: and code:
+// terms are kept as they are.
+func codeOnly(text string) string {
+	return codeWord.ReplaceAllStringFunc(text, func(w string) string {
+		if strings.HasPrefix(w, "code:") || tagOperator.MatchString(w) || w == `""` {
+			return w
+		}
+		return "code:" + w
+	})
+}
+
+// textQuery is newTextQuery, matching only code blocks when the filter
+// asks for that
+func (f searchFilter) textQuery(text string) query.Query {
+	if f.CodeOnly {
+		text = codeOnly(text)
+	}
+	return newTextQuery(text)
+}
+
+// matchAnywhere matches text anywhere in a document and ranks documents
+// higher when it appears in their headings or, for API docs, class and
+// member names. Headings are part of the content too, so that clause only
+// affects scoring. Names are analyzed by the code analyzer, which splits
+// "java.util.HashMap" into terms the content doesn't have, so those clauses
+// also find API pages the other clauses miss.
+// The text is analyzed like each document's language, see language.go.
+func matchAnywhere(text string) query.Query {
+	return matchInLanguages(func(analyzer string) query.Query {
+		// the title and content are in _all, analyzed each their own way
+		// when the config sets analyzers for them
+		analyzers := []string{fieldAnalyzer("Title", analyzer)}
+		if a := fieldAnalyzer("Content", analyzer); a != analyzers[0] {
+			analyzers = append(analyzers, a)
+		}
+		var clauses []query.Query
+		for _, a := range analyzers {
+			all := bleve.NewMatchQuery(text)
+			all.Analyzer = a
+			clauses = append(clauses, all)
+		}
+		headings := bleve.NewMatchQuery(text)
+		headings.SetField("Headings")
+		headings.Analyzer = fieldAnalyzer("Headings", analyzer)
+		headings.SetBoost(headingsBoost)
+		clauses = append(clauses, headings)
+		// in a fixed order, so the query reads the same in logs every time
+		for _, f := range []struct {
+			field string
+			boost float64
+		}{{"Symbol", symbolBoost}, {"Members", membersBoost}} {
+			names := bleve.NewMatchQuery(text)
+			names.SetField(f.field)
+			names.Analyzer = codeAnalyzer
+			names.SetBoost(f.boost)
+			clauses = append(clauses, names)
+		}
+		return bleve.NewDisjunctionQuery(clauses...)
+	})
+}
+
+// searchFilter narrows a search down beyond what the user typed
+type searchFilter struct {
+	// Types are the file types to include, all when empty
+	Types []string
+	// Version is the pinned docset version, all when empty
+	Version string
+	// Denied are the docsets the caller may not see
+	Denied []string
+	// Since and Until limit ModifiedAt; zero leaves that end open
+	Since, Until time.Time
+	// Tags must all be on a document, none when empty
+	Tags []string
+	// CodeOnly matches the words of the query in code blocks only
+	CodeOnly bool
+	// Docsets are the docsets to search, all when empty
+	Docsets []string
+	// Language is the detected language documents must have, any when
+	// empty
+	Language string
+	// Trust is the trust level documents must have, any when empty
+	Trust string
+	// Recent applies the recency ranker to every docset, for the "recent"
+	// sort order
+	Recent bool
+}
+
+// rankers are the rankers the filter adds to those of each docset
+func (f searchFilter) rankers() []string {
+	if f.Recent {
+		return []string{"recency"}
+	}
+	return nil
+}
+
+// filterFromRequest combines the type and date parameters, the pinned
+// version and the caller's docset access
+func filterFromRequest(r *http.Request) (searchFilter, error) {
+	since, until, err := updatedWindow(r.URL.Query(), time.Now())
+	if err != nil {
+		return searchFilter{}, err
+	}
+	prefs := preferencesFromRequest(r)
+	return searchFilter{
+		Types:    typesFromRequest(r),
+		Version:  prefs.Version,
+		Denied:   deniedDocsets(r.Context()),
+		Since:    since,
+		Until:    until,
+		Tags:     parseTags(r.URL.Query()["tag"]...),
+		CodeOnly: r.URL.Query().Get("code") == "1",
+		Docsets:  parseDocsets(r.URL.Query()["docset"]...),
+		Language: languageFromRequest(r),
+		Trust:    trustFromRequest(r),
+		Recent:   prefs.Sort == "recent",
+	}, nil
+}
+
+func (f searchFilter) apply(q query.Query) query.Query {
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		modified := bleve.NewDateRangeQuery(f.Since, f.Until)
+		modified.SetField("ModifiedAt")
+		q = bleve.NewConjunctionQuery(q, modified)
+	}
+	q = filterTrust(filterLanguage(filterDocsets(q, f.Docsets), f.Language), f.Trust)
+	return restrictQuery(restrictVersion(filterTypes(filterTags(q, f.Tags), f.Types), f.Version), f.Denied)
+}
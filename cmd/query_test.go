@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// withEmptyIndex installs a fresh in-memory index as the global index
+func withEmptyIndex(t *testing.T) bleve.Index {
+	t.Helper()
+	idx, err := bleve.NewMemOnly(newIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := index
+	index = idx
+	t.Cleanup(func() {
+		idx.Close()
+		index = old
+	})
+	return idx
+}
+
+func TestHeadingMatchesRankFirst(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	docs := map[string]Document{
+		"mention.html": {Title: "Databases", Content: "Pooling: the database driver covers pooling of sockets."},
+		"heading.html": {Title: "Databases", Content: "Connection pooling. Tuning the database driver covers sockets.", Headings: "Connection pooling"},
+	}
+	for name, doc := range docs {
+		doc.URL = filepath.Join(root, name)
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := performSearch("pooling", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].URL != "heading.html" {
+		t.Errorf("results = %+v, want heading.html first", results)
+	}
+}
+
+func TestMatchAnywhereIsStable(t *testing.T) {
+	withConfig(t, Config{})
+	first, err := json.Marshal(matchAnywhere("connection pool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if again, _ := json.Marshal(matchAnywhere("connection pool")); string(again) != string(first) {
+			t.Fatalf("query changed between runs:\n%s\n%s", first, again)
+		}
+	}
+}
+
+func TestCodeOperatorSearchesCodeBlocks(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	pages := map[string]string{
+		"sample.html": `<p>Cancel slow calls.</p><pre><span>ctx</span>, cancel := <span>context</span>.<span>WithTimeout</span>(ctx, time.Second)</pre>`,
+		"prose.html":  `<p>Use context.WithTimeout to cancel slow calls.</p>`,
+	}
+	for name, html := range pages {
+		page := extractPage(html)
+		doc := Document{Title: name, Content: page.Content, URL: filepath.Join(root, name), CodeBlocks: page.CodeBlocks}
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		codeOnly bool
+		want     []string
+	}{
+		{"code:context.WithTimeout", false, []string{"sample.html"}},
+		{`code:"cancel := context"`, false, []string{"sample.html"}},
+		{"code:context.WithTimeout slow", false, []string{"sample.html"}},
+		{"code:WithTimeout.context", false, nil},
+		{"slow", false, []string{"prose.html", "sample.html"}},
+		{"context.WithTimeout", true, []string{"sample.html"}},
+		{"ctx.WithTimeout", true, nil},
+		{`"ctx, cancel" time.Second`, true, []string{"sample.html"}},
+		{"slow", true, nil},
+	}
+	for _, tt := range tests {
+		results, err := performSearch(tt.query, searchFilter{CodeOnly: tt.codeOnly}, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.URL)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s (code only %v): results = %v, want %v", tt.query, tt.codeOnly, got, tt.want)
+		}
+	}
+}
+
+func TestCodeOnly(t *testing.T) {
+	tests := map[string]string{
+		"ctx.WithTimeout":                 "code:ctx.WithTimeout",
+		`"ctx, cancel" deadline`:          `code:"ctx, cancel" code:deadline`,
+		"code:select tag:networking pool": "code:select tag:networking code:pool",
+		`""`:                              `""`,
+	}
+	for text, want := range tests {
+		if got := codeOnly(text); got != want {
+			t.Errorf("codeOnly(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestDeprecationDetected(t *testing.T) {
+	tests := map[string]bool{
+		`<p>Dial connects to a server.</p><p>Deprecated: use DialContext.</p>`:         true,
+		`<div class="admonition deprecation-notice">Use v2 instead.</div><p>Dial.</p>`: true,
+		"# Dial\n\nDeprecated: use DialContext.\n":                                     true,
+		`<p>Dial connects to a server. Nothing here is deprecated.</p>`:                false,
+	}
+	for page, want := range tests {
+		if got := extractPage(page).Deprecated; got != want {
+			t.Errorf("extractPage(%q).Deprecated = %v, want %v", page, got, want)
+		}
+	}
+}
+
+func TestDeprecatedDocumentsRankLower(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	// identical text, so without the penalty the order is arbitrary
+	docs := map[string]Document{
+		"old.html": {Title: "Dial", Content: "Dial connects to a server.", Deprecated: true},
+		"new.html": {Title: "Dial", Content: "Dial connects to a server."},
+	}
+	for name, doc := range docs {
+		doc.URL = filepath.Join(root, name)
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := performSearch("dial", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].URL != "new.html" || !results[1].Deprecated {
+		t.Errorf("results = %+v, want new.html first and old.html flagged", results)
+	}
+
+	api, err := runAPISearch("dial", []string{"url"}, searchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(api.Hits) != 2 || api.Hits[0].Fields["url"] != "new.html" || api.Hits[1].Score >= api.Hits[0].Score {
+		t.Errorf("API hits = %+v, want new.html first", api.Hits)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+)
+
+// rerankDepth is how many of the best hits rankers reorder. Pages beyond
+// it keep bleve's order.
+const rerankDepth = 50
+
+// ranker adjusts the scores of the top hits of a search. Each docset picks
+// its rankers in the config, so new ranking strategies plug in here rather
+// than into the search handlers.
+type ranker interface {
+	// Rerank changes the Score of hits, reading their stored fields (see
+	// rankingFields) and the query text
+	Rerank(text string, hits []*search.DocumentMatch, now time.Time)
+}
+
+// rankers are the names accepted in DocsetConfig.Rankers, run in this
+// order
+var rankers = []struct {
+	name string
+	ranker
+}{
+	{"deprecated", deprecatedRanker{}},
+	{"recency", recencyRanker{}},
+}
+
+// defaultRankers apply to docsets that don't list their own
+var defaultRankers = []string{"deprecated"}
+
+// rankingFields are the stored fields rankers and collapseCopies read,
+// loaded with every ranked search
+var rankingFields = []string{"Docset", "Deprecated", "ModifiedAt", "Checksum"}
+
+func knownRanker(name string) bool {
+	for _, r := range rankers {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rankersFor returns the rankers configured for docset
+func rankersFor(docset string) []string {
+	for _, ds := range config.Docsets {
+		if ds.Name == docset && ds.Rankers != nil {
+			return ds.Rankers
+		}
+	}
+	return defaultRankers
+}
+
+// rerank runs the rankers of each hit's docset, and the extra ones the
+// search asked for, over hits and sorts them by the new scores. Use it on
+// hits sorted by relevance.
+func rerank(text string, hits search.DocumentMatchCollection, now time.Time, extra ...string) {
+	picked := make(map[string][]*search.DocumentMatch)
+	for _, hit := range hits {
+		docset, _ := hit.Fields["Docset"].(string)
+		names := rankersFor(docset)
+		for _, name := range extra {
+			if !contains(names, name) {
+				names = append(names[:len(names):len(names)], name)
+			}
+		}
+		for _, name := range names {
+			picked[name] = append(picked[name], hit)
+		}
+	}
+	for _, r := range rankers {
+		if len(picked[r.name]) > 0 {
+			r.Rerank(text, picked[r.name], now)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+}
+
+// searchRanked runs a search sorted by relevance with the rankers applied
+// to its best rerankDepth hits. The page req asks for is cut from the
+// reranked hits followed by the rest in bleve's order, so pages neither
+// overlap nor skip hits. Extra rankers apply to hits of every docset.
+// Copies of the same content among the reranked hits are shown once.
+func searchRanked(idx bleve.Index, req *bleve.SearchRequest, text string, extra ...string) (*bleve.SearchResult, error) {
+	from, size := req.From, req.Size
+	req.Fields = append(req.Fields, rankingFields...)
+	if from >= rerankDepth {
+		return idx.Search(req)
+	}
+	req.From, req.Size = 0, max(from+size, rerankDepth)
+	result, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	n := min(rerankDepth, len(result.Hits))
+	rerank(text, result.Hits[:n], time.Now(), extra...)
+	kept, copies := collapseCopies(result.Hits[:n])
+	result.Hits = append(kept, result.Hits[n:]...)
+	result.Total -= uint64(copies)
+	result.Hits = result.Hits[min(from, len(result.Hits)):min(from+size, len(result.Hits))]
+	return result, nil
+}
+
+// deprecatedRanker applies deprecatedPenalty to hits whose stored
+// Deprecated field is set
+type deprecatedRanker struct{}
+
+func (deprecatedRanker) Rerank(_ string, hits []*search.DocumentMatch, _ time.Time) {
+	for _, hit := range hits {
+		if deprecated, _ := hit.Fields["Deprecated"].(bool); deprecated {
+			hit.Score *= deprecatedPenalty
+		}
+	}
+}
+
+const (
+	// defaultRecencyBoost is the most a just-modified document gains
+	defaultRecencyBoost = 0.2
+	// defaultRecencyHalfLifeDays is the age at which the gain has halved
+	defaultRecencyHalfLifeDays = 180
+)
+
+// recencyRanker favours recently modified documents, for docsets like
+// release notes where the newest page is usually the one wanted, and for
+// searches sorted by "recent". The gain decays exponentially with the age
+// of the document, see RankingConfig.
+type recencyRanker struct{}
+
+func (recencyRanker) Rerank(_ string, hits []*search.DocumentMatch, now time.Time) {
+	boost, halfLife := recencySettings()
+	for _, hit := range hits {
+		s, _ := hit.Fields["ModifiedAt"].(string)
+		modified, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			continue
+		}
+		age := max(now.Sub(modified), 0)
+		hit.Score *= 1 + boost*math.Exp2(-float64(age)/float64(halfLife))
+	}
+}
+
+// recencySettings returns the configured recency boost and half-life, or
+// their defaults
+func recencySettings() (float64, time.Duration) {
+	boost, days := defaultRecencyBoost, float64(defaultRecencyHalfLifeDays)
+	if config.Ranking.RecencyBoost > 0 {
+		boost = config.Ranking.RecencyBoost
+	}
+	if config.Ranking.RecencyHalfLifeDays > 0 {
+		days = config.Ranking.RecencyHalfLifeDays
+	}
+	return boost, time.Duration(days * float64(24*time.Hour))
+}
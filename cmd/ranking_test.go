@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRankersPerDocset(t *testing.T) {
+	withConfig(t, Config{Docsets: []DocsetConfig{
+		{Name: "releases", Path: "releases", Rankers: []string{"recency"}},
+		{Name: "archive", Path: "archive", Rankers: []string{}},
+	}})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	now := time.Now().UTC()
+	docs := []Document{
+		{Title: "v1", Content: "release notes", URL: "releases/v1.html", Docset: "releases", ModifiedAt: now.AddDate(-3, 0, 0)},
+		{Title: "v2", Content: "release notes", URL: "releases/v2.html", Docset: "releases", ModifiedAt: now.AddDate(0, 0, -1)},
+		{Title: "old", Content: "release notes", URL: "archive/old.html", Docset: "archive", Deprecated: true, ModifiedAt: now},
+		{Title: "guide", Content: "release notes", URL: "guides/guide.html", Docset: "guides", Deprecated: true, ModifiedAt: now},
+	}
+	for _, doc := range docs {
+		doc.URL = filepath.Join(root, doc.URL)
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := performSearch("release notes", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Title)
+	}
+	// recency lifts the new release; the archive docset turned the
+	// deprecation penalty off, the default docset keeps it
+	if len(got) != 4 || got[0] != "v2" || got[3] != "guide" {
+		t.Errorf("results = %v, want v2 first and the deprecated guide last", got)
+	}
+}
+
+func TestSearchRankedPages(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	// every other document is deprecated, so reranking moves about half
+	for i := 0; i < rerankDepth+20; i++ {
+		doc := Document{Title: fmt.Sprintf("doc %d", i), Content: strings.Repeat("pool ", 1+i%7), URL: filepath.Join(root, fmt.Sprintf("d%03d.html", i)), Deprecated: i%2 == 0}
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for page := 0; page < 4; page++ {
+		results, err := performSearchPage("pool", searchFilter{}, page*20, 20, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			if seen[r.URL] {
+				t.Errorf("page %d repeats %s", page+1, r.URL)
+			}
+			seen[r.URL] = true
+		}
+	}
+	if len(seen) != rerankDepth+20 {
+		t.Errorf("pages cover %d documents, want %d", len(seen), rerankDepth+20)
+	}
+}
+
+func TestUnknownRanker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"docsets": [{"name": "guides", "path": "guides", "rankers": ["clicks"]}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), `"clicks"`) {
+		t.Errorf("err = %v, want an unknown ranker error", err)
+	}
+}
+
+func TestRecentSortOrder(t *testing.T) {
+	withConfig(t, Config{Ranking: RankingConfig{RecencyBoost: 1, RecencyHalfLifeDays: 30}})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	now := time.Now().UTC()
+	// the stale copy matches a little better, so it wins on relevance alone
+	docs := []Document{
+		{Title: "design", Content: "design doc design", URL: "old/design.html", ModifiedAt: now.AddDate(-1, 0, 0)},
+		{Title: "design", Content: "design doc", URL: "new/design.html", ModifiedAt: now.AddDate(0, 0, -2)},
+	}
+	for _, doc := range docs {
+		doc.URL = filepath.Join(root, doc.URL)
+		if err := idx.Index(doc.URL, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for sort, want := range map[string]string{"relevance": "old/design.html", "recent": "new/design.html"} {
+		filter, err := filterFromRequest(httptest.NewRequest(http.MethodGet, "/search?q=design&sort="+sort, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := performSearch("design", filter, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[0].URL != want {
+			t.Errorf("sort=%s: first result = %v, want %s", sort, results, want)
+		}
+	}
+
+	if boost, halfLife := recencySettings(); boost != 1 || halfLife != 30*24*time.Hour {
+		t.Errorf("recency settings = %v, %v", boost, halfLife)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket for a single client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter is the rate limiter in use, or nil when rate limiting is disabled
+var limiter *rateLimiter
+
+// rateLimiter hands out one token bucket per client IP
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	rl := &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+	go rl.cleanup()
+	return rl
+}
+
+// allow takes a token for key. When the bucket is empty it returns false
+// and how long until the next token is available.
+func (rl *rateLimiter) allow(key string) (bool, time.Duration) {
+	return rl.allowN(key, 1)
+}
+
+// allowN charges n tokens for key. The request is admitted as long as at
+// least one token is left; the bucket may go into debt for the rest, which
+// delays the client's following requests accordingly.
+func (rl *rateLimiter) allowN(key string, n int) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens -= float64(n)
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	return false, wait
+}
+
+// cleanup drops buckets that have refilled completely, so forgetting them
+// changes nothing
+func (rl *rateLimiter) cleanup() {
+	for range time.Tick(time.Minute) {
+		rl.mu.Lock()
+		for key, b := range rl.buckets {
+			if b.tokens+time.Since(b.last).Seconds()*rl.rate >= rl.burst {
+				delete(rl.buckets, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// rateLimited reports whether limitRate charges r
+func rateLimited(r *http.Request) bool {
+	return r.URL.Path == "/search" || r.URL.Path == "/search/results" || r.URL.Path == "/search/export" || strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// limitRate applies per-IP rate limiting to search requests and passes
+// everything else through
+func limitRate(rl *rateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rateLimited(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, wait := rl.allow(clientIP(r)); !ok {
+			tooManyRequests(w, r, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	if isAPIRequest(r) {
+		writeError(w, r, http.StatusTooManyRequests, "too many requests")
+		return
+	}
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+// clientIP returns the caller's address, honouring X-Forwarded-For only
+// when the server is configured to sit behind trusted proxies. Entries are
+// read from the right: the leftmost ones are supplied by the client and can
+// be forged, while each trusted proxy appends the address it saw.
+func clientIP(r *http.Request) string {
+	if config.RateLimit.TrustProxy {
+		var hops []string
+		for _, fwd := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(fwd, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+
+		trusted := config.RateLimit.TrustedHops
+		if trusted < 1 {
+			trusted = 1
+		}
+		if len(hops) >= trusted {
+			return hops[len(hops)-trusted]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
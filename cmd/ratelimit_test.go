@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestLimitRateRetryAfter(t *testing.T) {
+	h := limitRate(newRateLimiter(0.5, 2), okHandler)
+
+	for i := 0; i < 2; i++ {
+		if rec := serve(h, httptest.NewRequest(http.MethodGet, "/search?q=x", nil)); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within burst: status = %d", i, rec.Code)
+		}
+	}
+
+	rec := serve(h, httptest.NewRequest(http.MethodGet, "/search?q=x", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request after burst: status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	// one token at 0.5/s takes two seconds to refill
+	if got, _ := strconv.Atoi(rec.Header().Get("Retry-After")); got != 2 {
+		t.Errorf("Retry-After = %q, want 2", rec.Header().Get("Retry-After"))
+	}
+
+	if rec := serve(h, httptest.NewRequest(http.MethodGet, "/guide/index.html", nil)); rec.Code != http.StatusOK {
+		t.Errorf("static file was rate limited: status = %d", rec.Code)
+	}
+}
+
+func TestAllowNChargesDebt(t *testing.T) {
+	rl := newRateLimiter(1, 5)
+
+	if ok, _ := rl.allowN("c", 50); !ok {
+		t.Fatal("first batch rejected with a full bucket")
+	}
+	ok, wait := rl.allowN("c", 1)
+	if ok {
+		t.Fatal("request admitted while the bucket is in debt")
+	}
+	if wait.Seconds() < 45 {
+		t.Errorf("wait = %v, want the debt of the batch to be paid off first", wait)
+	}
+}
+
+func TestClientIPUsesRightmostForwardedFor(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/search", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "6.6.6.6, 203.0.113.7")
+
+	withConfig(t, Config{})
+	if got := clientIP(r); got != "10.0.0.1" {
+		t.Errorf("untrusted proxy: clientIP = %q, want 10.0.0.1", got)
+	}
+
+	withConfig(t, Config{RateLimit: RateLimitConfig{TrustProxy: true}})
+	if got := clientIP(r); got != "203.0.113.7" {
+		t.Errorf("one trusted hop: clientIP = %q, want 203.0.113.7", got)
+	}
+
+	withConfig(t, Config{RateLimit: RateLimitConfig{TrustProxy: true, TrustedHops: 2}})
+	if got := clientIP(r); got != "6.6.6.6" {
+		t.Errorf("two trusted hops: clientIP = %q, want 6.6.6.6", got)
+	}
+}
+
+func TestFailedAuthIsThrottled(t *testing.T) {
+	withConfig(t, Config{Auth: AuthConfig{Users: []AuthUser{{Name: "alice", Password: "s3cret"}}}})
+	old := limiter
+	limiter = newRateLimiter(0.1, 2)
+	t.Cleanup(func() { limiter = old })
+
+	h := limitRate(limiter, requireAuth(okHandler))
+	codes := make([]int, 4)
+	for i := range codes {
+		r := httptest.NewRequest(http.MethodGet, "/guide/index.html", nil)
+		r.SetBasicAuth("alice", "guess"+strconv.Itoa(i))
+		codes[i] = serve(h, r).Code
+	}
+	if codes[0] != http.StatusUnauthorized || codes[3] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want 401 first and 429 once the bucket is empty", codes)
+	}
+
+	// a failed search is charged by limitRate only, not again by requireAuth
+	limiter = newRateLimiter(0.1, 2)
+	h = limitRate(limiter, requireAuth(okHandler))
+	for i := range codes[:2] {
+		r := httptest.NewRequest(http.MethodGet, "/api/search?q=pool", nil)
+		r.SetBasicAuth("alice", "guess"+strconv.Itoa(i))
+		codes[i] = serve(h, r).Code
+	}
+	if codes[0] != http.StatusUnauthorized || codes[1] != http.StatusUnauthorized {
+		t.Errorf("statuses = %v, want a 401 for each of two attempts with a burst of 2", codes[:2])
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// queryLogEntry is one line of a query log: a search and the result that
+// was clicked for it
+type queryLogEntry struct {
+	Query   string `json:"query"`
+	Clicked string `json:"clicked"`
+	// Position is where the clicked result was ranked, from 1, or 0 when
+	// it wasn't recorded
+	Position int `json:"position"`
+}
+
+// replayResult compares where a clicked result ranked with where it
+// ranks now
+type replayResult struct {
+	Query   string `json:"query"`
+	Clicked string `json:"clicked"`
+	Clicks  int    `json:"clicks"`
+	// Before is the position in the latest log entry that recorded one,
+	// After the position in the current index; 0 is unknown for Before
+	// and not within the replayed depth for After
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+// Changed reports whether the result moved. Results without a recorded
+// position count as changed when they fell out of the replayed depth.
+func (r replayResult) Changed() bool {
+	if r.Before == 0 {
+		return r.After == 0
+	}
+	return r.Before != r.After
+}
+
+// replayReport sums up a replay. The reciprocal ranks are weighted by
+// clicks and count a result outside the depth as 0.
+type replayReport struct {
+	Queries int `json:"queries"`
+	Clicks  int `json:"clicks"`
+	// Depth is how many results of each query were looked at
+	Depth     int            `json:"depth"`
+	MRRBefore float64        `json:"mrr_before"`
+	MRRAfter  float64        `json:"mrr_after"`
+	Improved  int            `json:"improved"`
+	Worse     int            `json:"worse"`
+	Unchanged int            `json:"unchanged"`
+	NotFound  int            `json:"not_found"`
+	Results   []replayResult `json:"results"`
+}
+
+// readQueryLog parses a query log in JSON Lines. Blank lines are skipped.
+func readQueryLog(r io.Reader) ([]queryLogEntry, error) {
+	var entries []queryLogEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var e queryLogEntry
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if e.Query == "" || e.Clicked == "" {
+			return nil, fmt.Errorf("line %d: query and clicked are required", line)
+		}
+		e.Clicked = strings.TrimPrefix(e.Clicked, "/")
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// replayQueryLog runs every query of the log against the current index,
+// looking at the first depth results, and reports where the clicked
+// results rank now
+func replayQueryLog(entries []queryLogEntry, depth int) (replayReport, error) {
+	type key struct{ query, clicked string }
+	byClick := make(map[key]*replayResult)
+	var order []key
+	for _, e := range entries {
+		k := key{e.Query, e.Clicked}
+		r, ok := byClick[k]
+		if !ok {
+			r = &replayResult{Query: e.Query, Clicked: e.Clicked}
+			byClick[k] = r
+			order = append(order, k)
+		}
+		r.Clicks++
+		if e.Position > 0 {
+			r.Before = e.Position
+		}
+	}
+
+	report := replayReport{Depth: depth}
+	ranked := make(map[string]map[string]int)
+	for _, k := range order {
+		positions, ok := ranked[k.query]
+		if !ok {
+			results, err := performSearch(k.query, searchFilter{}, depth, nil)
+			if err != nil {
+				return replayReport{}, fmt.Errorf("replaying %q: %w", k.query, err)
+			}
+			positions = make(map[string]int, len(results))
+			for i, doc := range results {
+				if _, seen := positions[doc.URL]; !seen {
+					positions[doc.URL] = i + 1
+				}
+			}
+			ranked[k.query] = positions
+		}
+
+		r := byClick[k]
+		r.After = positions[r.Clicked]
+		report.Clicks += r.Clicks
+		report.MRRBefore += float64(r.Clicks) * reciprocalRank(r.Before)
+		report.MRRAfter += float64(r.Clicks) * reciprocalRank(r.After)
+		switch {
+		case r.After == 0:
+			report.NotFound++
+		case r.Before == 0 || r.Before == r.After:
+			report.Unchanged++
+		case r.After < r.Before:
+			report.Improved++
+		default:
+			report.Worse++
+		}
+		report.Results = append(report.Results, *r)
+	}
+	report.Queries = len(ranked)
+	if report.Clicks > 0 {
+		report.MRRBefore /= float64(report.Clicks)
+		report.MRRAfter /= float64(report.Clicks)
+	}
+
+	// the most clicked results matter most
+	sort.SliceStable(report.Results, func(i, j int) bool { return report.Results[i].Clicks > report.Results[j].Clicks })
+	return report, nil
+}
+
+func reciprocalRank(position int) float64 {
+	if position == 0 {
+		return 0
+	}
+	return 1 / float64(position)
+}
+
+// writeReplayReport prints the results that moved, or all of them, and the
+// summary. The json format prints the whole report.
+func writeReplayReport(w io.Writer, report replayReport, format string, all bool) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	position := func(p int, missing string) string {
+		if p == 0 {
+			return missing
+		}
+		return fmt.Sprint(p)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUERY\tCLICKED\tCLICKS\tBEFORE\tAFTER")
+	for _, r := range report.Results {
+		if all || r.Changed() {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", truncate(r.Query, 40), r.Clicked, r.Clicks,
+				position(r.Before, "-"), position(r.After, fmt.Sprintf(">%d", report.Depth)))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d queries, %d clicks: %d improved, %d worse, %d unchanged, %d not in the top %d\nMRR %.3f before, %.3f after\n",
+		report.Queries, report.Clicks, report.Improved, report.Worse, report.Unchanged, report.NotFound, report.Depth,
+		report.MRRBefore, report.MRRAfter)
+	return err
+}
+
+// runReplay replays a query log against the current index, so a change to
+// the ranking can be checked against what users clicked before it ships
+func runReplay(args []string) error {
+	fs, opts := newFlagSet("replay", "[flags] <query log>", false)
+	format := fs.String("format", "table", "Output format: table or json")
+	depth := fs.Int("n", 20, "How many results of each query to look at")
+	all := fs.Bool("all", false, "List every clicked result, not only the ones that moved")
+	fs.Float64Var(&headingsBoost, "headings-boost", headingsBoost, "How much more a match in a heading counts, to try another value")
+	fs.Float64Var(&deprecatedPenalty, "deprecated-penalty", deprecatedPenalty, "Score factor for deprecated documents, to try another value")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *depth < 1 || (*format != "table" && *format != "json") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := opts.apply(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	entries, err := readQueryLog(f)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", fs.Arg(0), err)
+	}
+
+	if index, err = openIndex(indexPath); err != nil {
+		return err
+	}
+	defer index.Close()
+
+	report, err := replayQueryLog(entries, *depth)
+	if err != nil {
+		return err
+	}
+	return writeReplayReport(os.Stdout, report, *format, *all)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadQueryLog(t *testing.T) {
+	log := `{"query": "retry", "clicked": "/guides/retries.html", "position": 3}
+
+{"query": "retry", "clicked": "guides/retries.html"}`
+	entries, err := readQueryLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Clicked != "guides/retries.html" || entries[0].Position != 3 {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	if _, err := readQueryLog(strings.NewReader(`{"query": "retry"}`)); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("missing click: err = %v", err)
+	}
+	if _, err := readQueryLog(strings.NewReader("{}\nnot json")); err == nil {
+		t.Error("invalid log accepted")
+	}
+}
+
+func TestReplayQueryLog(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	pages := map[string]string{
+		"retries.html": `<title>Retries</title><h1>Retries</h1><p>How the client retries failed requests.</p>`,
+		"client.html":  `<title>Client</title><p>The client sends requests and may retry them.</p>`,
+		"tls.html":     `<title>TLS</title><p>Certificates.</p>`,
+	}
+	for name, page := range pages {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(page), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []queryLogEntry{
+		{Query: "retries", Clicked: "retries.html", Position: 2},
+		{Query: "retries", Clicked: "retries.html", Position: 2},
+		{Query: "retries", Clicked: "tls.html", Position: 1},
+		{Query: "client", Clicked: "client.html"},
+	}
+	report, err := replayQueryLog(entries, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Queries != 2 || report.Clicks != 4 {
+		t.Errorf("queries = %d, clicks = %d", report.Queries, report.Clicks)
+	}
+	if report.Improved != 1 || report.NotFound != 1 || report.Unchanged != 1 || report.Worse != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	first := report.Results[0]
+	if first.Clicked != "retries.html" || first.Clicks != 2 || first.Before != 2 || first.After != 1 {
+		t.Errorf("most clicked = %+v", first)
+	}
+	// (2 * 1/2 + 1) / 4 before, (2 * 1 + 0 + 1/1) / 4 after
+	if report.MRRBefore != 0.5 || report.MRRAfter != 0.75 {
+		t.Errorf("mrr = %v before, %v after", report.MRRBefore, report.MRRAfter)
+	}
+
+	var out bytes.Buffer
+	if err := writeReplayReport(&out, report, "table", false); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	if !strings.Contains(text, ">10") || strings.Contains(text, "client.html") {
+		t.Errorf("table should list the moved results only:\n%s", text)
+	}
+	if !strings.Contains(text, "1 improved, 0 worse, 1 unchanged, 1 not in the top 10") || !strings.Contains(text, "MRR 0.500 before, 0.750 after") {
+		t.Errorf("summary missing:\n%s", text)
+	}
+}
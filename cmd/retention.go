@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// runRetention prunes old data once an hour, so a server that runs for
+// months doesn't grow without bound
+func runRetention() {
+	for {
+		if err := applyRetention(time.Now().UTC()); err != nil {
+			log.Printf("Error applying retention: %v", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// applyRetention drops idle search histories and old search analytics, and
+// removes archived snapshots beyond the limit
+func applyRetention(now time.Time) error {
+	if days := config.Retention.historyDays(); store != nil && days > 0 {
+		n, err := pruneHistory(now.AddDate(0, 0, -days), now)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Retention: dropped %d idle search histories", n)
+		}
+	}
+	if analyticsEnabled() {
+		n, err := pruneAnalytics(now.AddDate(0, 0, 1-config.Analytics.days()))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Retention: dropped %d days of search analytics", n)
+		}
+		if n, err = pruneZeroResults(now.AddDate(0, 0, -config.Analytics.days())); err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Retention: dropped %d queries from the zero-result log", n)
+		}
+	}
+	if config.Archive.Dir != "" {
+		n, err := pruneSnapshots(config.Archive)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Retention: removed %d archived snapshots", n)
+		}
+	}
+	return nil
+}
+
+// pruneHistory deletes the histories last updated before cutoff. Histories
+// from before updates were recorded start their clock now.
+func pruneHistory(cutoff, now time.Time) (int, error) {
+	removed := 0
+	err := store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(searchHistoryBucket))
+		if b == nil {
+			return nil
+		}
+		var stale [][]byte
+		stamp := map[string]searchHistory{}
+		err := b.ForEach(func(k, v []byte) error {
+			h, err := decodeHistory(v)
+			if err != nil {
+				return err
+			}
+			switch {
+			case h.Updated.IsZero():
+				h.Updated = now
+				stamp[string(k)] = h
+			case h.Updated.Before(cutoff):
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		for k, h := range stamp {
+			data, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(k), data); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return nil
+	})
+	return removed, err
+}
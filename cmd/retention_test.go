@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneHistory(t *testing.T) {
+	withStore(t)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := storePut(searchHistoryBucket, "legacy", []string{"oauth"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storePut(searchHistoryBucket, "idle", searchHistory{Queries: []string{"cache"}, Updated: now.AddDate(0, 0, -100)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storePut(searchHistoryBucket, "active", searchHistory{Queries: []string{"tls"}, Updated: now.AddDate(0, 0, -1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if recent, err := recentQueries("legacy"); err != nil || len(recent) != 1 || recent[0] != "oauth" {
+		t.Fatalf("legacy history = %v, %v", recent, err)
+	}
+
+	removed, err := pruneHistory(now.AddDate(0, 0, -90), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d histories, want 1", removed)
+	}
+	if recent, _ := recentQueries("idle"); len(recent) != 0 {
+		t.Errorf("idle history kept: %v", recent)
+	}
+	if recent, _ := recentQueries("active"); len(recent) != 1 {
+		t.Errorf("active history = %v", recent)
+	}
+
+	var h searchHistory
+	if found, err := storeGet(searchHistoryBucket, "legacy", &h); err != nil || !found {
+		t.Fatalf("legacy history gone: %v", err)
+	}
+	if !h.Updated.Equal(now) || len(h.Queries) != 1 {
+		t.Errorf("legacy history = %+v, want stamped with %v", h, now)
+	}
+}
+
+func TestForgetRemovedDocuments(t *testing.T) {
+	withStore(t)
+	if _, err := recordNewDocuments([]string{"a.html", "b.html"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := forgetRemovedDocuments([]string{"a.html"}); err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	storeEach(seenDocsBucket, func(id string, _ []byte) error {
+		seen = append(seen, id)
+		return nil
+	})
+	if len(seen) != 1 || seen[0] != "a.html" {
+		t.Errorf("seen = %v, want [a.html]", seen)
+	}
+
+	newIDs, err := recordNewDocuments([]string{"a.html", "b.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newIDs) != 1 || newIDs[0] != "b.html" {
+		t.Errorf("new = %v, want a returning document reported again", newIDs)
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"2024-05-01", "2024-05-02", "2024-05-03", "notes"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := pruneSnapshots(ArchiveConfig{Dir: dir, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d snapshots, want 1", removed)
+	}
+	snapshots, _ := archiveSnapshots(dir)
+	if len(snapshots) != 2 || snapshots[0] != "2024-05-02" {
+		t.Errorf("snapshots = %v", snapshots)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes")); err != nil {
+		t.Errorf("unrelated directory removed: %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3ETagsSuffix names the file beside the copy of an S3 source that records
+// the ETag of every object it downloaded, so the next fetch only downloads
+// the ones that changed. It's kept out of the copy, which is served.
+const s3ETagsSuffix = ".s3-etags.json"
+
+// s3ETagsPath is where the ETags of the copy in dir are kept
+func s3ETagsPath(dir string) string {
+	return filepath.Join(filepath.Dir(dir), "."+filepath.Base(dir)+s3ETagsSuffix)
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body, the payload of every
+// request the S3 source sends
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+var s3Client = &http.Client{Timeout: 5 * time.Minute}
+
+func validateS3(s SourceConfig) error {
+	c := s.S3
+	if c.Bucket == "" {
+		return errors.New("s3 needs a bucket")
+	}
+	if c.Endpoint != "" {
+		if u, err := url.Parse(c.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("s3 endpoint %q isn't an http or https url", c.Endpoint)
+		}
+	}
+	if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+		return errors.New("s3 needs both access_key_id and secret_access_key, or neither")
+	}
+	return nil
+}
+
+// endpoint is the base URL of the S3 API, AWS's in the bucket's region
+// unless the config names another service
+func (c S3Config) endpoint() string {
+	if c.Endpoint != "" {
+		return strings.TrimSuffix(c.Endpoint, "/")
+	}
+	return "https://s3." + c.region() + ".amazonaws.com"
+}
+
+func (c S3Config) region() string {
+	if c.Region != "" {
+		return c.Region
+	}
+	return "us-east-1"
+}
+
+// credentials are the configured keys, or those of the AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY environment variables along with the session token
+// of temporary ones in AWS_SESSION_TOKEN. Requests go unsigned without any,
+// for public buckets.
+func (c S3Config) credentials() (id, secret, token string) {
+	if c.AccessKeyID != "" {
+		return c.AccessKeyID, c.SecretAccessKey, ""
+	}
+	return os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+}
+
+// fetchS3 mirrors the documents under the source's prefix in its bucket
+// into dir. Objects already downloaded are fetched with a conditional GET
+// on their ETag, so only changed ones are downloaded again; files of
+// objects that were deleted are removed. When a download fails, the ETags
+// of the objects fetched before it are kept for the next try.
+func fetchS3(ctx context.Context, src SourceConfig, dir string) error {
+	c := src.S3
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	etagsPath := s3ETagsPath(dir)
+	etags := make(map[string]string)
+	if data, err := os.ReadFile(etagsPath); err == nil {
+		if err := json.Unmarshal(data, &etags); err != nil {
+			return fmt.Errorf("reading %s: %w", etagsPath, err)
+		}
+	}
+
+	keys, err := listS3(ctx, c)
+	if err != nil {
+		return err
+	}
+	fetched := make(map[string]string)
+	downloaded := 0
+	for _, key := range keys {
+		name := bundleName(strings.TrimPrefix(key, c.Prefix))
+		if name == "" || !(isDocumentName(name) || isBundle(name)) {
+			continue
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		etag := etags[name]
+		if _, err := os.Stat(file); err != nil {
+			etag = ""
+		}
+		etag, changed, err := getS3(ctx, c, key, etag, file)
+		if err != nil {
+			// what's been fetched is recorded along with the old ETags of
+			// the objects not reached yet, whose files are still there
+			for name, etag := range fetched {
+				etags[name] = etag
+			}
+			if werr := writeS3ETags(etagsPath, etags); werr != nil {
+				log.Printf("%s: %v", src.Name, werr)
+			}
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if changed {
+			downloaded++
+		}
+		fetched[name] = etag
+	}
+
+	for name := range etags {
+		if _, ok := fetched[name]; !ok {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(name))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	log.Printf("%s: downloaded %d of %d documents", src.Name, downloaded, len(fetched))
+	return writeS3ETags(etagsPath, fetched)
+}
+
+func writeS3ETags(path string, etags map[string]string) error {
+	data, err := json.MarshalIndent(etags, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// listS3 lists the keys under the prefix of the bucket, page by page
+func listS3(ctx context.Context, c S3Config) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}}
+		if c.Prefix != "" {
+			q.Set("prefix", c.Prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		res, err := s3Request(ctx, c, "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading the object list: %w", err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, obj.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// getS3 downloads the object at key into file unless its ETag is still
+// etag. It returns the object's ETag and whether it was downloaded.
+func getS3(ctx context.Context, c S3Config, key, etag, file string) (string, bool, error) {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	res, err := s3Request(ctx, c, key, nil, header)
+	if err != nil {
+		return "", false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified {
+		return etag, false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return "", false, err
+	}
+	tmp := file + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", false, err
+	}
+	_, err = io.Copy(f, res.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", false, err
+	}
+	if modified, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(file, modified, modified)
+	}
+	return res.Header.Get("ETag"), true, nil
+}
+
+// s3Request sends a signed GET for key in the bucket, or for the bucket
+// itself when key is empty. Answers other than 200 and 304 are errors.
+func s3Request(ctx context.Context, c S3Config, key string, query url.Values, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(c.endpoint())
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + c.Bucket + "/" + key
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if id, secret, token := c.credentials(); id != "" {
+		if token != "" {
+			req.Header.Set("X-Amz-Security-Token", token)
+		}
+		signS3(req, id, secret, c.region(), time.Now())
+	}
+	res, err := s3Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotModified {
+		var e struct{ Code, Message string }
+		xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&e)
+		res.Body.Close()
+		if e.Code != "" {
+			return nil, fmt.Errorf("answered %s: %s %s", res.Status, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("answered %s", res.Status)
+	}
+	return res, nil
+}
+
+// signS3 signs req with AWS Signature Version 4, covering its host and
+// every header already set
+func signS3(req *http.Request, id, secret, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+id+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but the characters AWS leaves
+// unreserved
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = s3Escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	var pairs []string
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
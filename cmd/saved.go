@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const savedSearchesBucket = "saved_searches"
+
+// maxSavedSearches caps the saved searches per user
+const maxSavedSearches = 50
+
+// SavedSearch is a named query with its filters that its owner can re-run
+// from the search page
+type SavedSearch struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// Params is the query string of the search, e.g. "q=pool&type=md"
+	Params  string    `json:"params"`
+	Created time.Time `json:"created"`
+}
+
+// searchParamNames are the parameters that make up a search
+var searchParamNames = []string{"q", "code", "docset", "language", "trust", "type", "tag", "updated", "since", "until"}
+
+// searchParams keeps the search parameters of params, in canonical order
+func searchParams(params url.Values) string {
+	kept := url.Values{}
+	for _, name := range searchParamNames {
+		if v := params[name]; len(v) > 0 {
+			kept[name] = v
+		}
+	}
+	return kept.Encode()
+}
+
+const visitorCookieName = "godochive_visitor"
+
+// visitorKey identifies whose saved searches and history a request sees:
+// the logged-in user or, without one, a random ID kept in a cookie. It
+// returns false for a visitor without that cookie.
+func visitorKey(r *http.Request) (string, bool) {
+	if p, ok := principalFromContext(r.Context()); ok {
+		return "user:" + p.Name, true
+	}
+	if c, err := r.Cookie(visitorCookieName); err == nil && c.Value != "" {
+		return "visitor:" + c.Value, true
+	}
+	return "", false
+}
+
+// ensureVisitorKey is visitorKey, setting the visitor cookie when missing
+func ensureVisitorKey(w http.ResponseWriter, r *http.Request) string {
+	if key, ok := visitorKey(r); ok {
+		return key
+	}
+	id := randomString(16)
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "visitor:" + id
+}
+
+// savedSearchesOf returns the saved searches of owner, sorted by name
+func savedSearchesOf(owner string) ([]SavedSearch, error) {
+	saved := []SavedSearch{}
+	if store == nil || owner == "" {
+		return saved, nil
+	}
+	err := storeEach(savedSearchesBucket, func(_ string, data []byte) error {
+		var s SavedSearch
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s.Owner == owner {
+			saved = append(saved, s)
+		}
+		return nil
+	})
+	sort.Slice(saved, func(i, j int) bool { return strings.ToLower(saved[i].Name) < strings.ToLower(saved[j].Name) })
+	return saved, err
+}
+
+// newSavedSearch validates a search to save. params is parsed as a query
+// string and reduced to the search parameters.
+func newSavedSearch(owner, name, params string) (SavedSearch, error) {
+	values, err := url.ParseQuery(params)
+	if err != nil {
+		return SavedSearch{}, errors.New("params must be a query string like q=pool&type=md")
+	}
+	if strings.TrimSpace(values.Get("q")) == "" {
+		return SavedSearch{}, errors.New("params must include a query (q)")
+	}
+	s := SavedSearch{
+		ID:      randomString(12),
+		Owner:   owner,
+		Name:    strings.TrimSpace(name),
+		Params:  searchParams(values),
+		Created: time.Now().UTC(),
+	}
+	if s.Name == "" {
+		s.Name = values.Get("q")
+	}
+	return s, nil
+}
+
+var errTooManySaved = fmt.Errorf("too many saved searches (max %d), delete some first", maxSavedSearches)
+
+// putSavedSearch stores s unless its owner has too many saved searches
+func putSavedSearch(s SavedSearch) error {
+	existing, err := savedSearchesOf(s.Owner)
+	if err != nil {
+		return err
+	}
+	if len(existing) >= maxSavedSearches {
+		return errTooManySaved
+	}
+	return storePut(savedSearchesBucket, s.ID, s)
+}
+
+func handleListSaved(w http.ResponseWriter, r *http.Request) {
+	owner, _ := visitorKey(r)
+	saved, err := savedSearchesOf(owner)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func handleCreateSaved(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string `json:"name"`
+		Params string `json:"params"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	s, err := newSavedSearch(ensureVisitorKey(w, r), req.Name, req.Params)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := putSavedSearch(s); err == errTooManySaved {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, s)
+}
+
+func handleDeleteSaved(w http.ResponseWriter, r *http.Request) {
+	owner, _ := visitorKey(r)
+	var s SavedSearch
+	found, err := storeGet(savedSearchesBucket, r.PathValue("id"), &s)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || owner == "" || s.Owner != owner {
+		writeError(w, r, http.StatusNotFound, "no such saved search")
+		return
+	}
+
+	if err := storeDelete(savedSearchesBucket, s.ID); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSaveSearchForm saves the search from the form on the search page
+// and goes back to it
+func handleSaveSearchForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	s, err := newSavedSearch(ensureVisitorKey(w, r), r.PostForm.Get("name"), r.PostForm.Get("params"))
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	if err := putSavedSearch(s); err == errTooManySaved {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error saving search: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/search?"+s.Params, http.StatusSeeOther)
+}
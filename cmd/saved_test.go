@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withStore opens a fresh store as the global store for the duration of a
+// test
+func withStore(t *testing.T) {
+	t.Helper()
+	db, err := openStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := store
+	store = db
+	t.Cleanup(func() {
+		db.Close()
+		store = old
+	})
+}
+
+func TestSavedSearches(t *testing.T) {
+	withStore(t)
+
+	create := httptest.NewRequest(http.MethodPost, "/api/saved", strings.NewReader(`{"name": "Pools", "params": "type=md&q=pool&lang=de"}`))
+	rec := serve(http.HandlerFunc(handleCreateSaved), create)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body.String())
+	}
+	var saved SavedSearch
+	if err := json.NewDecoder(rec.Body).Decode(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Params != "q=pool&type=md" {
+		t.Errorf("params = %q, want only the search parameters", saved.Params)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != visitorCookieName {
+		t.Fatalf("cookies = %v, want the visitor cookie", cookies)
+	}
+
+	list := func(cookie *http.Cookie) []SavedSearch {
+		r := httptest.NewRequest(http.MethodGet, "/api/saved", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		var list []SavedSearch
+		if err := json.NewDecoder(serve(http.HandlerFunc(handleListSaved), r).Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	if got := list(cookies[0]); len(got) != 1 || got[0].Name != "Pools" {
+		t.Errorf("own saved searches = %+v", got)
+	}
+	if got := list(&http.Cookie{Name: visitorCookieName, Value: "someone-else"}); len(got) != 0 {
+		t.Errorf("other visitor sees %+v", got)
+	}
+	if got := list(nil); len(got) != 0 {
+		t.Errorf("new visitor sees %+v", got)
+	}
+
+	del := func(cookie *http.Cookie) int {
+		r := httptest.NewRequest(http.MethodDelete, "/api/saved/"+saved.ID, nil)
+		r.SetPathValue("id", saved.ID)
+		r.AddCookie(cookie)
+		return serve(http.HandlerFunc(handleDeleteSaved), r).Code
+	}
+	if code := del(&http.Cookie{Name: visitorCookieName, Value: "someone-else"}); code != http.StatusNotFound {
+		t.Errorf("deleting someone else's = %d, want 404", code)
+	}
+	if code := del(cookies[0]); code != http.StatusNoContent {
+		t.Errorf("delete = %d, want 204", code)
+	}
+	if got := list(cookies[0]); len(got) != 0 {
+		t.Errorf("after delete = %+v", got)
+	}
+}
+
+func TestSaveSearchForm(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{})
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"name": {"My pools"}, "params": {"q=pooling&updated=30d"}}
+	r := httptest.NewRequest(http.MethodPost, "/search/saved", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := serve(http.HandlerFunc(handleSaveSearchForm), r)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/search?q=pooling&updated=30d" {
+		t.Fatalf("save = %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	page := httptest.NewRequest(http.MethodGet, "/search?q=pooling", nil)
+	page.AddCookie(rec.Result().Cookies()[0])
+
+	body := serve(http.HandlerFunc(handleSearch), page).Body.String()
+	if !strings.Contains(body, `<option value="/search?q=pooling&amp;updated=30d">My pools</option>`) {
+		t.Errorf("search page doesn't offer the saved search:\n%s", body)
+	}
+
+	form.Set("params", "type=md")
+	r = httptest.NewRequest(http.MethodPost, "/search/saved", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if rec := serve(http.HandlerFunc(handleSaveSearchForm), r); rec.Code != http.StatusBadRequest {
+		t.Errorf("saving without a query = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// schemaVersion is the version of the index layout this binary reads: the
+// mapping and the documents it indexes. Bump it when a change needs
+// existing indexes updated, and register a migration for the old version
+// if that can be done in place; otherwise indexes are rebuilt.
+//
+// 2 stores the checksum of the content with every document, 3 the revision
+// of its source, 4 the authors and date of its front matter, 5 the class
+// and member names of Javadoc and Doxygen pages.
+const schemaVersion = 5
+
+const schemaInternalKey = "godochive:schema"
+
+// schemaMigrations update an index in place from the version they are
+// registered under to the next one
+var schemaMigrations = map[int]func(bleve.Index) error{}
+
+var errNoMigration = errors.New("no migration registered")
+
+// indexSchemaVersion is the schema version idx was built with. Indexes from
+// before versioning have version 0.
+func indexSchemaVersion(idx bleve.Index) int {
+	stamp, err := idx.GetInternal([]byte(schemaInternalKey))
+	if err != nil || stamp == nil {
+		return 0
+	}
+	v, err := strconv.Atoi(string(stamp))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// schemaUpToDate reports whether idx was built with the schema this binary
+// reads
+func schemaUpToDate(idx bleve.Index) bool {
+	return indexSchemaVersion(idx) == schemaVersion
+}
+
+func stampSchema(idx bleve.Index, version int) error {
+	return idx.SetInternal([]byte(schemaInternalKey), []byte(strconv.Itoa(version)))
+}
+
+// migrateSchema runs the migrations from version from up to to, stamping
+// each step. Nothing runs unless a migration is registered for every step.
+func migrateSchema(idx bleve.Index, from, to int) error {
+	for v := from; v < to; v++ {
+		if schemaMigrations[v] == nil {
+			return fmt.Errorf("%w from schema %d", errNoMigration, v)
+		}
+	}
+	for v := from; v < to; v++ {
+		if err := schemaMigrations[v](idx); err != nil {
+			return fmt.Errorf("migrating schema %d to %d: %w", v, v+1, err)
+		}
+		if err := stampSchema(idx, v+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeSchema brings idx, opened from path, up to schemaVersion: through
+// the registered migrations when they cover every version in between, by
+// rebuilding it from the docs otherwise. It returns the index to use and
+// whether it was rebuilt; idx is closed when it is replaced or on error.
+func upgradeSchema(idx bleve.Index, path string) (bleve.Index, bool, error) {
+	v := indexSchemaVersion(idx)
+	switch {
+	case v == schemaVersion:
+		return idx, false, nil
+	case v > schemaVersion:
+		idx.Close()
+		return nil, false, fmt.Errorf("the index has schema %d but this godochive only knows up to %d, upgrade it or run \"godochive index\"", v, schemaVersion)
+	}
+
+	err := migrateSchema(idx, v, schemaVersion)
+	if err == nil {
+		log.Printf("Migrated the index from schema %d to %d", v, schemaVersion)
+		return idx, false, nil
+	}
+	if !errors.Is(err, errNoMigration) {
+		idx.Close()
+		return nil, false, err
+	}
+
+	log.Printf("The index has schema %d and this version needs %d, rebuilding it from the docs", v, schemaVersion)
+	if err := idx.Close(); err != nil {
+		return nil, false, err
+	}
+	if err := rebuildIndex(path); err != nil {
+		return nil, false, fmt.Errorf("rebuilding the index: %w", err)
+	}
+	next, err := openIndex(path)
+	return next, true, err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestUpgradeSchema(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	if err := os.WriteFile(filepath.Join(root, "pool.html"), []byte("<title>Pooling</title><p>connections are pooled</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "index.bleve")
+	// open creates an empty index stamped with version, unstamped for 0
+	open := func(version int) bleve.Index {
+		t.Helper()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatal(err)
+		}
+		idx, err := bleve.New(path, newIndexMapping())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version > 0 {
+			if err := stampSchema(idx, version); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return idx
+	}
+
+	idx, rebuilt, err := upgradeSchema(open(0), path)
+	if err != nil || !rebuilt {
+		t.Fatalf("upgrade of an unversioned index: rebuilt = %v, %v", rebuilt, err)
+	}
+	if v := indexSchemaVersion(idx); v != schemaVersion {
+		t.Errorf("schema after the rebuild = %d, want %d", v, schemaVersion)
+	}
+	res, err := idx.Search(bleve.NewSearchRequest(bleve.NewMatchQuery("pooled")))
+	if err != nil || res.Total != 1 {
+		t.Errorf("search after the rebuild = %v, %v", res, err)
+	}
+	idx.Close()
+
+	// a migration for every step is run in place instead
+	old := schemaMigrations
+	t.Cleanup(func() { schemaMigrations = old })
+	migrated := 0
+	schemaMigrations = map[int]func(bleve.Index) error{
+		schemaVersion - 1: func(bleve.Index) error { migrated++; return nil },
+	}
+	idx, rebuilt, err = upgradeSchema(open(schemaVersion-1), path)
+	if err != nil || rebuilt || migrated != 1 {
+		t.Fatalf("upgrade with a migration: rebuilt = %v, migrated %d times, %v", rebuilt, migrated, err)
+	}
+	if !schemaUpToDate(idx) {
+		t.Errorf("schema after the migration = %d", indexSchemaVersion(idx))
+	}
+	idx.Close()
+
+	if _, _, err := upgradeSchema(open(schemaVersion+1), path); err == nil {
+		t.Error("an index from a newer version was served")
+	}
+}
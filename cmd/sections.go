@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"golang.org/x/net/html"
+)
+
+const kindSection = "section"
+
+// pageSection is the part of a page from an h1-h3 heading to the next one.
+// Sections are indexed as documents of their own, so a search for a
+// subsection lands on its anchor rather than the top of a long page.
+type pageSection struct {
+	Anchor  string
+	Heading string
+	Content string
+}
+
+// findSections splits the body of a page at its h1-h3 headings. Files are
+// served as they are, so only headings with an id, or an anchor inside
+// them, can be linked to; the text below other headings stays with the
+// section before.
+func findSections(doc *html.Node) []pageSection {
+	var sections []pageSection
+	var text *strings.Builder
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && summarySkip[n.Data] {
+			return
+		}
+		if n.Type == html.ElementNode && (n.Data == "h1" || n.Data == "h2" || n.Data == "h3") {
+			if anchor := headingAnchor(n); anchor != "" {
+				if text != nil {
+					sections[len(sections)-1].Content = text.String()
+				}
+				sections = append(sections, pageSection{Anchor: anchor, Heading: strings.Join(strings.Fields(nodeText(n)), " ")})
+				text = &strings.Builder{}
+				return
+			}
+		}
+		if n.Type == html.TextNode && text != nil {
+			text.WriteString(n.Data)
+			text.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if text != nil {
+		sections[len(sections)-1].Content = text.String()
+	}
+	return sections
+}
+
+// headingAnchor is the id of a heading, or of an anchor inside it as some
+// generators write <h2><a id="usage"></a>Usage</h2>
+func headingAnchor(h *html.Node) string {
+	if id := attr(h, "id"); id != "" {
+		return id
+	}
+	for c := h.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			if id := attr(c, "id"); id != "" {
+				return id
+			}
+			if name := attr(c, "name"); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// sectionDocuments turns the sections of a page into documents whose ID
+// and URL point at the heading. Anchors taken by the page's examples are
+// skipped, and so are sections without text.
+func sectionDocuments(page Document, sections []pageSection, taken map[string]bool) []Document {
+	docs := make([]Document, 0, len(sections))
+	for _, s := range sections {
+		if taken[s.Anchor] || s.Heading == "" || strings.TrimSpace(s.Content) == "" {
+			continue
+		}
+		taken[s.Anchor] = true
+
+		docs = append(docs, Document{
+			Title:      page.Title + ": " + s.Heading,
+			Content:    s.Content,
+			URL:        page.URL + "#" + s.Anchor,
+			Docset:     page.Docset,
+			ModifiedAt: page.ModifiedAt,
+			Headings:   s.Heading,
+			Kind:       kindSection,
+			Deprecated: page.Deprecated,
+			DocType:    page.DocType,
+			Size:       page.Size,
+			Version:    page.Version,
+			Tags:       page.Tags,
+			Authors:    page.Authors,
+			Date:       page.Date,
+			Trust:      page.Trust,
+			Language:   page.Language,
+		})
+	}
+	return docs
+}
+
+// pagesOnly restricts q to whole pages, leaving out the examples and
+// sections indexed from them
+func pagesOnly(q query.Query) query.Query {
+	pages := bleve.NewBooleanQuery()
+	pages.AddMust(q)
+	for _, kind := range []string{kindExample, kindSection} {
+		tq := bleve.NewTermQuery(kind)
+		tq.SetField("Kind")
+		pages.AddMustNot(tq)
+	}
+	return pages
+}
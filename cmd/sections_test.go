@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindSections(t *testing.T) {
+	page := `<title>Client</title><nav><h2 id="menu">Menu</h2></nav>
+<p>Intro text.</p>
+<h1 id="client">HTTP client</h1><p>Sending requests.</p>
+<h2><a id="retries"></a>Retry  budget</h2><p>Retries are capped.</p>
+<h4 id="deep">Too deep</h4><p>Still about retries.</p>
+<h3>No anchor</h3><p>Also still about retries.</p>
+<h3><a name="timeouts">Timeouts</a></h3><p>Requests time out.</p>`
+
+	got := extractPage(page).Sections
+	want := []pageSection{
+		{Anchor: "client", Heading: "HTTP client"},
+		{Anchor: "retries", Heading: "Retry budget"},
+		{Anchor: "timeouts", Heading: "Timeouts"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sections = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Anchor != want[i].Anchor || got[i].Heading != want[i].Heading {
+			t.Errorf("section %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	retries := strings.Join(strings.Fields(got[1].Content), " ")
+	if retries != "Retries are capped. Too deep Still about retries. No anchor Also still about retries." {
+		t.Errorf("retries content = %q", retries)
+	}
+}
+
+func TestSectionsIndexedAsDocuments(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+
+	page := `<title>HTTP client</title><p>Sending requests.</p>
+<h2 id="retry-budget">Retry budget</h2><p>Each client gets ten retries a minute.</p>
+<div id="example_Client_Do"><h3><a name="example_Client_Do"></a>Example</h3><pre>resp, err := client.Do(req)</pre></div>
+<h2 id="empty">Empty</h2>`
+	if err := os.WriteFile(filepath.Join(dir, "client.html"), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "client.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := documentsFor(filepath.Join(dir, "client.html"), info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, d := range docs {
+		urls = append(urls, filepath.Base(d.URL)+":"+d.Kind)
+	}
+	// the example's anchor is taken and the empty section has no text
+	if got := strings.Join(urls, ","); got != "client.html:,client.html#example_Client_Do:example,client.html#retry-budget:section" {
+		t.Errorf("documents = %s", got)
+	}
+
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	results, err := performSearch("retry budget", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || results[0].URL != "client.html#retry-budget" || results[0].Title != "HTTP client: Retry budget" {
+		t.Errorf("results = %+v, want the section first", results)
+	}
+}
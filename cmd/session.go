@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const sessionCookieName = "godochive_session"
+
+var sessionSecret []byte
+
+// session is the payload of the signed session cookie
+type session struct {
+	Name    string   `json:"name"`
+	Groups  []string `json:"groups,omitempty"`
+	Expires int64    `json:"exp"`
+}
+
+func initSessionSecret() {
+	if config.Auth.SessionSecret != "" {
+		sessionSecret = []byte(config.Auth.SessionSecret)
+		return
+	}
+	sessionSecret = make([]byte, 32)
+	if _, err := rand.Read(sessionSecret); err != nil {
+		log.Fatalf("Error generating session secret: %v", err)
+	}
+	log.Println("No session_secret configured, sessions will not survive a restart")
+}
+
+func sign(payload []byte) string {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verify(value string) ([]byte, error) {
+	encPayload, encSig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errors.New("malformed signed value")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encSig)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errors.New("invalid signature")
+	}
+	return payload, nil
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, s session) error {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    sign(payload),
+		Path:     "/",
+		Expires:  time.Unix(s.Expires, 0),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func sessionFromRequest(r *http.Request) (session, bool) {
+	var s session
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return s, false
+	}
+	payload, err := verify(cookie.Value)
+	if err != nil {
+		return s, false
+	}
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return s, false
+	}
+	if time.Now().Unix() > s.Expires {
+		return s, false
+	}
+	return s, true
+}
+
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Error reading random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+// shardsFile marks an index directory as sharded and records how many
+// shards it has
+const shardsFile = "shards.json"
+
+// maxShards bounds IndexConfig.Shards and the reshard command
+const maxShards = 256
+
+type shardManifest struct {
+	Shards int `json:"shards"`
+}
+
+// shardedIndex spreads the documents of a very large tree over several
+// bleve indexes, by a consistent hash of their page's path. Searches fan out
+// to every shard through the embedded alias; documents are read and written
+// on their own shard. The stamps of the index are kept on the first shard.
+type shardedIndex struct {
+	bleve.IndexAlias
+
+	path   string
+	shards []bleve.Index
+}
+
+func shardName(i int) string {
+	return fmt.Sprintf("shard-%03d", i)
+}
+
+// shardKey is what the shard of the document id is picked by: its page,
+// so the examples and sections of a page are on the page's shard
+func shardKey(id string) uint64 {
+	page, _, _ := strings.Cut(id, "#")
+	h := fnv.New64a()
+	h.Write([]byte(page))
+	return h.Sum64()
+}
+
+// jumpHash maps key to one of n buckets such that only about 1/n of the
+// keys move when a bucket is added, see Lamping and Veach, "A Fast, Minimal
+// Memory, Consistent Hash Algorithm"
+func jumpHash(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// newShardedIndex creates an empty index at path split into n shards
+func newShardedIndex(path string, n int) (*shardedIndex, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(shardManifest{Shards: n})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(path, shardsFile), data, 0o644); err != nil {
+		return nil, err
+	}
+	s := &shardedIndex{path: path}
+	for i := 0; i < n; i++ {
+		shard, err := newSingleIndex(filepath.Join(path, shardName(i)))
+		if err != nil {
+			s.closeShards()
+			return nil, err
+		}
+		s.shards = append(s.shards, shard)
+	}
+	s.IndexAlias = bleve.NewIndexAlias(s.shards...)
+	return s, nil
+}
+
+// openShardedIndex opens the n shards of the index at path
+func openShardedIndex(path string, n int, runtimeConfig map[string]interface{}) (*shardedIndex, error) {
+	s := &shardedIndex{path: path}
+	for i := 0; i < n; i++ {
+		shard, err := bleve.OpenUsing(filepath.Join(path, shardName(i)), runtimeConfig)
+		if err != nil {
+			s.closeShards()
+			return nil, fmt.Errorf("opening %s: %w", shardName(i), err)
+		}
+		s.shards = append(s.shards, shard)
+	}
+	s.IndexAlias = bleve.NewIndexAlias(s.shards...)
+	return s, nil
+}
+
+// readShardCount is the number of shards of the index at path, 0 when it
+// isn't sharded
+func readShardCount(path string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(path, shardsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var m shardManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return 0, fmt.Errorf("reading %s: %w", shardsFile, err)
+	}
+	if m.Shards < 1 || m.Shards > maxShards {
+		return 0, fmt.Errorf("%s: invalid shard count %d", shardsFile, m.Shards)
+	}
+	return m.Shards, nil
+}
+
+// indexShards is the number of shards a rebuild of the index at path gets:
+// as many as it has, or the configured number for a new index. Only the
+// reshard command changes it.
+func indexShards(path string) int {
+	if n, err := readShardCount(path); err == nil && n > 0 {
+		return n
+	}
+	if _, err := os.Stat(filepath.Join(path, "index_meta.json")); err == nil {
+		return 1
+	}
+	return max(config.Index.Shards, 1)
+}
+
+func (s *shardedIndex) shard(id string) bleve.Index {
+	return s.shards[jumpHash(shardKey(id), len(s.shards))]
+}
+
+func (s *shardedIndex) Index(id string, data interface{}) error {
+	return s.shard(id).Index(id, data)
+}
+
+func (s *shardedIndex) Delete(id string) error {
+	return s.shard(id).Delete(id)
+}
+
+func (s *shardedIndex) Document(id string) (bleveindex.Document, error) {
+	return s.shard(id).Document(id)
+}
+
+func (s *shardedIndex) Mapping() mapping.IndexMapping {
+	return s.shards[0].Mapping()
+}
+
+func (s *shardedIndex) GetInternal(key []byte) ([]byte, error) {
+	return s.shards[0].GetInternal(key)
+}
+
+func (s *shardedIndex) SetInternal(key, val []byte) error {
+	return s.shards[0].SetInternal(key, val)
+}
+
+func (s *shardedIndex) DeleteInternal(key []byte) error {
+	return s.shards[0].DeleteInternal(key)
+}
+
+// CopyTo copies every shard into the directory d, which must be on disk
+func (s *shardedIndex) CopyTo(d bleveindex.Directory) error {
+	dir, ok := d.(bleve.FileSystemDirectory)
+	if !ok {
+		return errors.New("a sharded index can only be copied to a directory on disk")
+	}
+	if err := os.MkdirAll(string(dir), 0o755); err != nil {
+		return err
+	}
+	for i, shard := range s.shards {
+		copyable, ok := shard.(bleve.IndexCopyable)
+		if !ok {
+			return fmt.Errorf("index does not support copying")
+		}
+		if err := copyable.CopyTo(bleve.FileSystemDirectory(filepath.Join(string(dir), shardName(i)))); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(shardManifest{Shards: len(s.shards)})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(string(dir), shardsFile), data, 0o644)
+}
+
+func (s *shardedIndex) Close() error {
+	s.IndexAlias.Close()
+	return s.closeShards()
+}
+
+func (s *shardedIndex) closeShards() error {
+	var errs []error
+	for _, shard := range s.shards {
+		errs = append(errs, shard.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// runReshard is the "reshard" command. It rebuilds the index from the docs
+// into the new number of shards; like the index command, it needs the
+// server to be stopped.
+func runReshard(args []string) error {
+	fs, opts := newFlagSet("reshard", "[flags]", true)
+	shards := fs.Int("shards", 0, "Number of shards (default the index.shards setting of the config)")
+	fs.Parse(args)
+	if err := opts.apply(); err != nil {
+		return err
+	}
+	n := *shards
+	if n == 0 {
+		n = max(config.Index.Shards, 1)
+	}
+	if n < 1 || n > maxShards {
+		return fmt.Errorf("-shards must be between 1 and %d", maxShards)
+	}
+	if _, err := os.Stat(indexPath); err != nil {
+		return fmt.Errorf("no index at %s, run \"godochive index\" first", indexPath)
+	}
+	if indexShards(indexPath) == n {
+		fmt.Printf("%s already has %d shard(s)\n", indexPath, n)
+		return nil
+	}
+
+	var err error
+	store, err = openStore(opts.dbPath)
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+	defer store.Close()
+
+	start := time.Now()
+	if err := rebuildShards(indexPath, n); err != nil {
+		return err
+	}
+	fmt.Printf("Resharded %s into %d shard(s) in %dms\n", indexPath, n, time.Since(start).Milliseconds())
+	return refreshStandby()
+}
+
+// shardsOf returns the shards of idx, or idx itself when it isn't sharded.
+// The wrappers of the served index are looked through.
+func shardsOf(idx bleve.Index) []bleve.Index {
+	switch i := idx.(type) {
+	case *shardedIndex:
+		return i.shards
+	case *liveIndex:
+		i.mu.Lock()
+		current := i.current
+		i.mu.Unlock()
+		if current != nil {
+			return shardsOf(current)
+		}
+	case *failoverIndex:
+		i.mu.Lock()
+		primary := i.primary
+		if i.failedOver {
+			primary = i.standby
+		}
+		i.mu.Unlock()
+		return shardsOf(primary)
+	}
+	return []bleve.Index{idx}
+}
+
+// shardFor returns the shard of idx the document id is on, or idx itself
+// when it isn't sharded
+func shardFor(idx bleve.Index, id string) bleve.Index {
+	shards := shardsOf(idx)
+	if len(shards) == 1 {
+		return idx
+	}
+	return shards[jumpHash(shardKey(id), len(shards))]
+}
+
+// batcher indexes and deletes documents in batches of the configured size, one per
+// shard of a sharded index
+type batcher struct {
+	idx     bleve.Index
+	batches map[bleve.Index]*bleve.Batch
+}
+
+func newBatcher(idx bleve.Index) *batcher {
+	return &batcher{idx: idx, batches: make(map[bleve.Index]*bleve.Batch)}
+}
+
+func (b *batcher) Index(id string, data interface{}) error {
+	shard, batch := b.batchFor(id)
+	if err := batch.Index(id, data); err != nil {
+		return err
+	}
+	return b.applyIfFull(shard, batch)
+}
+
+func (b *batcher) Delete(id string) error {
+	shard, batch := b.batchFor(id)
+	batch.Delete(id)
+	return b.applyIfFull(shard, batch)
+}
+
+func (b *batcher) batchFor(id string) (bleve.Index, *bleve.Batch) {
+	shard := shardFor(b.idx, id)
+	batch := b.batches[shard]
+	if batch == nil {
+		batch = shard.NewBatch()
+		b.batches[shard] = batch
+	}
+	return shard, batch
+}
+
+func (b *batcher) applyIfFull(shard bleve.Index, batch *bleve.Batch) error {
+	if !batchFull(batch) {
+		return nil
+	}
+	if err := shard.Batch(batch); err != nil {
+		return err
+	}
+	batch.Reset()
+	return nil
+}
+
+// Flush applies the batches that aren't full yet
+func (b *batcher) Flush() error {
+	for shard, batch := range b.batches {
+		if batch.Size() == 0 {
+			continue
+		}
+		if err := shard.Batch(batch); err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	return nil
+}
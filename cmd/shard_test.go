@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestShardedIndex(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	const pages = 20
+	for i := 0; i < pages; i++ {
+		page := fmt.Sprintf("<title>Page %d</title><h2 id=\"pool\">Pooling</h2><p>connections are pooled</p>", i)
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("page%02d.html", i)), []byte(page), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "index.bleve")
+	if err := rebuildShards(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := indexShards(path); n != 3 {
+		t.Fatalf("shards after the build = %d", n)
+	}
+	idx, err := openIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	s, ok := idx.(*shardedIndex)
+	if !ok {
+		t.Fatalf("opened a %T", idx)
+	}
+
+	// every shard has documents, and a page's sections are on its shard
+	var total uint64
+	for i, shard := range s.shards {
+		n, err := shard.DocCount()
+		if err != nil || n == 0 {
+			t.Errorf("shard %d has %d documents, %v", i, n, err)
+		}
+		total += n
+	}
+	if n, _ := idx.DocCount(); n != total {
+		t.Errorf("DocCount = %d, shards hold %d", n, total)
+	}
+	page := filepath.Join(root, "page07.html")
+	if doc, err := shardFor(idx, page+"#pool").Document(page + "#pool"); err != nil || doc == nil {
+		t.Errorf("section of %s isn't on the page's shard: %v", page, err)
+	}
+
+	sections := bleve.NewTermQuery(kindSection)
+	sections.SetField("Kind")
+	res, err := idx.Search(bleve.NewSearchRequestOptions(sections, pages*2, 0, false))
+	if err != nil || res.Total != pages {
+		t.Errorf("fan-out search = %v, %v", res, err)
+	}
+	if !docsetsUpToDate(idx) || !schemaUpToDate(idx) {
+		t.Error("the stamps of the build aren't read back")
+	}
+	if _, err := optimizeIndex(context.Background(), idx); err != nil {
+		t.Errorf("optimize: %v", err)
+	}
+
+	copied := filepath.Join(t.TempDir(), "copy")
+	if err := s.CopyTo(bleve.FileSystemDirectory(copied)); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := openIndex(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := cp.DocCount(); n != total {
+		t.Errorf("copy has %d documents, want %d", n, total)
+	}
+	cp.Close()
+}
+
+func TestJumpHash(t *testing.T) {
+	const keys = 10000
+	moved := 0
+	for k := uint64(0); k < keys; k++ {
+		key := shardKey(fmt.Sprintf("/docs/page%d.html", k))
+		before, after := jumpHash(key, 4), jumpHash(key, 5)
+		if before < 0 || before >= 4 || after < 0 || after >= 5 {
+			t.Fatalf("key %d hashed to %d and %d", k, before, after)
+		}
+		if before != after {
+			moved++
+		}
+	}
+	// about a fifth of the keys move to the new shard, none elsewhere
+	if moved < keys/6 || moved > keys/4 {
+		t.Errorf("%d of %d keys moved going from 4 to 5 shards", moved, keys)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// shareParam carries a share token on a shared URL
+const shareParam = "share"
+
+// shareTokenPrefix sets share tokens apart from session cookies, which are
+// signed with the same secret
+const shareTokenPrefix = "share:"
+
+const (
+	defaultShareHours = 24
+	maxShareHours     = 30 * 24
+)
+
+// shareGrant is the payload of a share token. It grants anonymous access to
+// exactly one path and query until it expires.
+type shareGrant struct {
+	Path    string `json:"path"`
+	Query   string `json:"query,omitempty"`
+	By      string `json:"by"`
+	Expires int64  `json:"exp"`
+}
+
+func newShareToken(g shareGrant) (string, error) {
+	payload, err := json.Marshal(g)
+	if err != nil {
+		return "", err
+	}
+	return sign(append([]byte(shareTokenPrefix), payload...)), nil
+}
+
+// sharedAccess reports whether r carries a valid share token for its URL
+func sharedAccess(r *http.Request) bool {
+	token := r.URL.Query().Get(shareParam)
+	if token == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	payload, err := verify(token)
+	if err != nil {
+		return false
+	}
+	grant, ok := strings.CutPrefix(string(payload), shareTokenPrefix)
+	if !ok {
+		return false
+	}
+	var g shareGrant
+	if err := json.Unmarshal([]byte(grant), &g); err != nil {
+		return false
+	}
+	if time.Now().Unix() > g.Expires {
+		return false
+	}
+	// the stylesheets and scripts of the shared page load with its token
+	if strings.HasPrefix(r.URL.Path, "/_static/") {
+		return true
+	}
+	return g.Path == r.URL.Path && g.Query == shareQuery(r.URL.Query())
+}
+
+// shareQuery is the query without the share token, in canonical order
+func shareQuery(params url.Values) string {
+	rest := make(url.Values, len(params))
+	for k, v := range params {
+		if k != shareParam {
+			rest[k] = v
+		}
+	}
+	return rest.Encode()
+}
+
+// ShareRequest is the body of POST /api/share
+type ShareRequest struct {
+	URL   string `json:"url"`
+	Hours int    `json:"hours"`
+}
+
+// ShareResponse is the body returned by POST /api/share
+type ShareResponse struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// handleShare creates a link that opens a document or a search page without
+// logging in. Shared visitors see what anonymous users would, so documents
+// of restricted docsets can't be shared.
+func handleShare(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok || !authEnabled() {
+		writeError(w, r, http.StatusBadRequest, "Share links need authentication to be enabled")
+		return
+	}
+
+	var req ShareRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if req.Hours == 0 {
+		req.Hours = defaultShareHours
+	}
+	if req.Hours < 0 || req.Hours > maxShareHours {
+		writeError(w, r, http.StatusBadRequest, "hours must be between 1 and 720")
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+		writeError(w, r, http.StatusBadRequest, "url must be a path like /guides/start.html or /search?q=...")
+		return
+	}
+	if u.Path != "/search" {
+		path, _, err := documentPathFor(r.Context(), u.Path)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Only documents and search pages can be shared")
+			return
+		}
+		if !canAccessPath(context.Background(), path) {
+			writeError(w, r, http.StatusForbidden, "Documents of restricted docsets can't be shared")
+			return
+		}
+	}
+
+	g := shareGrant{
+		Path:    u.Path,
+		Query:   shareQuery(u.Query()),
+		By:      p.Name,
+		Expires: time.Now().Add(time.Duration(req.Hours) * time.Hour).Unix(),
+	}
+	token, err := newShareToken(g)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	shared := g.Path + "?"
+	if g.Query != "" {
+		shared += g.Query + "&"
+	}
+	shared += shareParam + "=" + token
+	writeJSON(w, http.StatusOK, ShareResponse{URL: absoluteURL(shared), Expires: time.Unix(g.Expires, 0).UTC()})
+}
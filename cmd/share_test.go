@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createShare asks handleShare for a link as a member of groups and returns
+// the response
+func createShare(t *testing.T, body string, groups ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/api/share", strings.NewReader(body)).WithContext(memberContext(groups...))
+	return serve(http.HandlerFunc(handleShare), r)
+}
+
+func TestShareLinks(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{"guides/start.html", "security/playbooks/incident.html"} {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("<html></html>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := restrictedConfig
+	cfg.Auth = AuthConfig{Users: []AuthUser{{Name: "alice", Password: "s3cret"}}}
+	withConfig(t, cfg)
+	withRoot(t, dir)
+	oldSecret := sessionSecret
+	sessionSecret = []byte("test-secret")
+	t.Cleanup(func() { sessionSecret = oldSecret })
+
+	rec := createShare(t, `{"url": "/search?q=pool&type=md", "hours": 2}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("share search = %d %s", rec.Code, rec.Body.String())
+	}
+	var resp ShareResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(resp.Expires); d < time.Hour || d > 2*time.Hour {
+		t.Errorf("expires in %v, want 2h", d)
+	}
+	shared, err := url.Parse(resp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := requireAuth(okHandler)
+	token := shared.Query().Get(shareParam)
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{shared.RequestURI(), http.StatusOK},
+		// parameters in another order are the same search
+		{"/search?type=md&q=pool&share=" + token, http.StatusOK},
+		{"/search?q=secret&type=md&share=" + token, http.StatusUnauthorized},
+		{"/guides/start.html?share=" + token, http.StatusUnauthorized},
+		{"/search?q=pool&type=md&share=" + token + "x", http.StatusUnauthorized},
+		// the shared page's assets load with its token
+		{"/_static/style.css?share=" + token, http.StatusOK},
+		{"/_static/style.css", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if rec := serve(h, httptest.NewRequest(http.MethodGet, tt.target, nil)); rec.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.target, rec.Code, tt.want)
+		}
+	}
+
+	// the token doesn't pass for a session cookie
+	r := httptest.NewRequest(http.MethodGet, "/guides/start.html", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	if rec := serve(h, r); rec.Code != http.StatusUnauthorized {
+		t.Errorf("share token as session cookie = %d, want 401", rec.Code)
+	}
+
+	expired, err := newShareToken(shareGrant{Path: "/guides/start.html", Expires: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(h, httptest.NewRequest(http.MethodGet, "/guides/start.html?share="+expired, nil)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expired share = %d, want 401", rec.Code)
+	}
+
+	for body, want := range map[string]int{
+		`{"url": "/guides/start.html"}`:                 http.StatusOK,
+		`{"url": "/security/playbooks/incident.html"}`:  http.StatusForbidden,
+		`{"url": "/guides/missing.html"}`:               http.StatusBadRequest,
+		`{"url": "/guides/../../etc/passwd.html"}`:      http.StatusBadRequest,
+		`{"url": "https://evil.example.com/search"}`:    http.StatusBadRequest,
+		`{"url": "/guides/start.html", "hours": 10000}`: http.StatusBadRequest,
+	} {
+		if rec := createShare(t, body, "security"); rec.Code != want {
+			t.Errorf("share %s = %d, want %d", body, rec.Code, want)
+		}
+	}
+}
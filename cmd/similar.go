@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+const (
+	// similarTerms is how many of a document's most significant terms
+	// look for related documents
+	similarTerms = 12
+	// defaultSimilar and maxSimilar bound the related documents returned
+	defaultSimilar = 5
+	maxSimilar     = 20
+)
+
+// SimilarDocument is a document related to another
+type SimilarDocument struct {
+	Path  string  `json:"path"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// SimilarResponse is the body of /api/similar/{path}
+type SimilarResponse struct {
+	Path string `json:"path"`
+	// Terms are the significant terms of the document the related
+	// documents were found with, most significant first
+	Terms     []string          `json:"terms"`
+	Documents []SimilarDocument `json:"documents"`
+}
+
+// significantTerms returns the terms of the document id that are frequent
+// in it and rare in the index, weighted by tf-idf, most significant first.
+// The content is analyzed the way it was indexed, so the terms match the
+// index as they are.
+func significantTerms(ctx context.Context, idx bleve.Index, id string) (map[string]float64, []string, error) {
+	req := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery([]string{id}), 1, 0, false)
+	req.Fields = []string{"Title", "Content", "Language"}
+	res, err := idx.SearchInContext(ctx, req)
+	if err != nil || len(res.Hits) == 0 {
+		return nil, nil, err
+	}
+	fields := res.Hits[0].Fields
+	title, _ := fields["Title"].(string)
+	content, _ := fields["Content"].(string)
+	lang, _ := fields["Language"].(string)
+
+	analyzer := contentAnalyzer(idx, lang)
+	if analyzer == nil {
+		return nil, nil, nil
+	}
+	freq := make(map[string]int)
+	for _, token := range analyzer.Analyze([]byte(title + "\n" + content)) {
+		if term := string(token.Term); len([]rune(term)) > 2 && strings.IndexFunc(term, unicode.IsLetter) >= 0 {
+			freq[term]++
+		}
+	}
+
+	// on a sharded index the document's shard stands in for the whole index
+	adv, err := shardFor(idx, id).Advanced()
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := adv.Reader()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+	total, err := reader.DocCount()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	weights := make(map[string]float64, len(freq))
+	for term, tf := range freq {
+		tfr, err := reader.TermFieldReader(ctx, []byte(term), "Content", false, false, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		df := tfr.Count()
+		tfr.Close()
+		// terms in nearly every document say nothing about this one
+		if df == 0 || float64(df) > float64(total)/2 {
+			continue
+		}
+		weights[term] = float64(tf) * math.Log(float64(total)/float64(df))
+	}
+	terms := make([]string, 0, len(weights))
+	for term := range weights {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if weights[terms[i]] != weights[terms[j]] {
+			return weights[terms[i]] > weights[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > similarTerms {
+		terms = terms[:similarTerms]
+	}
+	return weights, terms, nil
+}
+
+// similarDocuments finds the pages sharing the most significant terms of
+// the document id, leaving out the document itself, its sections and
+// examples, and the docsets in denied
+func similarDocuments(ctx context.Context, idx bleve.Index, id string, denied []string, size int) ([]string, []SimilarDocument, error) {
+	weights, terms, err := significantTerms(ctx, idx, id)
+	if err != nil || len(terms) == 0 {
+		return terms, nil, err
+	}
+	should := make([]query.Query, 0, len(terms))
+	for _, term := range terms {
+		tq := bleve.NewTermQuery(term)
+		tq.SetField("Content")
+		tq.SetBoost(weights[term])
+		should = append(should, tq)
+	}
+	q := bleve.NewBooleanQuery()
+	q.AddShould(should...)
+	q.AddMustNot(bleve.NewDocIDQuery([]string{id}))
+	for _, kind := range []string{kindExample, kindSection} {
+		tq := bleve.NewTermQuery(kind)
+		tq.SetField("Kind")
+		q.AddMustNot(tq)
+	}
+
+	req := bleve.NewSearchRequestOptions(restrictQuery(q, denied), size, 0, false)
+	req.Fields = []string{"Title", "Docset"}
+	res, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return terms, nil, err
+	}
+	docs := make([]SimilarDocument, 0, len(res.Hits))
+	for _, hit := range res.Hits {
+		if !hitAllowed(hit.ID, denied) {
+			continue
+		}
+		rel, err := filepath.Rel(root, hit.ID)
+		if err != nil {
+			continue
+		}
+		title, _ := hit.Fields["Title"].(string)
+		docs = append(docs, SimilarDocument{Path: filepath.ToSlash(rel), Title: title, Score: hit.Score})
+	}
+	return terms, docs, nil
+}
+
+// handleAPISimilar returns the documents related to the one at the path
+func handleAPISimilar(w http.ResponseWriter, r *http.Request) {
+	path, _, err := documentPath(r, r.PathValue("path"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	size := defaultSimilar
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSimilar {
+			writeError(w, r, http.StatusBadRequest, "size must be between 1 and "+strconv.Itoa(maxSimilar))
+			return
+		}
+		size = n
+	}
+
+	terms, docs, err := similarDocuments(r.Context(), index, path, deniedDocsets(r.Context()), size)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if terms == nil {
+		terms = []string{}
+	}
+	if docs == nil {
+		docs = []SimilarDocument{}
+	}
+	writeJSON(w, http.StatusOK, SimilarResponse{Path: tagKey(path), Terms: terms, Documents: docs})
+}
+
+// handleRelated renders the related documents of a search result, which
+// its side panel fetches when opened
+func handleRelated(w http.ResponseWriter, r *http.Request) {
+	path, _, err := documentPath(r, r.URL.Query().Get("path"))
+	if err != nil {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	_, docs, err := similarDocuments(r.Context(), index, path, deniedDocsets(r.Context()), defaultSimilar)
+	if err != nil {
+		log.Printf("Error finding documents related to %s: %v", path, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "related_entries", struct {
+		Page
+		Documents []SimilarDocument
+	}{newPage(r, "search.related"), docs})
+}
+
+// maxCachedRelated bounds the pages whose related documents are cached
+const maxCachedRelated = 1000
+
+// relatedCache keeps the related documents of served pages, which take a
+// search to find, for as long as the server has the same index and build
+var relatedCache = struct {
+	sync.Mutex
+	index bleve.Index
+	build string
+	docs  map[string][]SimilarDocument
+}{}
+
+// cachedRelated is similarDocuments for a served page, cached per page and
+// set of denied docsets until the next index build
+func cachedRelated(ctx context.Context, path string, denied []string) ([]SimilarDocument, error) {
+	build, _ := index.GetInternal([]byte(buildInternalKey))
+	key := path + "\x00" + strings.Join(denied, ",")
+	relatedCache.Lock()
+	if relatedCache.index != index || relatedCache.build != string(build) || len(relatedCache.docs) >= maxCachedRelated {
+		relatedCache.index, relatedCache.build, relatedCache.docs = index, string(build), make(map[string][]SimilarDocument)
+	}
+	docs, ok := relatedCache.docs[key]
+	relatedCache.Unlock()
+	if ok {
+		return docs, nil
+	}
+
+	_, docs, err := similarDocuments(ctx, index, path, denied, defaultSimilar)
+	if err != nil {
+		return nil, err
+	}
+	relatedCache.Lock()
+	if relatedCache.index == index && relatedCache.build == string(build) {
+		relatedCache.docs[key] = docs
+	}
+	relatedCache.Unlock()
+	return docs, nil
+}
+
+// relatedNav lists related documents at the bottom of served pages, styled
+// inline like tocNav
+var relatedNav = template.Must(template.New("related").Parse(`<nav class="godochive-related" style="border-top:1px solid #ddd;padding:.5em 0;margin:1em 0 0;font-size:.9em">` +
+	`<strong>{{.Label}}</strong><ul style="margin:.25em 0 0;padding-left:1.25em">{{range .Documents}}<li><a href="/{{.Path}}">{{.Title}}</a></li>{{end}}</ul></nav>`))
+
+var bodyEndTag = regexp.MustCompile(`(?i)</body\s*>`)
+
+// withRelated returns the HTML page content with the documents related to
+// the one at path, as far as r may see them, before the closing body tag.
+// Pages without related documents are returned as they are.
+func withRelated(r *http.Request, path string, content []byte) []byte {
+	docs, err := cachedRelated(r.Context(), path, deniedDocsets(r.Context()))
+	if err != nil {
+		log.Printf("Error finding documents related to %s: %v", path, err)
+	}
+	if len(docs) == 0 {
+		return content
+	}
+	var nav bytes.Buffer
+	err = relatedNav.Execute(&nav, struct {
+		Label     string
+		Documents []SimilarDocument
+	}{newPage(r, "search.related").T("search.related"), docs})
+	if err != nil {
+		return content
+	}
+	return beforeBodyEnd(content, nav.Bytes())
+}
+
+// beforeBodyEnd inserts extra before the closing body tag of content, or at
+// its end when there is none
+func beforeBodyEnd(content, extra []byte) []byte {
+	at := len(content)
+	if loc := bodyEndTag.FindIndex(content); loc != nil {
+		at = loc[0]
+	}
+	out := make([]byte, 0, len(content)+len(extra))
+	out = append(out, content[:at]...)
+	out = append(out, extra...)
+	return append(out, content[at:]...)
+}
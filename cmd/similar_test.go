@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSimilarDocuments(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	dir := t.TempDir()
+	pages := map[string]string{
+		"guides/pool.html":              "<title>Pools</title><p>The connection pool keeps idle connections open. The pool size limits idle connections.</p></body>",
+		"guides/tuning.html":            "<title>Tuning</title><p>Tune the pool size to the number of idle connections you expect.</p>",
+		"guides/cache.html":             "<title>Cache</title><p>The cache stores responses until eviction.</p>",
+		"guides/deploy.html":            "<title>Deploy</title><p>Deploy the service with the release script.</p>",
+		"guides/logs.html":              "<title>Logs</title><p>Logs are rotated daily by the agent.</p>",
+		"security/playbooks/leaks.html": "<title>Leaks</title><p>Leaked idle connections exhaust the pool.</p>",
+	}
+	for rel, html := range pages {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(html), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	if _, err := buildIndex(root); err != nil {
+		t.Fatal(err)
+	}
+
+	similar := func(r *http.Request) SimilarResponse {
+		r.SetPathValue("path", "guides/pool.html")
+		rec := serve(http.HandlerFunc(handleAPISimilar), r)
+		var resp SimilarResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("similar = %d (%v)", rec.Code, err)
+		}
+		return resp
+	}
+
+	resp := similar(httptest.NewRequest(http.MethodGet, "/api/similar/guides/pool.html", nil))
+	if len(resp.Documents) == 0 || resp.Documents[0].Path != "guides/tuning.html" {
+		t.Errorf("documents = %+v, want the tuning guide first", resp.Documents)
+	}
+	for _, doc := range resp.Documents {
+		if doc.Path == "guides/pool.html" || strings.HasPrefix(doc.Path, "security/") {
+			t.Errorf("documents include %s", doc.Path)
+		}
+	}
+	if len(resp.Terms) == 0 || !contains(resp.Terms, "idle") {
+		t.Errorf("terms = %q, want idle among them", resp.Terms)
+	}
+
+	member := similar(httptest.NewRequest(http.MethodGet, "/api/similar/guides/pool.html", nil).WithContext(memberContext("security")))
+	found := false
+	for _, doc := range member.Documents {
+		found = found || doc.Path == "security/playbooks/leaks.html"
+	}
+	if !found {
+		t.Errorf("documents for a member = %+v, want the playbook", member.Documents)
+	}
+
+	// served pages list them at the bottom when configured
+	config.DocumentRelated = true
+	out := string(withRelated(httptest.NewRequest(http.MethodGet, "/guides/pool.html", nil), filepath.Join(root, "guides/pool.html"), []byte(pages["guides/pool.html"])))
+	if !strings.Contains(out, `<a href="/guides/tuning.html">Tuning</a>`) || !strings.HasSuffix(out, "</nav></body>") {
+		t.Errorf("served page = %s", out)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// maxSitemapURLs is the most URLs one sitemap file may list
+const maxSitemapURLs = 50000
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// handleSitemap lists every indexed document the caller may read, with its
+// modification time, for intranet crawlers and search appliances. Past
+// maxSitemapURLs documents it serves a sitemap index instead, whose
+// entries are the pages /sitemap.xml?page=1, 2, ...
+func handleSitemap(w http.ResponseWriter, r *http.Request) {
+	denied := deniedDocsets(r.Context())
+	// examples and sections are parts of their pages, which are listed
+	q := restrictQuery(pagesOnly(bleve.NewMatchAllQuery()), denied)
+
+	var out interface{}
+	if p := r.URL.Query().Get("page"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			renderError(w, r, http.StatusBadRequest)
+			return
+		}
+		set, err := sitemapPage(q, denied, (n-1)*maxSitemapURLs)
+		if err != nil {
+			log.Printf("Error building sitemap: %v", err)
+			renderError(w, r, http.StatusInternalServerError)
+			return
+		}
+		if len(set.URLs) == 0 && n > 1 {
+			renderError(w, r, http.StatusNotFound)
+			return
+		}
+		out = set
+	} else {
+		count, err := index.Search(bleve.NewSearchRequestOptions(q, 0, 0, false))
+		if err != nil {
+			log.Printf("Error building sitemap: %v", err)
+			renderError(w, r, http.StatusInternalServerError)
+			return
+		}
+		if count.Total > maxSitemapURLs {
+			idx := sitemapIndex{}
+			for n := 1; uint64(n-1)*maxSitemapURLs < count.Total; n++ {
+				idx.Sitemaps = append(idx.Sitemaps, sitemapURL{Loc: absoluteURL(fmt.Sprintf("/sitemap.xml?page=%d", n))})
+			}
+			out = idx
+		} else if out, err = sitemapPage(q, denied, 0); err != nil {
+			log.Printf("Error building sitemap: %v", err)
+			renderError(w, r, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Printf("Error encoding sitemap: %v", err)
+	}
+}
+
+// sitemapPage lists up to maxSitemapURLs documents matching q, in ID order
+// so pages don't overlap
+func sitemapPage(q query.Query, denied []string, from int) (sitemapURLSet, error) {
+	set := sitemapURLSet{URLs: []sitemapURL{}}
+	searchRequest := bleve.NewSearchRequestOptions(q, maxSitemapURLs, from, false)
+	searchRequest.Fields = []string{"ModifiedAt"}
+	searchRequest.SortBy([]string{"_id"})
+
+	result, err := index.Search(searchRequest)
+	if err != nil {
+		return set, err
+	}
+	for _, hit := range result.Hits {
+		if !hitAllowed(hit.ID, denied) {
+			continue
+		}
+		rel, err := filepath.Rel(root, hit.ID)
+		if err != nil {
+			continue
+		}
+		// paths are percent-encoded as the protocol asks; the encoder
+		// escapes what XML needs, like the & of "R&D.html"
+		u := sitemapURL{Loc: absoluteURL((&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath())}
+		if s, ok := hit.Fields["ModifiedAt"].(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				u.LastMod = t.UTC().Format(time.RFC3339)
+			}
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	return set, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := restrictedConfig
+	cfg.BaseURL = "https://docs.example.com"
+	withConfig(t, cfg)
+	withRoot(t, "/docs")
+	idx := withEmptyIndex(t)
+
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, rel := range []string{"guides/a.html", "guides/b.md", "guides/R&D notes.html", "security/playbooks/c.html"} {
+		path := filepath.Join(root, rel)
+		if err := idx.Index(path, Document{Title: rel, URL: path, Docset: docsetFor(path), ModifiedAt: modified}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	example := filepath.Join(root, "guides/a.html") + "#example-1"
+	if err := idx.Index(example, Document{Title: "example", URL: example, Kind: kindExample}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(http.HandlerFunc(handleSitemap), httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("sitemap = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var set sitemapURLSet
+	if err := xml.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	want := []sitemapURL{
+		{Loc: "https://docs.example.com/guides/R&D%20notes.html", LastMod: "2024-05-01T12:00:00Z"},
+		{Loc: "https://docs.example.com/guides/a.html", LastMod: "2024-05-01T12:00:00Z"},
+		{Loc: "https://docs.example.com/guides/b.md", LastMod: "2024-05-01T12:00:00Z"},
+	}
+	if len(set.URLs) != len(want) || set.URLs[0] != want[0] || set.URLs[1] != want[1] || set.URLs[2] != want[2] {
+		t.Errorf("sitemap URLs = %+v, want %+v", set.URLs, want)
+	}
+	if !strings.Contains(rec.Body.String(), "<loc>https://docs.example.com/guides/R&amp;D%20notes.html</loc>") {
+		t.Errorf("the & of a path isn't escaped:\n%s", rec.Body.String())
+	}
+
+	for target, code := range map[string]int{
+		"/sitemap.xml?page=1": http.StatusOK,
+		"/sitemap.xml?page=2": http.StatusNotFound,
+		"/sitemap.xml?page=x": http.StatusBadRequest,
+	} {
+		if rec := serve(http.HandlerFunc(handleSitemap), httptest.NewRequest(http.MethodGet, target, nil)); rec.Code != code {
+			t.Errorf("%s = %d, want %d", target, rec.Code, code)
+		}
+	}
+}
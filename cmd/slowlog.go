@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// searchTiming is what the slow-query log knows about one search
+type searchTiming struct {
+	// Query is the bleve query that was run, as JSON
+	Query string
+	Hits  uint64
+	// Bleve is how long the index took, as bleve measured it
+	Bleve time.Duration
+}
+
+func newSearchTiming(req *bleve.SearchRequest, res *bleve.SearchResult) searchTiming {
+	t := searchTiming{Hits: res.Total, Bleve: res.Took}
+	if data, err := json.Marshal(req.Query); err == nil {
+		t.Query = string(data)
+	}
+	return t
+}
+
+// slowQueryThreshold is the latency above which searches are logged, 0
+// when slow_query_ms is unset
+func slowQueryThreshold() time.Duration {
+	return time.Duration(config.SlowQueryMS) * time.Millisecond
+}
+
+// logSlowSearch logs the search for text that r asked for when it took
+// longer than slow_query_ms since start. render is the time spent writing
+// the response; whatever isn't that or bleve's is reranking, loading
+// stored fields, snippets and facets.
+func logSlowSearch(r *http.Request, text string, t searchTiming, start time.Time, render time.Duration) {
+	threshold := slowQueryThreshold()
+	total := time.Since(start)
+	if text == "" || threshold <= 0 || total < threshold {
+		return
+	}
+	other := total - t.Bleve - render
+	if other < 0 {
+		other = 0
+	}
+	log.Printf("Slow search %s %s: q=%q hits=%d total=%s bleve=%s render=%s other=%s request_id=%s query=%s",
+		r.Method, r.URL.Path, text, t.Hits, total.Round(time.Millisecond), t.Bleve.Round(time.Millisecond),
+		render.Round(time.Millisecond), other.Round(time.Millisecond), requestIDFrom(r.Context()), t.Query)
+}
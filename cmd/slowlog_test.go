@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogSlowSearch(t *testing.T) {
+	withConfig(t, Config{SlowQueryMS: 500})
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	_, timing, err := performTimedSearch("pooling", searchFilter{}, 0, 10, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timing.Hits != 1 || !strings.Contains(timing.Query, "pooling") {
+		t.Errorf("timing = %+v, want one hit and the query", timing)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/search?q=pooling", nil)
+	logSlowSearch(r, "pooling", timing, time.Now(), 0)
+	if buf.Len() != 0 {
+		t.Errorf("a fast search was logged: %s", buf.String())
+	}
+	logSlowSearch(r, "pooling", timing, time.Now().Add(-time.Second), 200*time.Millisecond)
+	line := buf.String()
+	for _, want := range []string{"Slow search GET /search", `q="pooling"`, "hits=1", "render=200ms", "pooling"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log line %q lacks %q", line, want)
+		}
+	}
+
+	buf.Reset()
+	withConfig(t, Config{})
+	logSlowSearch(r, "pooling", timing, time.Now().Add(-time.Minute), 0)
+	if buf.Len() != 0 {
+		t.Errorf("logged without slow_query_ms: %s", buf.String())
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2/search"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const snippetLength = 150
+
+// snippetClusterGap is how far apart two matches can be and still be shown
+// in the same fragment of a snippet
+const snippetClusterGap = 40
+
+// snippetPolicy keeps the <mark> tags of a highlighted snippet and escapes
+// or drops everything else, so markup in an indexed document can't get into
+// the search page
+var snippetPolicy = bluemonday.NewPolicy().AllowElements("mark")
+
+// snippetFor builds the result snippet of hit from the first source
+// configured for its docset that has text. Without one it falls back to the
+// summary for title-only matches and to the start of the content otherwise.
+func snippetFor(docset string, hit *search.DocumentMatch) template.HTML {
+	var sources []string
+	for _, ds := range config.Docsets {
+		if ds.Name == docset {
+			sources = ds.SnippetSources
+			break
+		}
+	}
+
+	for _, source := range sources {
+		switch source {
+		case "meta_description":
+			if s, _ := hit.Fields["Description"].(string); s != "" {
+				return plainSnippet(s)
+			}
+		case "first_paragraph":
+			if s, _ := hit.Fields["Summary"].(string); s != "" {
+				return plainSnippet(s)
+			}
+		case "highlight":
+			content, _ := hit.Fields["Content"].(string)
+			if snippet := matchSnippet(content, hit.Locations["Content"]); snippet != "" {
+				return sanitizeSnippet(string(snippet))
+			}
+			if fragments := hit.Fragments["Content"]; len(fragments) > 0 {
+				return sanitizeSnippet(fragments[0])
+			}
+		}
+	}
+
+	// when only the title matched, the start of the content is often just
+	// navigation, so the summary paragraph makes a better snippet
+	if len(hit.Fragments["Content"]) == 0 {
+		if s, _ := hit.Fields["Summary"].(string); s != "" {
+			return plainSnippet(s)
+		}
+	}
+	content, _ := hit.Fields["Content"].(string)
+	return plainSnippet(content)
+}
+
+func plainSnippet(s string) template.HTML {
+	return template.HTML(template.HTMLEscapeString(truncate(s, snippetLength)))
+}
+
+// sanitizeSnippet makes highlighted HTML safe to show. The fragment
+// formatter and matchSnippet both escape the text around their <mark> tags,
+// this is in case one of them ever misses something.
+func sanitizeSnippet(s string) template.HTML {
+	return template.HTML(snippetPolicy.Sanitize(s))
+}
+
+// matchSpan is a match in the content, as byte offsets
+type matchSpan struct{ start, end int }
+
+// matchCluster is a run of matches close together
+type matchCluster struct {
+	spans []matchSpan
+}
+
+func (c matchCluster) start() int { return c.spans[0].start }
+func (c matchCluster) end() int   { return c.spans[len(c.spans)-1].end }
+
+// matchSnippet cuts a snippet around the matches in content. Matches close
+// together get one fragment of the full snippet length; matches scattered
+// through the page get two fragments of half the length each, around the
+// two densest runs of matches, so both show instead of one cut short, or
+// one fragment when those would overlap. It returns "" when there are no
+// usable match locations.
+func matchSnippet(content string, locations search.TermLocationMap) template.HTML {
+	clusters := matchClusters(content, locations)
+	if len(clusters) == 0 {
+		return ""
+	}
+	length := snippetLength
+	if len(clusters) > 1 {
+		// the two clusters with the most matches, kept in page order
+		clusters = append([]matchCluster(nil), clusters...)
+		sort.SliceStable(clusters, func(i, j int) bool { return len(clusters[i].spans) > len(clusters[j].spans) })
+		clusters = clusters[:2]
+		sort.Slice(clusters, func(i, j int) bool { return clusters[i].start() < clusters[j].start() })
+		length = snippetLength / 2
+		// clusters a little more than the gap apart would get fragments
+		// that overlap and repeat text, so they share one instead
+		_, _, firstEnd := snippetFragment(content, clusters[0], length)
+		if _, secondStart, _ := snippetFragment(content, clusters[1], length); secondStart < firstEnd {
+			merged := matchCluster{spans: append(append([]matchSpan(nil), clusters[0].spans...), clusters[1].spans...)}
+			clusters, length = []matchCluster{merged}, snippetLength
+		}
+	}
+
+	var b strings.Builder
+	end := 0
+	for i, c := range clusters {
+		fragment, start, fragmentEnd := snippetFragment(content, c, length)
+		switch {
+		case i > 0 && start > end:
+			b.WriteString(" … ")
+		case i > 0:
+			b.WriteString(" ")
+		case start > 0:
+			b.WriteString("… ")
+		}
+		b.WriteString(fragment)
+		end = fragmentEnd
+	}
+	if end < len(content) {
+		b.WriteString(" …")
+	}
+	return template.HTML(b.String())
+}
+
+// matchClusters sorts the match locations in content and groups those no
+// more than snippetClusterGap bytes apart
+func matchClusters(content string, locations search.TermLocationMap) []matchCluster {
+	var spans []matchSpan
+	for _, locs := range locations {
+		for _, loc := range locs {
+			start, end := int(loc.Start), int(loc.End)
+			if start < end && end <= len(content) {
+				spans = append(spans, matchSpan{start, end})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var clusters []matchCluster
+	for _, span := range spans {
+		if n := len(clusters); n > 0 && span.start <= clusters[n-1].end()+snippetClusterGap {
+			if span.start >= clusters[n-1].end() {
+				clusters[n-1].spans = append(clusters[n-1].spans, span)
+			}
+			continue
+		}
+		clusters = append(clusters, matchCluster{spans: []matchSpan{span}})
+	}
+	return clusters
+}
+
+// snippetFragment is about length bytes of content around c, cut at
+// spaces, with its matches marked. It returns the escaped fragment and
+// where it starts and ends in content.
+func snippetFragment(content string, c matchCluster, length int) (string, int, int) {
+	// a run of matches longer than the fragment keeps its first matches
+	for len(c.spans) > 1 && c.end()-c.start() > length {
+		c.spans = c.spans[:len(c.spans)-1]
+	}
+	pad := max((length-(c.end()-c.start()))/2, 0)
+	start := wordStart(content, max(c.start()-pad, 0), c.start())
+	end := wordEnd(content, min(c.end()+pad, len(content)), c.end())
+
+	var b strings.Builder
+	pos := start
+	for _, span := range c.spans {
+		b.WriteString(template.HTMLEscapeString(content[pos:span.start]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(content[span.start:span.end]) + "</mark>")
+		pos = span.end
+	}
+	b.WriteString(template.HTMLEscapeString(content[pos:end]))
+	return b.String(), start, end
+}
+
+// wordStart moves i forward to the start of a word, not past limit
+func wordStart(s string, i, limit int) int {
+	if i == 0 || s[i-1] == ' ' {
+		return i
+	}
+	if space := strings.IndexByte(s[i:limit], ' '); space >= 0 {
+		return i + space + 1
+	}
+	for i < limit && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return i
+}
+
+// wordEnd moves i back to the end of a word, not before limit
+func wordEnd(s string, i, limit int) int {
+	if i == len(s) || s[i] == ' ' {
+		return i
+	}
+	if space := strings.LastIndexByte(s[limit:i], ' '); space >= 0 {
+		return limit + space
+	}
+	for i > limit && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
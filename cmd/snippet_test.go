@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2/search"
+)
+
+func TestExtractPage(t *testing.T) {
+	page := extractPage(`<html><head><title>Pools</title><meta name="Description" content=" Tuning connection pools. "></head>
+<body><nav>Home</nav><p>
+  Pools keep   connections open.</p><p>Second.</p></body></html>`)
+
+	if page.Title != "Pools" || page.Description != "Tuning connection pools." || page.Summary != "Pools keep connections open." {
+		t.Errorf("extractPage = %+v", page)
+	}
+}
+
+func TestSnippetForFollowsDocsetOrder(t *testing.T) {
+	withConfig(t, Config{Docsets: []DocsetConfig{
+		{Name: "api", SnippetSources: []string{"meta_description", "first_paragraph"}},
+		{Name: "guides", SnippetSources: []string{"highlight", "meta_description"}},
+	}})
+	hit := &search.DocumentMatch{
+		Fields: map[string]interface{}{
+			"Content":     "Pools keep connections <open>.",
+			"Description": "Tuning & sizing pools",
+			"Summary":     "Pools keep connections open.",
+		},
+		Fragments: search.FieldFragmentMap{"Content": {"<mark>Pools</mark> keep connections &lt;open&gt;."}},
+	}
+
+	tests := []struct {
+		docset string
+		want   string
+	}{
+		{"api", "Tuning &amp; sizing pools"},
+		{"guides", "<mark>Pools</mark> keep connections &lt;open&gt;."},
+		{"other", "Pools keep connections &lt;open&gt;."},
+	}
+	for _, tt := range tests {
+		if got := string(snippetFor(tt.docset, hit)); got != tt.want {
+			t.Errorf("snippet for %s = %q, want %q", tt.docset, got, tt.want)
+		}
+	}
+
+	delete(hit.Fields, "Description")
+	if got := string(snippetFor("api", hit)); got != "Pools keep connections open." {
+		t.Errorf("without a description, snippet = %q, want the first paragraph", got)
+	}
+}
+
+func TestSnippetForSanitizesHighlights(t *testing.T) {
+	withConfig(t, Config{Docsets: []DocsetConfig{{Name: "guides", SnippetSources: []string{"highlight"}}}})
+	hit := &search.DocumentMatch{
+		Fields: map[string]interface{}{"Content": `Pools <script>alert(1)</script><img src=x onerror="alert(2)">`},
+		Fragments: search.FieldFragmentMap{"Content": {
+			`<mark onclick="alert(3)">Pools</mark> <script>alert(1)</script><img src=x onerror="alert(2)">`,
+		}},
+	}
+
+	got := string(snippetFor("guides", hit))
+	if got != "<mark>Pools</mark> " {
+		t.Errorf("sanitized fragment = %q", got)
+	}
+
+	// matched locations are cut from the stored content and escaped
+	hit.Locations = search.FieldTermLocationMap{"Content": {"pools": {{Start: 0, End: 5}}}}
+	got = string(snippetFor("guides", hit))
+	if strings.Contains(got, "<script") || strings.Contains(got, "<img") || !strings.HasPrefix(got, "<mark>Pools</mark> &lt;script&gt;") {
+		t.Errorf("sanitized match snippet = %q", got)
+	}
+}
+
+func TestExtractPageSkipsBoilerplateParagraphs(t *testing.T) {
+	page := extractPage(`<html><body>
+<header><p>Acme Docs: product guides, API reference and release notes for all teams</p></header>
+<p>Draft</p>
+<p>A connection pool keeps a set of open connections ready for reuse by requests.</p>
+</body></html>`)
+
+	if want := "A connection pool keeps a set of open connections ready for reuse by requests."; page.Summary != want {
+		t.Errorf("summary = %q, want %q", page.Summary, want)
+	}
+}
+
+func TestSnippetForTitleOnlyMatchUsesSummary(t *testing.T) {
+	withConfig(t, Config{})
+	hit := &search.DocumentMatch{Fields: map[string]interface{}{
+		"Content": "Home Guides API Pools keep connections open.",
+		"Summary": "A connection pool keeps open connections ready for reuse.",
+	}}
+
+	if got := string(snippetFor("", hit)); got != "A connection pool keeps open connections ready for reuse." {
+		t.Errorf("snippet = %q, want the summary", got)
+	}
+}
+
+func TestMatchSnippet(t *testing.T) {
+	locate := func(content string, terms ...string) search.TermLocationMap {
+		locations := search.TermLocationMap{}
+		for _, term := range terms {
+			for i := 0; ; {
+				j := strings.Index(content[i:], term)
+				if j < 0 {
+					break
+				}
+				locations[term] = append(locations[term], &search.Location{Start: uint64(i + j), End: uint64(i + j + len(term))})
+				i += j + len(term)
+			}
+		}
+		return locations
+	}
+
+	// close together: one fragment of the whole length
+	dense := "A pool keeps connections open. " + strings.Repeat("Other text goes here. ", 20)
+	got := string(matchSnippet(dense, locate(dense, "pool", "connections")))
+	if want := "A <mark>pool</mark> keeps <mark>connections</mark> open."; !strings.HasPrefix(got, want) || strings.Count(got, "…") != 1 {
+		t.Errorf("dense snippet = %q", got)
+	}
+
+	// scattered: two shorter fragments around the densest runs
+	filler := strings.Repeat("Other text goes here. ", 10)
+	scattered := filler + "The pool size is small. " + filler + "pool once. " + filler + "Each pool has a pool timeout. " + filler
+	got = string(matchSnippet(scattered, locate(scattered, "pool")))
+	if strings.Count(got, "<mark>") != 3 || strings.Count(got, "…") != 3 || len(got) > snippetLength+60 {
+		t.Errorf("scattered snippet = %q, want the first and last runs in two fragments", got)
+	}
+	if !strings.Contains(got, "The <mark>pool</mark> size") || !strings.Contains(got, "Each <mark>pool</mark> has a <mark>pool</mark> timeout") {
+		t.Errorf("scattered snippet = %q", got)
+	}
+
+	// a little more than the gap apart: the fragments would overlap, so
+	// the text between the matches shows once
+	near := filler + "The pool size is small. " + strings.Repeat("more ", 5) + "and the pool grows. " + filler
+	got = string(matchSnippet(near, locate(near, "pool")))
+	if strings.Count(got, "<mark>") != 2 || strings.Count(got, "is small") != 1 || strings.Count(got, "…") != 2 {
+		t.Errorf("snippet of nearby matches = %q, want one fragment", got)
+	}
+
+	if got := matchSnippet("no locations", nil); got != "" {
+		t.Errorf("snippet without locations = %q", got)
+	}
+	escaped := "pool <b> & more"
+	if got := string(matchSnippet(escaped, locate(escaped, "pool"))); got != "<mark>pool</mark> &lt;b&gt; &amp; more" {
+		t.Errorf("escaped snippet = %q", got)
+	}
+}
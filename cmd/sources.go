@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// sourceFetchers update the copy of a source in dir, by source type
+var sourceFetchers = map[string]func(ctx context.Context, src SourceConfig, dir string) error{
+	"crawl": fetchCrawl,
+	"git":   fetchGit,
+	"s3":    fetchS3,
+}
+
+// sourceValidators check the settings of a source type
+var sourceValidators = map[string]func(SourceConfig) error{
+	"crawl": validateCrawl,
+	"git":   validateGit,
+	"s3":    validateS3,
+}
+
+// sourceRevisioners tell the revision of the copy in dir, for the source
+// types that have revisions
+var sourceRevisioners = map[string]func(dir string) (string, error){
+	"git": gitRevision,
+}
+
+var (
+	revisionsMu sync.Mutex
+	// revisions caches the revision of each copy, by its directory
+	revisions = make(map[string]string)
+)
+
+// dir is where the copy of the source is kept, relative to the docs root
+func (s SourceConfig) dir() string {
+	if s.Dir != "" {
+		return s.Dir
+	}
+	return s.Name
+}
+
+// sourceFor returns the source whose copy holds path, nil for local docs
+func sourceFor(path string) *SourceConfig {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	for i, s := range config.Sources {
+		dir := filepath.ToSlash(s.dir())
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return &config.Sources[i]
+		}
+	}
+	return nil
+}
+
+// sourceDir is the directory of the copy of s
+func sourceDir(s SourceConfig) string {
+	return filepath.Join(root, filepath.FromSlash(s.dir()))
+}
+
+// revisionFor is the revision of its source the document at path was
+// fetched at, like a git commit, empty when the source has none
+func revisionFor(path string) string {
+	s := sourceFor(path)
+	if s == nil || sourceRevisioners[s.Type] == nil {
+		return ""
+	}
+	dir := sourceDir(*s)
+	revisionsMu.Lock()
+	defer revisionsMu.Unlock()
+	if rev, ok := revisions[dir]; ok {
+		return rev
+	}
+	rev, err := sourceRevisioners[s.Type](dir)
+	if err != nil {
+		log.Printf("Error reading the revision of %s: %v", s.Name, err)
+	}
+	revisions[dir] = rev
+	return rev
+}
+
+// forgetRevision drops the cached revision of the copy in dir after it was
+// fetched again
+func forgetRevision(dir string) {
+	revisionsMu.Lock()
+	delete(revisions, dir)
+	revisionsMu.Unlock()
+}
+
+func validateSources(sources []SourceConfig) error {
+	names := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, s := range sources {
+		if s.Name == "" {
+			return fmt.Errorf("sources: every source needs a name")
+		}
+		if names[s.Name] {
+			return fmt.Errorf("sources: the name %q is used twice", s.Name)
+		}
+		names[s.Name] = true
+		if sourceFetchers[s.Type] == nil {
+			return fmt.Errorf("sources: %q has unknown type %q", s.Name, s.Type)
+		}
+		dir := filepath.ToSlash(s.dir())
+		if path.IsAbs(dir) || path.Clean(dir) != dir || dir == "." || strings.HasPrefix(dir, "../") || dir == ".." {
+			return fmt.Errorf("sources: %q needs a dir inside the docs root, not %q", s.Name, s.dir())
+		}
+		if dirs[dir] {
+			return fmt.Errorf("sources: the dir %q is used twice", dir)
+		}
+		dirs[dir] = true
+		if s.RefreshMinutes < 0 {
+			return fmt.Errorf("sources: %q: refresh_minutes can't be negative", s.Name)
+		}
+		if err := sourceValidators[s.Type](s); err != nil {
+			return fmt.Errorf("sources: %q: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// replaceDir fills a new directory next to dir and moves it in place of dir
+// once fill succeeded, so a failed fetch leaves the old copy untouched
+func replaceDir(dir string, fill func(tmp string) error) error {
+	tmp := dir + ".new"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return err
+	}
+	if err := fill(tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// runFetch is the "fetch" command. It updates the copies of the configured
+// sources, or of the ones named, below the docs root; the index command
+// picks up the changes.
+func runFetch(args []string) error {
+	fs, opts := newFlagSet("fetch", "[flags] [source...]", false)
+	fs.Parse(args)
+	if err := opts.apply(); err != nil {
+		return err
+	}
+	sources := config.Sources
+	if fs.NArg() > 0 {
+		sources = nil
+		for _, name := range fs.Args() {
+			i := 0
+			for i < len(config.Sources) && config.Sources[i].Name != name {
+				i++
+			}
+			if i == len(config.Sources) {
+				return fmt.Errorf("no source named %q in the config", name)
+			}
+			sources = append(sources, config.Sources[i])
+		}
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no sources in the config")
+	}
+
+	for _, src := range sources {
+		start := time.Now()
+		dir := sourceDir(src)
+		if err := sourceFetchers[src.Type](context.Background(), src, dir); err != nil {
+			return fmt.Errorf("fetching %s: %w", src.Name, err)
+		}
+		fmt.Printf("Fetched %s into %s in %dms\n", src.Name, dir, time.Since(start).Milliseconds())
+	}
+	fmt.Println("Run \"godochive index\" to index the changes")
+	return nil
+}
+
+// watchSources refreshes the sources that ask for it while the server runs:
+// each is fetched again every RefreshMinutes, and the documents of its copy
+// that changed are indexed into the served index right away
+func watchSources(l *liveIndex) {
+	for _, src := range config.Sources {
+		if src.RefreshMinutes > 0 {
+			go refreshSource(l, src)
+		}
+	}
+}
+
+func refreshSource(l *liveIndex, src SourceConfig) {
+	for range time.Tick(time.Duration(src.RefreshMinutes) * time.Minute) {
+		if l.unavailable.Load() {
+			continue
+		}
+		refreshSourceOnce(l, src)
+	}
+}
+
+// refreshSourceOnce fetches src and indexes its changes into idx. A refresh
+// that comes while the docs are being indexed is skipped, the next one
+// catches up.
+func refreshSourceOnce(idx bleve.Index, src SourceConfig) {
+	if !ingesting.TryLock() {
+		log.Printf("Skipping the refresh of %s, the docs are being indexed", src.Name)
+		return
+	}
+	defer ingesting.Unlock()
+
+	dir := sourceDir(src)
+	if err := sourceFetchers[src.Type](context.Background(), src, dir); err != nil {
+		log.Printf("Error refreshing %s: %v", src.Name, err)
+		return
+	}
+	ids, err := buildIndexInto(idx, dir)
+	if err != nil {
+		log.Printf("Error indexing %s: %v", src.Name, err)
+		return
+	}
+	log.Printf("Refreshed %s, %d documents", src.Name, len(ids))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRefreshSkippedWhileIndexing(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	fetches := 0
+	sourceFetchers["test"] = func(ctx context.Context, src SourceConfig, dir string) error {
+		fetches++
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "pool.html"), []byte("<title>Pooling</title>"), 0o644)
+	}
+	t.Cleanup(func() { delete(sourceFetchers, "test") })
+	src := SourceConfig{Name: "wiki", Type: "test"}
+
+	ingesting.Lock()
+	refreshSourceOnce(idx, src)
+	ingesting.Unlock()
+	if fetches != 0 {
+		t.Errorf("refreshed %d times while indexing", fetches)
+	}
+
+	refreshSourceOnce(idx, src)
+	if n, err := idx.DocCount(); fetches != 1 || err != nil || n != 1 {
+		t.Errorf("refresh = %d fetches, %d documents, %v", fetches, n, err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+// failoverIndex serves searches from the primary index and switches to a
+// warm standby copy when the primary becomes unreadable. It wraps an index
+// alias, which makes the switch safe for concurrent searches.
+type failoverIndex struct {
+	bleve.IndexAlias
+
+	mu          sync.Mutex
+	primary     bleve.Index
+	standby     bleve.Index
+	standbyPath string
+	failedOver  bool
+}
+
+// withStandby wraps primary with a standby kept at path. The standby is
+// (re)created from the primary when it doesn't exist yet or when fresh is
+// set because the primary was just rebuilt.
+func withStandby(primary bleve.Index, path string, fresh bool) (*failoverIndex, error) {
+	f := &failoverIndex{
+		IndexAlias:  bleve.NewIndexAlias(primary),
+		primary:     primary,
+		standbyPath: path,
+	}
+
+	standby, err := openIndexUsing(path, indexRuntimeConfig())
+	switch {
+	case err == nil && !fresh:
+		f.standby = standby
+		return f, nil
+	case err == nil:
+		standby.Close()
+	case err != bleve.ErrorIndexPathDoesNotExist:
+		log.Printf("Error opening standby index, recreating it: %v", err)
+	}
+
+	if err := f.syncStandby(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// syncStandby replaces the standby with an online copy of the primary
+func (f *failoverIndex) syncStandby() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failedOver {
+		return fmt.Errorf("serving from the standby, not overwriting it")
+	}
+	copyable, ok := f.primary.(bleve.IndexCopyable)
+	if !ok {
+		return fmt.Errorf("index does not support copying")
+	}
+
+	tmp := f.standbyPath + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := copyable.CopyTo(bleve.FileSystemDirectory(tmp)); err != nil {
+		return err
+	}
+
+	if f.standby != nil {
+		f.standby.Close()
+		f.standby = nil
+	}
+	if err := os.RemoveAll(f.standbyPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.standbyPath); err != nil {
+		return err
+	}
+
+	standby, err := openIndexUsing(f.standbyPath, indexRuntimeConfig())
+	if err != nil {
+		return err
+	}
+	f.standby = standby
+	return nil
+}
+
+// CopyTo copies the index searches are served from
+func (f *failoverIndex) CopyTo(d bleveindex.Directory) error {
+	f.mu.Lock()
+	served := f.primary
+	if f.failedOver {
+		served = f.standby
+	}
+	f.mu.Unlock()
+
+	copyable, ok := served.(bleve.IndexCopyable)
+	if !ok {
+		return fmt.Errorf("index does not support copying")
+	}
+	return copyable.CopyTo(d)
+}
+
+func (f *failoverIndex) Search(req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	return f.SearchInContext(context.Background(), req)
+}
+
+// SearchInContext retries a failed search on the standby if the primary
+// turns out to be unreadable
+func (f *failoverIndex) SearchInContext(ctx context.Context, req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	res, err := f.IndexAlias.SearchInContext(ctx, req)
+	if err == nil || ctx.Err() != nil || !f.failover() {
+		return res, err
+	}
+	return f.IndexAlias.SearchInContext(ctx, req)
+}
+
+// failover switches to the standby. It first probes the primary with a
+// trivial search, so a query that is merely invalid doesn't trigger it.
+func (f *failoverIndex) failover() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failedOver || f.standby == nil {
+		return false
+	}
+	probe := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	if _, err := f.primary.Search(probe); err == nil {
+		return false
+	}
+
+	log.Printf("Primary index is unreadable, failing over to standby at %s", f.standbyPath)
+	f.IndexAlias.Swap([]bleve.Index{f.standby}, []bleve.Index{f.primary})
+	f.failedOver = true
+	return true
+}
+
+// releaseStandby closes the standby so that an index swapped in for the
+// primary can recreate it. Failed over, nothing is left to search.
+func (f *failoverIndex) releaseStandby() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.standby == nil {
+		return
+	}
+	if f.failedOver {
+		f.IndexAlias.Swap(nil, []bleve.Index{f.standby})
+	}
+	f.standby.Close()
+	f.standby = nil
+}
+
+func (f *failoverIndex) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.IndexAlias.Close()
+	err := f.primary.Close()
+	if f.standby != nil {
+		if serr := f.standby.Close(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
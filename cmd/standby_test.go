@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestStandbyFailover(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	dir := t.TempDir()
+	put := func(idx bleve.Index, title string) {
+		t.Helper()
+		doc := filepath.Join(root, title+".html")
+		if err := idx.Index(doc, Document{Title: title, Content: title, URL: doc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := func(idx bleve.Index, text string) uint64 {
+		t.Helper()
+		res, err := idx.Search(bleve.NewSearchRequest(bleve.NewMatchQuery(text)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Total
+	}
+
+	primary, err := bleve.New(filepath.Join(dir, "index.bleve"), newIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(primary, "Pooling")
+	f, err := withStandby(primary, filepath.Join(dir, "standby.bleve"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the primary is closed to break it, and closing it twice panics
+	primaryClosed := false
+	t.Cleanup(func() {
+		if !primaryClosed {
+			primary.Close()
+		}
+		f.standby.Close()
+	})
+	if total(f.standby, "pooling") != 1 {
+		t.Error("new standby isn't a copy of the primary")
+	}
+
+	put(primary, "Sharding")
+	if total(f.standby, "sharding") != 0 {
+		t.Error("standby changed before it was synced")
+	}
+	if err := f.syncStandby(); err != nil {
+		t.Fatal(err)
+	}
+	if total(f.standby, "sharding") != 1 {
+		t.Error("synced standby is missing the new document")
+	}
+
+	// a query that is merely invalid leaves the primary in place
+	if _, err := f.Search(bleve.NewSearchRequest(bleve.NewRegexpQuery("["))); err == nil || f.failedOver {
+		t.Fatalf("invalid query: err = %v, failed over = %v", err, f.failedOver)
+	}
+
+	if err := primary.Close(); err != nil {
+		t.Fatal(err)
+	}
+	primaryClosed = true
+	if total(f, "sharding") != 1 || !f.failedOver {
+		t.Errorf("searches aren't served from the standby, failed over = %v", f.failedOver)
+	}
+	if err := f.syncStandby(); err == nil {
+		t.Error("synced the standby while serving from it")
+	}
+}
@@ -0,0 +1,112 @@
+// Focus the search box with "/" like most documentation sites do
+document.addEventListener("keydown", function (e) {
+    var box = document.getElementById("search_textbox");
+    if (!box || e.key !== "/" || document.activeElement === box) {
+        return;
+    }
+    e.preventDefault();
+    box.focus();
+    box.select();
+});
+
+// Copy the code of an example result to the clipboard
+document.addEventListener("click", function (e) {
+    var button = e.target.closest(".example .copy");
+    if (!button || !navigator.clipboard) {
+        return;
+    }
+    var code = button.parentElement.querySelector("code");
+    navigator.clipboard.writeText(code.textContent).then(function () {
+        var label = button.textContent;
+        button.textContent = button.dataset.copied;
+        setTimeout(function () { button.textContent = label; }, 1500);
+    });
+});
+
+// Tell the server which result was opened, for the search analytics. A
+// beacon survives the page being left for the document.
+function reportOpen(e) {
+    var link = e.target.closest("a[data-open]");
+    if (!link || !navigator.sendBeacon) {
+        return;
+    }
+    var body = new FormData();
+    body.append("path", link.dataset.open);
+    navigator.sendBeacon("/search/open", body);
+}
+document.addEventListener("click", reportOpen);
+document.addEventListener("auxclick", reportOpen);
+
+// Update the results while typing. Requests are debounced, and a response
+// that arrives after a newer request was sent is dropped.
+(function () {
+    var box = document.getElementById("search_textbox");
+    var results = document.getElementById("results");
+    if (!box || !results || !window.fetch) {
+        return;
+    }
+    var timer, controller;
+    // checkboxes fire input events too, so type filters apply right away
+    box.form.addEventListener("input", function () {
+        clearTimeout(timer);
+        timer = setTimeout(function () {
+            if (controller) {
+                controller.abort();
+            }
+            controller = new AbortController();
+            var params = new URLSearchParams(new FormData(box.form));
+            fetch("/search/results?" + params, { signal: controller.signal })
+                .then(function (resp) {
+                    if (!resp.ok) {
+                        throw new Error(resp.statusText);
+                    }
+                    return resp.text();
+                })
+                .then(function (html) {
+                    results.innerHTML = html;
+                    history.replaceState(null, "", "/search?" + params);
+                })
+                .catch(function () {});
+        }, 250);
+    });
+})();
+
+// Load the entries of a directory in the browse tree the first time it's
+// expanded. toggle doesn't bubble, hence the capture.
+document.addEventListener("toggle", function (e) {
+    var dir = e.target;
+    if (!dir.matches || !dir.matches("details[data-src]") || !dir.open || dir.dataset.loaded || !window.fetch) {
+        return;
+    }
+    dir.dataset.loaded = "true";
+    fetch(dir.dataset.src)
+        .then(function (resp) {
+            if (!resp.ok) {
+                throw new Error(resp.statusText);
+            }
+            return resp.text();
+        })
+        .then(function (html) {
+            var summary = dir.querySelector("summary");
+            dir.innerHTML = "";
+            dir.appendChild(summary);
+            dir.insertAdjacentHTML("beforeend", html);
+        })
+        .catch(function () {
+            delete dir.dataset.loaded;
+        });
+}, true);
+
+// Apply a select marked data-autosubmit as soon as it changes
+document.addEventListener("change", function (e) {
+    if (e.target.matches("select[data-autosubmit]")) {
+        e.target.form.submit();
+    }
+});
+
+// Open the URL picked in a select marked data-navigate, e.g. saved searches
+document.addEventListener("change", function (e) {
+    if (e.target.matches("select[data-navigate]") && e.target.value) {
+        window.location = e.target.value;
+    }
+});
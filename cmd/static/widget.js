@@ -0,0 +1,104 @@
+// GoDocHive search widget. Include it on another site with
+//
+//     <div data-godochive></div>
+//     <script src="https://docs.example.com/widget.js" async></script>
+//
+// and it turns the element into a search box whose dropdown lists matching
+// documents, linking back to this server. Without such an element the box
+// is inserted where the script tag is. The site's origin must be listed in
+// the server's widget.allowed_origins.
+(function () {
+    var script = document.currentScript;
+    if (!script || !window.fetch) {
+        return;
+    }
+    var base = new URL(script.src).origin;
+
+    var style = document.createElement("style");
+    style.textContent =
+        ".gdh-widget{position:relative;display:inline-block;font:inherit}" +
+        ".gdh-widget input{width:18em;padding:4px 6px}" +
+        ".gdh-results{position:absolute;z-index:1000;left:0;right:0;margin:0;padding:0;list-style:none;" +
+        "background:#fff;color:#222;border:1px solid #ccc;box-shadow:0 2px 6px rgba(0,0,0,.15)}" +
+        ".gdh-results:empty{display:none}" +
+        ".gdh-results a{display:block;padding:4px 8px;color:inherit;text-decoration:none}" +
+        ".gdh-results a:hover,.gdh-results a:focus{background:#eef}" +
+        ".gdh-results .gdh-all{border-top:1px solid #eee;font-size:.9em}";
+    document.head.appendChild(style);
+
+    function mount(host) {
+        var form = document.createElement("form");
+        form.className = "gdh-widget";
+        form.action = base + "/search";
+        form.method = "GET";
+        form.setAttribute("role", "search");
+        var box = document.createElement("input");
+        box.type = "search";
+        box.name = "q";
+        box.autocomplete = "off";
+        box.placeholder = host.getAttribute("data-placeholder") || "Search the docs";
+        box.setAttribute("aria-label", box.placeholder);
+        var list = document.createElement("ul");
+        list.className = "gdh-results";
+        form.appendChild(box);
+        form.appendChild(list);
+        host.appendChild(form);
+
+        function item(href, text, className) {
+            var li = document.createElement("li");
+            var a = document.createElement("a");
+            a.href = href;
+            a.textContent = text;
+            if (className) {
+                a.className = className;
+            }
+            li.appendChild(a);
+            list.appendChild(li);
+        }
+
+        var timer, controller;
+        box.addEventListener("input", function () {
+            clearTimeout(timer);
+            timer = setTimeout(function () {
+                var q = box.value.trim();
+                if (controller) {
+                    controller.abort();
+                }
+                if (!q) {
+                    list.textContent = "";
+                    return;
+                }
+                controller = new AbortController();
+                var params = new URLSearchParams({ q: q, fields: "title,url", live: "1" });
+                fetch(base + "/api/v1/search?" + params, { signal: controller.signal, credentials: "include" })
+                    .then(function (resp) {
+                        if (!resp.ok) {
+                            throw new Error(resp.statusText);
+                        }
+                        return resp.json();
+                    })
+                    .then(function (data) {
+                        list.textContent = "";
+                        data.hits.forEach(function (hit) {
+                            item(base + "/" + hit.fields.url, hit.fields.title || hit.fields.url);
+                        });
+                        item(base + "/search?" + new URLSearchParams({ q: q }), "All results for “" + q + "”", "gdh-all");
+                    })
+                    .catch(function () {});
+            }, 200);
+        });
+        box.addEventListener("keydown", function (e) {
+            if (e.key === "Escape") {
+                list.textContent = "";
+            }
+        });
+    }
+
+    var hosts = document.querySelectorAll("[data-godochive]");
+    if (hosts.length === 0) {
+        var host = document.createElement("div");
+        script.parentNode.insertBefore(host, script);
+        hosts = [host];
+    }
+    Array.prototype.forEach.call(hosts, mount);
+})();
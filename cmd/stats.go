@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+const buildInternalKey = "godochive:build"
+
+// BuildInfo describes the last completed index build
+type BuildInfo struct {
+	Finished   time.Time `json:"finished"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// IndexStats is the body of /api/stats
+type IndexStats struct {
+	Documents        uint64        `json:"documents"`
+	DiskBytes        uint64        `json:"disk_bytes"`
+	Shards           int           `json:"shards"`
+	LastBuild        *BuildInfo    `json:"last_build,omitempty"`
+	DocsetsUpToDate  bool          `json:"docsets_up_to_date"`
+	AnalysisUpToDate bool          `json:"analysis_up_to_date"`
+	SchemaVersion    int           `json:"schema_version"`
+	SchemaUpToDate   bool          `json:"schema_up_to_date"`
+	Docsets          []DocsetCount `json:"docsets"`
+	Extensions       []string      `json:"extensions"`
+	Fields           []FieldInfo   `json:"fields"`
+}
+
+// DocsetCount is the number of indexed documents in a docset
+type DocsetCount struct {
+	Name      string `json:"name"`
+	Documents uint64 `json:"documents"`
+}
+
+// FieldInfo describes how a document field is analyzed and indexed
+type FieldInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Analyzer string `json:"analyzer,omitempty"`
+	Indexed  bool   `json:"indexed"`
+	Stored   bool   `json:"stored"`
+	InAll    bool   `json:"in_all"`
+}
+
+func stampBuild(idx bleve.Index, info BuildInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return idx.SetInternal([]byte(buildInternalKey), data)
+}
+
+// collectStats gathers the numbers shown by /stats and the stats command.
+// Only pages are counted, not their sections and examples, and documents
+// in denied docsets are left out.
+func collectStats(idx bleve.Index, denied []string) (IndexStats, error) {
+	stats := IndexStats{
+		DiskBytes:        indexDiskBytes(idx),
+		Shards:           len(shardsOf(idx)),
+		DocsetsUpToDate:  docsetsUpToDate(idx),
+		AnalysisUpToDate: analysisUpToDate(idx),
+		SchemaVersion:    indexSchemaVersion(idx),
+		SchemaUpToDate:   schemaUpToDate(idx),
+		Docsets:          []DocsetCount{},
+		Extensions:       allowedExtensions,
+		Fields:           fieldInfo(idx.Mapping()),
+	}
+
+	if data, err := idx.GetInternal([]byte(buildInternalKey)); err == nil && data != nil {
+		var info BuildInfo
+		if json.Unmarshal(data, &info) == nil {
+			stats.LastBuild = &info
+		}
+	}
+
+	req := bleve.NewSearchRequestOptions(restrictQuery(pagesOnly(bleve.NewMatchAllQuery()), denied), 0, 0, false)
+	req.AddFacet("docsets", bleve.NewFacetRequest("Docset", 1000))
+	res, err := idx.Search(req)
+	if err != nil {
+		return stats, err
+	}
+	stats.Documents = res.Total
+	if facet := res.Facets["docsets"]; facet != nil && facet.Terms != nil {
+		for _, t := range facet.Terms.Terms() {
+			stats.Docsets = append(stats.Docsets, DocsetCount{Name: t.Term, Documents: uint64(t.Count)})
+		}
+		// documents outside any docset have no term, so they aren't faceted
+		if facet.Missing > 0 {
+			stats.Docsets = append(stats.Docsets, DocsetCount{Documents: uint64(facet.Missing)})
+		}
+	}
+	sort.Slice(stats.Docsets, func(i, j int) bool { return stats.Docsets[i].Name < stats.Docsets[j].Name })
+	return stats, nil
+}
+
+// fieldInfo lists the fields of the document mapping, sorted by name
+func fieldInfo(m mapping.IndexMapping) []FieldInfo {
+	im, ok := m.(*mapping.IndexMappingImpl)
+	if !ok || im.DefaultMapping == nil {
+		return nil
+	}
+
+	var fields []FieldInfo
+	for name, dm := range im.DefaultMapping.Properties {
+		for _, f := range dm.Fields {
+			info := FieldInfo{Name: name, Type: f.Type, Analyzer: f.Analyzer, Indexed: f.Index, Stored: f.Store, InAll: f.IncludeInAll}
+			if info.Analyzer == "" && f.Type == "text" {
+				info.Analyzer = im.DefaultAnalyzer
+			}
+			fields = append(fields, info)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+func handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := collectStats(index, deniedDocsets(r.Context()))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := collectStats(index, deniedDocsets(r.Context()))
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Page
+		Stats IndexStats
+	}{
+		Page:  newPage(r, "stats.title"),
+		Stats: stats,
+	}
+	renderTemplate(w, "stats.html", data)
+}
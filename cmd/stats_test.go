@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIStatsHidesRestrictedDocsets(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	withRoot(t, t.TempDir())
+	withIndex(t, map[string]string{
+		"guides/a.html":                "Install",
+		"guides/b.html":                "Upgrade",
+		"security/playbooks/leak.html": "Credential leak",
+	})
+	// sections and examples of a page don't count as documents of their own
+	for _, part := range []Document{{URL: "guides/a.html#setup", Kind: kindSection}, {URL: "guides/a.html#example-1", Kind: kindExample}} {
+		part.URL = filepath.Join(root, part.URL)
+		part.Docset = docsetFor(part.URL)
+		if err := index.Index(part.URL, part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stampBuild(index, BuildInfo{Finished: time.Now().UTC(), DurationMS: 42}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/stats", nil).WithContext(memberContext("dev"))
+	rec := serve(http.HandlerFunc(handleAPIStats), r)
+
+	var stats IndexStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Documents != 2 || len(stats.Docsets) != 1 || stats.Docsets[0].Name != "guides" {
+		t.Errorf("documents = %d, docsets = %+v, want only the 2 guides", stats.Documents, stats.Docsets)
+	}
+	if stats.LastBuild == nil || stats.LastBuild.DurationMS != 42 {
+		t.Errorf("last build = %+v", stats.LastBuild)
+	}
+
+	var content *FieldInfo
+	for i, f := range stats.Fields {
+		if f.Name == "Content" {
+			content = &stats.Fields[i]
+		}
+	}
+	if content == nil || content.Analyzer != "standard" || !content.Indexed {
+		t.Errorf("Content field = %+v", content)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// store keeps server-side state that doesn't belong in the search index,
+// as JSON values in named bbolt buckets
+var store *bolt.DB
+
+func openStore(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+}
+
+func storePut(bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return store.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// storeGet decodes the value under key into v and reports whether it existed
+func storeGet(bucket, key string, v interface{}) (bool, error) {
+	var data []byte
+	err := store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		if d := b.Get([]byte(key)); d != nil {
+			data = append([]byte(nil), d...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// storeEach calls fn for every key in bucket, in key order
+func storeEach(bucket string, fn func(key string, data []byte) error) error {
+	return store.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+func storeDelete(bucket, key string) error {
+	return store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Suggestion is a page whose title completes what the user is typing
+type Suggestion struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// SuggestResponse is the body of /api/suggest
+type SuggestResponse struct {
+	Query       string       `json:"query"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// suggestQuery matches pages whose title has a word starting with each
+// word of text, since any of them can be abbreviated ("conn poo"). A
+// stemmed title term can be shorter than what was typed ("pooli" doesn't
+// prefix "pool"), so each word also counts as a whole word.
+func suggestQuery(text string) query.Query {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return bleve.NewMatchNoneQuery()
+	}
+	var clauses []query.Query
+	for _, word := range words {
+		prefix := bleve.NewPrefixQuery(word)
+		prefix.SetField("Title")
+		whole := bleve.NewMatchQuery(word)
+		whole.SetField("Title")
+		clauses = append(clauses, bleve.NewDisjunctionQuery(prefix, whole))
+	}
+	return pagesOnly(bleve.NewConjunctionQuery(clauses...))
+}
+
+// handleAPISuggest completes a partial query to page titles, for search
+// boxes that offer pages while the user types
+func handleAPISuggest(w http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("q")
+	size := 10
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 50 {
+			writeError(w, r, http.StatusBadRequest, "size must be between 1 and 50")
+			return
+		}
+		size = n
+	}
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := SuggestResponse{Query: text, Suggestions: []Suggestion{}}
+	if strings.TrimSpace(text) == "" {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	searchRequest := bleve.NewSearchRequestOptions(filter.apply(suggestQuery(text)), size, 0, false)
+	searchRequest.Fields = []string{"Title", "URL"}
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, hit := range searchResult.Hits {
+		if !hitAllowed(hit.ID, filter.Denied) {
+			continue
+		}
+		stored := toAPIHit(hit.ID, hit.Score, hit.Fields, []string{"title", "url"})
+		title, _ := stored.Fields["title"].(string)
+		url, _ := stored.Fields["url"].(string)
+		resp.Suggestions = append(resp.Suggestions, Suggestion{Title: title, URL: url})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPISuggest(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+
+	files := map[string]string{
+		"pool.html":    "<html><head><title>Connection pooling</title></head><body><p>Reuse connections.</p></body></html>",
+		"timeout.html": "<html><head><title>Connection timeouts</title></head><body><p>Give up after a while.</p></body></html>",
+		"polls.html":   "<html><head><title>Polls</title></head><body><p>Connection pooling is covered elsewhere.</p></body></html>",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	suggest := func(q string) []Suggestion {
+		rec := serve(http.HandlerFunc(handleAPISuggest), httptest.NewRequest(http.MethodGet, "/api/suggest?q="+q, nil))
+		var resp SuggestResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("suggest %q: %d, %v", q, rec.Code, err)
+		}
+		return resp.Suggestions
+	}
+	if got := suggest("conn+poo"); len(got) != 1 || got[0] != (Suggestion{Title: "Connection pooling", URL: "pool.html"}) {
+		t.Errorf("conn poo: %+v", got)
+	}
+	if got := suggest("conn"); len(got) != 2 {
+		t.Errorf("conn: %+v, want both connection pages", got)
+	}
+	if got := suggest("+"); len(got) != 0 {
+		t.Errorf("blank query: %+v", got)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withStore(t)
+	withEmptyIndex(t)
+
+	if err := os.WriteFile(filepath.Join(dir, "pool.html"), []byte("<html><head><title>Pooling</title></head><body><p>Reuse connections.</p></body></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(http.HandlerFunc(handleIngest), httptest.NewRequest(http.MethodPost, "/api/admin/ingest", nil))
+	var res IngestResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil || rec.Code != http.StatusOK || res.Documents == 0 {
+		t.Fatalf("ingest = %d %+v, %v", rec.Code, res, err)
+	}
+	if results, err := performSearch("reuse", searchFilter{}, 10, nil); err != nil || len(results) != 1 {
+		t.Errorf("results after ingest = %+v, %v", results, err)
+	}
+
+	ingesting.Lock()
+	defer ingesting.Unlock()
+	if rec := serve(http.HandlerFunc(handleIngest), httptest.NewRequest(http.MethodPost, "/api/admin/ingest", nil)); rec.Code != http.StatusConflict {
+		t.Errorf("overlapping ingest: %d", rec.Code)
+	}
+}
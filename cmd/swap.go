@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+)
+
+const (
+	// indexSwapInterval is how often the server looks for a new index
+	indexSwapInterval = 5 * time.Second
+	// retiredIndexGrace is how long a swapped-out index stays open, so
+	// searches already running on it can finish
+	retiredIndexGrace = time.Minute
+	// rebuildAfterAttempts is how many times an unreadable index is
+	// reopened before it is rebuilt from the docs
+	rebuildAfterAttempts = 3
+)
+
+// indexRecoveryInterval is the pause between attempts to recover an
+// unreadable index
+var indexRecoveryInterval = 10 * time.Second
+
+var errIndexUnavailable = errors.New("search is temporarily unavailable")
+
+// liveIndex is the index the server searches. It wraps an alias, so an
+// index rebuilt elsewhere and moved into place can be swapped in while
+// searches run, and an index that became unreadable can be recovered.
+type liveIndex struct {
+	bleve.IndexAlias
+
+	// path is the index directory
+	path string
+
+	mu      sync.Mutex
+	current bleve.Index
+	// dir is the index directory last looked at, swapped in or not
+	dir os.FileInfo
+	// onStandby is set while current is the standby itself, because the
+	// primary couldn't be opened at startup
+	onStandby bool
+
+	// unavailable is set while the index can't be read and is recovered in
+	// the background
+	unavailable atomic.Bool
+}
+
+// newLiveIndex wraps idx, opened from the index directory path or, when
+// onStandby is set, from the standby because path was unreadable. A nil idx
+// starts out unavailable.
+func newLiveIndex(idx bleve.Index, path string, onStandby bool) *liveIndex {
+	l := &liveIndex{IndexAlias: bleve.NewIndexAlias(), path: path, current: idx, onStandby: onStandby}
+	l.dir, _ = os.Stat(path)
+	if idx == nil {
+		l.markUnavailable()
+	} else {
+		l.IndexAlias.Add(idx)
+	}
+	return l
+}
+
+func (l *liveIndex) Search(req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	return l.SearchInContext(context.Background(), req)
+}
+
+// SearchInContext fails fast while the index is unavailable, and makes it
+// unavailable when a search fails because the index can't be read
+func (l *liveIndex) SearchInContext(ctx context.Context, req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	if l.unavailable.Load() {
+		return nil, errIndexUnavailable
+	}
+	res, err := l.IndexAlias.SearchInContext(ctx, req)
+	if err == nil || ctx.Err() != nil {
+		return res, err
+	}
+	// a query that is merely invalid leaves the index readable
+	probe := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	if _, perr := l.IndexAlias.SearchInContext(ctx, probe); perr == nil {
+		return res, err
+	}
+	log.Printf("Index is unreadable, search is unavailable until it is recovered: %v", err)
+	l.markUnavailable()
+	return nil, errIndexUnavailable
+}
+
+// markUnavailable turns searches away and starts recovering the index
+func (l *liveIndex) markUnavailable() {
+	if l.unavailable.CompareAndSwap(false, true) {
+		go l.recover()
+	}
+}
+
+// recover reopens the index until that works, rebuilding it from the docs
+// every few failed attempts
+func (l *liveIndex) recover() {
+	for attempt := 1; ; attempt++ {
+		time.Sleep(indexRecoveryInterval)
+		err := l.reopen()
+		if err == nil {
+			log.Printf("Index at %s reopened, search is available again", l.path)
+			return
+		}
+		log.Printf("Error reopening the index (attempt %d): %v", attempt, err)
+		if attempt%rebuildAfterAttempts == 0 {
+			log.Printf("Rebuilding the index at %s from the docs", l.path)
+			if err := rebuildIndex(l.path); err != nil {
+				log.Printf("Error rebuilding the index: %v", err)
+			}
+		}
+	}
+}
+
+// reopen opens the index at l.path again and, once it answers a search,
+// puts it in place of the unreadable one
+func (l *liveIndex) reopen() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the broken index may still hold the files open
+	if l.current != nil && !l.onStandby {
+		l.IndexAlias.Swap(nil, []bleve.Index{l.current})
+		l.current.Close()
+		l.current = nil
+	}
+	next, err := openIndex(l.path)
+	if err != nil {
+		return err
+	}
+	probe := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	if _, err := next.Search(probe); err != nil {
+		next.Close()
+		return err
+	}
+	if !docsetsUpToDate(next) || !analysisUpToDate(next) || !schemaUpToDate(next) {
+		next.Close()
+		return errors.New("the index was built with an outdated configuration")
+	}
+	if err := l.install(next, info); err != nil {
+		return err
+	}
+	l.unavailable.Store(false)
+	return nil
+}
+
+// swapIfReplaced swaps in the index at l.path if its directory was replaced
+// since it was last looked at. A new index that doesn't match the
+// configuration is left alone, like at startup.
+func (l *liveIndex) swapIfReplaced() (bool, error) {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		// in the middle of being moved
+		return false, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dir != nil && os.SameFile(info, l.dir) {
+		return false, nil
+	}
+
+	// an index that can't be used isn't retried until it's replaced again
+	next, err := openIndex(l.path)
+	if err != nil {
+		l.dir = info
+		return false, err
+	}
+	if !docsetsUpToDate(next) || !analysisUpToDate(next) || !schemaUpToDate(next) {
+		next.Close()
+		l.dir = info
+		return false, errors.New("the new index was built with an outdated configuration, keeping the current one")
+	}
+	if err := l.install(next, info); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// install puts next, opened from the directory info, in place of the
+// current index, with the standby recreated from it. l.mu is held.
+func (l *liveIndex) install(next bleve.Index, info os.FileInfo) error {
+	if config.StandbyIndexPath != "" {
+		// whatever holds the standby open lets go of it first
+		if f, ok := l.current.(*failoverIndex); ok {
+			f.releaseStandby()
+		} else if l.onStandby && l.current != nil {
+			l.IndexAlias.Swap(nil, []bleve.Index{l.current})
+			l.current.Close()
+			l.current = nil
+		}
+		f, err := withStandby(next, config.StandbyIndexPath, true)
+		if err != nil {
+			next.Close()
+			return err
+		}
+		next = f
+	}
+
+	if l.current == nil {
+		l.IndexAlias.Add(next)
+	} else {
+		l.IndexAlias.Swap([]bleve.Index{next}, []bleve.Index{l.current})
+		retired := l.current
+		time.AfterFunc(retiredIndexGrace, func() { retired.Close() })
+	}
+	l.current, l.dir, l.onStandby = next, info, false
+	return nil
+}
+
+// served returns the index being served, nil while there is none
+func (l *liveIndex) served() bleve.Index {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current
+}
+
+// CopyTo copies the index being served, so the live index can be archived
+func (l *liveIndex) CopyTo(d bleveindex.Directory) error {
+	copyable, ok := l.served().(bleve.IndexCopyable)
+	if !ok {
+		return fmt.Errorf("index does not support copying")
+	}
+	return copyable.CopyTo(d)
+}
+
+// syncStandby refreshes the standby of the index being served, if it has
+// one
+func (l *liveIndex) syncStandby() error {
+	if f, ok := l.served().(*failoverIndex); ok {
+		return f.syncStandby()
+	}
+	return nil
+}
+
+func (l *liveIndex) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.IndexAlias.Close()
+	if l.current == nil {
+		return nil
+	}
+	return l.current.Close()
+}
+
+// searchUnavailable reports whether the index is being recovered
+func searchUnavailable() bool {
+	l, ok := index.(*liveIndex)
+	return ok && l.unavailable.Load()
+}
+
+// watchIndexSwaps swaps in new indexes as they are moved into place and
+// ends a maintenance that was waiting for one
+func watchIndexSwaps(l *liveIndex) {
+	for range time.Tick(indexSwapInterval) {
+		if l.unavailable.Load() {
+			continue
+		}
+		swapped, err := l.swapIfReplaced()
+		if err != nil {
+			log.Printf("Error swapping in the new index: %v", err)
+			continue
+		}
+		if swapped {
+			log.Printf("Swapped in the new index at %s", l.path)
+			endMaintenanceAfterSwap()
+		}
+	}
+}
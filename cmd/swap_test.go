@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestSwapIndex(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	withMaintenance(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.bleve")
+	build := func(dest, title string) {
+		t.Helper()
+		idx, err := bleve.New(dest, newIndexMapping())
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := filepath.Join(root, strings.ToLower(title)+".html")
+		if err := idx.Index(doc, Document{Title: title, Content: title, URL: doc}); err != nil {
+			t.Fatal(err)
+		}
+		if err := stampDocsets(idx); err != nil {
+			t.Fatal(err)
+		}
+		if err := stampSchema(idx, schemaVersion); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replace := func(title string) {
+		t.Helper()
+		build(path+".new", title)
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".new", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := func(l *liveIndex, text string) uint64 {
+		t.Helper()
+		res, err := l.Search(bleve.NewSearchRequest(bleve.NewMatchQuery(text)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Total
+	}
+
+	build(path, "Pooling")
+	idx, err := openIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLiveIndex(idx, path, false)
+	defer l.Close()
+	if swapped, err := l.swapIfReplaced(); swapped || err != nil {
+		t.Fatalf("swap of the same index = %v, %v", swapped, err)
+	}
+
+	setMaintenance(Maintenance{Enabled: true, UntilSwap: true})
+	replace("Sharding")
+	if swapped, err := l.swapIfReplaced(); !swapped || err != nil {
+		t.Fatalf("swap of a new index = %v, %v", swapped, err)
+	}
+	endMaintenanceAfterSwap()
+	if total(l, "sharding") != 1 || total(l, "pooling") != 0 {
+		t.Error("searches don't use the new index")
+	}
+	if currentMaintenance().Enabled {
+		t.Error("maintenance until a swap didn't end")
+	}
+
+	// an index built for other docsets is refused once
+	replace("Caching")
+	withConfig(t, restrictedConfig)
+	if swapped, err := l.swapIfReplaced(); swapped || err == nil {
+		t.Errorf("swap of an outdated index = %v, %v", swapped, err)
+	}
+	if swapped, err := l.swapIfReplaced(); swapped || err != nil {
+		t.Errorf("second look at an outdated index = %v, %v", swapped, err)
+	}
+	if total(l, "sharding") != 1 {
+		t.Error("the outdated index replaced the current one")
+	}
+}
+
+// diskIndex is named so that embedding it keeps its Index method
+type diskIndex = bleve.Index
+
+// unreadableIndex fails every search, like an index on a failing disk
+type unreadableIndex struct {
+	diskIndex
+}
+
+func (unreadableIndex) SearchInContext(context.Context, *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	return nil, errors.New("read index.bleve/store/000000000002.zap: input/output error")
+}
+
+func breakIndex(l *liveIndex) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	broken := unreadableIndex{l.current}
+	l.IndexAlias.Swap([]bleve.Index{broken}, []bleve.Index{l.current})
+	l.current = broken
+}
+
+func TestIndexRecovery(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	withMaintenance(t)
+	oldInterval := indexRecoveryInterval
+	indexRecoveryInterval = 10 * time.Millisecond
+	t.Cleanup(func() { indexRecoveryInterval = oldInterval })
+	if err := os.WriteFile(filepath.Join(root, "pool.html"), []byte("<title>Pooling</title><p>connections are pooled</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "index.bleve")
+	if err := rebuildIndex(path); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := func(l *liveIndex) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for l.unavailable.Load() {
+			if time.Now().After(deadline) {
+				t.Fatal("the index wasn't recovered")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		res, err := l.Search(bleve.NewSearchRequest(bleve.NewMatchQuery("pooled")))
+		if err != nil || res.Total != 1 {
+			t.Fatalf("search after recovery = %v, %v", res, err)
+		}
+	}
+
+	// a server started without a readable index recovers it
+	l := newLiveIndex(nil, path, false)
+	defer l.Close()
+	old := index
+	index = l
+	t.Cleanup(func() { index = old })
+	recovered(l)
+
+	// an index failing mid-flight is reopened, and search is turned away
+	// meanwhile; holding the lock keeps it from being reopened too soon
+	breakIndex(l)
+	l.mu.Lock()
+	if _, err := l.Search(bleve.NewSearchRequest(bleve.NewMatchQuery("pooled"))); err != errIndexUnavailable {
+		l.mu.Unlock()
+		t.Fatalf("search of a failed index = %v", err)
+	}
+	handler := duringMaintenance(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/search?q=pooled", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "temporarily unavailable") {
+		t.Errorf("search page while recovering = %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/pool.html", nil))
+	if rec.Body.String() != "served" {
+		t.Errorf("docs while recovering = %d", rec.Code)
+	}
+	l.mu.Unlock()
+	recovered(l)
+
+	// an index that can't be opened any more is rebuilt from the docs
+	breakIndex(l)
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "index_meta.json"), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l.Search(bleve.NewSearchRequest(bleve.NewMatchQuery("pooled")))
+	recovered(l)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// synonyms are the groups of words that mean the same, like "k8s" and
+// "kubernetes". They're applied when a query is built rather than when
+// documents are indexed, so changing them needs no rebuild.
+var synonyms struct {
+	sync.RWMutex
+	groups [][]string
+}
+
+// maxSynonymGroups caps the groups, which every query is checked against
+const maxSynonymGroups = 1000
+
+// parseSynonyms reads one group per line, its words or phrases separated
+// by commas. Blank lines and lines starting with # are skipped.
+func parseSynonyms(r io.Reader) ([][]string, error) {
+	var groups [][]string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		group := parseSynonymGroup(strings.Split(text, ","))
+		if len(group) < 2 {
+			return nil, fmt.Errorf("line %d: a group needs at least two words", line)
+		}
+		groups = append(groups, group)
+	}
+	if len(groups) > maxSynonymGroups {
+		return nil, fmt.Errorf("too many groups (max %d)", maxSynonymGroups)
+	}
+	return groups, scanner.Err()
+}
+
+// parseSynonymGroup lowercases the words of a group and drops empty and
+// repeated ones
+func parseSynonymGroup(words []string) []string {
+	var group []string
+	for _, w := range words {
+		if w = strings.ToLower(strings.Join(strings.Fields(w), " ")); w != "" && !contains(group, w) {
+			group = append(group, w)
+		}
+	}
+	return group
+}
+
+func formatSynonyms(groups [][]string) string {
+	var b strings.Builder
+	for _, group := range groups {
+		b.WriteString(strings.Join(group, ", ") + "\n")
+	}
+	return b.String()
+}
+
+// loadSynonyms reads config.SynonymsFile, if any, replacing the groups in
+// use. A missing file means no synonyms yet.
+func loadSynonyms() error {
+	var groups [][]string
+	if config.SynonymsFile != "" {
+		f, err := os.Open(config.SynonymsFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			defer f.Close()
+			if groups, err = parseSynonyms(f); err != nil {
+				return fmt.Errorf("%s: %w", config.SynonymsFile, err)
+			}
+		}
+	}
+	synonyms.Lock()
+	synonyms.groups = groups
+	synonyms.Unlock()
+	return nil
+}
+
+// saveSynonyms writes groups to config.SynonymsFile and puts them in use
+func saveSynonyms(groups [][]string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(config.SynonymsFile), ".synonyms-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.WriteString(tmp, formatSynonyms(groups)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), config.SynonymsFile); err != nil {
+		return err
+	}
+	synonyms.Lock()
+	synonyms.groups = groups
+	synonyms.Unlock()
+	return nil
+}
+
+func synonymGroups() [][]string {
+	synonyms.RLock()
+	defer synonyms.RUnlock()
+	return synonyms.groups
+}
+
+// expandSynonyms adds the synonyms of the words and phrases in text to
+// it. Matches are scored like the words typed, so "k8s" finds documents
+// that only say "Kubernetes".
+func expandSynonyms(text string) string {
+	lower := " " + strings.ToLower(strings.Join(strings.Fields(text), " ")) + " "
+	var extra []string
+	for _, group := range synonymGroups() {
+		if !containsPhrase(lower, group) {
+			continue
+		}
+		for _, w := range group {
+			if !strings.Contains(lower, " "+w+" ") && !contains(extra, w) {
+				extra = append(extra, w)
+			}
+		}
+	}
+	if len(extra) == 0 {
+		return text
+	}
+	return text + " " + strings.Join(extra, " ")
+}
+
+// containsPhrase reports whether padded, a space-padded lowercase text,
+// has one of phrases as whole words
+func containsPhrase(padded string, phrases []string) bool {
+	for _, p := range phrases {
+		if strings.Contains(padded, " "+p+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// SynonymsBody is the body of /api/admin/synonyms
+type SynonymsBody struct {
+	Synonyms [][]string `json:"synonyms"`
+}
+
+var synonymWord = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} ._+#-]{0,63}$`)
+
+func handleGetSynonyms(w http.ResponseWriter, r *http.Request) {
+	groups := synonymGroups()
+	if groups == nil {
+		groups = [][]string{}
+	}
+	writeJSON(w, http.StatusOK, SynonymsBody{Synonyms: groups})
+}
+
+// handlePutSynonyms replaces the synonyms file and applies it to the next
+// searches
+func handlePutSynonyms(w http.ResponseWriter, r *http.Request) {
+	if config.SynonymsFile == "" {
+		writeError(w, r, http.StatusConflict, "no synonyms_file is configured")
+		return
+	}
+	var req SynonymsBody
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Synonyms) > maxSynonymGroups {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("too many groups (max %d)", maxSynonymGroups))
+		return
+	}
+	groups := make([][]string, 0, len(req.Synonyms))
+	for i, words := range req.Synonyms {
+		group := parseSynonymGroup(words)
+		if len(group) < 2 {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("group %d needs at least two words", i+1))
+			return
+		}
+		for _, word := range group {
+			if !synonymWord.MatchString(word) {
+				writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid synonym %q", word))
+				return
+			}
+		}
+		groups = append(groups, group)
+	}
+	if err := saveSynonyms(groups); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, SynonymsBody{Synonyms: groups})
+}
+
+// handleReloadSynonyms rereads the synonyms file after it was edited by
+// hand
+func handleReloadSynonyms(w http.ResponseWriter, r *http.Request) {
+	if err := loadSynonyms(); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	handleGetSynonyms(w, r)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func withSynonyms(t *testing.T, groups [][]string) {
+	t.Helper()
+	old := synonymGroups()
+	synonyms.groups = groups
+	t.Cleanup(func() { synonyms.groups = old })
+}
+
+func TestParseSynonyms(t *testing.T) {
+	groups, err := parseSynonyms(strings.NewReader("# containers\nk8s, Kubernetes\n\npostgres,PostgreSQL, pg ,postgres\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"k8s", "kubernetes"}, {"postgres", "postgresql", "pg"}}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups = %q, want %q", groups, want)
+	}
+	if _, err := parseSynonyms(strings.NewReader("k8s\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("err = %v, want an error for line 1", err)
+	}
+}
+
+func TestExpandSynonyms(t *testing.T) {
+	withSynonyms(t, [][]string{{"k8s", "kubernetes"}, {"postgres", "postgresql"}, {"go", "golang"}})
+	tests := map[string]string{
+		"K8s deploy":        "K8s deploy kubernetes",
+		"kubernetes k8s":    "kubernetes k8s",
+		"postgres pooling":  "postgres pooling postgresql",
+		"google cloud":      "google cloud",
+		"postgresql driver": "postgresql driver postgres",
+	}
+	for text, want := range tests {
+		if got := expandSynonyms(text); got != want {
+			t.Errorf("expandSynonyms(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestSearchSynonyms(t *testing.T) {
+	withConfig(t, Config{SynonymsFile: filepath.Join(t.TempDir(), "synonyms.txt")})
+	withSynonyms(t, nil)
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+	doc := Document{Title: "Deploying", Content: "Deploy the service to Kubernetes.", URL: filepath.Join(root, "deploy.html")}
+	if err := idx.Index(doc.URL, doc); err != nil {
+		t.Fatal(err)
+	}
+	count := func() int {
+		results, err := performSearch("k8s", searchFilter{}, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(results)
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("results before adding synonyms = %d", n)
+	}
+
+	put := httptest.NewRequest(http.MethodPut, "/api/admin/synonyms", strings.NewReader(`{"synonyms": [["k8s", "Kubernetes"]]}`))
+	if rec := serve(http.HandlerFunc(handlePutSynonyms), put); rec.Code != http.StatusOK {
+		t.Fatalf("put = %d %s", rec.Code, rec.Body.String())
+	}
+	if n := count(); n != 1 {
+		t.Errorf("results after adding synonyms = %d, want 1", n)
+	}
+	if data, _ := os.ReadFile(config.SynonymsFile); string(data) != "k8s, kubernetes\n" {
+		t.Errorf("file = %q", data)
+	}
+
+	// edited by hand, then reloaded
+	if err := os.WriteFile(config.SynonymsFile, []byte("# none\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(http.HandlerFunc(handleReloadSynonyms), httptest.NewRequest(http.MethodPost, "/api/admin/synonyms/reload", nil)); rec.Code != http.StatusOK {
+		t.Fatalf("reload = %d", rec.Code)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("results after reloading = %d, want 0", n)
+	}
+
+	bad := httptest.NewRequest(http.MethodPut, "/api/admin/synonyms", strings.NewReader(`{"synonyms": [["k8s"]]}`))
+	if rec := serve(http.HandlerFunc(handlePutSynonyms), bad); rec.Code != http.StatusBadRequest {
+		t.Errorf("single word group: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
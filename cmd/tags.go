@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// tagsBucket maps document paths relative to the root to their tags. Tags
+// are kept in the database so they survive rebuilding the index, and are
+// copied into the index for searching.
+const tagsBucket = "document_tags"
+
+// maxTags caps the tags of one document
+const maxTags = 20
+
+// validTag keeps tags short and usable in URLs and tag: queries
+var validTag = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// tagOperator finds tag:<name> in what the user typed
+var tagOperator = regexp.MustCompile(`(?:^|\s)tag:(\S+)`)
+
+// tagKey is the database key of the document at path
+func tagKey(path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// tagsFor returns the tags of the document at path
+func tagsFor(path string) []string {
+	if store == nil {
+		return nil
+	}
+	var tags []string
+	if _, err := storeGet(tagsBucket, tagKey(path), &tags); err != nil {
+		log.Printf("Error loading tags of %s: %v", path, err)
+	}
+	return tags
+}
+
+// parseTags splits repeated or comma-separated tag values, lowercased and
+// without duplicates
+func parseTags(values ...string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" && !contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+// validateTags checks tags to set on a document
+func validateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("too many tags (max %d)", maxTags)
+	}
+	for _, t := range tags {
+		if !validTag.MatchString(t) {
+			return fmt.Errorf("invalid tag %q: use up to 32 lowercase letters, digits, - and _", t)
+		}
+	}
+	return nil
+}
+
+// filterTags limits q to documents with all of tags
+func filterTags(q query.Query, tags []string) query.Query {
+	if len(tags) == 0 {
+		return q
+	}
+	must := []query.Query{q}
+	for _, t := range tags {
+		tq := bleve.NewTermQuery(t)
+		tq.SetField("Tags")
+		must = append(must, tq)
+	}
+	return bleve.NewConjunctionQuery(must...)
+}
+
+// storedTags reads the stored Tags field of a hit, which comes back as a
+// string for a single tag and a slice for several
+func storedTags(field interface{}) []string {
+	switch v := field.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		tags := make([]string, 0, len(v))
+		for _, t := range v {
+			if s, ok := t.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+		return tags
+	}
+	return nil
+}
+
+// tagFilter is a tag the search page filters by, with a link to the same
+// search without it
+type tagFilter struct {
+	Name   string
+	Remove string
+}
+
+func tagFilters(params url.Values) []tagFilter {
+	tags := parseTags(params["tag"]...)
+	filters := make([]tagFilter, 0, len(tags))
+	for _, t := range tags {
+		without := url.Values{}
+		for k, v := range params {
+			without[k] = v
+		}
+		var rest []string
+		for _, other := range tags {
+			if other != t {
+				rest = append(rest, other)
+			}
+		}
+		without["tag"] = rest
+		filters = append(filters, tagFilter{Name: t, Remove: "/search?" + without.Encode()})
+	}
+	return filters
+}
+
+var errNotDocument = errors.New("path must be an indexed document, like guides/start.html")
+
+// documentPath returns the file of the indexed document at rel, a path
+// below the root, if the request can read it
+func documentPath(r *http.Request, rel string) (string, os.FileInfo, error) {
+	return documentPathFor(r.Context(), rel)
+}
+
+// documentPathFor is documentPath for the caller in ctx
+func documentPathFor(ctx context.Context, rel string) (string, os.FileInfo, error) {
+	rel = strings.TrimPrefix(rel, "/")
+	if rel == "" || filepath.Clean("/"+rel) != "/"+rel || !isDocumentName(rel) {
+		return "", nil, errNotDocument
+	}
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	info, err := statDoc(path)
+	if err != nil || info.IsDir() || !canAccessPath(ctx, path) {
+		return "", nil, errNotDocument
+	}
+	return path, info, nil
+}
+
+// setTags stores the tags of the document at path and reindexes it, so the
+// change is searchable right away
+func setTags(path string, info os.FileInfo, tags []string) error {
+	sort.Strings(tags)
+	var err error
+	if len(tags) == 0 {
+		err = storeDelete(tagsBucket, tagKey(path))
+	} else {
+		err = storePut(tagsBucket, tagKey(path), tags)
+	}
+	if err != nil {
+		return err
+	}
+	return reindexDocument(path, info)
+}
+
+// reindexDocument indexes the document at path again, with its examples,
+// after its tags or notes changed
+func reindexDocument(path string, info os.FileInfo) error {
+	docs, err := documentsFor(path, info, sharedNoteTexts())
+	if err != nil {
+		return err
+	}
+	batch := newBatcher(index)
+	for _, doc := range docs {
+		if err := batch.Index(doc.URL, doc); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+// TagsResponse is the body of /api/tags/{path}
+type TagsResponse struct {
+	Path string   `json:"path"`
+	Tags []string `json:"tags"`
+}
+
+func handleGetTags(w http.ResponseWriter, r *http.Request) {
+	path, _, err := documentPath(r, r.PathValue("path"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	tags := tagsFor(path)
+	if tags == nil {
+		tags = []string{}
+	}
+	writeJSON(w, http.StatusOK, TagsResponse{Path: tagKey(path), Tags: tags})
+}
+
+func handlePutTags(w http.ResponseWriter, r *http.Request) {
+	path, info, err := documentPath(r, r.PathValue("path"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	tags := parseTags(req.Tags...)
+	if err := validateTags(tags); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := setTags(path, info, tags); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	writeJSON(w, http.StatusOK, TagsResponse{Path: tagKey(path), Tags: tags})
+}
+
+// handleTagsForm sets the tags of a search result from the comma-separated
+// list in its edit form, then goes back to the search
+func handleTagsForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	path, info, err := documentPath(r, r.PostForm.Get("path"))
+	if err != nil {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	tags := parseTags(r.PostForm.Get("tags"))
+	if err := validateTags(tags); err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	if err := setTags(path, info, tags); err != nil {
+		log.Printf("Error setting tags of %s: %v", path, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, safeRedirectPath(r.PostForm.Get("next")), http.StatusSeeOther)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	got := parseTags("Onboarding, networking", "onboarding", " ,")
+	if want := []string{"onboarding", "networking"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTags = %q, want %q", got, want)
+	}
+	for _, tags := range [][]string{{"has space"}, {"-leading"}, {strings.Repeat("x", 33)}, make([]string, maxTags+1)} {
+		if err := validateTags(tags); err == nil {
+			t.Errorf("validateTags(%q) accepted invalid tags", tags)
+		}
+	}
+	if err := validateTags([]string{"onboarding", "k8s_v2"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTagDocuments(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{})
+	withDocFiles(t, map[string]string{"guides/pool.html": "connection pooling", "guides/cache.html": "connection caching"})
+	withEmptyIndex(t)
+	if _, err := buildIndex(root); err != nil {
+		t.Fatal(err)
+	}
+
+	put := httptest.NewRequest(http.MethodPut, "/api/tags/guides/pool.html", strings.NewReader(`{"tags": ["Onboarding", "networking"]}`))
+	put.SetPathValue("path", "guides/pool.html")
+	rec := serve(http.HandlerFunc(handlePutTags), put)
+	var resp TagsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(resp.Tags, []string{"networking", "onboarding"}) {
+		t.Fatalf("put = %d %+v", rec.Code, resp)
+	}
+
+	search := func(query string, filter searchFilter) []string {
+		results, err := performSearch(query, filter, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var urls []string
+		for _, doc := range results {
+			urls = append(urls, doc.URL)
+		}
+		return urls
+	}
+	if got := search("connection", searchFilter{Tags: []string{"onboarding"}}); !reflect.DeepEqual(got, []string{"guides/pool.html"}) {
+		t.Errorf("tag filter = %q, want the tagged document", got)
+	}
+	if got := search("connection tag:Networking", searchFilter{}); !reflect.DeepEqual(got, []string{"guides/pool.html"}) {
+		t.Errorf("tag: operator = %q, want the tagged document", got)
+	}
+	if got := search("connection", searchFilter{Tags: []string{"onboarding", "security"}}); len(got) != 0 {
+		t.Errorf("two tags = %q, want documents with both only", got)
+	}
+
+	// tags live in the database, so a rebuilt index has them again
+	withEmptyIndex(t)
+	if _, err := buildIndex(root); err != nil {
+		t.Fatal(err)
+	}
+	results, _ := performSearch("pooling", searchFilter{}, 10, nil)
+	if len(results) != 1 || !reflect.DeepEqual(results[0].Tags, []string{"networking", "onboarding"}) {
+		t.Errorf("results after rebuilding = %+v", results)
+	}
+
+	bad := httptest.NewRequest(http.MethodPut, "/api/tags/guides/nope.html", strings.NewReader(`{"tags": []}`))
+	bad.SetPathValue("path", "guides/nope.html")
+	if rec := serve(http.HandlerFunc(handlePutTags), bad); rec.Code != http.StatusNotFound {
+		t.Errorf("tagging a missing document = %d, want 404", rec.Code)
+	}
+}
+
+func TestTagFilters(t *testing.T) {
+	got := tagFilters(url.Values{"q": {"pool"}, "tag": {"a,b"}})
+	want := []tagFilter{{"a", "/search?q=pool&tag=b"}, {"b", "/search?q=pool&tag=a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tagFilters = %+v, want %+v", got, want)
+	}
+}
+
+func TestTagRouteGroups(t *testing.T) {
+	for method, want := range map[string]string{http.MethodGet: routeRead, http.MethodPut: routeWrite} {
+		if got := routeGroup(httptest.NewRequest(method, "/api/tags/guides/pool.html", nil)); got != want {
+			t.Errorf("%s /api/tags = %q, want %q", method, got, want)
+		}
+	}
+}
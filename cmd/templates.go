@@ -0,0 +1,176 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+//go:embed static
+var staticFS embed.FS
+
+// Page is the data the shared layout needs; page templates embed it
+type Page struct {
+	Title string
+	Prefs Preferences
+	Lang  string
+	// ExplicitLang is set when the language was chosen with ?lang=, so
+	// forms can carry it along
+	ExplicitLang string
+	// SignIn links to the login page for anonymous visitors of public
+	// routes, who aren't sent there automatically
+	SignIn string
+	// Share is the token of a share link the page was opened with, passed
+	// on to the stylesheets and scripts so they load without logging in
+	Share string
+}
+
+// newPage prepares the layout data for r, with the title looked up in the
+// message catalog
+func newPage(r *http.Request, titleKey string) Page {
+	lang := negotiateLanguage(r)
+	p := Page{Lang: lang, Prefs: preferencesFromRequest(r), Title: translate(lang, titleKey)}
+	if r.URL.Query().Get("lang") == lang {
+		p.ExplicitLang = lang
+	}
+	if _, ok := principalFromContext(r.Context()); !ok {
+		if sharedAccess(r) {
+			p.Share = r.URL.Query().Get(shareParam)
+		} else if oidcEnabled() {
+			p.SignIn = "/auth/login?next=" + url.QueryEscape(r.URL.RequestURI())
+		}
+	}
+	return p
+}
+
+// T translates a UI message into the page language
+func (p Page) T(key string, args ...interface{}) string {
+	return translate(p.Lang, key, args...)
+}
+
+// templates holds every page template, parsed once at startup
+var templates *template.Template
+
+var templateFuncs = template.FuncMap{
+	"truncate": truncate,
+	"join":     strings.Join,
+	"bytes":    formatBytes,
+}
+
+// truncate cuts s to at most l characters plus an ellipsis. It cuts at the
+// last space when that keeps more than half of the text, and otherwise
+// between characters, never inside one. The search page, the JSON outputs
+// and the CLI all cut text with it.
+func truncate(s string, l int) string {
+	n, cut := 0, len(s)
+	for i := range s {
+		if n == l {
+			cut = i
+			break
+		}
+		n++
+	}
+	if cut == len(s) {
+		return s
+	}
+	head := s[:cut]
+	if r, _ := utf8.DecodeRuneInString(s[cut:]); !unicode.IsSpace(r) {
+		if space := strings.LastIndexFunc(head, unicode.IsSpace); space > len(head)/2 {
+			head = head[:space]
+		}
+	}
+	return strings.TrimRightFunc(head, unicode.IsSpace) + "…"
+}
+
+// loadTemplates parses the embedded templates, then any *.html files in the
+// configured theme templates directory. Later definitions win, so an override
+// file may redefine a whole page or just a block such as "footer".
+func loadTemplates() error {
+	if err := loadCatalogs(); err != nil {
+		return err
+	}
+
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return err
+	}
+
+	if dir := config.Theme.TemplatesDir; dir != "" {
+		overrides, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		if err != nil {
+			return err
+		}
+		if len(overrides) > 0 {
+			if tmpl, err = tmpl.ParseFiles(overrides...); err != nil {
+				return err
+			}
+		}
+	}
+	templates = tmpl
+	return nil
+}
+
+// staticHandler serves the CSS and JS under /_static/, a prefix unlikely to
+// clash with a "static" folder in the served docs. Files in the theme static
+// directory take precedence over the embedded ones.
+func staticHandler() http.Handler {
+	var files fs.FS
+	files, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		panic(err)
+	}
+	if dir := config.Theme.StaticDir; dir != "" {
+		files = overlayFS{top: os.DirFS(dir), bottom: files}
+	}
+	return http.StripPrefix("/_static/", http.FileServer(http.FS(files)))
+}
+
+// overlayFS looks a file up in top first and falls back to bottom
+type overlayFS struct {
+	top, bottom fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	return o.bottom.Open(name)
+}
+
+// renderError shows a localized error page
+func renderError(w http.ResponseWriter, r *http.Request, status int) {
+	data := struct {
+		Page
+		Message string
+	}{
+		Page: newPage(r, "error.title"),
+	}
+	data.Message = data.T("error." + strconv.Itoa(status))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "error.html", data); err != nil {
+		log.Printf("Error rendering error page: %v", err)
+	}
+}
+
+// renderTemplate executes the named page template
+func renderTemplate(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSearchTemplateRenders(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	results := []Document{{Title: "Connection pooling", URL: "guides/pool.html", Content: "Pools keep connections open."}}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		results = append(results, Document{Title: "Net " + name, URL: "net/" + name + ".html"})
+	}
+
+	rec := httptest.NewRecorder()
+	renderTemplate(rec, "search.html", searchView{
+		Page:     Page{Lang: "en", Prefs: Preferences{Theme: "dark", Version: "v2"}},
+		Query:    "pool",
+		Results:  results,
+		Groups:   groupBySection(results),
+		Versions: []string{"v1", "v2"},
+	})
+
+	body := rec.Body.String()
+	for _, want := range []string{`value="pool"`, `href="/guides/pool.html"`, "Connection pooling", "/_static/style.css", `data-theme="dark"`, "Show 1 more from /net/</summary>", `<option value="v2" selected>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("rendered page is missing %q", want)
+		}
+	}
+}
+
+func TestThemeOverrides(t *testing.T) {
+	tmplDir, staticDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmplDir, "brand.html"), []byte(`{{define "footer"}}<p>ACME docs</p></body></html>{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staticDir, "theme.css"), []byte("body { color: purple; }"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	withConfig(t, Config{Theme: ThemeConfig{TemplatesDir: tmplDir, StaticDir: staticDir}})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	renderTemplate(rec, "search.html", searchView{Page: Page{Lang: "en", Prefs: defaultPrefs}, Query: "pool"})
+	if body := rec.Body.String(); !strings.Contains(body, "ACME docs") || !strings.Contains(body, `value="pool"`) {
+		t.Errorf("footer override not applied:\n%s", body)
+	}
+
+	for path, want := range map[string]string{"/_static/theme.css": "purple", "/_static/app.js": "search_textbox"} {
+		rec := httptest.NewRecorder()
+		staticHandler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET %s = %q, want it to contain %q", path, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestLiveSearchRendersOnlyResults(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"guides/pool.html": "connection pooling"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(http.HandlerFunc(handleLiveSearch), httptest.NewRequest(http.MethodGet, "/search/results?q=pooling", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, `href="/guides/pool.html"`) {
+		t.Errorf("live results = %d %q, want the pool page", rec.Code, body)
+	}
+	if strings.Contains(body, "<html") || strings.Contains(body, "search_textbox") {
+		t.Errorf("live results include the page around them:\n%s", body)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		l    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"connection pools keep connections open", 20, "connection pools…"},
+		{"connection pools keep", 16, "connection pools…"},
+		{"Verbindungsgrößenüberwachung", 20, "Verbindungsgrößenübe…"},
+		{"接続プールは接続を開いたままにします", 6, "接続プールは…"},
+		{"a pool, then more", 8, "a pool,…"},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.l)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.l, got, tt.want)
+		}
+	}
+}
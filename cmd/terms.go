@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// termFields maps the API names of the fields that can be analysed for
+// terminology to their names in the index
+var termFields = map[string]string{
+	"title":   "Title",
+	"content": "Content",
+	"docset":  "Docset",
+	"tags":    "Tags",
+}
+
+// TermCount is a term and the number of documents containing it
+type TermCount struct {
+	Term string `json:"term"`
+	Docs int    `json:"docs"`
+}
+
+// TopTermsResponse is the body of /api/terms
+type TopTermsResponse struct {
+	Field     string      `json:"field"`
+	TotalDocs uint64      `json:"total_docs"`
+	Terms     []TermCount `json:"terms"`
+}
+
+// DocFreqResponse is the body of /api/terms/df
+type DocFreqResponse struct {
+	Field     string `json:"field"`
+	Term      string `json:"term"`
+	Docs      uint64 `json:"docs"`
+	TotalDocs uint64 `json:"total_docs"`
+}
+
+// handleTopTerms lists the terms of a field found in the most documents.
+// Counts come from a terms facet over every page the caller may see, so
+// restricted docsets don't leak their vocabulary.
+func handleTopTerms(w http.ResponseWriter, r *http.Request) {
+	name, field, ok := termFieldParam(w, r)
+	if !ok {
+		return
+	}
+
+	size := 25
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 1000 {
+			writeError(w, r, http.StatusBadRequest, "size must be between 1 and 1000")
+			return
+		}
+		size = n
+	}
+
+	q := restrictQuery(pagesOnly(bleve.NewMatchAllQuery()), deniedDocsets(r.Context()))
+	searchRequest := bleve.NewSearchRequestOptions(q, 0, 0, false)
+	searchRequest.AddFacet("terms", bleve.NewFacetRequest(field, size))
+
+	searchResult, err := index.Search(searchRequest)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := TopTermsResponse{Field: name, TotalDocs: searchResult.Total, Terms: []TermCount{}}
+	if facet, ok := searchResult.Facets["terms"]; ok && facet.Terms != nil {
+		for _, t := range facet.Terms.Terms() {
+			resp.Terms = append(resp.Terms, TermCount{Term: t.Term, Docs: t.Count})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDocFreq returns how many pages contain a term in a field. The
+// term goes through the field's analyzer, so "Pooling" finds "pooling".
+func handleDocFreq(w http.ResponseWriter, r *http.Request) {
+	name, field, ok := termFieldParam(w, r)
+	if !ok {
+		return
+	}
+
+	term := r.URL.Query().Get("term")
+	if strings.TrimSpace(term) == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing term parameter")
+		return
+	}
+
+	denied := deniedDocsets(r.Context())
+
+	matches, err := index.Search(bleve.NewSearchRequestOptions(restrictQuery(pagesOnly(termQuery(field, term)), denied), 0, 0, false))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	all, err := index.Search(bleve.NewSearchRequestOptions(restrictQuery(pagesOnly(bleve.NewMatchAllQuery()), denied), 0, 0, false))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DocFreqResponse{
+		Field:     name,
+		Term:      term,
+		Docs:      matches.Total,
+		TotalDocs: all.Total,
+	})
+}
+
+// termQuery matches the documents with every word of term in field. The
+// title and content are analyzed like each document's language, the other
+// fields are keywords.
+func termQuery(field, term string) query.Query {
+	match := func(analyzer string) query.Query {
+		mq := bleve.NewMatchQuery(term)
+		mq.SetField(field)
+		mq.SetOperator(query.MatchQueryOperatorAnd)
+		mq.Analyzer = analyzer
+		return mq
+	}
+	if field != "Title" && field != "Content" {
+		return match(keyword.Name)
+	}
+	return matchInLanguages(func(analyzer string) query.Query {
+		return match(fieldAnalyzer(field, analyzer))
+	})
+}
+
+func termFieldParam(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	name := strings.ToLower(r.URL.Query().Get("field"))
+	if name == "" {
+		name = "content"
+	}
+	field, ok := termFields[name]
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "Unknown field "+strconv.Quote(name))
+		return "", "", false
+	}
+	return name, field, true
+}
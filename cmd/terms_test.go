@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withSectionedDocs indexes a page with a heading section about zebras and
+// a page without one
+func withSectionedDocs(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+
+	files := map[string]string{
+		"animals.html": `<title>Animals</title><p>Some animals.</p><h2 id="zebra">Stripes</h2><p>The zebra has stripes.</p>`,
+		"plants.html":  `<title>Plants</title><p>Some plants.</p>`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCountsLeaveOutSections(t *testing.T) {
+	withSectionedDocs(t)
+
+	rec := serve(http.HandlerFunc(handleAPICount), httptest.NewRequest(http.MethodGet, "/api/count?q=zebra", nil))
+	var count APICountResponse
+	if err := json.NewDecoder(rec.Body).Decode(&count); err != nil || count.Count != 1 {
+		t.Errorf("count = %+v, %v, want 1", count, err)
+	}
+
+	rec = serve(http.HandlerFunc(handleDocFreq), httptest.NewRequest(http.MethodGet, "/api/terms/df?term=zebra", nil))
+	var df DocFreqResponse
+	if err := json.NewDecoder(rec.Body).Decode(&df); err != nil || df.Docs != 1 || df.TotalDocs != 2 {
+		t.Errorf("df = %+v, %v, want 1 of 2", df, err)
+	}
+
+	rec = serve(http.HandlerFunc(handleTopTerms), httptest.NewRequest(http.MethodGet, "/api/terms?field=title", nil))
+	var top TopTermsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&top); err != nil || top.TotalDocs != 2 {
+		t.Fatalf("top terms = %+v, %v, want 2 documents", top, err)
+	}
+	for _, term := range top.Terms {
+		if term.Docs != 1 {
+			t.Errorf("title term %q in %d documents, want 1", term.Term, term.Docs)
+		}
+	}
+}
+
+// withTermDocs indexes guides and a restricted playbook with overlapping
+// words in their content
+func withTermDocs(t *testing.T) {
+	t.Helper()
+	withConfig(t, restrictedConfig)
+	withRoot(t, t.TempDir())
+	withIndex(t, map[string]string{
+		"guides/a.html":                "connection pooling",
+		"guides/b.html":                "connection retries",
+		"guides/c.html":                "pooling limits",
+		"security/playbooks/leak.html": "credential leak connection",
+	})
+}
+
+func TestTopTerms(t *testing.T) {
+	withTermDocs(t)
+
+	get := func(target string) (*httptest.ResponseRecorder, TopTermsResponse) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, target, nil).WithContext(memberContext("dev"))
+		rec := serve(http.HandlerFunc(handleTopTerms), r)
+		var resp TopTermsResponse
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec, resp
+	}
+
+	_, resp := get("/api/terms")
+	counts := make(map[string]int)
+	for _, term := range resp.Terms {
+		counts[term.Term] = term.Docs
+	}
+	// the playbook is hidden, its words and its connection aren't counted
+	want := map[string]int{"connection": 2, "pooling": 2, "retries": 1, "limits": 1}
+	if resp.Field != "content" || resp.TotalDocs != 3 || !reflect.DeepEqual(counts, want) {
+		t.Errorf("terms = %+v, want %v of 3 documents", resp, want)
+	}
+
+	if _, resp := get("/api/terms?size=1"); len(resp.Terms) != 1 || resp.Terms[0].Docs != 2 {
+		t.Errorf("size=1: terms = %+v, want one of the most common", resp.Terms)
+	}
+	for _, target := range []string{"/api/terms?size=0", "/api/terms?size=1001", "/api/terms?field=url"} {
+		if rec, _ := get(target); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", target, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestDocFreq(t *testing.T) {
+	withTermDocs(t)
+
+	tests := []struct {
+		target string
+		groups []string
+		docs   uint64
+		total  uint64
+	}{
+		// the term is analyzed like the field
+		{"/api/terms/df?term=Pooling", []string{"dev"}, 2, 3},
+		// every word has to be there
+		{"/api/terms/df?term=connection+pooling", []string{"dev"}, 1, 3},
+		{"/api/terms/df?term=connection", []string{"dev"}, 2, 3},
+		{"/api/terms/df?term=connection", []string{"security"}, 3, 4},
+		{"/api/terms/df?field=title&term=leak", []string{"dev"}, 0, 3},
+		// keyword fields match as a whole
+		{"/api/terms/df?field=docset&term=guides", []string{"dev"}, 3, 3},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil).WithContext(memberContext(tt.groups...))
+		rec := serve(http.HandlerFunc(handleDocFreq), r)
+		var resp DocFreqResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: %v", tt.target, err)
+		}
+		if resp.Docs != tt.docs || resp.TotalDocs != tt.total {
+			t.Errorf("%s as %v: %d of %d documents, want %d of %d", tt.target, tt.groups, resp.Docs, resp.TotalDocs, tt.docs, tt.total)
+		}
+	}
+
+	if rec := serve(http.HandlerFunc(handleDocFreq), httptest.NewRequest(http.MethodGet, "/api/terms/df?term=+", nil)); rec.Code != http.StatusBadRequest {
+		t.Errorf("blank term: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"golang.org/x/net/html"
+)
+
+// tocEntry is one heading of a page's table of contents
+type tocEntry struct {
+	// Level is 1 for h1 through 6 for h6
+	Level int `json:"level"`
+	// Anchor is the id to link to, empty for headings that can't be linked
+	Anchor string `json:"anchor,omitempty"`
+	Text   string `json:"text"`
+}
+
+// Indent is how far the entry is indented below the top level of toc
+func (e tocEntry) Indent(toc []tocEntry) int {
+	top := 6
+	for _, t := range toc {
+		top = min(top, t.Level)
+	}
+	return e.Level - top
+}
+
+// findTOC lists the h1-h6 headings of a page in order, leaving out the
+// ones in navigation and page chrome
+func findTOC(doc *html.Node) []tocEntry {
+	var toc []tocEntry
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && summarySkip[n.Data] {
+			return
+		}
+		if n.Type == html.ElementNode && len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6' {
+			if text := strings.Join(strings.Fields(nodeText(n)), " "); text != "" {
+				toc = append(toc, tocEntry{Level: int(n.Data[1] - '0'), Anchor: headingAnchor(n), Text: text})
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return toc
+}
+
+// encodeTOC is the stored form of toc. Bleve only stores flat fields, so
+// it's kept as JSON text.
+func encodeTOC(toc []tocEntry) string {
+	if len(toc) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(toc)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// storedTOC decodes the TOC field of a hit
+func storedTOC(v interface{}) []tocEntry {
+	s, _ := v.(string)
+	var toc []tocEntry
+	if s != "" {
+		json.Unmarshal([]byte(s), &toc)
+	}
+	return toc
+}
+
+// loadTOC reads the stored table of contents of the indexed document id.
+// It reports false when the document isn't in the index.
+func loadTOC(id string) ([]tocEntry, bool, error) {
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery([]string{id}), 1, 0, false)
+	searchRequest.Fields = []string{"TOC"}
+	result, err := index.Search(searchRequest)
+	if err != nil || len(result.Hits) == 0 {
+		return nil, false, err
+	}
+	return storedTOC(result.Hits[0].Fields["TOC"]), true, nil
+}
+
+// handleTOC renders the table of contents of the indexed page in the path
+// parameter, for the side panel of a search result
+func handleTOC(w http.ResponseWriter, r *http.Request) {
+	rel := strings.TrimPrefix(r.URL.Query().Get("path"), "/")
+	id := filepath.Join(root, filepath.FromSlash(rel))
+	if rel == "" || !canAccessPath(r.Context(), id) {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+
+	toc, found, err := loadTOC(id)
+	if err != nil {
+		log.Printf("Error reading the table of contents of %s: %v", id, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+
+	renderTemplate(w, "toc_entries", struct {
+		Page
+		Path    string
+		Entries []tocEntry
+	}{newPage(r, "search.toc"), filepath.ToSlash(rel), toc})
+}
+
+// OutlineNode is a heading of a document with the headings below it
+type OutlineNode struct {
+	Level    int           `json:"level"`
+	Anchor   string        `json:"anchor,omitempty"`
+	Text     string        `json:"text"`
+	Children []OutlineNode `json:"children"`
+}
+
+// OutlineResponse is the heading tree of a document
+type OutlineResponse struct {
+	Path    string        `json:"path"`
+	Outline []OutlineNode `json:"outline"`
+}
+
+// outlineTree nests the flat toc: each heading goes below the closest
+// heading before it with a lower level. Skipped levels, like an h3 right
+// after an h1, don't add empty nodes.
+func outlineTree(toc []tocEntry) []OutlineNode {
+	var build func(i, parent int) ([]OutlineNode, int)
+	build = func(i, parent int) ([]OutlineNode, int) {
+		nodes := []OutlineNode{}
+		for i < len(toc) && toc[i].Level > parent {
+			e := toc[i]
+			node := OutlineNode{Level: e.Level, Anchor: e.Anchor, Text: e.Text}
+			node.Children, i = build(i+1, e.Level)
+			nodes = append(nodes, node)
+		}
+		return nodes, i
+	}
+	nodes, _ := build(0, 0)
+	return nodes
+}
+
+// handleAPIOutline returns the heading tree of an indexed document, for
+// tools that show a document's structure. The id is the document path
+// with its slashes escaped, as in /api/doc/guides%2Fstart.html/outline.
+func handleAPIOutline(w http.ResponseWriter, r *http.Request) {
+	path, _, err := documentPath(r, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	toc, found, err := loadTOC(path)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, errNotDocument.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, OutlineResponse{Path: tagKey(path), Outline: outlineTree(toc)})
+}
+
+// tocNav is the table of contents put at the top of served pages. It's
+// styled inline, since it lands in pages the server didn't write.
+var tocNav = template.Must(template.New("toc").Parse(`<nav class="godochive-toc" style="border:1px solid #ddd;padding:.5em 1em;margin:0 0 1em;font-size:.9em">` +
+	`<ul style="list-style:none;margin:0;padding:0">{{range .}}<li style="margin-left:{{.Indent $}}em"><a href="#{{.Anchor}}">{{.Text}}</a></li>{{end}}</ul></nav>`))
+
+var bodyTag = regexp.MustCompile(`(?i)<body[^>]*>`)
+
+// headElements are the elements that belong in a page's head, and whether
+// they have content and an end tag
+var headElements = map[string]bool{"title": true, "style": true, "script": true, "noscript": true, "template": true, "meta": false, "link": false, "base": false}
+
+// contentStart is where the content of an HTML page without a body tag
+// starts: after its doctype, its html and head tags and what belongs in the
+// head. Putting anything before that would take the page out of standards
+// mode or move the rest of its head into the body.
+func contentStart(content []byte) int {
+	z := html.NewTokenizer(bytes.NewReader(content))
+	at, open := 0, 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return at
+		}
+		raw := z.Raw()
+		name, _ := z.TagName()
+		switch tt {
+		case html.TextToken:
+			if open == 0 && len(bytes.TrimSpace(raw)) > 0 {
+				return at
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			hasEnd, inHead := headElements[string(name)]
+			switch {
+			case string(name) == "html" || string(name) == "head":
+			case inHead:
+				if hasEnd && tt == html.StartTagToken {
+					open++
+				}
+			case open == 0:
+				return at
+			}
+		case html.EndTagToken:
+			if headElements[string(name)] && open > 0 {
+				open--
+			} else if string(name) == "html" {
+				return at
+			}
+		}
+		at += len(raw)
+	}
+}
+
+// withTOC returns the HTML page content with a table of contents of its
+// linkable headings after the opening body tag, or where the content starts
+// in pages without one. Pages with fewer than two such headings are
+// returned as they are.
+func withTOC(content []byte) []byte {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return content
+	}
+	var linked []tocEntry
+	for _, e := range findTOC(doc) {
+		if e.Anchor != "" {
+			linked = append(linked, e)
+		}
+	}
+	if len(linked) < 2 {
+		return content
+	}
+
+	var nav bytes.Buffer
+	if err := tocNav.Execute(&nav, linked); err != nil {
+		return content
+	}
+	at := 0
+	if loc := bodyTag.FindIndex(content); loc != nil {
+		at = loc[1]
+	} else {
+		at = contentStart(content)
+	}
+	out := make([]byte, 0, len(content)+nav.Len())
+	out = append(out, content[:at]...)
+	out = append(out, nav.Bytes()...)
+	return append(out, content[at:]...)
+}
+
+// rewritesDocuments reports whether served HTML pages get anything
+// inserted, so they go through serveWithTOC
+func rewritesDocuments() bool {
+	return config.DocumentTOC || config.DocumentRelated || config.DocumentBookmark
+}
+
+// serveWithTOC serves the HTML page at filePath with its table of contents,
+// related documents and bookmark star inserted as configured, see withTOC,
+// withRelated and withBookmarkStar. It reports false for other files,
+// leaving the headers of setCacheHeaders in place.
+func serveWithTOC(w http.ResponseWriter, r *http.Request, filePath string, info os.FileInfo) bool {
+	// pages without an extension are HTML if they sniff as such
+	if t := mappedFileType(filePath); t != "html" && (t != "" || filepath.Ext(filePath) != "") {
+		return false
+	}
+	content, err := readDoc(filePath)
+	if err != nil || fileType(filePath, content) != "html" {
+		return false
+	}
+	if config.DocumentTOC {
+		content = withTOC(content)
+	}
+	if config.DocumentRelated {
+		content = withRelated(r, filePath, content)
+	}
+	if config.DocumentBookmark {
+		content = withBookmarkStar(r, filePath, content)
+		// the star shows whether this visitor bookmarked the page
+		w.Header().Add("Vary", "Cookie")
+	}
+	// the page changes with the index and the config, not only the file,
+	// so it's validated by what is served rather than by the file's date
+	w.Header().Set("ETag", contentETag(content))
+	http.ServeContent(w, r, info.Name(), time.Time{}, bytes.NewReader(content))
+	return true
+}
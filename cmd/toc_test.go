@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const tocPage = `<html><head><title>Client</title></head><body class="doc">
+<nav><h2 id="menu">Menu</h2></nav>
+<h1 id="client">HTTP <code>client</code></h1><p>Sending requests.</p>
+<h2><a id="retries"></a>Retries</h2><p>Retries are capped.</p>
+<h3>Backoff</h3><p>Exponential.</p>
+</body></html>`
+
+func TestFindTOC(t *testing.T) {
+	got := extractPage(tocPage).TOC
+	want := []tocEntry{
+		{Level: 1, Anchor: "client", Text: "HTTP client"},
+		{Level: 2, Anchor: "retries", Text: "Retries"},
+		{Level: 3, Text: "Backoff"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("toc = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if indent := got[2].Indent(got); indent != 2 {
+		t.Errorf("indent of h3 = %d, want 2", indent)
+	}
+	if back := storedTOC(encodeTOC(got)); len(back) != 3 || back[1] != want[1] {
+		t.Errorf("stored toc = %+v", back)
+	}
+}
+
+func TestHandleTOC(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	if err := os.MkdirAll(filepath.Join(dir, "guides"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "guides/client.html"), []byte(tocPage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleTOC(rec, httptest.NewRequest("GET", "/toc?path=guides/client.html", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`href="/guides/client.html#retries"`, "Backoff", `class="indent-2"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("toc missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Menu") {
+		t.Errorf("toc lists navigation headings:\n%s", body)
+	}
+
+	for _, path := range []string{"guides/missing.html", "", "../etc/passwd"} {
+		rec := httptest.NewRecorder()
+		handleTOC(rec, httptest.NewRequest("GET", "/toc?path="+path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("toc of %q: status = %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestServeWithTOC(t *testing.T) {
+	dir := t.TempDir()
+	withRoot(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "client.html"), []byte(tocPage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "short.html"), []byte(`<body><h1 id="only">Only</h1></body>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		serveFiles(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d", path, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	withConfig(t, Config{})
+	if body := get("/client.html"); body != tocPage {
+		t.Errorf("page changed without document_toc:\n%s", body)
+	}
+
+	withConfig(t, Config{DocumentTOC: true})
+	body := get("/client.html")
+	if !strings.HasPrefix(body, `<html><head><title>Client</title></head><body class="doc"><nav class="godochive-toc"`) {
+		t.Errorf("toc not at the top of the body:\n%s", body)
+	}
+	if !strings.Contains(body, `<a href="#retries">Retries</a>`) || strings.Contains(body, ">Backoff</a>") {
+		t.Errorf("toc should link the anchored headings only:\n%s", body)
+	}
+	if body := get("/short.html"); strings.Contains(body, "godochive-toc") {
+		t.Errorf("toc added to a page with one heading:\n%s", body)
+	}
+}
+
+func TestWithTOCWithoutBody(t *testing.T) {
+	headings := `<h2 id="pool">Pooling</h2><p>reuse</p><h2 id="limits">Limits</h2>`
+	// the table of contents goes after the doctype and everything that
+	// belongs in the head, so the page stays in standards mode
+	for _, head := range []string{
+		"<!DOCTYPE html>\n<html lang=\"en\"><head><meta charset=\"utf-8\"><title>Client <b></title>\n<script>var body = \"<p>\";</script></head>\n",
+		"<!doctype html><!-- generated --><title>Client</title>",
+		"",
+	} {
+		out := string(withTOC([]byte(head + headings)))
+		if !strings.HasPrefix(out, head+`<nav class="godochive-toc"`) || !strings.HasSuffix(out, headings) {
+			t.Errorf("toc not where the content starts:\n%s", out)
+		}
+	}
+}
+
+func TestOutlineTree(t *testing.T) {
+	got := outlineTree([]tocEntry{
+		{Level: 1, Anchor: "a", Text: "A"},
+		{Level: 3, Text: "A.1"},
+		{Level: 2, Anchor: "b", Text: "A.2"},
+		{Level: 1, Text: "B"},
+	})
+	if len(got) != 2 || got[0].Text != "A" || got[1].Text != "B" {
+		t.Fatalf("top level = %+v", got)
+	}
+	if kids := got[0].Children; len(kids) != 2 || kids[0].Text != "A.1" || kids[1].Anchor != "b" {
+		t.Errorf("children of A = %+v", kids)
+	}
+	if got[1].Children == nil {
+		t.Error("leaf children are nil, want an empty list")
+	}
+}
+
+func TestHandleAPIOutline(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, Config{})
+	withRoot(t, dir)
+	withEmptyIndex(t)
+	if err := os.MkdirAll(filepath.Join(dir, "guides"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "guides/client.html"), []byte(tocPage), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildIndex(dir); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/doc/{id}/outline", handleAPIOutline)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/doc/guides%2Fclient.html/outline", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp OutlineResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Path != "guides/client.html" || len(resp.Outline) != 1 {
+		t.Fatalf("outline = %+v", resp)
+	}
+	retries := resp.Outline[0].Children
+	if len(retries) != 1 || retries[0].Anchor != "retries" || len(retries[0].Children) != 1 || retries[0].Children[0].Text != "Backoff" {
+		t.Errorf("children = %+v", retries)
+	}
+
+	for _, id := range []string{"guides%2Fmissing.html", "..%2Fetc%2Fpasswd"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/doc/"+id+"/outline", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("outline of %q: status = %d, want 404", id, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Trust levels tell official references from content imported from
+// forums or wikis. Docsets get theirs from the config, and admins can set
+// single documents apart.
+const (
+	trustOfficial  = "official"
+	trustCommunity = "community"
+)
+
+var trustLevels = []string{trustOfficial, trustCommunity}
+
+// trustBucket maps document paths relative to the root to the trust level
+// an admin gave them, which overrides the level of their docset
+const trustBucket = "document_trust"
+
+// trustFor returns the trust level of the document at path: the one an
+// admin set for it, or else its docset's
+func trustFor(path string) string {
+	if store != nil {
+		var level string
+		if _, err := storeGet(trustBucket, tagKey(path), &level); err != nil {
+			log.Printf("Error loading the trust level of %s: %v", path, err)
+		}
+		if level != "" {
+			return level
+		}
+	}
+	if ds := docsetConfigFor(path); ds != nil {
+		return ds.Trust
+	}
+	return ""
+}
+
+// setTrust stores the trust level of the document at path, or removes it
+// when empty so the docset's applies, and reindexes the document
+func setTrust(path string, info os.FileInfo, level string) error {
+	var err error
+	if level == "" {
+		err = storeDelete(trustBucket, tagKey(path))
+	} else {
+		err = storePut(trustBucket, tagKey(path), level)
+	}
+	if err != nil {
+		return err
+	}
+	return reindexDocument(path, info)
+}
+
+// trustFromRequest reads the trust parameter, ignoring unknown levels
+func trustFromRequest(r *http.Request) string {
+	if level := r.URL.Query().Get("trust"); contains(trustLevels, level) {
+		return level
+	}
+	return ""
+}
+
+// filterTrust limits q to documents of the given trust level; empty means
+// no filter
+func filterTrust(q query.Query, level string) query.Query {
+	if level == "" {
+		return q
+	}
+	tq := bleve.NewTermQuery(level)
+	tq.SetField("Trust")
+	return bleve.NewConjunctionQuery(q, tq)
+}
+
+func trustOptions(selected string) []filterOption {
+	options := make([]filterOption, 0, len(trustLevels))
+	for _, level := range trustLevels {
+		options = append(options, filterOption{Value: level, Label: level, Checked: level == selected})
+	}
+	return options
+}
+
+// TrustResponse is the body of /api/admin/trust/{path}
+type TrustResponse struct {
+	Path  string `json:"path"`
+	Trust string `json:"trust"`
+}
+
+func handleGetTrust(w http.ResponseWriter, r *http.Request) {
+	path, _, err := documentPath(r, r.PathValue("path"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, TrustResponse{Path: tagKey(path), Trust: trustFor(path)})
+}
+
+func handlePutTrust(w http.ResponseWriter, r *http.Request) {
+	path, info, err := documentPath(r, r.PathValue("path"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	var req struct {
+		Trust string `json:"trust"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if req.Trust != "" && !contains(trustLevels, req.Trust) {
+		writeError(w, r, http.StatusBadRequest, `trust must be "official", "community" or empty`)
+		return
+	}
+	if err := setTrust(path, info, req.Trust); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, TrustResponse{Path: tagKey(path), Trust: trustFor(path)})
+}
+
+// handleTrustForm sets the trust level of a search result from the admin
+// form under it, then goes back to the search
+func handleTrustForm(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		renderError(w, r, http.StatusForbidden)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	path, info, err := documentPath(r, r.PostForm.Get("path"))
+	if err != nil {
+		renderError(w, r, http.StatusNotFound)
+		return
+	}
+	level := r.PostForm.Get("trust")
+	if level != "" && !contains(trustLevels, level) {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	if err := setTrust(path, info, level); err != nil {
+		log.Printf("Error setting the trust level of %s: %v", path, err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, safeRedirectPath(r.PostForm.Get("next")), http.StatusSeeOther)
+}
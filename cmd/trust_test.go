@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTrustLevels(t *testing.T) {
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	withStore(t)
+	withConfig(t, Config{
+		Docsets: []DocsetConfig{
+			{Name: "guides", Path: "guides", Trust: trustOfficial},
+			{Name: "forum", Path: "forum", Trust: trustCommunity},
+		},
+		Auth: AuthConfig{Tokens: []AuthToken{{Name: "ops", Token: "ops-tok", Groups: []string{"admins"}}}, AdminGroups: []string{"admins"}},
+	})
+	withDocFiles(t, map[string]string{"guides/pool.html": "connection pool", "forum/pool.html": "pool question", "forum/answer.html": "pool answer", "misc/pool.html": "pool notes"})
+	withEmptyIndex(t)
+	if _, err := buildIndex(root); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(level string) []string {
+		results, err := performSearch("pool", searchFilter{Trust: level}, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, doc := range results {
+			got = append(got, doc.URL+"="+doc.Trust)
+		}
+		sort.Strings(got)
+		return got
+	}
+	if got, want := strings.Join(search(""), ","), "forum/answer.html=community,forum/pool.html=community,guides/pool.html=official,misc/pool.html="; got != want {
+		t.Errorf("results = %s, want %s", got, want)
+	}
+
+	// an admin vouches for one forum answer
+	form := url.Values{"path": {"forum/answer.html"}, "trust": {trustOfficial}, "next": {"/search?q=pool"}}
+	post := func(r *http.Request) int {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(http.HandlerFunc(handleTrustForm), r).Code
+	}
+	if code := post(httptest.NewRequest(http.MethodPost, "/trust", strings.NewReader(form.Encode())).WithContext(memberContext())); code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := post(httptest.NewRequest(http.MethodPost, "/trust", strings.NewReader(form.Encode())).WithContext(memberContext("admins"))); code != http.StatusSeeOther {
+		t.Fatalf("admin: status = %d", code)
+	}
+	if got, want := strings.Join(search(trustOfficial), ","), "forum/answer.html=official,guides/pool.html=official"; got != want {
+		t.Errorf("official = %s, want %s", got, want)
+	}
+
+	// clearing it falls back to the docset's level
+	put := httptest.NewRequest(http.MethodPut, "/api/admin/trust/forum/answer.html", strings.NewReader(`{"trust": ""}`)).WithContext(memberContext("admins"))
+	put.SetPathValue("path", "forum/answer.html")
+	if rec := serve(requireAdmin(handlePutTrust), put); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"trust":"community"`) {
+		t.Errorf("clearing = %d %s", rec.Code, rec.Body.String())
+	}
+	bad := httptest.NewRequest(http.MethodPut, "/api/admin/trust/forum/answer.html", strings.NewReader(`{"trust": "verified"}`)).WithContext(memberContext("admins"))
+	bad.SetPathValue("path", "forum/answer.html")
+	if rec := serve(requireAdmin(handlePutTrust), bad); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown level: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if got, want := strings.Join(search(trustCommunity), ","), "forum/answer.html=community,forum/pool.html=community"; got != want {
+		t.Errorf("community = %s, want %s", got, want)
+	}
+}
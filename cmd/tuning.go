@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/index/scorch"
+	"github.com/blevesearch/bleve/v2/index/upsidedown"
+	"github.com/blevesearch/bleve/v2/index/upsidedown/store/boltdb"
+)
+
+// defaultBatchSize is how many documents are indexed per batch when the
+// config doesn't say
+const defaultBatchSize = 500
+
+// indexTypes are the index formats IndexConfig.Type can name
+var indexTypes = []string{scorch.Name, upsidedown.Name}
+
+func (c IndexConfig) validate() error {
+	if c.Type != "" && !contains(indexTypes, c.Type) {
+		return fmt.Errorf("index: unknown type %q, use %q or %q", c.Type, scorch.Name, upsidedown.Name)
+	}
+	if c.BatchSize < 0 || c.MemoryQuotaMB < 0 {
+		return fmt.Errorf("index: batch_size and memory_quota_mb can't be negative")
+	}
+	if c.MaxDepth < 0 {
+		return fmt.Errorf("index: max_depth can't be negative")
+	}
+	if c.Shards < 0 || c.Shards > maxShards {
+		return fmt.Errorf("index: shards must be between 1 and %d", maxShards)
+	}
+	m := c.Merge
+	if m.MaxSegmentsPerTier < 0 || m.MaxSegmentDocs < 0 || m.SegmentsPerMergeTask < 0 {
+		return fmt.Errorf("index: merge settings can't be negative")
+	}
+	if m.SegmentsPerMergeTask == 1 {
+		return fmt.Errorf("index: merge.segments_per_merge_task must be at least 2")
+	}
+	return validateFileTypes(c.FileTypes)
+}
+
+// indexRuntimeConfig is what bleve creates and opens indexes with: the
+// merge policy, for scorch indexes. Upside-down indexes ignore it.
+func indexRuntimeConfig() map[string]interface{} {
+	m := config.Index.Merge
+	plan := map[string]interface{}{}
+	if m.MaxSegmentsPerTier > 0 {
+		plan["MaxSegmentsPerTier"] = m.MaxSegmentsPerTier
+	}
+	if m.MaxSegmentDocs > 0 {
+		plan["MaxSegmentSize"] = m.MaxSegmentDocs
+	}
+	if m.SegmentsPerMergeTask > 0 {
+		plan["SegmentsPerMergeTask"] = m.SegmentsPerMergeTask
+	}
+	if len(plan) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"scorchMergePlanOptions": plan}
+}
+
+// newIndex creates an empty index at path, of the configured type and
+// split into shards when shards is more than 1
+func newIndex(path string, shards int) (bleve.Index, error) {
+	if shards > 1 {
+		s, err := newShardedIndex(path, shards)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return newSingleIndex(path)
+}
+
+func newSingleIndex(path string) (bleve.Index, error) {
+	if config.Index.Type == upsidedown.Name {
+		return bleve.NewUsing(path, newIndexMapping(), upsidedown.Name, boltdb.Name, nil)
+	}
+	return bleve.NewUsing(path, newIndexMapping(), scorch.Name, bleve.Config.DefaultKVStore, indexRuntimeConfig())
+}
+
+// batchFull reports whether batch should be applied before more documents
+// are added to it
+func batchFull(batch *bleve.Batch) bool {
+	size := config.Index.BatchSize
+	if size == 0 {
+		size = defaultBatchSize
+	}
+	if batch.Size() >= size {
+		return true
+	}
+	quota := uint64(config.Index.MemoryQuotaMB) << 20
+	return quota > 0 && batch.TotalDocsSize() >= quota
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+func TestIndexTuning(t *testing.T) {
+	withRoot(t, t.TempDir())
+	for i := 0; i < 5; i++ {
+		page := fmt.Sprintf("<title>Page %d</title><p>connections are pooled</p>", i)
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("page%d.html", i)), []byte(page), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]IndexConfig{
+		"scorch in small batches": {BatchSize: 2, Merge: MergeConfig{MaxSegmentsPerTier: 2, SegmentsPerMergeTask: 2}},
+		"scorch under a quota":    {MemoryQuotaMB: 1},
+		"upside down":             {Type: "upside_down", BatchSize: 3},
+	}
+	for name, tuning := range tests {
+		withConfig(t, Config{Index: tuning})
+		path := filepath.Join(t.TempDir(), "index.bleve")
+		idx, err := newIndex(path, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := buildIndexInto(idx, root); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		idx.Close()
+
+		idx, err = openIndex(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		res, err := idx.Search(bleve.NewSearchRequest(bleve.NewMatchQuery("pooled")))
+		if err != nil || res.Total != 5 {
+			t.Errorf("%s: search = %v, %v", name, res, err)
+		}
+		idx.Close()
+	}
+}
+
+func TestIndexConfigValidate(t *testing.T) {
+	for _, c := range []IndexConfig{
+		{Type: "rocksdb"},
+		{BatchSize: -1},
+		{Merge: MergeConfig{MaxSegmentDocs: -5}},
+		{Merge: MergeConfig{SegmentsPerMergeTask: 1}},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("%+v is valid", c)
+		}
+	}
+	if err := (IndexConfig{Type: "scorch", BatchSize: 1000, MemoryQuotaMB: 256}).validate(); err != nil {
+		t.Error(err)
+	}
+}
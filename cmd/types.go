@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// docType is the file type a document is filtered by: the type its
+// extension maps to, like html for ".htm" and ".xhtml", or else the
+// extension without the dot
+func docType(path string) string {
+	if t := mappedFileType(path); t != "" {
+		return t
+	}
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// docTypeOf is docType for a document whose content sniffed as typ, which
+// files without an extension are filtered by
+func docTypeOf(path, typ string) string {
+	if t := docType(path); t != "" {
+		return t
+	}
+	return typ
+}
+
+// typeIcons are the icons shown before results of each file type.
+// Source files share one; types without an icon get a blank page.
+var typeIcons = map[string]string{
+	"html": "🌐",
+	"pdf":  "📕",
+	"md":   "📝",
+	"txt":  "📄",
+	"go":   "⌨️", "py": "⌨️", "js": "⌨️", "ts": "⌨️", "java": "⌨️", "rs": "⌨️", "c": "⌨️", "sh": "⌨️",
+}
+
+// Icon is the icon of the document's file type
+func (d Document) Icon() string {
+	if icon, ok := typeIcons[d.DocType]; ok {
+		return icon
+	}
+	return "📄"
+}
+
+// DisplaySize is the file size for people, like "12 KB", empty when the
+// index predates sizes
+func (d Document) DisplaySize() string {
+	if d.Size <= 0 {
+		return ""
+	}
+	return formatBytes(uint64(d.Size))
+}
+
+// formatBytes writes a size for people, like "12 KB" or "1.5 GB"
+func formatBytes(n uint64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 || size >= 10 {
+		return fmt.Sprintf("%.0f %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// availableTypes lists the file types of the allowed extensions in order,
+// then those of index.file_types
+func availableTypes() []string {
+	var types []string
+	for _, ext := range allowedExtensions {
+		if t := docType(ext); t != "" && !contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	var mapped []string
+	for _, t := range config.Index.FileTypes {
+		if !contains(types, t) && !contains(mapped, t) {
+			mapped = append(mapped, t)
+		}
+	}
+	sort.Strings(mapped)
+	return append(types, mapped...)
+}
+
+// typesFromRequest reads the type parameter, which may be repeated
+// (type=html&type=md, as sent by the checkboxes) or comma-separated
+func typesFromRequest(r *http.Request) []string {
+	return parseTypes(r.URL.Query()["type"]...)
+}
+
+func parseTypes(values ...string) []string {
+	var types []string
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if t = docType("." + strings.TrimSpace(t)); t != "" && !contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// filterTypes limits q to documents of the given types; no types means
+// no filter
+func filterTypes(q query.Query, types []string) query.Query {
+	if len(types) == 0 {
+		return q
+	}
+	terms := make([]query.Query, 0, len(types))
+	for _, t := range types {
+		tq := bleve.NewTermQuery(t)
+		tq.SetField("DocType")
+		terms = append(terms, tq)
+	}
+	return bleve.NewConjunctionQuery(q, bleve.NewDisjunctionQuery(terms...))
+}
+
+// typeOption is a file type checkbox on the search page
+type typeOption struct {
+	Name    string
+	Checked bool
+}
+
+func typeOptions(selected []string) []typeOption {
+	var options []typeOption
+	for _, t := range availableTypes() {
+		options = append(options, typeOption{Name: t, Checked: contains(selected, t)})
+	}
+	return options
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTypesFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/search?q=x&type=html&type=MD,.htm,txt", nil)
+	if got, want := typesFromRequest(r), []string{"html", "md", "txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("typesFromRequest = %v, want %v", got, want)
+	}
+}
+
+func TestSearchFiltersByType(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	for _, name := range []string{"pool.html", "pool.md", "pool.txt"} {
+		path := filepath.Join(root, name)
+		doc := Document{Title: "Pooling", Content: "connection pooling", URL: path, DocType: docType(path), Size: 2048}
+		if err := idx.Index(path, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := performSearch("pooling", searchFilter{Types: []string{"md", "txt"}}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, doc := range results {
+		urls = append(urls, doc.URL)
+		if doc.DocType == "" || doc.DisplaySize() != "2.0 KB" {
+			t.Errorf("%s: type %q, size %q, want them from the stored fields", doc.URL, doc.DocType, doc.DisplaySize())
+		}
+	}
+	if len(urls) != 2 || contains(urls, "pool.html") {
+		t.Errorf("results = %v, want pool.md and pool.txt", urls)
+	}
+
+	api, err := runAPISearch("pooling", []string{"url"}, searchFilter{Types: []string{"html"}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api.Total != 1 || api.Hits[0].Fields["url"] != "pool.html" {
+		t.Errorf("API total = %d, hits = %+v, want only pool.html", api.Total, api.Hits)
+	}
+}
+
+func TestDisplaySize(t *testing.T) {
+	for size, want := range map[int64]string{0: "", 512: "512 B", 1536: "1.5 KB", 20 << 10: "20 KB", 3 << 20: "3.0 MB"} {
+		if got := (Document{Size: size}).DisplaySize(); got != want {
+			t.Errorf("DisplaySize(%d) = %q, want %q", size, got, want)
+		}
+	}
+	if icon := (Document{DocType: "md"}).Icon(); icon != typeIcons["md"] {
+		t.Errorf("icon of md = %q", icon)
+	}
+	if icon := (Document{DocType: "rst"}).Icon(); icon != "📄" {
+		t.Errorf("icon of an unknown type = %q", icon)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// updatedRanges are the choices of the "updated" select on the search page
+var updatedRanges = []string{"7d", "30d", "365d"}
+
+// updatedWindow reads the date filters: updated=30d for documents modified
+// in the last 30 days, and since=/until= for a range of dates. until
+// includes the whole day. Zero times leave that end open.
+func updatedWindow(params url.Values, now time.Time) (since, until time.Time, err error) {
+	if v := params.Get("updated"); v != "" {
+		days, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+		if err != nil || !strings.HasSuffix(v, "d") || days <= 0 {
+			return since, until, fmt.Errorf("invalid updated %q, want a number of days like 30d", v)
+		}
+		since = now.AddDate(0, 0, -days)
+	}
+	if v := params.Get("since"); v != "" {
+		t, err := parseDate(v)
+		if err != nil {
+			return since, until, fmt.Errorf("invalid since: %v", err)
+		}
+		if t.After(since) {
+			since = t
+		}
+	}
+	if v := params.Get("until"); v != "" {
+		t, err := parseDate(v)
+		if err != nil {
+			return since, until, fmt.Errorf("invalid until: %v", err)
+		}
+		if len(v) == len(time.DateOnly) {
+			t = t.AddDate(0, 0, 1)
+		}
+		until = t
+	}
+	return since, until, nil
+}
+
+// parseDate accepts a date (2006-01-02) or an RFC 3339 timestamp
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpdatedWindow(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		params       string
+		since, until time.Time
+	}{
+		{"", time.Time{}, time.Time{}},
+		{"updated=30d", now.AddDate(0, 0, -30), time.Time{}},
+		{"since=2024-03-10&until=2024-03-20", day(10), day(21)},
+		// the later start wins
+		{"updated=7d&since=2024-03-01", now.AddDate(0, 0, -7), time.Time{}},
+		{"until=2024-03-20T08:00:00Z", time.Time{}, time.Date(2024, 3, 20, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		params, _ := url.ParseQuery(tt.params)
+		since, until, err := updatedWindow(params, now)
+		if err != nil || !since.Equal(tt.since) || !until.Equal(tt.until) {
+			t.Errorf("updatedWindow(%q) = %v, %v, %v, want %v, %v", tt.params, since, until, err, tt.since, tt.until)
+		}
+	}
+
+	for _, bad := range []string{"updated=30", "updated=-1d", "updated=monthd", "since=yesterday"} {
+		params, _ := url.ParseQuery(bad)
+		if _, _, err := updatedWindow(params, now); err == nil {
+			t.Errorf("updatedWindow(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestSearchFiltersByModifiedAt(t *testing.T) {
+	withConfig(t, Config{})
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	docs := map[string]time.Time{
+		"fresh.html": time.Now().AddDate(0, 0, -3),
+		"stale.html": time.Now().AddDate(-1, 0, 0),
+	}
+	for name, modified := range docs {
+		path := filepath.Join(root, name)
+		doc := Document{Title: "Pooling", Content: "connection pooling", URL: path, ModifiedAt: modified}
+		if err := idx.Index(path, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := performSearch("pooling", searchFilter{Since: time.Now().AddDate(0, 0, -30)}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].URL != "fresh.html" {
+		t.Errorf("results = %+v, want only fresh.html", results)
+	}
+
+	api, err := runAPISearch("pooling", []string{"url"}, searchFilter{Until: time.Now().AddDate(0, -1, 0)}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api.Total != 1 || api.Hits[0].Fields["url"] != "stale.html" {
+		t.Errorf("API total = %d, hits = %+v, want only stale.html", api.Total, api.Hits)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// usageFields are the stored fields the disk usage report accounts for
+var usageFields = []string{"Title", "Content", "URL", "Docset"}
+
+// UsageResponse estimates how the index size is spread over docsets and
+// fields. Bleve doesn't track sizes per field, so the on-disk size is split
+// in proportion to the stored text of each docset and field.
+type UsageResponse struct {
+	TotalBytes uint64        `json:"total_bytes"`
+	Documents  uint64        `json:"documents"`
+	Docsets    []DocsetUsage `json:"docsets"`
+}
+
+// DocsetUsage is the estimated share of one docset
+type DocsetUsage struct {
+	Name           string            `json:"name"`
+	Documents      uint64            `json:"documents"`
+	EstimatedBytes uint64            `json:"estimated_bytes"`
+	Fields         map[string]uint64 `json:"fields"`
+}
+
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := indexUsage(index)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// handleUsagePage shows the usage report to admins, the largest docsets
+// first
+func handleUsagePage(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		renderError(w, r, http.StatusForbidden)
+		return
+	}
+	usage, err := indexUsage(index)
+	if err != nil {
+		log.Printf("Error estimating the index usage: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "usage.html", struct {
+		Page
+		Usage  UsageResponse
+		Fields []string
+	}{newPage(r, "usage.title"), usage, usageFields})
+}
+
+// indexUsage reads the stored fields of every document, in pages sorted by
+// ID, and tallies their length per docset and field
+func indexUsage(idx bleve.Index) (UsageResponse, error) {
+	textBytes := make(map[string]map[string]uint64)
+	docs := make(map[string]uint64)
+	var total uint64
+
+	var after []string
+	for {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 1000, 0, false)
+		req.Fields = usageFields
+		req.SortBy([]string{"_id"})
+		req.SearchAfter = after
+
+		res, err := idx.Search(req)
+		if err != nil {
+			return UsageResponse{}, err
+		}
+		for _, hit := range res.Hits {
+			docset, _ := hit.Fields["Docset"].(string)
+			if textBytes[docset] == nil {
+				textBytes[docset] = make(map[string]uint64)
+			}
+			docs[docset]++
+			for _, field := range usageFields {
+				s, _ := hit.Fields[field].(string)
+				textBytes[docset][field] += uint64(len(s))
+				total += uint64(len(s))
+			}
+		}
+		if len(res.Hits) < 1000 {
+			break
+		}
+		after = []string{res.Hits[len(res.Hits)-1].ID}
+	}
+
+	usage := UsageResponse{TotalBytes: indexDiskBytes(idx), Docsets: []DocsetUsage{}}
+	for name, fields := range textBytes {
+		du := DocsetUsage{Name: name, Documents: docs[name], Fields: make(map[string]uint64)}
+		for field, n := range fields {
+			share := estimateShare(usage.TotalBytes, n, total)
+			du.Fields[field] = share
+			du.EstimatedBytes += share
+		}
+		usage.Documents += du.Documents
+		usage.Docsets = append(usage.Docsets, du)
+	}
+	sort.Slice(usage.Docsets, func(i, j int) bool {
+		return usage.Docsets[i].EstimatedBytes > usage.Docsets[j].EstimatedBytes
+	})
+	return usage, nil
+}
+
+func estimateShare(diskBytes, part, whole uint64) uint64 {
+	if whole == 0 {
+		return 0
+	}
+	return uint64(float64(diskBytes) * float64(part) / float64(whole))
+}
+
+// indexDiskBytes is the size of idx on disk, or 0 when it can't be told
+func indexDiskBytes(idx bleve.Index) uint64 {
+	var n uint64
+	for _, shard := range shardsOf(idx) {
+		adv, err := shard.Advanced()
+		if err != nil {
+			return 0
+		}
+		m, ok := adv.(mergeableIndex)
+		if !ok {
+			return 0
+		}
+		n += diskBytes(m)
+	}
+	return n
+}
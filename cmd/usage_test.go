@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIndexUsageCountsDocsets(t *testing.T) {
+	withConfig(t, restrictedConfig)
+	withRoot(t, t.TempDir())
+	withIndex(t, map[string]string{
+		"guides/a.html":                "Install",
+		"guides/b.html":                "Upgrade",
+		"security/playbooks/leak.html": "Credential leak",
+	})
+
+	usage, err := indexUsage(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Documents != 3 {
+		t.Errorf("documents = %d, want 3", usage.Documents)
+	}
+	got := make(map[string]uint64)
+	for _, du := range usage.Docsets {
+		got[du.Name] = du.Documents
+	}
+	if got["guides"] != 2 || got["security-playbooks"] != 1 {
+		t.Errorf("documents per docset = %v", got)
+	}
+}
+
+func TestUsagePage(t *testing.T) {
+	cfg := restrictedConfig
+	cfg.Auth = AuthConfig{Tokens: []AuthToken{{Name: "ops", Token: "ops-tok"}}, AdminGroups: []string{"admins"}}
+	withConfig(t, cfg)
+	withRoot(t, t.TempDir())
+	withIndex(t, map[string]string{"guides/a.html": "Install", "security/playbooks/leak.html": "Credential leak"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serve(http.HandlerFunc(handleUsagePage), httptest.NewRequest(http.MethodGet, "/admin/usage", nil).WithContext(memberContext())); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin got status %d", rec.Code)
+	}
+	rec := serve(http.HandlerFunc(handleUsagePage), httptest.NewRequest(http.MethodGet, "/admin/usage", nil).WithContext(memberContext("admins")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "<td>guides</td><td>1</td>") || !strings.Contains(body, "<td>security-playbooks</td><td>1</td>") {
+		t.Errorf("the page doesn't list the docsets:\n%s", body)
+	}
+	if !strings.Contains(body, "<th>Titles</th>") || strings.Contains(body, "usage.field.") {
+		t.Errorf("the field labels aren't translated:\n%s", body)
+	}
+}
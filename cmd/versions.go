@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// versions lists the configured docset versions in config order
+func versions() []string {
+	var list []string
+	for _, ds := range config.Docsets {
+		if ds.Version != "" && !contains(list, ds.Version) {
+			list = append(list, ds.Version)
+		}
+	}
+	return list
+}
+
+// versionFor returns the version of the docset a file belongs to, empty
+// for unversioned docs
+func versionFor(path string) string {
+	if ds := docsetConfigFor(path); ds != nil {
+		return ds.Version
+	}
+	return ""
+}
+
+// restrictVersion hides documents of versions other than version.
+// Unversioned documents are always included.
+func restrictVersion(q query.Query, version string) query.Query {
+	if version == "" {
+		return q
+	}
+
+	restricted := bleve.NewBooleanQuery()
+	restricted.AddMust(q)
+	for _, v := range versions() {
+		if v == version {
+			continue
+		}
+		tq := bleve.NewTermQuery(v)
+		tq.SetField("Version")
+		restricted.AddMustNot(tq)
+	}
+	return restricted
+}
+
+// pinnedPath returns the path of the same page in the given version of its
+// docset, or "" when path is in that version already, isn't versioned or
+// has no counterpart
+func pinnedPath(path, version string) string {
+	ds := docsetConfigFor(path)
+	if version == "" || ds == nil || ds.Version == "" || ds.Version == version {
+		return ""
+	}
+	rel, err := filepath.Rel(filepath.Join(root, ds.Path), path)
+	if err != nil {
+		return ""
+	}
+	for _, other := range config.Docsets {
+		if other.Name != ds.Name || other.Version != version {
+			continue
+		}
+		target := filepath.Join(root, other.Path, rel)
+		if _, err := os.Stat(target); err == nil {
+			return target
+		}
+	}
+	return ""
+}
+
+// redirectToPinnedVersion sends a browser that pinned a version to the same
+// page in that version. It reports whether it redirected.
+func redirectToPinnedVersion(w http.ResponseWriter, r *http.Request, path string) bool {
+	target := pinnedPath(path, preferencesFromRequest(r).Version)
+	if target == "" {
+		return false
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	u := "/" + filepath.ToSlash(rel)
+	if strings.HasSuffix(r.URL.Path, "/") && !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	if r.URL.RawQuery != "" {
+		u += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, u, http.StatusFound)
+	return true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var versionedConfig = Config{
+	Docsets: []DocsetConfig{
+		{Name: "api", Path: "api/v1", Version: "v1"},
+		{Name: "api", Path: "api/v2", Version: "v2"},
+	},
+}
+
+// pinnedRequest is a request from a browser that pinned version
+func pinnedRequest(method, target, version string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.AddCookie(&http.Cookie{Name: prefsCookieName, Value: url.Values{"version": {version}}.Encode()})
+	return r
+}
+
+func TestPinnedVersionFiltersSearch(t *testing.T) {
+	withConfig(t, versionedConfig)
+	withRoot(t, t.TempDir())
+	idx := withEmptyIndex(t)
+
+	for _, rel := range []string{"api/v1/dial.html", "api/v2/dial.html", "guides/dial.html"} {
+		path := filepath.Join(root, rel)
+		doc := Document{Title: "Dial", Content: "dial a server", URL: path, Docset: docsetFor(path), Version: versionFor(path)}
+		if err := idx.Index(path, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pinned, err := filterFromRequest(pinnedRequest("GET", "/search?q=dial", "v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := performSearch("dial", pinned, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, doc := range results {
+		urls = append(urls, doc.URL)
+	}
+	if len(urls) != 2 || contains(urls, filepath.Join("api", "v1", "dial.html")) {
+		t.Errorf("results = %v, want v2 and the unversioned guide", urls)
+	}
+
+	all, err := performSearch("dial", searchFilter{}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("unpinned results = %d, want 3", len(all))
+	}
+}
+
+func TestPinnedVersionRedirectsBrowsing(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{"api/v1/dial.html", "api/v2/dial.html", "api/v1/old.html"} {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("<html></html>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withConfig(t, versionedConfig)
+	withRoot(t, dir)
+
+	tests := []struct {
+		path, version string
+		want          int
+		location      string
+	}{
+		{"/api/v1/dial.html", "v2", http.StatusFound, "/api/v2/dial.html"},
+		{"/api/v1/", "v2", http.StatusFound, "/api/v2/"},
+		{"/api/v2/dial.html", "v2", http.StatusOK, ""},
+		{"/api/v1/dial.html", "", http.StatusOK, ""},
+		// no counterpart in v2
+		{"/api/v1/old.html", "v2", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		rec := serve(http.HandlerFunc(serveFiles), pinnedRequest("GET", tt.path, tt.version))
+		if rec.Code != tt.want || rec.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s pinned to %q = %d %q, want %d %q", tt.path, tt.version, rec.Code, rec.Header().Get("Location"), tt.want, tt.location)
+		}
+	}
+}
+
+func TestVersionPreference(t *testing.T) {
+	withConfig(t, versionedConfig)
+
+	if got := defaultPrefs.merge(url.Values{"version": {"v1"}}).Version; got != "v1" {
+		t.Errorf("version = %q, want v1", got)
+	}
+	if got := defaultPrefs.merge(url.Values{"version": {"v9"}}).Version; got != "" {
+		t.Errorf("unknown version = %q, want it ignored", got)
+	}
+	pinned := Preferences{Version: "v1"}
+	if got := pinned.merge(url.Values{"version": {""}}).Version; got != "" {
+		t.Errorf("empty version = %q, want it to unpin", got)
+	}
+	if got := pinned.merge(url.Values{"theme": {"dark"}}).Version; got != "v1" {
+		t.Errorf("version = %q after changing the theme, want v1 kept", got)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// defaultMaxDepth is how many directories deep symlinks are followed when
+// the config doesn't say
+const defaultMaxDepth = 32
+
+// walkTree walks the docs below root like filepath.Walk, following
+// symlinks to directories when IndexConfig.FollowSymlinks is set. Links are
+// resolved to the directory they lead to, and a directory already walked,
+// through a link cycle or a second link to it, isn't walked again.
+// Directories deeper than IndexConfig.MaxDepth are skipped.
+func walkTree(root string, fn filepath.WalkFunc) error {
+	if !config.Index.FollowSymlinks {
+		return filepath.Walk(root, fn)
+	}
+	w := &treeWalker{fn: fn, visited: make(map[string]bool), maxDepth: config.Index.MaxDepth}
+	if w.maxDepth == 0 {
+		w.maxDepth = defaultMaxDepth
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walk(root, info, 0)
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+type treeWalker struct {
+	fn       filepath.WalkFunc
+	visited  map[string]bool
+	maxDepth int
+}
+
+func (w *treeWalker) walk(path string, info os.FileInfo, depth int) error {
+	if !info.IsDir() {
+		return w.fn(path, info, nil)
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return w.fn(path, info, err)
+	}
+	if w.visited[real] {
+		log.Printf("Not following %s: %s was walked already", path, real)
+		return nil
+	}
+	w.visited[real] = true
+	if depth > w.maxDepth {
+		log.Printf("Not following %s: it's more than %d directories deep", path, w.maxDepth)
+		return nil
+	}
+
+	if err := w.fn(path, info, nil); err != nil {
+		if errors.Is(err, filepath.SkipDir) {
+			return nil
+		}
+		return err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if err := w.fn(path, info, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+			return err
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		name := filepath.Join(path, entry.Name())
+		// Stat follows links; dangling ones are skipped
+		info, err := os.Stat(name)
+		if err != nil {
+			if entry.Type()&os.ModeSymlink != 0 {
+				log.Printf("Skipping %s: %v", name, err)
+				continue
+			}
+			if err := w.fn(name, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.walk(name, info, depth+1); err != nil {
+			// like filepath.Walk, SkipDir for a file skips the rest of
+			// its directory
+			if errors.Is(err, filepath.SkipDir) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
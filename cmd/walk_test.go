@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWalkSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	shared := filepath.Join(dir, "shared")
+	for _, d := range []string{docs, shared, filepath.Join(docs, "a", "b")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(docs, "index.html"), filepath.Join(docs, "a", "b", "deep.html"), filepath.Join(shared, "pool.html")} {
+		if err := os.WriteFile(f, []byte("<title>Page</title><p>text</p>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		filepath.Join(docs, "shared"):        shared,
+		filepath.Join(docs, "shared-too"):    shared,
+		filepath.Join(docs, "a", "loop"):     docs,
+		filepath.Join(docs, "dangling.html"): filepath.Join(dir, "missing.html"),
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skip("symlinks aren't supported here:", err)
+		}
+	}
+
+	walked := func(tuning IndexConfig) string {
+		t.Helper()
+		withConfig(t, Config{Index: tuning})
+		var files []string
+		err := walkTree(docs, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				rel, _ := filepath.Rel(docs, path)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(files)
+		return strings.Join(files, ",")
+	}
+
+	if got := walked(IndexConfig{}); got != "a/b/deep.html,a/loop,dangling.html,index.html,shared,shared-too" {
+		t.Errorf("without following, walked %s", got)
+	}
+	// the loop and the second link to shared are walked once
+	if got := walked(IndexConfig{FollowSymlinks: true}); got != "a/b/deep.html,index.html,shared/pool.html" {
+		t.Errorf("following, walked %s", got)
+	}
+	if got := walked(IndexConfig{FollowSymlinks: true, MaxDepth: 1}); got != "index.html,shared/pool.html" {
+		t.Errorf("following one directory deep, walked %s", got)
+	}
+}
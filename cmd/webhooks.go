@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// WebhookEvent is the body POSTed to lifecycle webhooks
+type WebhookEvent struct {
+	Event string                 `json:"event"`
+	Time  time.Time              `json:"time"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// fireWebhooks delivers event to every configured webhook subscribed to it.
+// Delivery is synchronous so a failure event still goes out before the
+// process exits; errors are only logged.
+func fireWebhooks(event string, data map[string]interface{}) {
+	for _, hook := range config.Webhooks {
+		if !hook.wants(event) {
+			continue
+		}
+		payload := WebhookEvent{Event: event, Time: time.Now().UTC(), Data: data}
+		if err := deliverWebhook(hook, payload); err != nil {
+			log.Printf("Error delivering %s webhook to %s: %v", event, hook.URL, err)
+		}
+	}
+}
+
+func (h WebhookConfig) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverWebhook POSTs the event, signing the body with HMAC-SHA256 in the
+// X-GoDocHive-Signature header when the hook has a secret
+func deliverWebhook(hook WebhookConfig, payload WebhookEvent) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GoDocHive-Event", payload.Event)
+	if hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write(body)
+		req.Header.Set("X-GoDocHive-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWebhooks(t *testing.T) {
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	var mu sync.Mutex
+	var received []delivery
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		received = append(received, delivery{r.Header.Clone(), body})
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+	deliveries := func() []delivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]delivery(nil), received...)
+	}
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	withConfig(t, Config{Webhooks: []WebhookConfig{
+		// a failing hook doesn't keep the others from being called
+		{URL: failing.URL},
+		{URL: receiver.URL + "/signed", Events: []string{"index.completed"}, Secret: "s3cret"},
+		{URL: receiver.URL + "/other", Events: []string{"index.failed"}},
+	}})
+	fireWebhooks("index.completed", map[string]interface{}{"documents": 3})
+
+	if len(deliveries()) != 1 {
+		t.Fatalf("deliveries = %d, want only the subscribed hook", len(deliveries()))
+	}
+	got := deliveries()[0]
+	var event WebhookEvent
+	if err := json.Unmarshal(got.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != "index.completed" || event.Time.IsZero() || event.Data["documents"] != 3.0 {
+		t.Errorf("payload = %+v", event)
+	}
+	if got.header.Get("X-GoDocHive-Event") != "index.completed" || got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", got.header)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(got.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.header.Get("X-GoDocHive-Signature") != want {
+		t.Errorf("signature = %q, want %q", got.header.Get("X-GoDocHive-Signature"), want)
+	}
+
+	// without a secret the body isn't signed
+	if err := deliverWebhook(WebhookConfig{URL: receiver.URL}, WebhookEvent{Event: "index.started"}); err != nil {
+		t.Fatal(err)
+	}
+	if sig := deliveries()[1].header.Get("X-GoDocHive-Signature"); sig != "" {
+		t.Errorf("unsigned hook got signature %q", sig)
+	}
+
+	err := deliverWebhook(WebhookConfig{URL: failing.URL}, WebhookEvent{Event: "index.started"})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("failing receiver: err = %v, want its status", err)
+	}
+	failing.Close()
+	if err := deliverWebhook(WebhookConfig{URL: failing.URL}, WebhookEvent{Event: "index.started"}); err == nil {
+		t.Error("unreachable receiver: no error")
+	}
+}
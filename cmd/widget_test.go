@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWidgetScript(t *testing.T) {
+	rec := serve(http.HandlerFunc(handleWidget), httptest.NewRequest(http.MethodGet, "/widget.js", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") {
+		t.Fatalf("widget = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "/api/v1/search?") {
+		t.Error("widget doesn't call the versioned search API")
+	}
+}
+
+func TestAllowCORS(t *testing.T) {
+	withConfig(t, Config{Widget: WidgetConfig{AllowedOrigins: []string{"https://wiki.example.com"}}})
+	h := allowCORS(okHandler)
+
+	request := func(method, target, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		return serve(h, r)
+	}
+
+	rec := request(http.MethodGet, "/api/search?q=pool", "https://wiki.example.com")
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://wiki.example.com" || rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("allowed origin got headers %v", rec.Header())
+	}
+	rec = request(http.MethodOptions, "/api/search?q=pool", "https://wiki.example.com")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") != "GET, HEAD" {
+		t.Errorf("preflight = %d %v", rec.Code, rec.Header())
+	}
+
+	for _, tt := range []struct{ method, target, origin string }{
+		{http.MethodGet, "/api/search?q=pool", "https://evil.example.com"},
+		{http.MethodPost, "/api/saved", "https://wiki.example.com"},
+		{http.MethodGet, "/search?q=pool", "https://wiki.example.com"},
+	} {
+		if got := request(tt.method, tt.target, tt.origin).Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s %s from %s allowed %q", tt.method, tt.target, tt.origin, got)
+		}
+	}
+}
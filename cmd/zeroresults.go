@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search"
+	bleveindex "github.com/blevesearch/bleve_index_api"
+	bolt "go.etcd.io/bbolt"
+)
+
+// zeroResultsBucket logs the queries that found nothing, keyed by the
+// normalized query. A query leaves the log once it finds something again.
+// The bucket's sequence counts the queries in it.
+const zeroResultsBucket = "zero_result_queries"
+
+// maxNearMisses is how many near misses are listed per word
+const maxNearMisses = 3
+
+// maxZeroResultQueries caps the queries in the log. New queries past it
+// aren't logged until others leave it, so made-up queries can't grow the
+// database without bound.
+var maxZeroResultQueries uint64 = 1000
+
+// nearMissFields are the dictionaries near misses are looked up in
+var nearMissFields = []string{"Title", "Content"}
+
+// ZeroResultQuery is a query in the zero-result log, with the terms of the
+// index that are spelled almost like its words. The near misses are looked
+// up when the log is listed, not stored.
+type ZeroResultQuery struct {
+	Query      string     `json:"query"`
+	Searches   int        `json:"searches"`
+	FirstSeen  time.Time  `json:"first_seen"`
+	LastSeen   time.Time  `json:"last_seen"`
+	NearMisses []NearMiss `json:"near_misses"`
+}
+
+// NearMiss lists the indexed terms within a typo or two of a word of the
+// query, the most frequent first
+type NearMiss struct {
+	Word  string   `json:"word"`
+	Terms []string `json:"terms"`
+}
+
+// recordZeroResults logs a search for query that found nothing
+func recordZeroResults(query string, now time.Time) error {
+	q := normalizeQuery(query)
+	if q == "" {
+		return nil
+	}
+	return store.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(zeroResultsBucket))
+		if err != nil {
+			return err
+		}
+		var entry ZeroResultQuery
+		if data := b.Get([]byte(q)); data != nil {
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+		} else {
+			if b.Sequence() >= maxZeroResultQueries {
+				return nil
+			}
+			if _, err := b.NextSequence(); err != nil {
+				return err
+			}
+			entry = ZeroResultQuery{Query: q, FirstSeen: now.UTC()}
+		}
+		entry.Searches++
+		entry.LastSeen = now.UTC()
+		entry.NearMisses = nil
+		return putJSON(b, q, entry)
+	})
+}
+
+// resolveZeroResults drops query from the log, since it found something.
+// Most queries that find something were never logged, so it only opens a
+// write transaction for those that were.
+func resolveZeroResults(query string) error {
+	key := []byte(normalizeQuery(query))
+	logged := false
+	err := store.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(zeroResultsBucket)); b != nil {
+			logged = b.Get(key) != nil
+		}
+		return nil
+	})
+	if err != nil || !logged {
+		return err
+	}
+	return store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(zeroResultsBucket))
+		if b == nil || b.Get(key) == nil {
+			return nil
+		}
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+		return forgetZeroResults(b, 1)
+	})
+}
+
+// forgetZeroResults lowers the count of logged queries by n
+func forgetZeroResults(b *bolt.Bucket, n int) error {
+	if seq := b.Sequence(); seq > uint64(n) {
+		return b.SetSequence(seq - uint64(n))
+	}
+	return b.SetSequence(0)
+}
+
+// zeroResultQueries lists the log, the most searched first, with the near
+// misses the index has for each query now
+func zeroResultQueries() ([]ZeroResultQuery, error) {
+	queries := []ZeroResultQuery{}
+	if store == nil {
+		return queries, nil
+	}
+	err := storeEach(zeroResultsBucket, func(_ string, data []byte) error {
+		var q ZeroResultQuery
+		if err := json.Unmarshal(data, &q); err != nil {
+			return err
+		}
+		if q.Searches >= config.Analytics.MinSearches {
+			queries = append(queries, q)
+		}
+		return nil
+	})
+	sort.Slice(queries, func(i, j int) bool {
+		if queries[i].Searches != queries[j].Searches {
+			return queries[i].Searches > queries[j].Searches
+		}
+		return queries[i].LastSeen.After(queries[j].LastSeen)
+	})
+	if err != nil {
+		return queries, err
+	}
+	for i := range queries {
+		if queries[i].NearMisses, err = nearMisses(index, queries[i].Query); err != nil {
+			return queries, err
+		}
+	}
+	return queries, nil
+}
+
+// pruneZeroResults drops the queries last searched before cutoff
+func pruneZeroResults(cutoff time.Time) (int, error) {
+	removed := 0
+	err := store.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(zeroResultsBucket))
+		if b == nil {
+			return nil
+		}
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var q ZeroResultQuery
+			if err := json.Unmarshal(v, &q); err != nil {
+				return err
+			}
+			if q.LastSeen.Before(cutoff) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return forgetZeroResults(b, removed)
+	})
+	return removed, err
+}
+
+// nearMisses looks up the terms of the title and content dictionaries
+// within one edit of each word of query, or two for words of six letters
+// or more. Words shorter than three letters are skipped, they match too
+// much.
+func nearMisses(idx bleve.Index, query string) ([]NearMiss, error) {
+	misses := []NearMiss{}
+	words := strings.FieldsFunc(query, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+	for _, word := range words {
+		if len([]rune(word)) < 3 || containsNearMiss(misses, word) {
+			continue
+		}
+		fuzziness := 1
+		if len([]rune(word)) >= 6 {
+			fuzziness = 2
+		}
+		counts := make(map[string]uint64)
+		for _, shard := range shardsOf(idx) {
+			if err := fuzzyTerms(shard, word, fuzziness, counts); err != nil {
+				return nil, err
+			}
+		}
+		delete(counts, word)
+		if len(counts) == 0 {
+			continue
+		}
+		terms := make([]string, 0, len(counts))
+		for t := range counts {
+			terms = append(terms, t)
+		}
+		sort.Slice(terms, func(i, j int) bool {
+			if counts[terms[i]] != counts[terms[j]] {
+				return counts[terms[i]] > counts[terms[j]]
+			}
+			return terms[i] < terms[j]
+		})
+		if len(terms) > maxNearMisses {
+			terms = terms[:maxNearMisses]
+		}
+		misses = append(misses, NearMiss{Word: word, Terms: terms})
+	}
+	return misses, nil
+}
+
+func containsNearMiss(misses []NearMiss, word string) bool {
+	for _, m := range misses {
+		if m.Word == word {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzyTerms adds the terms of the near-miss fields of shard within
+// fuzziness edits of word to counts, with the number of documents holding
+// them. Scorch finds them with an automaton, other index types by checking
+// every term.
+func fuzzyTerms(shard bleve.Index, word string, fuzziness int, counts map[string]uint64) error {
+	adv, err := shard.Advanced()
+	if err != nil {
+		return err
+	}
+	reader, err := adv.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for _, field := range nearMissFields {
+		var dict bleveindex.FieldDict
+		fuzzy, ok := reader.(bleveindex.IndexReaderFuzzy)
+		if ok {
+			dict, err = fuzzy.FieldDictFuzzy(field, word, fuzziness, "")
+		} else {
+			dict, err = reader.FieldDict(field)
+		}
+		if err != nil {
+			return err
+		}
+		entry, err := dict.Next()
+		for err == nil && entry != nil {
+			if ok {
+				counts[entry.Term] += entry.Count
+			} else if d, exceeded := search.LevenshteinDistanceMax(word, entry.Term, fuzziness); !exceeded && d <= fuzziness {
+				counts[entry.Term] += entry.Count
+			}
+			entry, err = dict.Next()
+		}
+		dict.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleAPIZeroResults(w http.ResponseWriter, r *http.Request) {
+	queries, err := zeroResultQueries()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, queries)
+}
+
+func handleZeroResults(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		renderError(w, r, http.StatusForbidden)
+		return
+	}
+	queries, err := zeroResultQueries()
+	if err != nil {
+		log.Printf("Error loading the zero-result log: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "zero_results.html", struct {
+		Page
+		Queries  []ZeroResultQuery
+		Enabled  bool
+		Synonyms bool
+	}{newPage(r, "zero_results.title"), queries, analyticsEnabled(), config.SynonymsFile != ""})
+}
+
+// handleAddSynonymForm makes a word of a zero-result query a synonym of a
+// near miss, joining the group either is in already, and goes back to the
+// zero-result log
+func handleAddSynonymForm(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r.Context()) {
+		renderError(w, r, http.StatusForbidden)
+		return
+	}
+	if err := r.ParseForm(); err != nil || config.SynonymsFile == "" {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	pair := parseSynonymGroup([]string{r.PostForm.Get("word"), r.PostForm.Get("term")})
+	if len(pair) != 2 || !synonymWord.MatchString(pair[0]) || !synonymWord.MatchString(pair[1]) {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	groups := addSynonymPair(synonymGroups(), pair[0], pair[1])
+	if len(groups) > maxSynonymGroups {
+		renderError(w, r, http.StatusBadRequest)
+		return
+	}
+	if err := saveSynonyms(groups); err != nil {
+		log.Printf("Error saving synonyms: %v", err)
+		renderError(w, r, http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/zero-results", http.StatusSeeOther)
+}
+
+// addSynonymPair returns groups with a and b in one group: the first group
+// holding either, or a new one. groups isn't changed.
+func addSynonymPair(groups [][]string, a, b string) [][]string {
+	updated := make([][]string, len(groups))
+	copy(updated, groups)
+	for i, group := range updated {
+		if contains(group, a) || contains(group, b) {
+			updated[i] = parseSynonymGroup(append(append([]string{}, group...), a, b))
+			return updated
+		}
+	}
+	return append(updated, []string{a, b})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNearMisses(t *testing.T) {
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{
+		"k8s/deploy.html":  "Deploying to Kubernetes",
+		"k8s/pods.html":    "Kubernetes pods",
+		"guides/pool.html": "connection pooling",
+	})
+
+	misses, err := nearMisses(index, "kuberntes podz x kuberntes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NearMiss{{Word: "kuberntes", Terms: []string{"kubernetes"}}, {Word: "podz", Terms: []string{"pods"}}}
+	if !reflect.DeepEqual(misses, want) {
+		t.Errorf("near misses = %+v, want %+v", misses, want)
+	}
+}
+
+func TestAddSynonymPair(t *testing.T) {
+	groups := [][]string{{"k8s", "kubernetes"}}
+	if got := addSynonymPair(groups, "kuberntes", "kubernetes"); !reflect.DeepEqual(got, [][]string{{"k8s", "kubernetes", "kuberntes"}}) {
+		t.Errorf("joined group = %q", got)
+	}
+	if got := addSynonymPair(groups, "pg", "postgres"); len(got) != 2 || !reflect.DeepEqual(got[1], []string{"pg", "postgres"}) {
+		t.Errorf("new group = %q", got)
+	}
+	if len(groups[0]) != 2 {
+		t.Errorf("the groups passed in changed: %q", groups)
+	}
+}
+
+func TestZeroResultLog(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{
+		Analytics:    AnalyticsConfig{Enabled: true},
+		SynonymsFile: filepath.Join(t.TempDir(), "synonyms.txt"),
+		Auth:         AuthConfig{Tokens: []AuthToken{{Name: "ops", Token: "ops-tok"}}, AdminGroups: []string{"admins"}},
+	})
+	withSynonyms(t, nil)
+	withRoot(t, "/docs")
+	withIndex(t, map[string]string{"k8s/deploy.html": "Deploying to Kubernetes"})
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	search := func() {
+		serve(http.HandlerFunc(handleSearch), httptest.NewRequest(http.MethodGet, "/search?q=Kuberntes", nil))
+	}
+
+	search()
+	search()
+	queries, err := zeroResultQueries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 || queries[0].Query != "kuberntes" || queries[0].Searches != 2 ||
+		!reflect.DeepEqual(queries[0].NearMisses, []NearMiss{{Word: "kuberntes", Terms: []string{"kubernetes"}}}) {
+		t.Fatalf("log = %+v, want kuberntes searched twice with kubernetes as near miss", queries)
+	}
+	page := serve(http.HandlerFunc(handleZeroResults), httptest.NewRequest(http.MethodGet, "/admin/zero-results", nil).WithContext(memberContext("admins")))
+	if !strings.Contains(page.Body.String(), `name="term" value="kubernetes"`) {
+		t.Errorf("the log page doesn't offer kubernetes as a synonym:\n%s", page.Body.String())
+	}
+
+	form := url.Values{"word": {"kuberntes"}, "term": {"kubernetes"}}
+	add := func(req *http.Request) int {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(http.HandlerFunc(handleAddSynonymForm), req).Code
+	}
+	if code := add(httptest.NewRequest(http.MethodPost, "/admin/synonyms", strings.NewReader(form.Encode())).WithContext(memberContext())); code != http.StatusForbidden {
+		t.Errorf("non-admin got status %d", code)
+	}
+	if code := add(httptest.NewRequest(http.MethodPost, "/admin/synonyms", strings.NewReader(form.Encode())).WithContext(memberContext("admins"))); code != http.StatusSeeOther {
+		t.Fatalf("status %d", code)
+	}
+	if got := synonymGroups(); !reflect.DeepEqual(got, [][]string{{"kuberntes", "kubernetes"}}) {
+		t.Errorf("synonyms = %q", got)
+	}
+
+	// with the synonym, the query finds the page and leaves the log
+	search()
+	if queries, _ := zeroResultQueries(); len(queries) != 0 {
+		t.Errorf("log = %+v, want it empty once the query finds something", queries)
+	}
+}
+
+func TestZeroResultLogCap(t *testing.T) {
+	withStore(t)
+	withConfig(t, Config{Analytics: AnalyticsConfig{Enabled: true}})
+	withEmptyIndex(t)
+	old := maxZeroResultQueries
+	maxZeroResultQueries = 2
+	t.Cleanup(func() { maxZeroResultQueries = old })
+
+	logged := func() []string {
+		queries, err := zeroResultQueries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, q := range queries {
+			got = append(got, q.Query)
+		}
+		sort.Strings(got)
+		return got
+	}
+	now := time.Now()
+	for _, q := range []string{"kuberntes", "shardng", "replicaton"} {
+		if err := recordZeroResults(q, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := logged(); !reflect.DeepEqual(got, []string{"kuberntes", "shardng"}) {
+		t.Errorf("log = %q, want the first two queries", got)
+	}
+
+	// a query that finds something makes room; one never logged is a no-op
+	for _, q := range []string{"kuberntes", "pooling"} {
+		if err := resolveZeroResults(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recordZeroResults("replicaton", now); err != nil {
+		t.Fatal(err)
+	}
+	if got := logged(); !reflect.DeepEqual(got, []string{"replicaton", "shardng"}) {
+		t.Errorf("log = %q, want replicaton logged once there was room", got)
+	}
+}
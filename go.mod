@@ -3,14 +3,19 @@ module go-doc-server
 go 1.22.5
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/blevesearch/bleve/v2 v2.4.1
+	github.com/blevesearch/bleve_index_api v1.1.9
+	github.com/microcosm-cc/bluemonday v1.0.27
+	go.etcd.io/bbolt v1.3.7
 	golang.org/x/net v0.27.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/RoaringBitmap/roaring v1.9.3 // indirect
+	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/bits-and-blooms/bitset v1.12.0 // indirect
-	github.com/blevesearch/bleve_index_api v1.1.9 // indirect
 	github.com/blevesearch/geo v0.1.20 // indirect
 	github.com/blevesearch/go-faiss v1.0.19 // indirect
 	github.com/blevesearch/go-porterstemmer v1.0.3 // indirect
@@ -30,8 +35,8 @@ require (
 	github.com/golang/geo v0.0.0-20210211234256-740aa86cb551 // indirect
 	github.com/golang/protobuf v1.3.2 // indirect
 	github.com/golang/snappy v0.0.1 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
 	github.com/json-iterator/go v0.0.0-20171115153421-f7279a603ede // indirect
 	github.com/mschoch/smat v0.2.0 // indirect
-	go.etcd.io/bbolt v1.3.7 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 )